@@ -0,0 +1,80 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrDisallowedURL is returned when a request is sent to a host that isn't
+// allowed by WithAllowedHosts, or over plain HTTP.
+var ErrDisallowedURL = errors.New("URL not allowed")
+
+// DefaultAllowedHosts are the hosts GitHub serves its API, releases and
+// release assets from.
+var DefaultAllowedHosts = []string{
+	"api.github.com",
+	"github.com",
+	"objects.githubusercontent.com",
+	"release-assets.githubusercontent.com",
+}
+
+// WithAllowedHosts refuses to send requests, including redirects, to hosts
+// other than hosts or over plain HTTP, so a tampered release can't point the
+// downloader at an arbitrary server. Hosts may start with "*." to allow all
+// subdomains. Without hosts, DefaultAllowedHosts are allowed. The host of
+// WithGitHubBaseURL is always allowed.
+func WithAllowedHosts(hosts ...string) Opt {
+	return func(u *upgrader) {
+		if len(hosts) == 0 {
+			hosts = DefaultAllowedHosts
+		}
+		u.allowedHosts = append(u.allowedHosts, hosts...)
+	}
+}
+
+// allowlistTransport refuses requests to hosts that aren't allowed.
+type allowlistTransport struct {
+	base  http.RoundTripper
+	hosts []string
+}
+
+func (t *allowlistTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.check(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+func (t *allowlistTransport) check(u *url.URL) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: %s doesn't use HTTPS", ErrDisallowedURL, u.Redacted())
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range t.hosts {
+		if matchHost(allowed, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s isn't an allowed host", ErrDisallowedURL, host)
+}
+
+// matchHost reports whether host matches pattern, which may start with "*."
+// to match all subdomains.
+func matchHost(pattern, host string) bool {
+	pattern, host = strings.ToLower(pattern), strings.ToLower(host)
+	if host == pattern {
+		return true
+	}
+	domain, ok := strings.CutPrefix(pattern, "*.")
+	return ok && strings.HasSuffix(host, "."+domain)
+}
@@ -0,0 +1,255 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tryUnArchive unarchives the downloaded update and returns the paths to the
+// unarchived temp files in dir, keyed on the names of the binaries selected
+// by sel. If dir is empty, the default directory for temporary files is used.
+// At most maxBytes are extracted, unless maxBytes is 0.
+func tryUnArchive(dir string, sel *entrySelector, maxBytes int64, arPath, arSuffix string) (map[string]string, error) {
+	if arSuffix == "" { // no extension - assume it's a binary
+		if len(sel.names) != 1 {
+			return nil, fmt.Errorf("a binary asset can only contain a single binary")
+		}
+		return map[string]string{sel.names[0]: arPath}, nil
+	}
+
+	if arSuffix == ".zip" {
+		return unZip(dir, sel, maxBytes, arPath)
+	}
+
+	f, err := os.Open(arPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	return unArchiveStream(dir, sel, maxBytes, f, arSuffix)
+}
+
+// streamable reports whether archives with arSuffix can be extracted while
+// they are downloaded. Zip archives need random access.
+func streamable(arSuffix string) bool {
+	switch arSuffix {
+	case ".tar.gz", ".tar", ".gz":
+		return true
+	default:
+		return false
+	}
+}
+
+// unArchiveStream unarchives an archive read sequentially from r, see tryUnArchive.
+func unArchiveStream(dir string, sel *entrySelector, maxBytes int64, r io.Reader, arSuffix string) (map[string]string, error) {
+	switch arSuffix {
+	case ".tar.gz":
+		return unTarGz(dir, sel, maxBytes, r)
+	case ".tar":
+		return unTar(dir, sel, maxBytes, r)
+	case ".gz":
+		if len(sel.names) != 1 {
+			return nil, fmt.Errorf("a .gz asset can only contain a single binary")
+		}
+		p, err := unGz(dir, sel.names[0], maxBytes, r)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{sel.names[0]: p}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedArchive, arSuffix)
+	}
+}
+
+// unsupportedArchive reports whether name has the extension of an archive
+// format that can't be extracted, which would otherwise be installed as is.
+func unsupportedArchive(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.xz", ".txz", ".tar.bz2", ".tbz2", ".tar.zst", ".xz", ".bz2", ".zst", ".7z", ".rar"} {
+		if strings.HasSuffix(lower, ext) {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+// extraction collects the binaries extracted from an archive.
+type extraction struct {
+	dir   string
+	sel   *entrySelector
+	limit *limitedExtraction
+	found map[string]string
+	exact map[string]bool
+}
+
+func newExtraction(dir string, sel *entrySelector, maxBytes int64) *extraction {
+	return &extraction{
+		dir:   dir,
+		sel:   sel,
+		limit: &limitedExtraction{max: maxBytes},
+		found: make(map[string]string, len(sel.names)),
+		exact: make(map[string]bool, len(sel.names)),
+	}
+}
+
+// add extracts entry if it holds one of the binaries, replacing an entry
+// extracted for the binary before, see entrySelector.pick. open is only
+// called if it does.
+func (x *extraction) add(entry string, open func() (io.ReadCloser, error)) error {
+	name, ok := x.sel.pick(entry, x.exact)
+	if !ok {
+		return nil
+	}
+	rc, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	p, err := writeExecutable(x.dir, name, x.limit.reader(rc))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if old, ok := x.found[name]; ok {
+		os.Remove(old)
+	}
+	x.found[name] = p
+	x.exact[name] = filepath.Base(entry) == name
+	return nil
+}
+
+// result returns the extracted binaries, or an error and removes them if
+// any binary is missing.
+func (x *extraction) result() (map[string]string, error) {
+	if err := missingNames(x.sel.names, x.found); err != nil {
+		removeAll(x.found)
+		return nil, err
+	}
+	return x.found, nil
+}
+
+// missingNames returns an error listing the names that weren't found in the archive.
+func missingNames(names []string, found map[string]string) error {
+	var missing []string
+	for _, name := range names {
+		if _, ok := found[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("file not found in archive: %s", strings.Join(missing, ", "))
+}
+
+// removeAll removes the temp files created for an extraction that failed.
+func removeAll(found map[string]string) {
+	for _, p := range found {
+		os.Remove(p)
+	}
+}
+
+// unTarGz unarchives a .tar.gz file.
+func unTarGz(dir string, sel *entrySelector, maxBytes int64, r io.Reader) (map[string]string, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gzip: %w", err)
+	}
+	defer gzr.Close()
+	return unTar(dir, sel, maxBytes, gzr)
+}
+
+// unTar unarchives a .tar file.
+func unTar(dir string, sel *entrySelector, maxBytes int64, r io.Reader) (map[string]string, error) {
+	tarr := tar.NewReader(r)
+	x := newExtraction(dir, sel, maxBytes)
+
+	for !sel.done(x.exact) {
+		hdr, err := tarr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			removeAll(x.found)
+			return nil, fmt.Errorf("failed to read next header: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := x.add(hdr.Name, func() (io.ReadCloser, error) { return io.NopCloser(tarr), nil }); err != nil {
+			removeAll(x.found)
+			return nil, err
+		}
+	}
+	return x.result()
+}
+
+// unZip unarchives the .zip file at arPath.
+func unZip(dir string, sel *entrySelector, maxBytes int64, arPath string) (map[string]string, error) {
+	zr, err := zip.OpenReader(arPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip: %w", err)
+	}
+	defer zr.Close()
+	x := newExtraction(dir, sel, maxBytes)
+	for _, f := range zr.File {
+		// skip directories, e.g. "savvy_1.0/", and symlinks
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		if err := x.add(f.Name, f.Open); err != nil {
+			removeAll(x.found)
+			return nil, err
+		}
+		if sel.done(x.exact) {
+			break
+		}
+	}
+	return x.result()
+}
+
+// unGz unarchives a .gz file.
+// It returns the path to the unarchived temp file.
+func unGz(dir, prefix string, maxBytes int64, r io.Reader) (string, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzr.Close()
+
+	limit := &limitedExtraction{max: maxBytes}
+	return writeExecutable(dir, prefix, limit.reader(gzr))
+}
+
+// writeExecutable copies r into a new executable temp file in dir and returns
+// its path. The file is removed if it can't be written completely.
+func writeExecutable(dir, prefix string, r io.Reader) (p string, err error) {
+	out, err := os.CreateTemp(dir, filepath.Base(prefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		// the file is closed before it is removed, which fails on Windows otherwise
+		if closeErr := out.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to write file: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(out.Name())
+			p = ""
+		}
+	}()
+
+	if _, err := io.Copy(out, r); err != nil {
+		return "", fmt.Errorf("failed to copy file: %w", err)
+	}
+	if err := out.Chmod(0o755); err != nil {
+		return "", fmt.Errorf("failed to change file permissions: %w", err)
+	}
+	return out.Name(), nil
+}
@@ -0,0 +1,238 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTarGz writes a .tar.gz archive containing files to a temp file and returns its path.
+func writeTarGz(t *testing.T, files map[string]string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "asset.tar.gz")
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	return p
+}
+
+// writeZip writes a .zip archive containing files to a temp file and returns
+// its path. Names ending in "/" are added as directories.
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "asset.zip")
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return p
+}
+
+func TestTryUnArchive(t *testing.T) {
+	arPath := writeTarGz(t, map[string]string{
+		"README.md":  "readme",
+		"bin/server": "server",
+		"bin/agent":  "agent",
+	})
+
+	t.Run("MultipleBinaries", func(t *testing.T) {
+		extracted, err := tryUnArchive(t.TempDir(), prefixEntries("server", "agent"), 0, arPath, ".tar.gz")
+		require.NoError(t, err)
+		defer removeAll(extracted)
+		for name, p := range extracted {
+			content, err := os.ReadFile(p)
+			require.NoError(t, err)
+			assert.Equal(t, name, string(content))
+		}
+		assert.Len(t, extracted, 2)
+	})
+	t.Run("MissingBinary", func(t *testing.T) {
+		extracted, err := tryUnArchive(t.TempDir(), prefixEntries("server", "ctl"), 0, arPath, ".tar.gz")
+		assert.ErrorContains(t, err, "ctl")
+		assert.Nil(t, extracted)
+	})
+}
+
+func TestArchiveEntrySelection(t *testing.T) {
+	arPath := writeTarGz(t, map[string]string{
+		"savvy_1.0.0/savvy-helper":   "helper",
+		"savvy_1.0.0/savvy":          "savvy",
+		"savvy_1.0.0/bin/savvy-ctl":  "ctl",
+		"savvy_1.0.0/docs/savvy.1":   "man",
+		"savvy_1.0.0/agent_linux_v1": "agent",
+	})
+	zipPath := writeZip(t, map[string]string{
+		"savvy_1.0.0/savvy-helper": "helper",
+		"savvy_1.0.0/savvy":        "savvy",
+	})
+
+	cases := []struct {
+		name string
+		sel  *entrySelector
+		want map[string]string
+	}{
+		{"PrefixPrefersExactName", prefixEntries("savvy"), map[string]string{"savvy": "savvy"}},
+		{"Exact", &entrySelector{names: []string{"savvy"}, match: MatchEntryExact()}, map[string]string{"savvy": "savvy"}},
+		{"GlobBaseName", &entrySelector{names: []string{"ctl"}, match: MatchEntryGlob("savvy-c*")}, map[string]string{"ctl": "ctl"}},
+		{"GlobPath", &entrySelector{names: []string{"ctl"}, match: MatchEntryGlob("*/bin/*")}, map[string]string{"ctl": "ctl"}},
+		{"Regexp", &entrySelector{names: []string{"agent"}, match: MatchEntryRegexp(regexp.MustCompile(`/agent_linux_v\d+$`))}, map[string]string{"agent": "agent"}},
+		{"PerBinary", &entrySelector{
+			names:    []string{"savvy", "helper"},
+			match:    MatchEntryExact(),
+			matchers: map[string]EntryMatcher{"helper": MatchEntryGlob("*-helper")},
+		}, map[string]string{"savvy": "savvy", "helper": "helper"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			extracted, err := tryUnArchive(t.TempDir(), tc.sel, 0, arPath, ".tar.gz")
+			require.NoError(t, err)
+			defer removeAll(extracted)
+			got := make(map[string]string, len(extracted))
+			for name, p := range extracted {
+				got[name] = readFile(t, p)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("OwnMatcherFirst", func(t *testing.T) {
+		sel := &entrySelector{names: []string{"savvy", "completion"}, match: MatchEntryPrefix(), matchers: map[string]EntryMatcher{"completion": MatchEntryGlob("*.bash")}}
+		name, ok := sel.pick("savvy_1.0.0/savvy.bash", map[string]bool{})
+		assert.True(t, ok)
+		assert.Equal(t, "completion", name)
+		name, ok = sel.pick("savvy_1.0.0/savvy.bash", map[string]bool{"completion": false})
+		assert.True(t, ok)
+		assert.Equal(t, "savvy", name)
+	})
+	t.Run("Zip", func(t *testing.T) {
+		extracted, err := tryUnArchive(t.TempDir(), prefixEntries("savvy"), 0, zipPath, ".zip")
+		require.NoError(t, err)
+		defer removeAll(extracted)
+		assert.Equal(t, "savvy", readFile(t, extracted["savvy"]))
+	})
+	t.Run("NoMatch", func(t *testing.T) {
+		_, err := tryUnArchive(t.TempDir(), &entrySelector{names: []string{"savvy"}, match: MatchEntryGlob("[")}, 0, arPath, ".tar.gz")
+		assert.ErrorContains(t, err, "file not found in archive: savvy")
+	})
+}
+
+func TestUnZip(t *testing.T) {
+	arPath := writeZip(t, map[string]string{
+		"savvy_1.0.0_windows_amd64/":          "",
+		"savvy_1.0.0_windows_amd64/README.md": "readme",
+		"savvy_1.0.0_windows_amd64/savvy.exe": "new",
+	})
+	extracted, err := tryUnArchive(t.TempDir(), prefixEntries("savvy.exe"), 0, arPath, ".zip")
+	require.NoError(t, err)
+	defer removeAll(extracted)
+	assert.Equal(t, "new", readFile(t, extracted["savvy.exe"]))
+
+	_, err = tryUnArchive(t.TempDir(), prefixEntries("savvy"), 0, writeZip(t, map[string]string{"savvy/": ""}), ".zip")
+	assert.ErrorContains(t, err, "file not found in archive")
+}
+
+func TestUpgradeWindowsZip(t *testing.T) {
+	const assetName = "savvy_1.0.0_windows_amd64.zip"
+	archive, err := os.ReadFile(writeZip(t, map[string]string{"savvy_1.0.0_windows_amd64/savvy.exe": "new"}))
+	require.NoError(t, err)
+	sum := sha256.Sum256(archive)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + assetName:
+			w.Write(archive)
+		case "/checksums.txt":
+			fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(sum[:]), assetName)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	executablePath := filepath.Join(t.TempDir(), "savvy.exe")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+	u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath, WithAllowManagedInstall(),
+		WithAssetDownloader(asset.NewAssetDownloader(executablePath, asset.WithOS("windows"), asset.WithArch("amd64")))).(*upgrader)
+	u.releaseGetter = &fakeReleaseGetter{info: &release.Info{
+		TagName: "v1.0.0",
+		Assets: []release.Asset{
+			{Name: assetName, BrowserDownloadURL: srv.URL + "/" + assetName, Size: int64(len(archive))},
+			{Name: "checksums.txt", BrowserDownloadURL: srv.URL + "/checksums.txt"},
+		},
+	}}
+
+	result, err := u.UpgradeWithResult(context.Background(), "0.9.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.True(t, result.ChecksumVerified)
+	assert.Equal(t, "new", readFile(t, executablePath))
+}
+
+func TestUpgradeTgz(t *testing.T) {
+	assetName := fmt.Sprintf("savvy_%s_%s.tgz", runtime.GOOS, runtime.GOARCH)
+	archive, err := os.ReadFile(writeTarGz(t, map[string]string{"savvy": "new"}))
+	require.NoError(t, err)
+	sum := sha256.Sum256(archive)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + assetName:
+			w.Write(archive)
+		case "/checksums.txt":
+			fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(sum[:]), assetName)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+	u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath, WithAllowManagedInstall()).(*upgrader)
+	u.releaseGetter = &fakeReleaseGetter{info: &release.Info{
+		TagName: "v1.0.0",
+		Assets: []release.Asset{
+			{Name: assetName, BrowserDownloadURL: srv.URL + "/" + assetName, Size: int64(len(archive))},
+			{Name: "checksums.txt", BrowserDownloadURL: srv.URL + "/checksums.txt"},
+		},
+	}}
+
+	// .tgz is an alias of .tar.gz, not an archive installed as is
+	result, err := u.UpgradeWithResult(context.Background(), "0.9.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.True(t, result.ChecksumVerified)
+	assert.Equal(t, "new", readFile(t, executablePath))
+}
@@ -0,0 +1,175 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+)
+
+// archiveChecksumNames are the lowercased names of the checksum files looked
+// up inside release archives.
+var archiveChecksumNames = []string{"sha256sums", "sha256sums.txt", "checksums.txt"}
+
+// WithArchiveChecksums verifies the extracted binaries against a SHA256SUMS
+// or checksums.txt file shipped inside the release archive, for releases that
+// publish neither a checksum asset nor asset digests. Published checksums are
+// always preferred.
+//
+// This is weaker than verifying published checksums: it detects corrupted
+// downloads, but not a tampered archive, whose checksums can be tampered with
+// too. The upgrade is therefore reported with an ErrChecksumNotVerified
+// warning, and ChecksumVerified is false. Archives are downloaded to disk
+// rather than extracted while downloading, since they are read twice.
+func WithArchiveChecksums() Opt {
+	return func(u *upgrader) {
+		u.archiveChecksums = true
+	}
+}
+
+// missingChecksumsAllowed reports whether the upgrade may continue although
+// loading the published checksums failed with err. Installers aren't
+// archives, so they never have archive checksums.
+func (u *upgrader) missingChecksumsAllowed(err error) bool {
+	return errors.Is(err, checksum.ErrNoCheckSumAsset) && (u.checksumPolicy == ChecksumWarn || u.archiveChecksums && u.installer == nil)
+}
+
+// checkArchiveChecksums verifies the binaries extracted from an asset whose
+// release publishes no checksums, see WithArchiveChecksums. It returns the
+// warning to report, or an error if the policy requires checksums and the
+// archive has none.
+func (u *upgrader) checkArchiveChecksums(name, arPath, arSuffix string, extracted map[string]string, warning error) (error, error) {
+	sums, err := verifyArchiveChecksums(arPath, arSuffix, u.entrySelector(), u.binaryNames(), extracted)
+	if err != nil {
+		return nil, err
+	}
+	if sums == "" {
+		if u.checksumPolicy != ChecksumWarn {
+			return nil, fmt.Errorf("%w: %s contains no checksum file either", checksum.ErrNoCheckSumAsset, name)
+		}
+		return warning, nil
+	}
+	return fmt.Errorf("%w: only verified against %s inside %s", ErrChecksumNotVerified, sums, name), nil
+}
+
+// verifyArchiveChecksums verifies the extracted binaries against the checksum
+// file inside the archive at arPath, keyed on the base names of its entries.
+// Other files picked by sel, e.g. archive files, needn't be listed. It
+// returns the name of the checksum file, or "" if the archive has none.
+func verifyArchiveChecksums(arPath, arSuffix string, sel *entrySelector, binaries []string, extracted map[string]string) (string, error) {
+	var sumsName string
+	var sums *checksum.Info
+	// entries maps each binary to the base name of its archive entry, picked
+	// as when it was extracted
+	entries := make(map[string]string, len(sel.names))
+	exact := make(map[string]bool, len(sel.names))
+	err := walkArchive(arPath, arSuffix, func(entry string, r io.Reader) error {
+		base := path.Base(entry)
+		if sums == nil && slices.Contains(archiveChecksumNames, strings.ToLower(base)) {
+			var err error
+			if sums, err = checksum.Parse(io.LimitReader(r, maxChecksumsSize)); err != nil {
+				return fmt.Errorf("failed to parse %s: %w", entry, err)
+			}
+			sumsName = base
+			return nil
+		}
+		if name, ok := sel.pick(entry, exact); ok {
+			entries[name] = base
+			exact[name] = filepath.Base(entry) == name
+		}
+		return nil
+	})
+	if err != nil || sums == nil {
+		return "", err
+	}
+
+	listed := make(map[string]string, len(sums.Files))
+	for file, sum := range sums.Files {
+		listed[path.Base(file)] = sum
+	}
+	for _, name := range binaries {
+		entry := entries[name]
+		expected, ok := listed[strings.ToLower(entry)]
+		if !ok {
+			return "", fmt.Errorf("%s inside the archive: %w", sumsName, &ChecksumMismatchError{Asset: entry})
+		}
+		actual, err := fileSHA256(extracted[name])
+		if err != nil {
+			return "", fmt.Errorf("failed to hash %s: %w", entry, err)
+		}
+		if actual != expected {
+			return "", fmt.Errorf("%s inside the archive: %w", sumsName, &ChecksumMismatchError{Asset: entry, Expected: expected, Actual: actual})
+		}
+	}
+	return sumsName, nil
+}
+
+// walkArchive calls fn with the name and content of each regular file in the
+// archive at arPath. Assets that aren't tar or zip archives have no entries.
+func walkArchive(arPath, arSuffix string, fn func(name string, r io.Reader) error) error {
+	switch arSuffix {
+	case ".zip":
+		zr, err := zip.OpenReader(arPath)
+		if err != nil {
+			return fmt.Errorf("failed to open zip: %w", err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("failed to open file: %w", err)
+			}
+			err = fn(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case ".tar.gz", ".tar":
+		f, err := os.Open(arPath)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		defer f.Close()
+		var r io.Reader = f
+		if arSuffix == ".tar.gz" {
+			gzr, err := gzip.NewReader(f)
+			if err != nil {
+				return fmt.Errorf("failed to read gzip: %w", err)
+			}
+			defer gzr.Close()
+			r = gzr
+		}
+		tarr := tar.NewReader(r)
+		for {
+			hdr, err := tarr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read next header: %w", err)
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := fn(hdr.Name, tarr); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+}
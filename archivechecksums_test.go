@@ -0,0 +1,63 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveChecksums(t *testing.T) {
+	ctx := context.Background()
+	sum := sha256.Sum256([]byte("new"))
+	sums := hex.EncodeToString(sum[:]) + "  ./savvy\n"
+
+	// newUpgrader returns an upgrader for a release that only ships files in its archive
+	newUpgrader := func(t *testing.T, files map[string]string, opts ...Opt) (*upgrader, string) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", files, opts...)
+		info := u.releaseGetter.(*fakeReleaseGetter).info
+		info.Assets = info.Assets[:1]
+		return u, executablePath
+	}
+
+	t.Run("Verified", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, map[string]string{"savvy_0.2.0/savvy": "new", "savvy_0.2.0/SHA256SUMS": sums}, WithArchiveChecksums())
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.False(t, result.ChecksumVerified)
+		require.Len(t, result.Warnings, 1)
+		assert.ErrorIs(t, result.Warnings[0], ErrChecksumNotVerified)
+		assert.ErrorContains(t, result.Warnings[0], "SHA256SUMS")
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("ArchiveFileUnlisted", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, map[string]string{"savvy": "new", "LICENSE": "license", "SHA256SUMS": sums},
+			WithArchiveChecksums(), WithArchiveFiles(ArchiveFile{Path: "LICENSE"}))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, map[string]string{"savvy": "tampered", "SHA256SUMS": sums}, WithArchiveChecksums())
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		var mismatch *ChecksumMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, "savvy", mismatch.Asset)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("NoArchiveChecksums", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, map[string]string{"savvy": "new"}, WithArchiveChecksums())
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrNoCheckSumAsset)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, map[string]string{"savvy": "new", "SHA256SUMS": sums})
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrNoCheckSumAsset)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+}
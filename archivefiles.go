@@ -0,0 +1,79 @@
+package upgrade
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// DefaultArchiveFileMode is the mode of archive files without a Mode.
+const DefaultArchiveFileMode os.FileMode = 0o644
+
+// ArchiveFile is a file installed from the release archive along with the
+// binaries, see WithArchiveFiles.
+type ArchiveFile struct {
+	// Entry selects the archive entry, e.g. MatchEntryGlob("*/LICENSE"). If
+	// nil, the entry whose base name is the base name of Path is selected.
+	Entry EntryMatcher
+	// Path is where the file is installed. Relative paths are relative to
+	// the directory of the executable, e.g. "../share/savvy/LICENSE".
+	Path string
+	// Mode is the mode of the installed file, DefaultArchiveFileMode if zero.
+	Mode os.FileMode
+}
+
+// WithArchiveFiles installs files from the release archive along with the
+// binaries, e.g. a man page, shell completions or a license, for tools that
+// ship as a small bundle. The files are verified like the binaries and
+// replaced all-or-nothing with them, creating their directories if needed.
+// The upgrade fails if the archive lacks one of them.
+func WithArchiveFiles(files ...ArchiveFile) Opt {
+	return func(u *upgrader) {
+		u.archiveFiles = append(u.archiveFiles, files...)
+	}
+}
+
+// entryMatcher returns the matcher selecting the archive entry of f.
+func (f ArchiveFile) entryMatcher() EntryMatcher {
+	if f.Entry != nil {
+		return f.Entry
+	}
+	base := filepath.Base(f.Path)
+	return func(_, entry string) bool {
+		return path.Base(entry) == base
+	}
+}
+
+// archiveFile returns the archive file extracted as key, see entrySelector.
+func (u *upgrader) archiveFile(key string) (ArchiveFile, bool) {
+	for _, f := range u.archiveFiles {
+		if f.Path == key {
+			return f, true
+		}
+	}
+	return ArchiveFile{}, false
+}
+
+// stageFile moves the archive file extracted to p into the staging directory
+// dir and returns its staged path and destination. The i-th file is staged
+// as "<i>-<name>", since files installed to different directories may share
+// their name.
+func stageFile(dir, installDir string, i int, f ArchiveFile, p string) (string, string, error) {
+	staged := filepath.Join(dir, fmt.Sprintf("%d-%s", i, filepath.Base(f.Path)))
+	if err := moveFile(p, staged); err != nil {
+		return "", "", fmt.Errorf("failed to stage %s: %w", f.Path, err)
+	}
+	mode := f.Mode
+	if mode == 0 {
+		mode = DefaultArchiveFileMode
+	}
+	if err := os.Chmod(staged, mode); err != nil {
+		return "", "", fmt.Errorf("failed to change permissions of %s: %w", f.Path, err)
+	}
+	dst := f.Path
+	if !filepath.IsAbs(dst) {
+		dst = filepath.Join(installDir, dst)
+	}
+	return staged, dst, nil
+}
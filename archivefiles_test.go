@@ -0,0 +1,105 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveFiles(t *testing.T) {
+	const assetName = "savvy_1.0.0_linux_amd64.tar.gz"
+	archive, err := os.ReadFile(writeTarGz(t, map[string]string{
+		"savvy_1.0.0/savvy":                  "new",
+		"savvy_1.0.0/LICENSE":                "license",
+		"savvy_1.0.0/completions/savvy.bash": "complete -F _savvy savvy",
+	}))
+	require.NoError(t, err)
+	sum := sha256.Sum256(archive)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + assetName:
+			w.Write(archive)
+		case "/checksums.txt":
+			fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(sum[:]), assetName)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	newUpgrader := func(t *testing.T, files ...ArchiveFile) (*upgrader, string) {
+		root := t.TempDir()
+		executablePath := filepath.Join(root, "bin", "savvy")
+		require.NoError(t, os.MkdirAll(filepath.Dir(executablePath), 0o755))
+		require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+		u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath, WithAllowManagedInstall(), WithArchiveFiles(files...),
+			WithAssetDownloader(asset.NewAssetDownloader(executablePath, asset.WithOS("linux"), asset.WithArch("amd64")))).(*upgrader)
+		u.releaseGetter = &fakeReleaseGetter{info: &release.Info{
+			TagName: "v1.0.0",
+			Assets: []release.Asset{
+				{Name: assetName, BrowserDownloadURL: srv.URL + "/" + assetName, Size: int64(len(archive))},
+				{Name: "checksums.txt", BrowserDownloadURL: srv.URL + "/checksums.txt"},
+			},
+		}}
+		return u, root
+	}
+
+	t.Run("Installed", func(t *testing.T) {
+		completion := filepath.Join(t.TempDir(), "completions", "savvy")
+		u, root := newUpgrader(t,
+			ArchiveFile{Entry: MatchEntryGlob("LICENSE"), Path: filepath.Join("..", "share", "savvy", "LICENSE")},
+			ArchiveFile{Entry: MatchEntryGlob("*/completions/*.bash"), Path: completion, Mode: 0o600},
+		)
+		result, err := u.UpgradeWithResult(context.Background(), "0.9.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.Equal(t, "new", readFile(t, u.executablePath))
+
+		license := filepath.Join(root, "share", "savvy", "LICENSE")
+		assert.Equal(t, "license", readFile(t, license))
+		assert.Equal(t, "complete -F _savvy savvy", readFile(t, completion))
+		if runtime.GOOS != "windows" {
+			fi, err := os.Stat(license)
+			require.NoError(t, err)
+			assert.Equal(t, DefaultArchiveFileMode, fi.Mode().Perm())
+			fi, err = os.Stat(completion)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+		}
+	})
+	t.Run("DefaultEntry", func(t *testing.T) {
+		u, root := newUpgrader(t, ArchiveFile{Path: filepath.Join("..", "share", "savvy", "LICENSE")})
+		license := filepath.Join(root, "share", "savvy", "LICENSE")
+		require.NoError(t, os.MkdirAll(filepath.Dir(license), 0o755))
+		require.NoError(t, os.WriteFile(license, []byte("old license"), 0o755))
+		_, err := u.UpgradeWithResult(context.Background(), "0.9.0")
+		require.NoError(t, err)
+		assert.Equal(t, "license", readFile(t, license))
+		if runtime.GOOS != "windows" {
+			// the Mode applies, not the one of the replaced file
+			fi, err := os.Stat(license)
+			require.NoError(t, err)
+			assert.Equal(t, DefaultArchiveFileMode, fi.Mode().Perm())
+		}
+		assert.NotPanics(t, func() { WithArchiveEntry("savvy", nil)(u) })
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		u, root := newUpgrader(t, ArchiveFile{Entry: MatchEntryGlob("savvy.1"), Path: "savvy.1"})
+		_, err := u.UpgradeWithResult(context.Background(), "0.9.0")
+		assert.ErrorContains(t, err, "file not found in archive: savvy.1")
+		assert.Equal(t, "old", readFile(t, u.executablePath))
+		assert.NoFileExists(t, filepath.Join(root, "bin", "savvy.1"))
+	})
+}
@@ -0,0 +1,241 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// DefaultFailureBackoff is how long RunAutoUpgrader waits after the first
+// failed attempt by default. The wait doubles with every further failure.
+const DefaultFailureBackoff = time.Minute
+
+// AutoUpgradeEventType identifies an AutoUpgradeEvent.
+type AutoUpgradeEventType string
+
+const (
+	// AutoUpgradeChecking is emitted before each attempt.
+	AutoUpgradeChecking AutoUpgradeEventType = "checking"
+	// AutoUpgradeUpToDate is emitted when no update was available.
+	AutoUpgradeUpToDate AutoUpgradeEventType = "up-to-date"
+	// AutoUpgradeUpgraded is emitted after the binary was replaced.
+	AutoUpgradeUpgraded AutoUpgradeEventType = "upgraded"
+	// AutoUpgradeStaged is emitted after an update was staged to be
+	// installed at the next start, see WithApplyOnNextStart.
+	AutoUpgradeStaged AutoUpgradeEventType = "staged"
+	// AutoUpgradeFailed is emitted when an attempt or saving the state failed.
+	AutoUpgradeFailed AutoUpgradeEventType = "failed"
+)
+
+// AutoUpgradeEvent reports the progress of RunAutoUpgrader.
+type AutoUpgradeEvent struct {
+	Type AutoUpgradeEventType
+	Time time.Time
+	// Version is the running version.
+	Version string
+	// Result is set after an attempt, Err if it failed.
+	Result *UpgradeResult
+	Err    error
+	// NextAttempt is set after an attempt.
+	NextAttempt time.Time
+}
+
+type autoUpgrader struct {
+	upgrader   Upgrader
+	version    string
+	interval   time.Duration
+	minBackoff time.Duration
+	store      state.Store
+	restart    func(ctx context.Context, result *UpgradeResult) error
+	events     func(AutoUpgradeEvent)
+}
+
+// AutoUpgradeOpt configures RunAutoUpgrader.
+type AutoUpgradeOpt func(*autoUpgrader)
+
+// AutoUpgradeState persists when to check next and the failures so far in
+// store, so restarting the process doesn't reset the interval or backoff.
+func AutoUpgradeState(store state.Store) AutoUpgradeOpt {
+	return func(a *autoUpgrader) {
+		a.store = store
+	}
+}
+
+// AutoUpgradeRestart calls restart after the binary was replaced, e.g. to
+// exit and let a service manager start the new version, or to call Reexec.
+// It is also called after an update was staged, so the next start installs
+// it. If restart returns, the loop continues with the new version.
+func AutoUpgradeRestart(restart func(ctx context.Context, result *UpgradeResult) error) AutoUpgradeOpt {
+	return func(a *autoUpgrader) {
+		a.restart = restart
+	}
+}
+
+// AutoUpgradeEvents calls fn with every event, e.g. to log or export metrics.
+// fn is called synchronously and should return quickly.
+func AutoUpgradeEvents(fn func(AutoUpgradeEvent)) AutoUpgradeOpt {
+	return func(a *autoUpgrader) {
+		a.events = fn
+	}
+}
+
+// AutoUpgradeBackoff waits min after the first failed attempt instead of
+// DefaultFailureBackoff. The wait doubles with every further failure, up to
+// the interval.
+func AutoUpgradeBackoff(min time.Duration) AutoUpgradeOpt {
+	return func(a *autoUpgrader) {
+		a.minBackoff = min
+	}
+}
+
+// RunAutoUpgrader upgrades the running binary every interval until ctx is
+// done, for long-running agents. Each attempt runs AutoUpgrade, so it
+// waits for the maintenance window set with WithSchedule, and is verified
+// like any other upgrade. Upgraders that aren't an AutoUpgrader run
+// UpgradeWithResult instead, so u must implement one of AutoUpgrader and
+// ResultUpgrader. Failed attempts are retried with exponential
+// backoff. It returns ctx.Err(), or an error if the restart hook fails.
+//
+// With WithReexec, the process is replaced before the state of the attempt
+// is saved. Prefer AutoUpgradeRestart together with AutoUpgradeState.
+func RunAutoUpgrader(ctx context.Context, u Upgrader, currentVersion string, interval time.Duration, opts ...AutoUpgradeOpt) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid auto-upgrade interval: %s", interval)
+	}
+	switch u.(type) {
+	case AutoUpgrader, ResultUpgrader:
+	default:
+		return fmt.Errorf("%T implements neither AutoUpgrader nor ResultUpgrader", u)
+	}
+	a := &autoUpgrader{upgrader: u, version: currentVersion, interval: interval, minBackoff: DefaultFailureBackoff}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	st, err := a.load(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		if err := sleepUntil(ctx, st.NextAttempt); err != nil {
+			return err
+		}
+		a.emit(AutoUpgradeEvent{Type: AutoUpgradeChecking})
+
+		result, err := a.attempt(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		now := time.Now()
+		st.LastCheck = now
+		event := AutoUpgradeEvent{Result: result, Err: err}
+		switch {
+		case err != nil:
+			st.Failures++
+			st.LastError = err.Error()
+			st.NextAttempt = now.Add(a.backoff(st.Failures))
+			event.Type = AutoUpgradeFailed
+		case result.Upgraded:
+			st.Failures, st.LastError = 0, ""
+			st.LastUpgrade = now
+			st.NextAttempt = now.Add(a.interval)
+			event.Type = AutoUpgradeUpgraded
+			if result.NewVersion != "" {
+				a.version = result.NewVersion
+			}
+		case result.Pending:
+			st.Failures, st.LastError = 0, ""
+			st.NextAttempt = now.Add(a.interval)
+			event.Type = AutoUpgradeStaged
+		default:
+			st.Failures, st.LastError = 0, ""
+			st.NextAttempt = now.Add(a.interval)
+			event.Type = AutoUpgradeUpToDate
+		}
+		event.NextAttempt = st.NextAttempt
+		a.emit(event)
+
+		if err := a.save(ctx, st); err != nil {
+			a.emit(AutoUpgradeEvent{Type: AutoUpgradeFailed, Err: err, NextAttempt: st.NextAttempt})
+		}
+		if (event.Type == AutoUpgradeUpgraded || event.Type == AutoUpgradeStaged) && a.restart != nil {
+			if err := a.restart(ctx, result); err != nil {
+				if result.Pending {
+					return fmt.Errorf("staged %s but failed to restart: %w", result.TargetVersion, err)
+				}
+				return fmt.Errorf("upgraded to %s but failed to restart: %w", result.NewVersion, err)
+			}
+		}
+	}
+}
+
+// backoff returns how long to wait after failures failed attempts in a row.
+func (a *autoUpgrader) backoff(failures int) time.Duration {
+	d := a.minBackoff
+	for i := 1; i < failures && d < a.interval; i++ {
+		d *= 2
+	}
+	return min(d, a.interval)
+}
+
+func (a *autoUpgrader) emit(e AutoUpgradeEvent) {
+	if a.events == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.Version = a.version
+	a.events(e)
+}
+
+func (a *autoUpgrader) load(ctx context.Context) (*state.AutoUpgrade, error) {
+	if a.store == nil {
+		return &state.AutoUpgrade{}, nil
+	}
+	s, err := a.store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.AutoUpgrade == nil {
+		return &state.AutoUpgrade{}, nil
+	}
+	return s.AutoUpgrade, nil
+}
+
+func (a *autoUpgrader) save(ctx context.Context, st *state.AutoUpgrade) error {
+	if a.store == nil {
+		return nil
+	}
+	// reload, since other processes may have changed the rest of the state
+	s, err := a.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	s.AutoUpgrade = st
+	return a.store.Save(ctx, s)
+}
+
+// sleepUntil blocks until t or until ctx is done.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// attempt upgrades the running binary once.
+func (a *autoUpgrader) attempt(ctx context.Context) (*UpgradeResult, error) {
+	if u, ok := a.upgrader.(AutoUpgrader); ok {
+		return u.AutoUpgrade(ctx, a.version)
+	}
+	return a.upgrader.(ResultUpgrader).UpgradeWithResult(ctx, a.version)
+}
@@ -0,0 +1,114 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingUpgrader is an Upgrader whose AutoUpgrade always fails.
+type failingUpgrader struct {
+	Upgrader
+	calls int
+}
+
+func (f *failingUpgrader) AutoUpgrade(ctx context.Context, currentVersion string) (*UpgradeResult, error) {
+	f.calls++
+	return &UpgradeResult{PreviousVersion: currentVersion, NewVersion: currentVersion}, errors.New("offline")
+}
+
+func TestRunAutoUpgrader(t *testing.T) {
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+	store := state.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var events []AutoUpgradeEventType
+	var restarted *UpgradeResult
+	err := RunAutoUpgrader(ctx, u, "0.1.0", time.Hour,
+		AutoUpgradeState(store),
+		AutoUpgradeEvents(func(e AutoUpgradeEvent) { events = append(events, e.Type) }),
+		AutoUpgradeRestart(func(ctx context.Context, result *UpgradeResult) error {
+			restarted = result
+			cancel()
+			return nil
+		}),
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []AutoUpgradeEventType{AutoUpgradeChecking, AutoUpgradeUpgraded}, events)
+	require.NotNil(t, restarted)
+	assert.Equal(t, "v0.2.0", restarted.NewVersion)
+	assert.Equal(t, "new", readFile(t, executablePath))
+
+	s, err := store.Load(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, s.AutoUpgrade)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), s.AutoUpgrade.NextAttempt, time.Minute)
+}
+
+func TestRunAutoUpgraderStaged(t *testing.T) {
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithApplyOnNextStart())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var events []AutoUpgradeEventType
+	var restarted *UpgradeResult
+	err := RunAutoUpgrader(ctx, u, "0.1.0", time.Hour,
+		AutoUpgradeEvents(func(e AutoUpgradeEvent) { events = append(events, e.Type) }),
+		AutoUpgradeRestart(func(ctx context.Context, result *UpgradeResult) error {
+			restarted = result
+			cancel()
+			return nil
+		}),
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []AutoUpgradeEventType{AutoUpgradeChecking, AutoUpgradeStaged}, events)
+	require.NotNil(t, restarted)
+	assert.True(t, restarted.Pending)
+	assert.Equal(t, "old", readFile(t, executablePath))
+	assert.True(t, HasPendingUpdate(executablePath))
+}
+
+func TestRunAutoUpgraderBackoff(t *testing.T) {
+	store := state.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	f := &failingUpgrader{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	failed := 0
+	err := RunAutoUpgrader(ctx, f, "0.1.0", time.Hour,
+		AutoUpgradeState(store),
+		AutoUpgradeBackoff(10*time.Millisecond),
+		AutoUpgradeEvents(func(e AutoUpgradeEvent) {
+			if e.Type == AutoUpgradeFailed {
+				failed++
+			}
+		}),
+	)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.GreaterOrEqual(t, failed, 2)
+	assert.GreaterOrEqual(t, f.calls, failed)
+
+	// the failures survive a restart
+	s, err := store.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, failed, s.AutoUpgrade.Failures)
+	assert.Equal(t, "offline", s.AutoUpgrade.LastError)
+
+	a := &autoUpgrader{interval: time.Hour, minBackoff: time.Minute}
+	assert.Equal(t, time.Minute, a.backoff(1))
+	assert.Equal(t, 4*time.Minute, a.backoff(3))
+	assert.Equal(t, time.Hour, a.backoff(100))
+}
+
+func TestRunAutoUpgraderWithoutResults(t *testing.T) {
+	// an Upgrader with only the two original methods can't report results
+	err := RunAutoUpgrader(context.Background(), struct{ Upgrader }{}, "0.1.0", time.Hour)
+	assert.ErrorContains(t, err, "neither AutoUpgrader nor ResultUpgrader")
+}
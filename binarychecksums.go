@@ -0,0 +1,109 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// maxChecksumsSize bounds how much of a checksums file is read.
+const maxChecksumsSize = 1 << 20
+
+// WithBinaryChecksums verifies the extracted binaries against the release
+// asset name, a checksums file listing the binaries rather than the archives,
+// e.g. "binaries_sha256sums.txt", for projects that publish both. A binary
+// is verified if a file listed with its checksum matches the binary's
+// archive entry matcher, e.g. "savvy" or "savvy_1.0.0_linux_amd64/savvy".
+//
+// The upgrade fails with an ErrChecksumMismatch if a binary isn't listed or
+// doesn't match, and with ErrNoCheckSumAsset if the release lacks the file,
+// unless the policy is ChecksumWarn. UpgradeResult.BinaryChecksumsVerified
+// reports whether the binaries were verified. Assets installed with
+// UpgradeFromFile aren't verified against it.
+func WithBinaryChecksums(name string) Opt {
+	return func(u *upgrader) {
+		u.binaryChecksums = name
+	}
+}
+
+// verifyBinaryChecksums verifies the extracted binaries against the binary
+// checksums of r, see WithBinaryChecksums. It returns whether they were
+// verified, and a warning if the release publishes none with ChecksumWarn.
+func (u *upgrader) verifyBinaryChecksums(ctx context.Context, r *release.Info, extracted map[string]string) (bool, error, error) {
+	if u.binaryChecksums == "" || len(r.Assets) == 0 {
+		// local assets, see UpgradeFromFile, have no release to look the checksums up in
+		return false, nil, nil
+	}
+	url := policyAssetURL(r, u.binaryChecksums)
+	if url == "" {
+		err := fmt.Errorf("%w: the release has no %s", checksum.ErrNoCheckSumAsset, u.binaryChecksums)
+		if u.checksumPolicy == ChecksumWarn {
+			return false, fmt.Errorf("%w: binaries not verified: %w", ErrChecksumNotVerified, err), nil
+		}
+		return false, nil, err
+	}
+	sums, err := u.fetchChecksums(ctx, url)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to download %s: %w", u.binaryChecksums, err)
+	}
+
+	sel := u.entrySelector()
+	for _, name := range u.binaryNames() {
+		actual, err := fileSHA256(extracted[name])
+		if err != nil {
+			return false, nil, fmt.Errorf("failed to hash %s: %w", name, err)
+		}
+		if err := checkBinary(sums, sel.matcher(name), name, actual); err != nil {
+			return false, nil, fmt.Errorf("%s: %w", u.binaryChecksums, err)
+		}
+	}
+	return true, nil, nil
+}
+
+// checkBinary verifies that a file listed in sums that match accepts for the
+// binary name has the checksum actual.
+func checkBinary(sums *checksum.Info, match EntryMatcher, name, actual string) error {
+	var listed []string
+	for file, sum := range sums.Files {
+		if !match(name, file) {
+			continue
+		}
+		if sum == actual {
+			return nil
+		}
+		listed = append(listed, file)
+	}
+	if len(listed) == 0 {
+		return &ChecksumMismatchError{Asset: name, Actual: actual}
+	}
+	// report the file named like the binary, or else the first one
+	slices.Sort(listed)
+	key := listed[0]
+	if i := slices.IndexFunc(listed, func(f string) bool { return path.Base(f) == name }); i >= 0 {
+		key = listed[i]
+	}
+	return &ChecksumMismatchError{Asset: name, Expected: sums.Files[key], Actual: actual, Key: key}
+}
+
+// fetchChecksums downloads and parses the checksums file at url.
+func (u *upgrader) fetchChecksums(ctx context.Context, url string) (*checksum.Info, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := release.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	return checksum.Parse(io.LimitReader(resp.Body, maxChecksumsSize))
+}
@@ -0,0 +1,76 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryChecksums(t *testing.T) {
+	sum := sha256.Sum256([]byte("new"))
+	newSum := hex.EncodeToString(sum[:])
+
+	// withSums publishes sums as the release asset binaries.sha256
+	withSums := func(t *testing.T, u *upgrader, sums string) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(sums))
+		}))
+		t.Cleanup(srv.Close)
+		info := u.releaseGetter.(*fakeReleaseGetter).info
+		info.Assets = append(info.Assets, release.Asset{Name: "binaries.sha256", BrowserDownloadURL: srv.URL})
+	}
+
+	t.Run("Reported", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+		result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{executablePath: newSum}, result.BinaryChecksums)
+		assert.False(t, result.BinaryChecksumsVerified)
+		assert.Equal(t, newSum, UpgradeReport(result, nil).BinaryChecksums[executablePath])
+	})
+	t.Run("Verified", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy_0.2.0/savvy": "new"}, WithBinaryChecksums("binaries.sha256"))
+		withSums(t, u, "0000000000000000000000000000000000000000000000000000000000000000  savvy_0.2.0/savvy-helper\n"+newSum+"  savvy_0.2.0/savvy\n")
+		result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.BinaryChecksumsVerified)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithBinaryChecksums("binaries.sha256"))
+		withSums(t, u, "0000000000000000000000000000000000000000000000000000000000000000  savvy\n")
+		_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		var mismatch *ChecksumMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, "savvy", mismatch.Key)
+		assert.Equal(t, newSum, mismatch.Actual)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("NotListed", func(t *testing.T) {
+		u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithBinaryChecksums("binaries.sha256"))
+		withSums(t, u, newSum+"  agent\n")
+		_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.ErrorContains(t, err, "no checksum published for savvy")
+	})
+	t.Run("Missing", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithBinaryChecksums("binaries.sha256"))
+		_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		assert.ErrorIs(t, err, ErrNoCheckSumAsset)
+		assert.Equal(t, "old", readFile(t, executablePath))
+
+		WithChecksumPolicy(ChecksumWarn)(u)
+		result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		require.NoError(t, err)
+		assert.False(t, result.BinaryChecksumsVerified)
+		require.NotEmpty(t, result.Warnings)
+		assert.ErrorIs(t, result.Warnings[len(result.Warnings)-1], ErrChecksumNotVerified)
+	})
+}
@@ -0,0 +1,251 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/getsavvyinc/upgrade-cli/trust"
+)
+
+// BundleManifestName is the name of the manifest Export writes to a bundle.
+const BundleManifestName = "bundle.json"
+
+// Bundle is the manifest of a bundle written by Export.
+type Bundle struct {
+	Version string        `json:"version"`
+	Assets  []BundleAsset `json:"assets"`
+}
+
+// BundleAsset is a release asset in a Bundle.
+type BundleAsset struct {
+	// Platform is the "<os>_<arch>" pair the asset was selected for.
+	Platform string `json:"platform"`
+	Name     string `json:"name"`
+	SHA256   string `json:"sha256"`
+	// Verified is true if the asset was verified against the release checksums.
+	Verified bool `json:"verified"`
+}
+
+// ExportOpt configures Export.
+type ExportOpt func(*exportConfig)
+
+type exportConfig struct {
+	platforms []string
+}
+
+// ExportPlatforms exports the assets for platforms, e.g. "linux_amd64" and
+// "darwin_arm64", instead of the asset for the running platform.
+// Platforms other than the running one require the default asset downloader.
+func ExportPlatforms(platforms ...string) ExportOpt {
+	return func(c *exportConfig) {
+		c.platforms = platforms
+	}
+}
+
+// BundleUpgrader is implemented by the Upgrader NewUpgrader returns, to
+// upgrade machines without network access.
+type BundleUpgrader interface {
+	// Export downloads a release into a directory that can be carried to
+	// machines without network access and installed with ImportAndUpgrade.
+	Export(ctx context.Context, version, destDir string, opts ...ExportOpt) (*Bundle, error)
+	// ImportAndUpgrade upgrades the current binary from a bundle written by Export.
+	ImportAndUpgrade(ctx context.Context, dir string) (*UpgradeResult, error)
+}
+
+var _ BundleUpgrader = (*upgrader)(nil)
+
+// Export downloads the release tagged version ("" or "latest" for the latest
+// release) into destDir as a portable bundle for ImportAndUpgrade: the assets
+// for the platforms, their checksums and signatures, and a manifest.
+//
+// The assets are verified according to the checksum policy and the trust
+// store before they are exported.
+func (u *upgrader) Export(ctx context.Context, version, destDir string, opts ...ExportOpt) (*Bundle, error) {
+	cfg := &exportConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var releaseInfo *release.Info
+	var err error
+	if version == "" || version == "latest" {
+		releaseInfo, err = u.releaseGetter.GetLatestRelease(ctx)
+	} else {
+		releaseInfo, err = releaseByTag(ctx, u.releaseGetter, u.tagPrefix, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []BundleAsset
+	for _, platform := range cfg.platforms {
+		a, err := u.selectForPlatform(ctx, releaseInfo.Assets, platform)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, BundleAsset{Platform: platform, Name: assetName(a)})
+	}
+	if len(cfg.platforms) == 0 {
+		selector, ok := u.assetDownloader.(asset.Selector)
+		if !ok {
+			return nil, fmt.Errorf("%w: the asset downloader can't select assets to export", ErrNoAsset)
+		}
+		a, err := selector.SelectAsset(ctx, releaseInfo.Assets)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, BundleAsset{Platform: runtime.GOOS + "_" + runtime.GOARCH, Name: assetName(a)})
+	}
+
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create bundle dir: %w", err)
+	}
+	files := make(map[string]bool)
+	for _, a := range releaseInfo.Assets {
+		name := assetName(a)
+		if !exportedWith(name, selected) {
+			continue
+		}
+		if err := u.fetchTo(ctx, a.BrowserDownloadURL, filepath.Join(destDir, name)); err != nil {
+			return nil, err
+		}
+		files[name] = true
+	}
+
+	bundle := &Bundle{Version: u.tagVersion(releaseInfo.TagName)}
+	for _, a := range selected {
+		if a, err = u.verifyExported(ctx, destDir, files, a); err != nil {
+			return nil, err
+		}
+		bundle.Assets = append(bundle.Assets, a)
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(destDir, BundleManifestName), data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write bundle manifest: %w", err)
+	}
+	return bundle, nil
+}
+
+// ImportAndUpgrade upgrades the current binary from a bundle written by Export.
+// The asset must match the digest the manifest records for it, on top of the
+// checksums and signatures in the bundle, or it fails with ErrChecksumMismatch.
+func (u *upgrader) ImportAndUpgrade(ctx context.Context, dir string) (*UpgradeResult, error) {
+	data, err := os.ReadFile(filepath.Join(dir, BundleManifestName))
+	if err != nil {
+		return &UpgradeResult{}, fmt.Errorf("failed to read bundle manifest: %w", err)
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return &UpgradeResult{}, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	digests := make(map[string]string, len(bundle.Assets))
+	for _, a := range bundle.Assets {
+		digests[a.Name] = a.SHA256
+	}
+	return u.UpgradeFromFile(ctx, dir, FileVersion(bundle.Version), func(s *localSource) {
+		s.digests = digests
+	})
+}
+
+// selectForPlatform returns the asset the default asset downloader selects for platform.
+func (u *upgrader) selectForPlatform(ctx context.Context, assets []release.Asset, platform string) (release.Asset, error) {
+	goos, goarch, ok := strings.Cut(platform, "_")
+	if !ok {
+		return release.Asset{}, fmt.Errorf("invalid platform %q, expected <os>_<arch>", platform)
+	}
+	if goos == runtime.GOOS && goarch == runtime.GOARCH {
+		if selector, ok := u.assetDownloader.(asset.Selector); ok {
+			return selector.SelectAsset(ctx, assets)
+		}
+	}
+	opts := append(slices.Clip(u.assetOpts), asset.WithOS(goos), asset.WithArch(goarch))
+	selector, ok := asset.NewAssetDownloader(u.executablePath, opts...).(asset.Selector)
+	if !ok {
+		return release.Asset{}, fmt.Errorf("%w: can't select assets for %s", ErrNoAsset, platform)
+	}
+	return selector.SelectAsset(ctx, assets)
+}
+
+// exportedWith reports whether the release asset called name is exported
+// with the selected assets: the assets themselves, their checksums and
+// signatures, and combined checksums files.
+func exportedWith(name string, selected []BundleAsset) bool {
+	if strings.HasSuffix(strings.ToLower(name), "checksums.txt") {
+		return true
+	}
+	for _, a := range selected {
+		for _, suffix := range []string{"", ".sha256", ".sha256sum", trust.Minisign.Suffix(), trust.Cosign.Suffix()} {
+			if name == a.Name+suffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyExported verifies an exported asset like UpgradeFromFile would.
+func (u *upgrader) verifyExported(ctx context.Context, dir string, files map[string]bool, a BundleAsset) (BundleAsset, error) {
+	p := filepath.Join(dir, a.Name)
+	sum, err := fileSHA256(p)
+	if err != nil {
+		return a, err
+	}
+	a.SHA256 = sum
+	info := &asset.Info{Name: a.Name, Checksum: sum, DownloadedBinaryFilePath: p}
+	checksums, signature := u.localCompanions(dir, files, a.Name)
+	a.Verified, err = u.verifyChecksum(ctx, func() (*checksum.Info, error) {
+		return loadLocalChecksums(checksums, a.Name)
+	}, info)
+	if err != nil && !errors.Is(err, ErrChecksumNotVerified) {
+		return a, err
+	}
+	if _, err := u.verifyLocalSignature(signature, info); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// fetchTo downloads url to the file at dst.
+func (u *upgrader) fetchTo(ctx context.Context, url, dst string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := release.CheckResponse(resp); err != nil {
+		return fmt.Errorf("failed to download %s: %w", filepath.Base(dst), err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", filepath.Base(dst), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
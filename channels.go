@@ -0,0 +1,300 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// Channel is a release channel an install follows. Each channel also
+// offers the releases of the more stable channels.
+type Channel string
+
+const (
+	// ChannelStable follows releases that aren't marked as pre-releases. It
+	// is the default.
+	ChannelStable Channel = "stable"
+	// ChannelBeta also follows pre-releases, except nightly builds.
+	ChannelBeta Channel = "beta"
+	// ChannelNightly follows every release, including pre-releases tagged
+	// as nightly or dev builds, e.g. "v1.3.0-nightly.20240601".
+	ChannelNightly Channel = "nightly"
+)
+
+// channels are the channels from the most to the least stable.
+var channels = []Channel{ChannelStable, ChannelBeta, ChannelNightly}
+
+// channelListLimit bounds how many releases are listed to find the latest
+// release of a channel.
+const channelListLimit = 100
+
+var (
+	// ErrUnknownChannel is returned for a channel other than stable, beta and nightly.
+	ErrUnknownChannel = errors.New("unknown release channel")
+	// ErrDowngrade is returned by SwitchChannel if the latest release of the
+	// channel is older than the running version, and by UpgradeFromFile for
+	// a local asset older than the installed version, see *DowngradeError.
+	ErrDowngrade = errors.New("the upgrade would downgrade")
+	// ErrListingUnsupported is returned for the beta and nightly channels if
+	// the release getter can't list releases, see release.Lister.
+	ErrListingUnsupported = errors.New("the release getter can't list releases")
+	// ErrTagLookupUnsupported is returned when a specific version is
+	// requested from a release getter that implements neither
+	// release.ByTagGetter nor release.Lister.
+	ErrTagLookupUnsupported = errors.New("the release getter can't look up releases by tag")
+)
+
+// DowngradeError is returned by SwitchChannel if the latest release of
+// Channel is older than the running version, and by UpgradeFromFile, with no
+// Channel, if the local asset is older than the installed version. It wraps
+// ErrDowngrade.
+type DowngradeError struct {
+	Channel        Channel
+	CurrentVersion string
+	LatestVersion  string
+}
+
+func (e *DowngradeError) Error() string {
+	if e.Channel == "" {
+		return fmt.Sprintf("%s: %s is older than %s", ErrDowngrade, e.LatestVersion, e.CurrentVersion)
+	}
+	return fmt.Sprintf("%s: the latest %s release %s is older than %s", ErrDowngrade, e.Channel, e.LatestVersion, e.CurrentVersion)
+}
+
+func (e *DowngradeError) Unwrap() error {
+	return ErrDowngrade
+}
+
+// WithChannel follows c instead of the stable channel, unless the user
+// switched channels with SwitchChannel, which is recorded in the state store.
+// The beta and nightly channels need a release getter that can list
+// releases, see release.Lister.
+func WithChannel(c Channel) Opt {
+	return func(u *upgrader) {
+		u.channel = c
+	}
+}
+
+// SwitchOpt configures SwitchChannel.
+type SwitchOpt func(*switchOptions)
+
+type switchOptions struct {
+	force bool
+}
+
+// ForceDowngrade lets SwitchChannel install the latest release of a
+// channel that is older than the running version, e.g. to leave a beta.
+func ForceDowngrade() SwitchOpt {
+	return func(o *switchOptions) {
+		o.force = true
+	}
+}
+
+// ChannelSwitcher is implemented by the Upgrader NewUpgrader returns, to
+// move an install between release channels.
+type ChannelSwitcher interface {
+	// Channel returns the release channel the install follows.
+	Channel(ctx context.Context) (Channel, error)
+	// SwitchChannel installs the latest release of channel and records that
+	// the install follows it, refusing to downgrade unless forced.
+	SwitchChannel(ctx context.Context, currentVersion string, channel Channel, opts ...SwitchOpt) (*UpgradeResult, error)
+}
+
+var _ ChannelSwitcher = (*upgrader)(nil)
+
+// Channel returns the channel the install follows: the one recorded by
+// SwitchChannel, or the one set with WithChannel, or ChannelStable.
+func (u *upgrader) Channel(ctx context.Context) (Channel, error) {
+	if u.stateStore != nil {
+		st, err := u.stateStore.Load(ctx)
+		if err != nil {
+			return "", err
+		}
+		if st.Channel != "" {
+			return Channel(st.Channel), nil
+		}
+	}
+	if u.channel != "" {
+		return u.channel, nil
+	}
+	return ChannelStable, nil
+}
+
+// SwitchChannel moves the install to channel: it installs the latest
+// release of channel unless it is currentVersion, and records channel in
+// the state store, see WithStateStore. It refuses with a *DowngradeError
+// if that release is older than currentVersion, unless ForceDowngrade is
+// passed. The result has Upgraded set to false if nothing was installed.
+func (u *upgrader) SwitchChannel(ctx context.Context, currentVersion string, channel Channel, opts ...SwitchOpt) (*UpgradeResult, error) {
+	result, err := u.switchChannel(ctx, currentVersion, channel, opts...)
+	if result.TargetVersion != "" {
+		u.record(ctx, actionUpgrade, u.executablePath, result, err)
+	}
+	if err != nil {
+		return result, err
+	}
+	return result, u.restart(result, u.executablePath)
+}
+
+func (u *upgrader) switchChannel(ctx context.Context, currentVersion string, channel Channel, opts ...SwitchOpt) (*UpgradeResult, error) {
+	start := time.Now()
+	result := &UpgradeResult{PreviousVersion: currentVersion, NewVersion: currentVersion}
+	defer func() { result.Duration = time.Since(start) }()
+
+	o := &switchOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !slices.Contains(channels, channel) {
+		return result, fmt.Errorf("%w: %q", ErrUnknownChannel, channel)
+	}
+	if u.stateStore == nil {
+		return result, errors.New("switching channels requires a state store, see WithStateStore")
+	}
+	curr, err := u.parseVersion(currentVersion)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse current version: %s with err %w", currentVersion, err)
+	}
+	releaseInfo, err := u.channelRelease(ctx, channel)
+	if err != nil {
+		return result, err
+	}
+	latest, err := u.parseVersion(u.tagVersion(releaseInfo.TagName))
+	if err != nil {
+		return result, fmt.Errorf("failed to parse latest version: %s with err %w", releaseInfo.TagName, err)
+	}
+
+	if cmp := u.versionScheme.Compare(latest, curr); cmp != 0 {
+		if cmp < 0 && !o.force {
+			return result, &DowngradeError{Channel: channel, CurrentVersion: curr.Original(), LatestVersion: latest.Original()}
+		}
+		update := &Update{
+			CurrentVersion: curr.Original(),
+			LatestVersion:  latest.Original(),
+			Available:      true,
+			Release:        releaseInfo,
+		}
+		u.metrics.UpgradeAttempted()
+		err := u.upgradeTo(ctx, update, result)
+		u.metrics.UpgradeFinished(err)
+		if err != nil {
+			return result, err
+		}
+	}
+	if err := state.SetChannel(ctx, u.stateStore, string(channel)); err != nil {
+		return result, fmt.Errorf("failed to record channel: %w", err)
+	}
+	return result, nil
+}
+
+// followsStable reports whether the install follows the stable channel.
+func (u *upgrader) followsStable(ctx context.Context) bool {
+	if u.channel == "" && u.stateStore == nil {
+		return true
+	}
+	channel, err := u.Channel(ctx)
+	return err == nil && channel == ChannelStable
+}
+
+// latestRelease returns the latest release of the channel the install follows.
+func (u *upgrader) latestRelease(ctx context.Context) (*release.Info, error) {
+	if u.channel == "" && u.stateStore == nil {
+		return u.releaseGetter.GetLatestRelease(ctx)
+	}
+	channel, err := u.Channel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return u.channelRelease(ctx, channel)
+}
+
+// channelRelease returns the newest release of channel.
+func (u *upgrader) channelRelease(ctx context.Context, channel Channel) (*release.Info, error) {
+	rank := slices.Index(channels, channel)
+	if rank < 0 {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownChannel, channel)
+	}
+	if channel == ChannelStable {
+		return u.releaseGetter.GetLatestRelease(ctx)
+	}
+	releases, err := listReleases(ctx, u.releaseGetter, release.ListOptions{Prereleases: true, Limit: channelListLimit})
+	if err != nil {
+		return nil, err
+	}
+	var newest *release.Info
+	var newestVersion Version
+	for i := range releases {
+		r := &releases[i]
+		if slices.Index(channels, releaseChannel(r)) > rank {
+			continue
+		}
+		v, err := u.parseVersion(u.tagVersion(r.TagName))
+		if err != nil {
+			continue
+		}
+		if newest == nil || u.versionScheme.Compare(v, newestVersion) > 0 {
+			newest, newestVersion = r, v
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("%w: no %s release", release.ErrReleaseNotFound, channel)
+	}
+	return newest, nil
+}
+
+// releaseChannel returns the channel r was published on.
+func releaseChannel(r *release.Info) Channel {
+	if !r.Prerelease {
+		return ChannelStable
+	}
+	tag := strings.ToLower(r.TagName)
+	if strings.Contains(tag, "nightly") || strings.Contains(tag, "dev") {
+		return ChannelNightly
+	}
+	return ChannelBeta
+}
+
+// releaseByTag returns the release of g tagged tag, see release.ByTagGetter.
+// Getters that can only list releases are searched for the tag the way the
+// GitHub getter looks it up: with prefix added if it is missing, and with a
+// "v" prefix if the version has none and there's no release without one.
+func releaseByTag(ctx context.Context, g release.Getter, prefix, tag string) (*release.Info, error) {
+	if t, ok := g.(release.ByTagGetter); ok {
+		return t.GetReleaseByTag(ctx, tag)
+	}
+	if _, ok := g.(release.Lister); !ok {
+		return nil, ErrTagLookupUnsupported
+	}
+	releases, err := listReleases(ctx, g, release.ListOptions{Prereleases: true})
+	if err != nil {
+		return nil, err
+	}
+	v := strings.TrimPrefix(tag, prefix)
+	candidates := []string{prefix + v}
+	if !strings.HasPrefix(v, "v") {
+		candidates = append(candidates, prefix+"v"+v)
+	}
+	for _, candidate := range candidates {
+		for i := range releases {
+			if releases[i].TagName == candidate {
+				return &releases[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", release.ErrReleaseNotFound, tag)
+}
+
+// listReleases lists the releases of g, see release.Lister.
+func listReleases(ctx context.Context, g release.Getter, opts release.ListOptions) ([]release.Info, error) {
+	l, ok := g.(release.Lister)
+	if !ok {
+		return nil, ErrListingUnsupported
+	}
+	return l.ListReleases(ctx, opts)
+}
@@ -0,0 +1,157 @@
+package upgrade
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listingGetter lists releases, newest first, and returns the first that
+// isn't a pre-release as the latest.
+type listingGetter struct {
+	releases []release.Info
+}
+
+func (g *listingGetter) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	for i := range g.releases {
+		if !g.releases[i].Prerelease {
+			return &g.releases[i], nil
+		}
+	}
+	return nil, release.ErrReleaseNotFound
+}
+
+func (g *listingGetter) ListReleases(ctx context.Context, opts release.ListOptions) ([]release.Info, error) {
+	return g.releases, nil
+}
+
+func TestSwitchChannel(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+
+	u, executablePath := newTestUpgrader(t, "v0.3.0-beta.1", map[string]string{"savvy": "beta"}, WithStateStore(store))
+	beta := *u.releaseGetter.(*fakeReleaseGetter).info
+	beta.Prerelease = true
+	stableUpgrader, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "stable"})
+	stable := *stableUpgrader.releaseGetter.(*fakeReleaseGetter).info
+	u.releaseGetter = &listingGetter{releases: []release.Info{
+		{TagName: "v0.4.0-nightly.20240601", Prerelease: true},
+		beta,
+		stable,
+	}}
+
+	channel, err := u.Channel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ChannelStable, channel)
+	update, err := u.Check(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.False(t, update.Available)
+
+	result, err := u.SwitchChannel(ctx, "0.2.0", ChannelBeta)
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "v0.3.0-beta.1", result.NewVersion)
+	assert.Equal(t, "beta", readFile(t, executablePath))
+	channel, err = u.Channel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ChannelBeta, channel)
+	update, err = u.Check(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.3.0-beta.1", update.LatestVersion)
+
+	// the latest stable release is older than the beta
+	_, err = u.SwitchChannel(ctx, "0.3.0-beta.1", ChannelStable)
+	var downgrade *DowngradeError
+	require.ErrorAs(t, err, &downgrade)
+	assert.ErrorIs(t, err, ErrDowngrade)
+	assert.Equal(t, "v0.2.0", downgrade.LatestVersion)
+	assert.Equal(t, "beta", readFile(t, executablePath))
+	channel, err = u.Channel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ChannelBeta, channel)
+
+	result, err = u.SwitchChannel(ctx, "0.3.0-beta.1", ChannelStable, ForceDowngrade())
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "stable", readFile(t, executablePath))
+	channel, err = u.Channel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, ChannelStable, channel)
+
+	_, err = u.SwitchChannel(ctx, "0.2.0", "lts")
+	assert.ErrorIs(t, err, ErrUnknownChannel)
+}
+
+func TestChannelNeedsLister(t *testing.T) {
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithChannel(ChannelBeta))
+	_, err := u.Check(context.Background(), "0.1.0")
+	assert.ErrorIs(t, err, ErrListingUnsupported)
+}
+
+// latestGetter only returns the latest release.
+type latestGetter struct {
+	info *release.Info
+}
+
+func (g latestGetter) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	return g.info, nil
+}
+
+func TestReleaseByTag(t *testing.T) {
+	ctx := context.Background()
+	g := &listingGetter{releases: []release.Info{{TagName: "v0.3.0-beta.1", Prerelease: true}, {TagName: "v0.2.0"}}}
+	info, err := releaseByTag(ctx, g, "", "v0.3.0-beta.1")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.3.0-beta.1", info.TagName)
+	_, err = releaseByTag(ctx, g, "", "v0.1.0")
+	assert.ErrorIs(t, err, release.ErrReleaseNotFound)
+
+	_, err = releaseByTag(ctx, latestGetter{info: &release.Info{TagName: "v0.2.0"}}, "", "v0.2.0")
+	assert.ErrorIs(t, err, ErrTagLookupUnsupported)
+
+	// tags are matched like the GitHub getter looks them up
+	g = &listingGetter{releases: []release.Info{{TagName: "cli/v0.2.0"}, {TagName: "server/v0.2.0"}, {TagName: "0.1.0"}}}
+	for tag, want := range map[string]string{"0.2.0": "cli/v0.2.0", "v0.2.0": "cli/v0.2.0", "cli/0.2.0": "cli/v0.2.0"} {
+		info, err := releaseByTag(ctx, g, "cli/", tag)
+		require.NoError(t, err, tag)
+		assert.Equal(t, want, info.TagName, tag)
+	}
+	info, err = releaseByTag(ctx, g, "", "0.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "0.1.0", info.TagName)
+	_, err = releaseByTag(ctx, g, "", "0.2.0")
+	assert.ErrorIs(t, err, release.ErrReleaseNotFound)
+}
+
+// staticTagGetter returns tag as the latest tag, like the releases feed.
+type staticTagGetter string
+
+func (g staticTagGetter) GetLatestTag(ctx context.Context) (string, error) {
+	return string(g), nil
+}
+
+func TestChannelBypassesFeed(t *testing.T) {
+	ctx := context.Background()
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "stable"}, WithChannel(ChannelBeta))
+	u.releaseGetter = &listingGetter{releases: []release.Info{{TagName: "v0.3.0-beta.1", Prerelease: true}, {TagName: "v0.2.0"}}}
+	u.tagGetter = staticTagGetter("v0.2.0")
+
+	// the feed only knows about stable releases
+	available, err := u.IsNewVersionAvailable(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.True(t, available)
+}
+
+func TestCustomGetterSkipsFeed(t *testing.T) {
+	u := NewUpgrader("getsavvyinc", "savvy", "savvy", WithReleaseFeed()).(*upgrader)
+	assert.NotNil(t, u.tagGetter)
+
+	// the custom getter's releases needn't be on GitHub
+	u = NewUpgrader("getsavvyinc", "savvy", "savvy", WithReleaseFeed(), WithReleaseGetter(&fakeReleaseGetter{})).(*upgrader)
+	assert.Nil(t, u.tagGetter)
+}
@@ -5,11 +5,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"path"
+	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 
+	"github.com/getsavvyinc/upgrade-cli/platform"
 	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/goreleaser"
 )
 
 type Downloader interface {
@@ -19,12 +25,53 @@ type Downloader interface {
 type Info struct {
 	// keyed on $binary_os_$arch
 	Checksums map[string]string
+	// Files holds the same checksums keyed on the lowercased file name.
+	Files map[string]string
+}
+
+func newInfo() *Info {
+	return &Info{Checksums: make(map[string]string), Files: make(map[string]string)}
+}
+
+// NewInfo returns an Info holding checksums, keyed on file name.
+func NewInfo(checksums map[string]string) *Info {
+	info := newInfo()
+	for name, checksum := range checksums {
+		info.add(name, checksum)
+	}
+	return info
+}
+
+// add records the checksum of the file called name.
+func (i *Info) add(name, checksum string) {
+	checksum = strings.ToLower(checksum)
+	i.Checksums[checksumKey(name)] = checksum
+	i.Files[strings.ToLower(name)] = checksum
+}
+
+// AssetDownloader is implemented by Downloaders that can limit downloads to
+// the checksum of the release asset that was selected for the upgrade.
+type AssetDownloader interface {
+	// DownloadForAsset is like Download, but only needs the checksum of the
+	// asset downloaded from selectedURL.
+	DownloadForAsset(ctx context.Context, assets []release.Asset, selectedURL string) (*Info, error)
 }
 
 type checksumDownloader struct {
-	assetSuffix string
+	assetSuffix     string
+	siblingSuffixes []string
+	preferSiblings  bool
+	ignoreDigests   bool
+	goreleaser      bool
+	client          *http.Client
+	apiToken        func(ctx context.Context) string
 }
 
+var (
+	_ Downloader      = (*checksumDownloader)(nil)
+	_ AssetDownloader = (*checksumDownloader)(nil)
+)
+
 type DownloadOpt func(*checksumDownloader)
 
 func WithAssetSuffix(suffix string) DownloadOpt {
@@ -33,9 +80,59 @@ func WithAssetSuffix(suffix string) DownloadOpt {
 	}
 }
 
+// WithSiblingSuffixes sets the suffixes of per-asset checksum files, e.g.
+// "savvy_linux_amd64.tar.gz.sha256". The default is ".sha256" and ".sha256sum".
+func WithSiblingSuffixes(suffixes ...string) DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.siblingSuffixes = suffixes
+	}
+}
+
+// WithPreferSiblings uses per-asset checksum files when present and only
+// falls back to the combined checksum file when there are none.
+// By default the combined checksum file is preferred.
+func WithPreferSiblings() DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.preferSiblings = true
+	}
+}
+
+// WithoutDigests ignores the asset digests published by GitHub and always
+// downloads checksum files.
+func WithoutDigests() DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.ignoreDigests = true
+	}
+}
+
+// WithGoReleaserMetadata uses the checksums recorded in goreleaser's
+// artifacts.json if the release has one, before downloading checksum files.
+func WithGoReleaserMetadata() DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.goreleaser = true
+	}
+}
+
+// WithHTTPClient downloads checksums with client instead of http.DefaultClient.
+func WithHTTPClient(client *http.Client) DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.client = client
+	}
+}
+
+// WithAPIDownloads downloads checksum files from their API endpoint,
+// authenticated with the token returned by token, see release.OpenAsset.
+func WithAPIDownloads(token func(ctx context.Context) string) DownloadOpt {
+	return func(c *checksumDownloader) {
+		c.apiToken = token
+	}
+}
+
 func NewCheckSumDownloader(opts ...DownloadOpt) Downloader {
 	d := &checksumDownloader{
-		assetSuffix: "checksums.txt",
+		assetSuffix:     "checksums.txt",
+		siblingSuffixes: []string{".sha256", ".sha256sum"},
+		client:          http.DefaultClient,
 	}
 	for _, opt := range opts {
 		opt(d)
@@ -46,10 +143,103 @@ func NewCheckSumDownloader(opts ...DownloadOpt) Downloader {
 var ErrNoCheckSumAsset = errors.New("no checksum asset found")
 
 func (c *checksumDownloader) Download(ctx context.Context, assets []release.Asset) (*Info, error) {
+	return c.DownloadForAsset(ctx, assets, "")
+}
+
+// DownloadForAsset uses the asset digests published by GitHub if present.
+// Otherwise it downloads the combined checksum file, or the per-asset
+// checksum files if there is none. An empty selectedURL downloads every
+// per-asset checksum file.
+func (c *checksumDownloader) DownloadForAsset(ctx context.Context, assets []release.Asset, selectedURL string) (*Info, error) {
+	sources := []func() (*Info, error){
+		func() (*Info, error) { return c.downloadCombined(ctx, assets) },
+		func() (*Info, error) { return c.downloadSiblings(ctx, assets, selectedURL) },
+	}
+	if c.preferSiblings {
+		sources[0], sources[1] = sources[1], sources[0]
+	}
+	if c.goreleaser {
+		sources = append([]func() (*Info, error){
+			func() (*Info, error) { return c.downloadGoReleaser(ctx, assets, selectedURL) },
+		}, sources...)
+	}
+	if !c.ignoreDigests {
+		sources = append([]func() (*Info, error){
+			func() (*Info, error) { return digests(assets, selectedURL) },
+		}, sources...)
+	}
+	for _, source := range sources {
+		info, err := source()
+		if errors.Is(err, ErrNoCheckSumAsset) {
+			continue
+		}
+		return info, err
+	}
+	return nil, ErrNoCheckSumAsset
+}
+
+// digests collects the sha256 digests GitHub published for assets, limited to
+// the asset downloaded from selectedURL if set. It doesn't need any downloads.
+func digests(assets []release.Asset, selectedURL string) (*Info, error) {
+	info := newInfo()
+	for _, a := range assets {
+		if selectedURL != "" && a.BrowserDownloadURL != selectedURL {
+			continue
+		}
+		digest, ok := strings.CutPrefix(a.Digest, "sha256:")
+		if !ok || digest == "" {
+			continue
+		}
+		name := a.Name
+		if name == "" {
+			name = path.Base(a.BrowserDownloadURL)
+		}
+		info.add(name, digest)
+	}
+	if len(info.Checksums) == 0 {
+		return nil, ErrNoCheckSumAsset
+	}
+	return info, nil
+}
+
+// downloadGoReleaser collects the checksums from goreleaser's artifacts.json,
+// limited to the asset downloaded from selectedURL if set.
+func (c *checksumDownloader) downloadGoReleaser(ctx context.Context, assets []release.Asset, selectedURL string) (*Info, error) {
+	artifacts, err := goreleaser.Fetch(ctx, c.client, assets)
+	if errors.Is(err, goreleaser.ErrNoMetadata) {
+		return nil, ErrNoCheckSumAsset
+	}
+	if err != nil {
+		return nil, err
+	}
+	selected := path.Base(selectedURL)
+	for _, a := range assets {
+		if a.BrowserDownloadURL == selectedURL && a.Name != "" {
+			selected = a.Name
+		}
+	}
+
+	info := newInfo()
+	for _, a := range artifacts {
+		if selectedURL != "" && a.Name != selected {
+			continue
+		}
+		if checksum := a.Checksum(); checksum != "" {
+			info.add(a.Name, checksum)
+		}
+	}
+	if len(info.Checksums) == 0 {
+		return nil, ErrNoCheckSumAsset
+	}
+	return info, nil
+}
+
+// downloadCombined downloads the checksum file covering every asset.
+func (c *checksumDownloader) downloadCombined(ctx context.Context, assets []release.Asset) (*Info, error) {
 	// iterate through the assets and find the one that matches the os and arch
 	for _, asset := range assets {
 		if strings.HasSuffix(asset.BrowserDownloadURL, c.assetSuffix) {
-			checksums, err := downloadCheckSum(ctx, asset.BrowserDownloadURL)
+			checksums, err := c.downloadCheckSum(ctx, asset)
 			if err != nil {
 				return nil, err
 			}
@@ -59,46 +249,145 @@ func (c *checksumDownloader) Download(ctx context.Context, assets []release.Asse
 	return nil, ErrNoCheckSumAsset
 }
 
+// downloadSiblings downloads per-asset checksum files, limited to the one for selectedURL if set.
+func (c *checksumDownloader) downloadSiblings(ctx context.Context, assets []release.Asset, selectedURL string) (*Info, error) {
+	byURL := make(map[string]release.Asset, len(assets))
+	for _, a := range assets {
+		byURL[a.BrowserDownloadURL] = a
+	}
+
+	info := newInfo()
+	for _, a := range assets {
+		if selectedURL != "" && a.BrowserDownloadURL != selectedURL {
+			continue
+		}
+		for _, suffix := range c.siblingSuffixes {
+			sibling, ok := byURL[a.BrowserDownloadURL+suffix]
+			if !ok {
+				continue
+			}
+			checksum, err := c.downloadSiblingCheckSum(ctx, sibling)
+			if err != nil {
+				return nil, err
+			}
+			name := a.Name
+			if name == "" {
+				name = path.Base(a.BrowserDownloadURL)
+			}
+			info.add(name, checksum)
+			break
+		}
+	}
+	if len(info.Checksums) == 0 {
+		return nil, ErrNoCheckSumAsset
+	}
+	return info, nil
+}
+
 var ErrInvalidChecksumFile = errors.New("invalid checksum file")
 
-func downloadCheckSum(ctx context.Context, url string) (*Info, error) {
-	// download the checksum file
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// checksumKey returns the key of the file name in Info.Checksums.
+func checksumKey(name string) string {
+	k := strings.ToLower(name)
+	for _, s := range []string{".tar.gz", ".tar", ".zip", ".gz"} {
+		k = strings.TrimSuffix(k, s)
+	}
+	return k
+}
+
+func (c *checksumDownloader) fetch(ctx context.Context, a release.Asset) (*http.Response, error) {
+	resp, err := release.OpenAsset(ctx, c.client, a, c.apiToken)
 	if err != nil {
 		return nil, err
 	}
+	if err := release.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: %w", path.Base(a.BrowserDownloadURL), err)
+	}
+	return resp, nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func (c *checksumDownloader) downloadCheckSum(ctx context.Context, a release.Asset) (*Info, error) {
+	// download the checksum file
+	resp, err := c.fetch(ctx, a)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	checksums := make(map[string]string)
+	return parseCheckSums(resp.Body)
+}
+
+// bsdLine matches the BSD style "SHA256 (file) = checksum" format.
+var bsdLine = regexp.MustCompile(`^SHA256 \((.+)\) = ([[:xdigit:]]{64})$`)
+
+// sha256Hex matches a hex encoded sha256 digest.
+var sha256Hex = regexp.MustCompile(`^[[:xdigit:]]{64}$`)
 
-	scanner := bufio.NewScanner(resp.Body)
+// Parse parses a checksums file in the format of sha256sum or BSD-style
+// "SHA256 (file) = checksum" lines, e.g. a checksums.txt copied to an
+// air-gapped machine.
+func Parse(r io.Reader) (*Info, error) {
+	return parseCheckSums(r)
+}
+
+// parseCheckSums parses a sha256sum or BSD style checksum file.
+// Lines that can't be parsed, such as comments, blank lines, "Hash: SHA256"
+// headers or signature footers, are skipped, and so are lines whose
+// checksum isn't a hex encoded sha256 digest.
+func parseCheckSums(r io.Reader) (*Info, error) {
+	info := newInfo()
+
+	scanner := bufio.NewScanner(r)
 	// parse the file and return the checksums
 	for scanner.Scan() {
 		line := scanner.Text()
 		// parse the line and extract the checksum
 		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := bsdLine.FindStringSubmatch(line); m != nil {
+			info.add(m[1], m[2])
+			continue
+		}
 		// there maybe one or more blank spaces between the checksum and the file name
 		parts := strings.Fields(line)
 		// parts[0] is the checksum, parts[1] is the file name
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("%w: checksum file is malformed", ErrInvalidChecksumFile)
+		if len(parts) != 2 || !sha256Hex.MatchString(parts[0]) {
+			continue
 		}
-		k := strings.ToLower(parts[1])
-		for _, s := range []string{".tar.gz", ".tar", ".zip", ".gz"} {
-			k = strings.TrimSuffix(k, s)
-		}
-		checksums[k] = strings.ToLower(parts[0])
+		// sha256sum marks files hashed in binary mode with a leading "*"
+		info.add(strings.TrimPrefix(parts[1], "*"), parts[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checksum file: %w", err)
+	}
+
+	if len(info.Checksums) == 0 {
+		return nil, fmt.Errorf("%w: no usable checksums found", ErrInvalidChecksumFile)
 	}
+	return info, nil
+}
 
-	if len(checksums) == 0 {
-		return nil, fmt.Errorf("%w: checksum file is empty", ErrInvalidChecksumFile)
+// downloadSiblingCheckSum downloads a per-asset checksum file, which contains
+// the checksum optionally followed by the file name.
+func (c *checksumDownloader) downloadSiblingCheckSum(ctx context.Context, a release.Asset) (string, error) {
+	resp, err := c.fetch(ctx, a)
+	if err != nil {
+		return "", err
 	}
-	return &Info{Checksums: checksums}, nil
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Fields(string(data))
+	if len(parts) == 0 || len(parts) > 2 {
+		return "", fmt.Errorf("%w: %s is malformed", ErrInvalidChecksumFile, path.Base(a.BrowserDownloadURL))
+	}
+	return strings.ToLower(parts[0]), nil
 }
 
 type CheckSumValidator interface {
@@ -135,12 +424,139 @@ func NewCheckSumValidator(opts ...ValidatorOption) CheckSumValidator {
 	return v
 }
 
+// AssetValidator is implemented by CheckSumValidators that can validate
+// against the file name of the downloaded release asset.
+type AssetValidator interface {
+	// IsAssetCheckSumValid looks up the checksum of assetName, falling back
+	// to IsCheckSumValid if the checksum file doesn't list it.
+	IsAssetCheckSumValid(ctx context.Context, assetName, binary string, checksums *Info, downloadedChecksum string) bool
+}
+
+// ExpectedFinder is implemented by CheckSumValidators that can report the
+// checksum they expect, e.g. to describe a mismatch.
+type ExpectedFinder interface {
+	// ExpectedCheckSum returns the checksum listed for assetName, or for
+	// binary on the validated platform if assetName isn't listed.
+	ExpectedCheckSum(assetName, binary string, checksums *Info) (string, bool)
+}
+
+// Verifier is implemented by CheckSumValidators that can explain why a
+// checksum isn't valid.
+type Verifier interface {
+	// Validate is like IsAssetCheckSumValid, but returns a *ValidationError
+	// instead of false.
+	Validate(ctx context.Context, assetName, binary string, checksums *Info, downloadedChecksum string) error
+}
+
+var (
+	// ErrNoEntry is returned by Validate when the checksums don't list the asset.
+	ErrNoEntry = errors.New("no checksum listed")
+	// ErrMismatch is returned by Validate when the checksum listed for the
+	// asset differs from the downloaded one.
+	ErrMismatch = errors.New("checksum mismatch")
+)
+
+// ValidationError describes why a checksum isn't valid. It wraps ErrNoEntry
+// or ErrMismatch.
+type ValidationError struct {
+	Asset string
+	// Key is the entry of the checksums that was compared. It's empty if
+	// none of the keys in LookedUp are listed.
+	Key string
+	// LookedUp are the keys that were looked up in order: the asset name,
+	// then the binary name for each spelling of the platform.
+	LookedUp []string
+	// Available are the file names the checksums list, sorted.
+	Available []string
+	Expected  string
+	Actual    string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s for %s: looked up %s, the checksums list %s", ErrNoEntry, e.Asset, strings.Join(e.LookedUp, ", "), strings.Join(e.Available, ", "))
+	}
+	return fmt.Sprintf("%s: %s has checksum %s, %s lists %s", ErrMismatch, e.Asset, e.Actual, e.Key, e.Expected)
+}
+
+func (e *ValidationError) Unwrap() error {
+	if e.Key == "" {
+		return ErrNoEntry
+	}
+	return ErrMismatch
+}
+
+var (
+	_ AssetValidator = (*validator)(nil)
+	_ ExpectedFinder = (*validator)(nil)
+	_ Verifier       = (*validator)(nil)
+)
+
+func (v *validator) IsAssetCheckSumValid(ctx context.Context, assetName, binary string, info *Info, downloadedChecksum string) bool {
+	return v.Validate(ctx, assetName, binary, info, downloadedChecksum) == nil
+}
+
 func (v *validator) IsCheckSumValid(ctx context.Context, binary string, info *Info, downloadedChecksum string) bool {
+	expectedChecksum, ok := v.ExpectedCheckSum("", binary, info)
+	return ok && expectedChecksum == downloadedChecksum
+}
 
-	key := fmt.Sprintf("%s_%s_%s", binary, v.os, v.arch)
-	expectedChecksum, ok := info.Checksums[key]
-	if !ok {
-		return false
+func (v *validator) Validate(ctx context.Context, assetName, binary string, info *Info, downloadedChecksum string) error {
+	actual := strings.ToLower(downloadedChecksum)
+	e := &ValidationError{Asset: assetName, Actual: actual}
+	if assetName == "" {
+		e.Asset = binary
+	}
+	e.Key, e.Expected = v.lookup(assetName, binary, info)
+	if e.Key == "" {
+		if assetName != "" {
+			e.LookedUp = append(e.LookedUp, strings.ToLower(assetName))
+		}
+		e.LookedUp = append(e.LookedUp, v.platformKeys(binary)...)
+		for name := range info.Files {
+			e.Available = append(e.Available, name)
+		}
+		slices.Sort(e.Available)
+		return e
+	}
+	if e.Expected != actual {
+		return e
+	}
+	return nil
+}
+
+func (v *validator) ExpectedCheckSum(assetName, binary string, info *Info) (string, bool) {
+	key, expectedChecksum := v.lookup(assetName, binary, info)
+	return expectedChecksum, key != ""
+}
+
+// lookup returns the key and checksum listed for assetName, or for binary on
+// the validated platform if assetName isn't listed. The key is empty if
+// neither is listed.
+func (v *validator) lookup(assetName, binary string, info *Info) (string, string) {
+	if key := strings.ToLower(assetName); key != "" {
+		if expectedChecksum, ok := info.Files[key]; ok {
+			return key, expectedChecksum
+		}
+	}
+	for _, key := range v.platformKeys(binary) {
+		if expectedChecksum, ok := info.Checksums[key]; ok {
+			return key, expectedChecksum
+		}
+	}
+	return "", ""
+}
+
+// platformKeys returns the keys of Info.Checksums the checksum of binary on
+// the validated platform may be listed under, in order of precedence.
+func (v *validator) platformKeys(binary string) []string {
+	binary = strings.ToLower(binary)
+	var keys []string
+	for _, suffix := range platform.Suffixes(v.os, v.arch) {
+		// the binary and platform may be separated by "_" or "-" as well
+		for _, sep := range platform.Separators {
+			keys = append(keys, binary+sep+suffix)
+		}
 	}
-	return expectedChecksum == downloadedChecksum
+	return keys
 }
@@ -2,6 +2,8 @@ package checksum
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -10,16 +12,17 @@ import (
 
 	"github.com/getsavvyinc/upgrade-cli/release"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // checksumData is a sample checksum file for testing
-// It contains the checksums, one or more spaces and binary_os_arch pairs
+// It contains the sha256 digests of the names, one or more spaces and binary_os_arch pairs
 // NOTE: we intentionally have an extra space at the beg of each line
-const checksumData = ` checksum_savvy_darwin_arm64  savvy_darwin_arm64
- checksum_savvy_darwin_x86_64 savvy_darwin_x86_64
- checksum_savvy_linux_arm64 savvy_linux_arm64
- checksum_savvy_linux_i386 savvy_linux_i386
- checksum_savvy_linux_x86_64  savvy_linux_x86_64
+const checksumData = ` 68f209f7acd1ba30021ad900d1b79fde28904722b8ae43e494008a7aff791577  savvy_darwin_arm64
+ a1f70a3a9d96e2c04dda0c2778006fe1798f733dc0f9028b7708a94f2bd03382 savvy_darwin_x86_64
+ 79f732c0e734556cb31c970bb408b86e22aeac024ea9b8b3e9820125172743d6 savvy_linux_arm64
+ 3c3ac01f72119b7bbd6d1e9c6aec486bb0d3070159c75a532bf90ca2fde5b038 savvy_linux_i386
+ dfe6f9ce7394e7acfda669032d142cb37ad7c3e36bd15c29e82cf5c84ea4d1dd  savvy_linux_x86_64
 `
 
 const malformedChecksumData = `6796a0fb64d0c78b2de5410a94749a 3bfb77291747c1835fbd427e8bf00f6af3  savvy_darwin_arm64
@@ -69,7 +72,8 @@ func TestDownloadCheckSum(t *testing.T) {
 		for k, v := range checksums.Checksums {
 			assert.NotEmpty(t, k)
 			assert.NotEmpty(t, v)
-			assert.Equal(t, strings.Join([]string{"checksum", k}, "_"), v)
+			sum := sha256.Sum256([]byte(k))
+			assert.Equal(t, hex.EncodeToString(sum[:]), v)
 		}
 	})
 	t.Run("InvalidCheckSumFile", func(t *testing.T) {
@@ -135,6 +139,14 @@ func TestCheckSumValidator(t *testing.T) {
 			isValid:            true,
 			binary:             binary,
 		},
+		{
+			name:               "ValidChecksumsWithArchAlias",
+			downloadedChecksum: checksum,
+			os:                 "linux",
+			arch:               "amd64",
+			isValid:            true,
+			binary:             binary,
+		},
 		{
 			name:               "InvalidChecksums",
 			downloadedChecksum: "invalid_checksum",
@@ -177,3 +189,173 @@ func TestCheckSumValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadSiblingCheckSums(t *testing.T) {
+	ctx := context.Background()
+	requested := map[string]int{}
+	srv := setupTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested[r.URL.Path]++
+		switch r.URL.Path {
+		case "/savvy_linux_x86_64.tar.gz.sha256":
+			io.WriteString(w, "CHECKSUM_LINUX  savvy_linux_x86_64.tar.gz\n")
+		case "/savvy_darwin_arm64.sha256":
+			io.WriteString(w, "checksum_darwin\n")
+		case "/checksums.txt":
+			io.WriteString(w, checksumData)
+		default:
+			t.Errorf("unexpected URL: %s", r.URL.Path)
+		}
+	}))
+	assets := []release.Asset{
+		{BrowserDownloadURL: srv.URL + "/savvy_linux_x86_64.tar.gz"},
+		{BrowserDownloadURL: srv.URL + "/savvy_linux_x86_64.tar.gz.sha256"},
+		{BrowserDownloadURL: srv.URL + "/savvy_darwin_arm64"},
+		{BrowserDownloadURL: srv.URL + "/savvy_darwin_arm64.sha256"},
+	}
+
+	t.Run("FallbackWithoutCombinedFile", func(t *testing.T) {
+		info, err := NewCheckSumDownloader().Download(ctx, assets)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"savvy_linux_x86_64": "checksum_linux",
+			"savvy_darwin_arm64": "checksum_darwin",
+		}, info.Checksums)
+	})
+	t.Run("OnlySelectedAsset", func(t *testing.T) {
+		clear(requested)
+		d := NewCheckSumDownloader().(AssetDownloader)
+		info, err := d.DownloadForAsset(ctx, assets, assets[2].BrowserDownloadURL)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"savvy_darwin_arm64": "checksum_darwin"}, info.Checksums)
+		assert.Equal(t, map[string]int{"/savvy_darwin_arm64.sha256": 1}, requested)
+	})
+	t.Run("PreferCombinedFile", func(t *testing.T) {
+		withCombined := append(assets, release.Asset{BrowserDownloadURL: srv.URL + "/checksums.txt"})
+		info, err := NewCheckSumDownloader().Download(ctx, withCombined)
+		require.NoError(t, err)
+		assert.Len(t, info.Checksums, 5)
+
+		info, err = NewCheckSumDownloader(WithPreferSiblings()).Download(ctx, withCombined)
+		require.NoError(t, err)
+		assert.Len(t, info.Checksums, 2)
+	})
+}
+
+func TestAssetDigests(t *testing.T) {
+	ctx := context.Background()
+	requested := 0
+	srv := setupTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested++
+		io.WriteString(w, checksumData)
+	}))
+	assets := []release.Asset{
+		{Name: "savvy_linux_x86_64.tar.gz", BrowserDownloadURL: srv.URL + "/savvy_linux_x86_64.tar.gz", Digest: "sha256:ABC123"},
+		{Name: "savvy_darwin_arm64", BrowserDownloadURL: srv.URL + "/savvy_darwin_arm64", Digest: "sha256:def456"},
+		{Name: "checksums.txt", BrowserDownloadURL: srv.URL + "/checksums.txt"},
+	}
+
+	t.Run("UsesDigests", func(t *testing.T) {
+		d := NewCheckSumDownloader().(AssetDownloader)
+		info, err := d.DownloadForAsset(ctx, assets, assets[0].BrowserDownloadURL)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"savvy_linux_x86_64": "abc123"}, info.Checksums)
+		assert.Zero(t, requested)
+	})
+	t.Run("FallbackWithoutDigest", func(t *testing.T) {
+		withoutDigests := []release.Asset{assets[0], assets[2]}
+		withoutDigests[0].Digest = ""
+		info, err := NewCheckSumDownloader().Download(ctx, withoutDigests)
+		require.NoError(t, err)
+		assert.Len(t, info.Checksums, 5)
+		assert.Equal(t, 1, requested)
+	})
+	t.Run("WithoutDigests", func(t *testing.T) {
+		requested = 0
+		info, err := NewCheckSumDownloader(WithoutDigests()).Download(ctx, assets)
+		require.NoError(t, err)
+		assert.Len(t, info.Checksums, 5)
+		assert.Equal(t, 1, requested)
+	})
+}
+
+// abc, def and ghi are sample sha256 digests.
+var (
+	abc = strings.Repeat("abc1", 16)
+	def = strings.Repeat("def2", 16)
+	ghi = strings.Repeat("0783", 16)
+)
+
+func TestParseCheckSums(t *testing.T) {
+	data := `-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+# checksums for savvy v0.2.0
+
+` + abc + `  savvy_linux_x86_64.tar.gz
+` + def + ` *savvy_windows_x86_64.zip
+SHA256 (savvy_darwin_arm64.tar.gz) = ` + strings.ToUpper(ghi) + `
+abc123  savvy_freebsd_amd64.tar.gz
+-----BEGIN PGP SIGNATURE-----
+iQIzBAEBCAAdFiEE
+-----END PGP SIGNATURE-----
+`
+	info, err := parseCheckSums(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"savvy_linux_x86_64":   abc,
+		"savvy_windows_x86_64": def,
+		"savvy_darwin_arm64":   ghi,
+	}, info.Checksums)
+
+	_, err = parseCheckSums(strings.NewReader("# nothing here\n\n"))
+	assert.ErrorIs(t, err, ErrInvalidChecksumFile)
+	_, err = parseCheckSums(strings.NewReader("<html>\nnot found\n</html>\n"))
+	assert.ErrorIs(t, err, ErrInvalidChecksumFile, "lines without a digest aren't checksums")
+}
+
+func TestAssetCheckSumValidator(t *testing.T) {
+	ctx := context.Background()
+	info, err := parseCheckSums(strings.NewReader(abc + "  mycli_1.2.3_Linux_x86_64.tar.gz\n" + def + "  mycli_linux_arm64.tar.gz\n"))
+	require.NoError(t, err)
+	v := NewCheckSumValidator(WithOS("linux"), WithArch("arm64")).(AssetValidator)
+
+	testCases := []struct {
+		name      string
+		assetName string
+		checksum  string
+		isValid   bool
+	}{
+		{name: "FullNameCaseInsensitive", assetName: "MYCLI_1.2.3_linux_x86_64.tar.gz", checksum: abc, isValid: true},
+		{name: "FullNameMismatch", assetName: "mycli_1.2.3_Linux_x86_64.tar.gz", checksum: def, isValid: false},
+		{name: "FallbackToPlatformKey", assetName: "unlisted.tar.gz", checksum: def, isValid: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.isValid, v.IsAssetCheckSumValid(ctx, tc.assetName, "mycli", info, tc.checksum))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	info, err := parseCheckSums(strings.NewReader(abc + "  mycli_linux_arm64.tar.gz\n" + def + "  mycli_darwin_arm64.tar.gz\n"))
+	require.NoError(t, err)
+	v := NewCheckSumValidator(WithOS("linux"), WithArch("arm64")).(Verifier)
+
+	require.NoError(t, v.Validate(ctx, "mycli_linux_arm64.tar.gz", "mycli", info, strings.ToUpper(abc)))
+
+	err = v.Validate(ctx, "mycli_linux_arm64.tar.gz", "mycli", info, def)
+	var invalid *ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.ErrorIs(t, err, ErrMismatch)
+	assert.Equal(t, "mycli_linux_arm64.tar.gz", invalid.Key)
+	assert.Equal(t, abc, invalid.Expected)
+	assert.Equal(t, def, invalid.Actual)
+
+	err = v.Validate(ctx, "other_linux_arm64.tar.gz", "other", info, abc)
+	require.ErrorAs(t, err, &invalid)
+	assert.ErrorIs(t, err, ErrNoEntry)
+	assert.Empty(t, invalid.Key)
+	assert.Equal(t, "other_linux_arm64.tar.gz", invalid.LookedUp[0])
+	assert.Contains(t, invalid.LookedUp, "other_linux_arm64")
+	assert.Equal(t, []string{"mycli_darwin_arm64.tar.gz", "mycli_linux_arm64.tar.gz"}, invalid.Available)
+}
@@ -0,0 +1,253 @@
+// Package config loads the user's upgrade settings from a config file and
+// environment variables, so every CLI built on the upgrader offers the same
+// settings under the same names.
+//
+// Settings are read from ~/.config/<app>/upgrade.toml, or the platform's
+// equivalent, see paths.New, and overridden by <APP>_UPGRADE_* environment variables:
+//
+//	# ~/.config/savvy/upgrade.toml
+//	channel = "beta"
+//	check_interval = "12h"
+//	skip_versions = ["0.4.0"]
+//	proxy = "http://proxy.example.com:3128"
+//	policy = "notify"
+//
+// The file is a flat subset of TOML: key = value pairs without tables.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	upgrade "github.com/getsavvyinc/upgrade-cli"
+	"github.com/getsavvyinc/upgrade-cli/paths"
+)
+
+// ErrInvalidConfig is returned by Load when the config file or an
+// environment variable holds an invalid setting.
+var ErrInvalidConfig = errors.New("invalid upgrade config")
+
+// Policy is what to do about updates found in the background.
+type Policy string
+
+const (
+	// PolicyAuto installs updates, e.g. with upgrade.RunAutoUpgrader.
+	PolicyAuto Policy = "auto"
+	// PolicyNotify only tells the user about updates.
+	PolicyNotify Policy = "notify"
+	// PolicyOff doesn't check for updates in the background.
+	PolicyOff Policy = "off"
+)
+
+// Config holds the user's upgrade settings. Settings that aren't set are
+// zero, so the CLI applies its own defaults.
+type Config struct {
+	// Channel is the release channel the user follows, e.g. "stable" or "beta".
+	Channel string
+	// CheckInterval is how often to check for updates in the background.
+	CheckInterval time.Duration
+	// SkipVersions are versions the user doesn't want to upgrade to.
+	SkipVersions []string
+	// Proxy is the HTTP proxy to send requests through.
+	Proxy *url.URL
+	// Policy is what to do about updates found in the background.
+	Policy Policy
+}
+
+// Opts returns the options applying c to an upgrader: WithChannel,
+// WithProxyURL and WithSkippedVersions. The CLI applies CheckInterval and
+// Policy, which decide when to upgrade.
+func (c *Config) Opts() []upgrade.Opt {
+	var opts []upgrade.Opt
+	if c.Channel != "" {
+		opts = append(opts, upgrade.WithChannel(upgrade.Channel(c.Channel)))
+	}
+	if c.Proxy != nil {
+		opts = append(opts, upgrade.WithProxyURL(c.Proxy))
+	}
+	if len(c.SkipVersions) > 0 {
+		opts = append(opts, upgrade.WithSkippedVersions(c.SkipVersions...))
+	}
+	return opts
+}
+
+type loader struct {
+	path      string
+	lookupEnv func(string) (string, bool)
+}
+
+// LoadOpt configures Load.
+type LoadOpt func(*loader)
+
+// WithPath reads the config file at path instead of the default one.
+func WithPath(path string) LoadOpt {
+	return func(l *loader) {
+		l.path = path
+	}
+}
+
+// WithLookupEnv looks up environment variables with lookupEnv instead of
+// os.LookupEnv, e.g. in tests.
+func WithLookupEnv(lookupEnv func(string) (string, bool)) LoadOpt {
+	return func(l *loader) {
+		l.lookupEnv = lookupEnv
+	}
+}
+
+// Path returns the default path of app's config file: upgrade.toml in app's
+// config directory, e.g. ~/.config/savvy/upgrade.toml on Linux, see paths.New.
+func Path(app string) (string, error) {
+	p, err := paths.New(app)
+	if err != nil {
+		return "", err
+	}
+	return p.ConfigFile(), nil
+}
+
+// EnvPrefix returns the prefix of app's environment variables, e.g.
+// "SAVVY_UPGRADE_" for "savvy".
+func EnvPrefix(app string) string {
+	return paths.EnvPrefix(app)
+}
+
+// Load loads app's config file and applies the environment variables
+// overriding it: <APP>_UPGRADE_CHANNEL, _CHECK_INTERVAL, _SKIP_VERSIONS
+// (comma-separated), _PROXY and _POLICY. <APP>_UPGRADE_CONFIG sets the path
+// of the config file. Empty variables are ignored, and a missing config file
+// isn't an error.
+func Load(app string, opts ...LoadOpt) (*Config, error) {
+	l := &loader{lookupEnv: os.LookupEnv}
+	for _, opt := range opts {
+		opt(l)
+	}
+	prefix := EnvPrefix(app)
+	path := l.path
+	if p, ok := l.lookupEnv(prefix + "CONFIG"); ok && p != "" {
+		path = p
+	}
+	if path == "" {
+		p, err := paths.New(app, paths.WithGetenv(func(name string) string {
+			v, _ := l.lookupEnv(name)
+			return v
+		}))
+		if err != nil {
+			return nil, err
+		}
+		path = p.ConfigFile()
+	}
+
+	c := &Config{}
+	values, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for key, v := range values {
+		if err := c.set(key, v); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, path, err)
+		}
+	}
+	for _, key := range []string{"channel", "check_interval", "skip_versions", "proxy", "policy"} {
+		name := prefix + strings.ToUpper(key)
+		v, ok := l.lookupEnv(name)
+		if !ok || strings.TrimSpace(v) == "" {
+			continue
+		}
+		var value any = v
+		if key == "skip_versions" {
+			value = splitList(v)
+		}
+		if err := c.set(key, value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, name, err)
+		}
+	}
+	return c, nil
+}
+
+// readFile parses the config file at path, which may not exist.
+func readFile(path string) (map[string]any, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	defer f.Close()
+	values, err := parseTOML(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, path, err)
+	}
+	return values, nil
+}
+
+// set sets the setting key to v. Unknown keys are ignored, so config files
+// can be shared with newer versions of the CLI.
+func (c *Config) set(key string, v any) error {
+	switch key {
+	case "channel":
+		s, err := str(key, v)
+		c.Channel = s
+		return err
+	case "check_interval":
+		s, err := str(key, v)
+		if err != nil || s == "" {
+			return err
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("check_interval must be a positive duration, e.g. \"24h\", not %q", s)
+		}
+		c.CheckInterval = d
+	case "skip_versions":
+		versions, ok := v.([]string)
+		if !ok {
+			return fmt.Errorf("skip_versions must be an array of strings")
+		}
+		c.SkipVersions = versions
+	case "proxy":
+		s, err := str(key, v)
+		if err != nil || s == "" {
+			return err
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("proxy must be a URL, e.g. \"http://proxy.example.com:3128\", not %q", s)
+		}
+		c.Proxy = u
+	case "policy":
+		s, err := str(key, v)
+		if err != nil {
+			return err
+		}
+		switch p := Policy(s); p {
+		case "", PolicyAuto, PolicyNotify, PolicyOff:
+			c.Policy = p
+		default:
+			return fmt.Errorf("policy must be %q, %q or %q, not %q", PolicyAuto, PolicyNotify, PolicyOff, s)
+		}
+	}
+	return nil
+}
+
+func str(key string, v any) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// splitList splits a comma-separated environment variable.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the flat subset of TOML config files use: key = value
+// pairs whose values are strings, booleans, integers or arrays of strings,
+// and comments. Tables aren't supported.
+func parseTOML(r io.Reader) (map[string]any, error) {
+	values := make(map[string]any)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables aren't supported", n)
+		}
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is defined twice", n, key)
+		}
+		v, rest, err := parseValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", n, key, err)
+		}
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("line %d: %s: unexpected %q after value", n, key, rest)
+		}
+		values[key] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// parseValue parses the value at the start of s and returns the rest of s.
+func parseValue(s string) (any, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`), strings.HasPrefix(s, "'"):
+		return parseString(s)
+	case strings.HasPrefix(s, "["):
+		var items []string
+		s = strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(s, "]") {
+			item, rest, err := parseString(s)
+			if err != nil {
+				return nil, "", fmt.Errorf("arrays may only hold strings: %w", err)
+			}
+			items = append(items, item)
+			s = strings.TrimSpace(rest)
+			if after, ok := strings.CutPrefix(s, ","); ok {
+				s = strings.TrimSpace(after)
+			} else if !strings.HasPrefix(s, "]") {
+				return nil, "", fmt.Errorf("unterminated array")
+			}
+		}
+		return items, s[1:], nil
+	}
+	token, rest, _ := strings.Cut(s, " ")
+	token, _, _ = strings.Cut(token, "#")
+	switch token {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	i, err := strconv.ParseInt(strings.ReplaceAll(token, "_", ""), 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid value %q", token)
+	}
+	return i, rest, nil
+}
+
+// parseString parses the basic or literal string at the start of s and
+// returns the rest of s.
+func parseString(s string) (string, string, error) {
+	if strings.HasPrefix(s, "'") {
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", fmt.Errorf("expected a string")
+	}
+	for end := 1; end < len(s); end++ {
+		switch s[end] {
+		case '\\':
+			end++
+		case '"':
+			str, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:end+1])
+			}
+			return str, s[end+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,168 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/delta"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// WithDeltaUpdates only downloads the parts of a new binary that changed, if
+// the release publishes a block index next to the asset, e.g.
+// "savvy_linux_amd64.blocks.json", see package delta. Blocks found in the
+// installed executable are reused and the others fetched with HTTP range
+// requests. This applies to assets that are binaries rather than archives,
+// since compressing a binary spreads every change over the whole archive.
+//
+// If the release has no index, the whole asset is downloaded instead. So it
+// is if patching fails, e.g. because the index is invalid or a block doesn't
+// match it, and the failure is reported in UpgradeResult.Warnings. The
+// patched asset is verified like a downloaded one, and
+// UpgradeResult.BytesDownloaded only counts the fetched bytes.
+func WithDeltaUpdates() Opt {
+	return func(u *upgrader) {
+		u.deltaUpdates = true
+	}
+}
+
+// deltaAsset patches the asset the asset downloader would download from the
+// installed executable, see WithDeltaUpdates. It returns a nil *asset.Info if
+// the asset has to be downloaded instead, with the reason patching failed as
+// a warning. It only fails if ctx is done.
+func (u *upgrader) deltaAsset(ctx context.Context, assets []release.Asset) (info *asset.Info, cleanup func() error, warning, err error) {
+	if !u.deltaUpdates {
+		return nil, nil, nil, nil
+	}
+	selector, ok := u.assetDownloader.(asset.Selector)
+	if !ok {
+		return nil, nil, nil, nil
+	}
+	a, err := selector.SelectAsset(ctx, assets)
+	if err != nil || asset.ArchiveSuffix(a.BrowserDownloadURL) != "" {
+		return nil, nil, nil, nil
+	}
+	name := assetName(a)
+	indexURL := policyAssetURL(&release.Info{Assets: assets}, name+delta.IndexSuffix)
+	if indexURL == "" {
+		return nil, nil, nil, nil
+	}
+
+	start := time.Now()
+	err = inPhase(ctx, "asset download", u.timeouts.Download, func(ctx context.Context) error {
+		var err error
+		info, cleanup, err = u.patchAsset(ctx, a, indexURL)
+		return err
+	})
+	if ctx.Err() != nil {
+		if cleanup != nil {
+			cleanup()
+		}
+		return nil, nil, nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to patch %s, downloaded it instead: %w", name, err), nil
+	}
+	u.metrics.AssetDownloaded(info.Size, time.Since(start))
+	info.Name = name
+	return info, cleanup, nil, nil
+}
+
+// patchAsset builds the asset a from the installed executable and the
+// blocks fetched from a's URL, following the index at indexURL.
+func (u *upgrader) patchAsset(ctx context.Context, a release.Asset, indexURL string) (*asset.Info, func() error, error) {
+	idx, err := u.fetchIndex(ctx, indexURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the index is only trusted as far as the asset's size, which bounds the download
+	if a.Size <= 0 && u.maxAssetSize <= 0 {
+		return nil, nil, fmt.Errorf("%w: the size of %s is unknown", delta.ErrInvalidIndex, assetName(a))
+	}
+	if a.Size > 0 && idx.Size != a.Size {
+		return nil, nil, fmt.Errorf("%w: describes %d bytes, the asset has %d", delta.ErrInvalidIndex, idx.Size, a.Size)
+	}
+	if u.maxAssetSize > 0 && idx.Size > u.maxAssetSize {
+		return nil, nil, &AssetTooLargeError{Asset: assetName(a), Size: idx.Size, Max: u.maxAssetSize}
+	}
+
+	seed, err := os.Open(u.executablePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer seed.Close()
+	fi, err := seed.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := os.CreateTemp(u.workDir, filepath.Base(u.executablePath))
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() error { return os.Remove(out.Name()) }
+	hash := sha256.New()
+	stats, err := delta.Patch(ctx, io.MultiWriter(out, hash), idx, seed, fi.Size(), u.fetchRange(a.BrowserDownloadURL))
+	if err == nil {
+		err = out.Chmod(0o755)
+	}
+	// the file is closed before it is removed, which fails on Windows otherwise
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return &asset.Info{
+		URL:                      a.BrowserDownloadURL,
+		Checksum:                 hex.EncodeToString(hash.Sum(nil)),
+		DownloadedBinaryFilePath: out.Name(),
+		Size:                     stats.Fetched,
+	}, cleanup, nil
+}
+
+// fetchIndex downloads and parses the block index at url.
+func (u *upgrader) fetchIndex(ctx context.Context, url string) (*delta.Index, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := release.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	return delta.ParseIndex(resp.Body)
+}
+
+// fetchRange returns a fetcher requesting ranges of url.
+func (u *upgrader) fetchRange(url string) delta.Fetcher {
+	return func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		resp, err := u.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return nil, fmt.Errorf("range request for %s returned %s", url, resp.Status)
+		}
+		return resp.Body, nil
+	}
+}
@@ -0,0 +1,334 @@
+// Package delta downloads a new version of a file by reusing the blocks it
+// shares with an old version, in the style of zsync: the publisher splits
+// the new file into fixed-size blocks and publishes a checksum for each of
+// them in an Index, and the client finds the blocks in the old file at any
+// offset with a rolling checksum and only fetches the rest.
+//
+// Publish an index next to a release asset with NewIndex:
+//
+//	idx, err := delta.NewIndex(f, delta.DefaultBlockSize)
+//	// write idx as JSON to "savvy_linux_amd64" + delta.IndexSuffix
+package delta
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// IndexSuffix is appended to the name of a release asset to name its index.
+const IndexSuffix = ".blocks.json"
+
+// DefaultBlockSize is the block size of indexes, a trade-off between the
+// size of the index and how much of a changed file can be reused.
+const DefaultBlockSize = 16 << 10
+
+// MaxBlockSize is the largest block size an index may have, since patching
+// holds a few blocks in memory.
+const MaxBlockSize = 1 << 20
+
+// maxIndexSize bounds how much of an index is read.
+const maxIndexSize = 16 << 20
+
+// ErrInvalidIndex is returned when an index can't be parsed or doesn't
+// describe the file it was used for.
+var ErrInvalidIndex = errors.New("invalid block index")
+
+// Index describes the blocks of a file.
+type Index struct {
+	BlockSize int   `json:"block_size"`
+	Size      int64 `json:"size"`
+	// SHA256 is the checksum of the whole file.
+	SHA256 string  `json:"sha256"`
+	Blocks []Block `json:"blocks"`
+}
+
+// Block is the checksums of a block. The last block may be shorter than
+// the block size.
+type Block struct {
+	// Weak is the rolling checksum used to find the block.
+	Weak uint32 `json:"weak"`
+	// Strong is the sha256 checksum confirming the block.
+	Strong string `json:"strong"`
+}
+
+// NewIndex reads the file r and returns its index with blocks of blockSize
+// bytes, at most MaxBlockSize.
+func NewIndex(r io.Reader, blockSize int) (*Index, error) {
+	if blockSize <= 0 || blockSize > MaxBlockSize {
+		return nil, fmt.Errorf("%w: block size %d", ErrInvalidIndex, blockSize)
+	}
+	idx := &Index{BlockSize: blockSize}
+	file := sha256.New()
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			b := buf[:n]
+			file.Write(b)
+			idx.Blocks = append(idx.Blocks, Block{Weak: weakSum(b), Strong: strongSum(b)})
+			idx.Size += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	idx.SHA256 = hex.EncodeToString(file.Sum(nil))
+	return idx, nil
+}
+
+// ParseIndex parses an index encoded as JSON.
+func ParseIndex(r io.Reader) (*Index, error) {
+	idx := &Index{}
+	if err := json.NewDecoder(io.LimitReader(r, maxIndexSize)).Decode(idx); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIndex, err)
+	}
+	if err := idx.validate(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+func (idx *Index) validate() error {
+	if idx.BlockSize <= 0 || idx.BlockSize > MaxBlockSize || idx.Size < 0 {
+		return fmt.Errorf("%w: block size %d, size %d", ErrInvalidIndex, idx.BlockSize, idx.Size)
+	}
+	if blocks := (idx.Size + int64(idx.BlockSize) - 1) / int64(idx.BlockSize); int64(len(idx.Blocks)) != blocks {
+		return fmt.Errorf("%w: %d blocks for %d bytes, expected %d", ErrInvalidIndex, len(idx.Blocks), idx.Size, blocks)
+	}
+	return nil
+}
+
+// blockLen returns the length of block i.
+func (idx *Index) blockLen(i int) int {
+	if rest := idx.Size - int64(i)*int64(idx.BlockSize); rest < int64(idx.BlockSize) {
+		return int(rest)
+	}
+	return idx.BlockSize
+}
+
+// Fetcher returns length bytes of the new file, starting at offset, e.g.
+// with an HTTP range request.
+type Fetcher func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// Stats describes how a file was patched.
+type Stats struct {
+	// Reused is the number of bytes copied from the old file.
+	Reused int64
+	// Fetched is the number of bytes fetched.
+	Fetched int64
+}
+
+// Patch writes the file described by idx to w. Blocks found in the old file
+// seed are copied from it, and the others are fetched with fetch, merging
+// adjacent blocks into one request. Every block and the whole file are
+// verified against idx.
+func Patch(ctx context.Context, w io.Writer, idx *Index, seed io.ReaderAt, seedSize int64, fetch Fetcher) (*Stats, error) {
+	if err := idx.validate(); err != nil {
+		return nil, err
+	}
+	found, err := findBlocks(idx, io.NewSectionReader(seed, 0, seedSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the old file: %w", err)
+	}
+
+	stats := &Stats{}
+	file := sha256.New()
+	out := io.MultiWriter(w, file)
+	buf := make([]byte, idx.BlockSize)
+	for i := 0; i < len(idx.Blocks); {
+		if off, ok := found[i]; ok {
+			b := buf[:idx.blockLen(i)]
+			if _, err := seed.ReadAt(b, off); err != nil {
+				return nil, fmt.Errorf("failed to read the old file: %w", err)
+			}
+			if err := writeBlock(out, idx, i, b); err != nil {
+				return nil, err
+			}
+			stats.Reused += int64(len(b))
+			i++
+			continue
+		}
+		// fetch the run of missing blocks starting at i
+		end := i + 1
+		for end < len(idx.Blocks) {
+			if _, ok := found[end]; ok {
+				break
+			}
+			end++
+		}
+		if err := fetchBlocks(ctx, out, idx, i, end, buf, fetch); err != nil {
+			return nil, err
+		}
+		for ; i < end; i++ {
+			stats.Fetched += int64(idx.blockLen(i))
+		}
+	}
+	if sum := hex.EncodeToString(file.Sum(nil)); idx.SHA256 != "" && sum != idx.SHA256 {
+		return nil, fmt.Errorf("%w: patched file has checksum %s, expected %s", ErrInvalidIndex, sum, idx.SHA256)
+	}
+	return stats, nil
+}
+
+// fetchBlocks fetches the blocks [start, end) and writes them to w.
+func fetchBlocks(ctx context.Context, w io.Writer, idx *Index, start, end int, buf []byte, fetch Fetcher) error {
+	offset := int64(start) * int64(idx.BlockSize)
+	var length int64
+	for i := start; i < end; i++ {
+		length += int64(idx.blockLen(i))
+	}
+	rc, err := fetch(ctx, offset, length)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	for i := start; i < end; i++ {
+		b := buf[:idx.blockLen(i)]
+		if _, err := io.ReadFull(rc, b); err != nil {
+			return fmt.Errorf("failed to fetch block %d: %w", i, err)
+		}
+		if err := writeBlock(w, idx, i, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBlock verifies b as block i and writes it to w.
+func writeBlock(w io.Writer, idx *Index, i int, b []byte) error {
+	if strongSum(b) != idx.Blocks[i].Strong {
+		return fmt.Errorf("%w: block %d doesn't match its checksum", ErrInvalidIndex, i)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// findBlocks scans the old file r for blocks of idx at any offset and
+// returns the offset of each block found. The last block is only found if
+// it is a whole block.
+func findBlocks(idx *Index, r io.Reader) (map[int]int64, error) {
+	size := idx.BlockSize
+	byWeak := make(map[uint32][]int, len(idx.Blocks))
+	for i, b := range idx.Blocks {
+		if idx.blockLen(i) == size {
+			byWeak[b.Weak] = append(byWeak[b.Weak], i)
+		}
+	}
+	found := make(map[int]int64)
+	br := bufio.NewReaderSize(r, 4*size)
+	s := &scanner{window: make([]byte, size), hash: sha256.New()}
+	for {
+		ok, err := s.fill(br)
+		if err != nil || !ok {
+			return found, err
+		}
+		for {
+			if s.match(byWeak, idx, found) {
+				break // continue after the block
+			}
+			c, err := br.ReadByte()
+			if errors.Is(err, io.EOF) {
+				return found, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			s.roll(c)
+		}
+	}
+}
+
+// scanner is a window of a block size sliding over the old file.
+type scanner struct {
+	window []byte
+	// head is the index of the oldest byte of window.
+	head int
+	// offset is the offset of the window in the old file.
+	offset int64
+	// next is the offset of the byte after the window.
+	next int64
+	a, b uint32
+	hash hash.Hash
+}
+
+// fill fills the window with the next block of r. It returns false at the
+// end of r.
+func (s *scanner) fill(r io.Reader) (bool, error) {
+	n, err := io.ReadFull(r, s.window)
+	s.offset = s.next
+	s.next += int64(n)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s.head = 0
+	s.a, s.b = weakParts(s.window)
+	return true, nil
+}
+
+// roll slides the window by one byte, c.
+func (s *scanner) roll(c byte) {
+	out := uint32(s.window[s.head])
+	s.a = (s.a - out + uint32(c)) & 0xffff
+	s.b = (s.b - uint32(len(s.window))*out + s.a) & 0xffff
+	s.window[s.head] = c
+	s.head = (s.head + 1) % len(s.window)
+	s.offset++
+	s.next++
+}
+
+// match records the offset of the blocks the window holds that weren't
+// found yet, and reports whether there were any.
+func (s *scanner) match(byWeak map[uint32][]int, idx *Index, found map[int]int64) bool {
+	candidates := byWeak[s.a|s.b<<16]
+	if len(candidates) == 0 {
+		return false
+	}
+	s.hash.Reset()
+	s.hash.Write(s.window[s.head:])
+	s.hash.Write(s.window[:s.head])
+	strong := hex.EncodeToString(s.hash.Sum(nil))
+	matched := false
+	for _, i := range candidates {
+		if idx.Blocks[i].Strong != strong {
+			continue
+		}
+		// identical blocks are all copied from the same offset
+		if _, ok := found[i]; !ok {
+			found[i] = s.offset
+			matched = true
+		}
+	}
+	return matched
+}
+
+// weakSum returns the rsync rolling checksum of b.
+func weakSum(b []byte) uint32 {
+	a, s := weakParts(b)
+	return a | s<<16
+}
+
+func weakParts(data []byte) (uint32, uint32) {
+	var a, b uint32
+	for i, c := range data {
+		a += uint32(c)
+		b += uint32(len(data)-i) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+func strongSum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+package delta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const blockSize = 1024
+
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+// fetcher serves ranges of file and counts the requests.
+type fetcher struct {
+	file     []byte
+	requests int
+	corrupt  bool
+}
+
+func (f *fetcher) fetch(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	f.requests++
+	b := bytes.Clone(f.file[offset : offset+length])
+	if f.corrupt {
+		b[0]++
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func patch(t *testing.T, oldFile, newFile []byte, f *fetcher) ([]byte, *Stats, error) {
+	t.Helper()
+	idx, err := NewIndex(bytes.NewReader(newFile), blockSize)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	stats, err := Patch(context.Background(), &out, idx, bytes.NewReader(oldFile), int64(len(oldFile)), f.fetch)
+	return out.Bytes(), stats, err
+}
+
+func TestPatch(t *testing.T) {
+	oldFile := randomBytes(1, 64*blockSize+100)
+
+	t.Run("Shifted", func(t *testing.T) {
+		// insert and change bytes at unaligned offsets, shifting the rest
+		newFile := append(bytes.Clone(oldFile[:5000]), []byte("inserted")...)
+		newFile = append(newFile, oldFile[5000:40000]...)
+		newFile = append(newFile, randomBytes(2, 3000)...)
+		newFile = append(newFile, oldFile[43000:]...)
+
+		f := &fetcher{file: newFile}
+		out, stats, err := patch(t, oldFile, newFile, f)
+		require.NoError(t, err)
+		assert.Equal(t, newFile, out)
+		assert.Equal(t, int64(len(newFile)), stats.Reused+stats.Fetched)
+		assert.Greater(t, stats.Reused, int64(len(newFile)*3/4))
+		assert.Less(t, f.requests, 8, "adjacent missing blocks are fetched together")
+	})
+	t.Run("Unchanged", func(t *testing.T) {
+		f := &fetcher{file: oldFile}
+		out, stats, err := patch(t, oldFile, oldFile, f)
+		require.NoError(t, err)
+		assert.Equal(t, oldFile, out)
+		// only the partial last block is fetched
+		assert.Equal(t, int64(100), stats.Fetched)
+	})
+	t.Run("NoSeed", func(t *testing.T) {
+		f := &fetcher{file: oldFile}
+		out, stats, err := patch(t, nil, oldFile, f)
+		require.NoError(t, err)
+		assert.Equal(t, oldFile, out)
+		assert.Equal(t, int64(len(oldFile)), stats.Fetched)
+		assert.Equal(t, 1, f.requests)
+	})
+	t.Run("CorruptBlock", func(t *testing.T) {
+		_, _, err := patch(t, nil, oldFile, &fetcher{file: oldFile, corrupt: true})
+		assert.ErrorIs(t, err, ErrInvalidIndex)
+	})
+}
+
+func TestParseIndex(t *testing.T) {
+	idx, err := NewIndex(bytes.NewReader(randomBytes(3, 3*blockSize+1)), blockSize)
+	require.NoError(t, err)
+	assert.Len(t, idx.Blocks, 4)
+	b, err := json.Marshal(idx)
+	require.NoError(t, err)
+
+	parsed, err := ParseIndex(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, idx, parsed)
+
+	for name, s := range map[string]string{
+		"Malformed":     "{",
+		"NoBlockSize":   `{"size": 10, "blocks": [{}]}`,
+		"MissingBlocks": `{"block_size": 4, "size": 10, "blocks": [{}]}`,
+		"HugeBlocks":    `{"block_size": 1073741824, "size": 10, "blocks": [{}]}`,
+	} {
+		_, err := ParseIndex(strings.NewReader(s))
+		assert.ErrorIs(t, err, ErrInvalidIndex, name)
+	}
+}
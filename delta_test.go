@@ -0,0 +1,131 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/delta"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaUpdates(t *testing.T) {
+	oldBinary := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(oldBinary)
+	newBinary := append(bytes.Clone(oldBinary[:100000]), []byte("changed")...)
+	newBinary = append(newBinary, oldBinary[100000:]...)
+
+	idx, err := delta.NewIndex(bytes.NewReader(newBinary), 4<<10)
+	require.NoError(t, err)
+	index, err := json.Marshal(idx)
+	require.NoError(t, err)
+	sum := sha256.Sum256(newBinary)
+
+	// setup serves newBinary as a raw binary asset, with index as its block
+	// index unless it is nil. onIndex is called when the index is requested.
+	var onIndex func()
+	setup := func(t *testing.T, index []byte, opts ...Opt) (*upgrader, string, *int64) {
+		assetName := fmt.Sprintf("savvy_%s_%s", runtime.GOOS, runtime.GOARCH)
+		checksums := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), assetName)
+		var served int64
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/" + assetName:
+				rec := httptest.NewRecorder()
+				http.ServeContent(rec, r, assetName, time.Time{}, bytes.NewReader(newBinary))
+				served += int64(rec.Body.Len())
+				for k, v := range rec.Header() {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(rec.Code)
+				w.Write(rec.Body.Bytes())
+			case "/" + assetName + delta.IndexSuffix:
+				if onIndex != nil {
+					onIndex()
+				}
+				w.Write(index)
+			case "/checksums.txt":
+				w.Write([]byte(checksums))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		t.Cleanup(srv.Close)
+
+		executablePath := filepath.Join(t.TempDir(), "savvy")
+		require.NoError(t, os.WriteFile(executablePath, oldBinary, 0o755))
+		opts = append([]Opt{WithAllowManagedInstall(), WithDeltaUpdates()}, opts...)
+		u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath, opts...).(*upgrader)
+		assets := []release.Asset{
+			{Name: assetName, BrowserDownloadURL: srv.URL + "/" + assetName, Size: int64(len(newBinary))},
+			{Name: "checksums.txt", BrowserDownloadURL: srv.URL + "/checksums.txt"},
+		}
+		if index != nil {
+			assets = append(assets, release.Asset{Name: assetName + delta.IndexSuffix, BrowserDownloadURL: srv.URL + "/" + assetName + delta.IndexSuffix})
+		}
+		u.releaseGetter = &fakeReleaseGetter{info: &release.Info{TagName: "v0.2.0", Assets: assets}}
+		return u, executablePath, &served
+	}
+
+	t.Run("Patched", func(t *testing.T) {
+		u, executablePath, served := setup(t, index)
+		result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		require.NoError(t, err)
+		assert.Equal(t, string(newBinary), readFile(t, executablePath))
+		assert.Less(t, *served, int64(len(newBinary)/4))
+		assert.Equal(t, *served, result.BytesDownloaded)
+	})
+	t.Run("NoIndex", func(t *testing.T) {
+		u, executablePath, served := setup(t, nil)
+		_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		require.NoError(t, err)
+		assert.Equal(t, string(newBinary), readFile(t, executablePath))
+		assert.Equal(t, int64(len(newBinary)), *served)
+	})
+	t.Run("InvalidIndex", func(t *testing.T) {
+		// the index describes another asset, so the whole asset is downloaded
+		other, err := delta.NewIndex(bytes.NewReader(oldBinary[:1000]), 4<<10)
+		require.NoError(t, err)
+		invalid, err := json.Marshal(other)
+		require.NoError(t, err)
+		u, executablePath, served := setup(t, invalid)
+		result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		require.NoError(t, err)
+		assert.Equal(t, string(newBinary), readFile(t, executablePath))
+		assert.Equal(t, int64(len(newBinary)), *served)
+		require.Len(t, result.Warnings, 1)
+		assert.ErrorIs(t, result.Warnings[0], delta.ErrInvalidIndex)
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		// a canceled upgrade doesn't fall back to downloading the asset
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		onIndex = cancel
+		defer func() { onIndex = nil }()
+		u, executablePath, served := setup(t, index)
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, string(oldBinary), readFile(t, executablePath))
+		assert.Zero(t, *served)
+	})
+	t.Run("TooLarge", func(t *testing.T) {
+		// the index is ignored and the full download fails
+		u, executablePath, _ := setup(t, index, WithMaxAssetSize(1<<10))
+		_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		assert.ErrorIs(t, err, ErrAssetTooLarge)
+		assert.Equal(t, string(oldBinary), readFile(t, executablePath))
+	})
+}
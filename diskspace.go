@@ -0,0 +1,97 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// ErrInsufficientSpace is returned before downloading an update that doesn't
+// fit on disk. The returned error is an *InsufficientSpaceError.
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// InsufficientSpaceError describes a directory without enough free space for an update.
+type InsufficientSpaceError struct {
+	Dir       string
+	Required  uint64
+	Available uint64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("%s: %s has %s free, %s required", ErrInsufficientSpace, e.Dir, formatBytes(e.Available), formatBytes(e.Required))
+}
+
+func (e *InsufficientSpaceError) Unwrap() error {
+	return ErrInsufficientSpace
+}
+
+// extractionFactor estimates how much larger the extracted binaries are than
+// a compressed archive. Go binaries usually compress 2-3x.
+const extractionFactor = 4
+
+// diskFree returns the free space of the filesystem holding dir and an ID of
+// that filesystem. It is a variable for tests.
+var diskFree = freeSpace
+
+// checkDiskSpace verifies that the download directory and the install
+// directory can hold a, its extracted binaries and their copies. Unknown
+// sizes and free space are not checked.
+func (u *upgrader) checkDiskSpace(a release.Asset) error {
+	if a.Size <= 0 {
+		return nil
+	}
+	size := uint64(a.Size)
+	extracted := size
+	switch name := strings.ToLower(a.Name); {
+	case strings.HasSuffix(name, ".tar"):
+	case strings.HasSuffix(name, ".gz"), strings.HasSuffix(name, ".tgz"), strings.HasSuffix(name, ".zip"):
+		extracted = size * extractionFactor
+	}
+
+	type need struct {
+		dir      string
+		required uint64
+		free     uint64
+	}
+	var needs []*need
+	byFS := map[string]*need{}
+	for _, n := range []*need{
+		{dir: u.tempDir(), required: size + extracted},
+		{dir: filepath.Dir(u.executablePath), required: extracted},
+	} {
+		free, fs, err := diskFree(n.dir)
+		if err != nil {
+			continue
+		}
+		if same, ok := byFS[fs]; ok {
+			same.required += n.required
+			continue
+		}
+		n.free = free
+		byFS[fs] = n
+		needs = append(needs, n)
+	}
+	for _, n := range needs {
+		if n.free < n.required {
+			return &InsufficientSpaceError{Dir: n.dir, Required: n.required, Available: n.free}
+		}
+	}
+	return nil
+}
+
+// formatBytes formats n in the largest fitting binary unit, e.g. "1.5 MiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
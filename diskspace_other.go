@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package upgrade
+
+import "errors"
+
+func freeSpace(dir string) (uint64, string, error) {
+	return 0, "", errors.ErrUnsupported
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd
+
+package upgrade
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func freeSpace(dir string) (uint64, string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, "", err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return 0, "", err
+	}
+	fs := dir
+	if sys, ok := fi.Sys().(*syscall.Stat_t); ok {
+		fs = fmt.Sprint(sys.Dev)
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), fs, nil
+}
@@ -0,0 +1,60 @@
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	installDir := t.TempDir()
+	free := map[string]uint64{}
+	fs := map[string]string{os.TempDir(): "tmp", installDir: "home"}
+	orig := diskFree
+	t.Cleanup(func() { diskFree = orig })
+	diskFree = func(dir string) (uint64, string, error) {
+		return free[dir], fs[dir], nil
+	}
+
+	u := NewUpgrader("getsavvyinc", "savvy", filepath.Join(installDir, "savvy")).(*upgrader)
+	archive := release.Asset{Name: "savvy_linux_amd64.tar.gz", Size: 10}
+
+	free[os.TempDir()], free[installDir] = 50, 40
+	assert.NoError(t, u.checkDiskSpace(archive))
+	assert.NoError(t, u.checkDiskSpace(release.Asset{Name: "savvy"}), "unknown sizes aren't checked")
+
+	free[os.TempDir()] = 49
+	err := u.checkDiskSpace(archive)
+	var insufficient *InsufficientSpaceError
+	require.ErrorAs(t, err, &insufficient)
+	assert.ErrorIs(t, err, ErrInsufficientSpace)
+	assert.Equal(t, &InsufficientSpaceError{Dir: os.TempDir(), Required: 50, Available: 49}, insufficient)
+
+	// raw binaries don't need room for extraction
+	assert.NoError(t, u.checkDiskSpace(release.Asset{Name: "savvy_linux_amd64", Size: 20}))
+
+	// directories on the same filesystem share its free space
+	fs[installDir] = "tmp"
+	free[os.TempDir()] = 80
+	assert.ErrorIs(t, u.checkDiskSpace(archive), ErrInsufficientSpace)
+	free[os.TempDir()] = 90
+	assert.NoError(t, u.checkDiskSpace(archive))
+
+	// the check runs before the download
+	name := "savvy_" + runtime.GOOS + "_" + runtime.GOARCH + ".tar.gz"
+	getter := &fakeReleaseGetter{info: &release.Info{TagName: "v0.2.0", Assets: []release.Asset{
+		{Name: name, BrowserDownloadURL: "https://example.invalid/" + name, Size: 1 << 40},
+	}}}
+	u = NewUpgrader("getsavvyinc", "savvy", filepath.Join(installDir, "savvy"), WithReleaseGetter(getter), WithAllowManagedInstall()).(*upgrader)
+	_, err = u.UpgradeWithResult(context.Background(), "0.1.0")
+	assert.ErrorIs(t, err, ErrInsufficientSpace)
+
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 MiB", formatBytes(3<<19))
+}
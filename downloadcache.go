@@ -0,0 +1,168 @@
+package upgrade
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// WithDownloadCache keeps verified downloads in dir, keyed on the release tag
+// and their checksum, so a retried upgrade, or upgrading again after a
+// rollback, reuses the asset instead of downloading it again.
+//
+// Only assets whose published checksum is known are cached. Cached assets go
+// through the same verification as downloaded ones.
+func WithDownloadCache(dir string) Opt {
+	return func(u *upgrader) {
+		u.downloadCacheDir = dir
+	}
+}
+
+// downloadAsset downloads the asset for the platform from assets, copies it
+// from the download cache or patches the installed executable. checksums are
+// the prefetched checksums the asset is verified against, which decide
+// whether the cached asset can be used. The warning reports why a delta
+// update fell back to downloading the asset.
+func (u *upgrader) downloadAsset(ctx context.Context, tag string, assets []release.Asset, checksums *checksumFetch) (info *asset.Info, cleanup func() error, warning, err error) {
+	if info, cleanup, ok := u.cachedAsset(ctx, tag, assets, checksums); ok {
+		return info, cleanup, nil, nil
+	}
+	info, cleanup, warning, err = u.deltaAsset(ctx, assets)
+	if info != nil || err != nil {
+		return info, cleanup, nil, err
+	}
+	start := time.Now()
+	err = inPhase(ctx, "asset download", u.timeouts.Download, func(ctx context.Context) error {
+		var err error
+		info, cleanup, err = u.assetDownloader.DownloadAsset(ctx, assets)
+		return err
+	})
+	if err == nil {
+		u.metrics.AssetDownloaded(info.Size, time.Since(start))
+	}
+	return info, cleanup, warning, err
+}
+
+// cachedAsset returns a copy of the cached asset the asset downloader would
+// download, if its checksum matches the published one in checksums. Without
+// checksums nothing is cached.
+func (u *upgrader) cachedAsset(ctx context.Context, tag string, assets []release.Asset, checksums *checksumFetch) (*asset.Info, func() error, bool) {
+	if u.downloadCacheDir == "" || checksums == nil {
+		return nil, nil, false
+	}
+	selector, ok := u.assetDownloader.(asset.Selector)
+	if !ok {
+		return nil, nil, false
+	}
+	finder, ok := u.checksumValidator.(checksum.ExpectedFinder)
+	if !ok {
+		return nil, nil, false
+	}
+	a, err := selector.SelectAsset(ctx, assets)
+	if err != nil {
+		return nil, nil, false
+	}
+	if checksums.assetURL != "" && checksums.assetURL != a.BrowserDownloadURL {
+		return nil, nil, false
+	}
+	info, err := checksums.wait()
+	if err != nil || info == nil {
+		return nil, nil, false
+	}
+	name := assetName(a)
+	expected, ok := finder.ExpectedCheckSum(name, filepath.Base(u.executablePath), info)
+	if !ok {
+		return nil, nil, false
+	}
+	cached, ok := u.downloadCachePath(tag, expected, name)
+	if !ok {
+		return nil, nil, false
+	}
+	if _, err := os.Stat(cached); err != nil {
+		return nil, nil, false
+	}
+
+	// the pipeline consumes the asset, so it works on a copy
+	f, err := os.CreateTemp(u.workDir, filepath.Base(u.executablePath))
+	if err != nil {
+		return nil, nil, false
+	}
+	f.Close()
+	cleanup := func() error { return os.Remove(f.Name()) }
+	if err := copyFile(cached, f.Name(), 0o755); err != nil {
+		cleanup()
+		return nil, nil, false
+	}
+	sum, err := fileSHA256(f.Name())
+	if err != nil || sum != expected {
+		cleanup()
+		os.Remove(cached)
+		return nil, nil, false
+	}
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		cleanup()
+		return nil, nil, false
+	}
+	return &asset.Info{
+		Name:                     name,
+		URL:                      a.BrowserDownloadURL,
+		Checksum:                 sum,
+		DownloadedBinaryFilePath: f.Name(),
+		ArSuffix:                 asset.ArchiveSuffix(a.BrowserDownloadURL),
+		Size:                     fi.Size(),
+	}, cleanup, true
+}
+
+// storeDownload adds a verified download to the download cache. Failures are
+// ignored, the cache only saves downloads.
+func (u *upgrader) storeDownload(tag string, info *asset.Info) {
+	if u.downloadCacheDir == "" {
+		return
+	}
+	cached, ok := u.downloadCachePath(tag, info.Checksum, info.Name)
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(cached); err == nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cached), 0o755); err != nil {
+		return
+	}
+	tmp := cached + ".tmp"
+	if err := copyFile(info.DownloadedBinaryFilePath, tmp, 0o644); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	if err := os.Rename(tmp, cached); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// downloadCachePath returns where the asset called name with checksum is
+// cached. It is false if any part can't be used as a file name.
+func (u *upgrader) downloadCachePath(tag, checksum, name string) (string, bool) {
+	parts := []string{url.PathEscape(tag), checksum, filepath.Base(name)}
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." || filepath.Base(p) != p {
+			return "", false
+		}
+	}
+	return filepath.Join(append([]string{u.downloadCacheDir}, parts...)...), true
+}
+
+// assetName returns the file name of a, falling back to the last element of its download URL.
+func assetName(a release.Asset) string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return path.Base(a.BrowserDownloadURL)
+}
@@ -0,0 +1,161 @@
+package upgrade
+
+import (
+	"maps"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// EntryMatcher reports whether the archive entry, a slash-separated path such
+// as "savvy_1.0.0_linux_amd64/savvy", holds the binary name.
+type EntryMatcher func(name, entry string) bool
+
+// MatchEntryPrefix matches entries whose base name starts with the binary's
+// name, e.g. "savvy" and "savvy.exe" for "savvy". It is the default.
+func MatchEntryPrefix() EntryMatcher {
+	return func(name, entry string) bool {
+		return strings.HasPrefix(filepath.Base(entry), name)
+	}
+}
+
+// MatchEntryExact matches entries whose base name is the binary's name, so
+// that "savvy-helper" isn't mistaken for "savvy".
+func MatchEntryExact() EntryMatcher {
+	return func(name, entry string) bool {
+		return filepath.Base(entry) == name
+	}
+}
+
+// MatchEntryGlob matches entries with path.Match. Patterns containing a slash
+// are matched against the whole entry, e.g. "*/bin/savvy", others against
+// its base name, e.g. "savvy_*". A malformed pattern matches no entry.
+func MatchEntryGlob(pattern string) EntryMatcher {
+	return func(_, entry string) bool {
+		if !strings.Contains(pattern, "/") {
+			entry = path.Base(entry)
+		}
+		ok, err := path.Match(pattern, entry)
+		return ok && err == nil
+	}
+}
+
+// MatchEntryRegexp matches entries whose whole path matches re.
+func MatchEntryRegexp(re *regexp.Regexp) EntryMatcher {
+	return func(_, entry string) bool {
+		return re.MatchString(entry)
+	}
+}
+
+// WithArchiveEntries selects the archive entries of the binaries with match
+// instead of MatchEntryPrefix.
+//
+// If several entries match a binary, the entry whose base name is the
+// binary's name wins, and otherwise the first one in the archive. An entry
+// matching several binaries goes to the one named like it, or else to one
+// with its own matcher, see WithArchiveEntry and WithArchiveFiles.
+func WithArchiveEntries(match EntryMatcher) Opt {
+	return func(u *upgrader) {
+		u.entryMatch = match
+	}
+}
+
+// WithArchiveEntry selects the archive entry of the binary name with match,
+// overriding WithArchiveEntries, e.g. for one of the binaries of WithBinaries
+// that is named differently in the archive. A nil match restores the matcher
+// of WithArchiveEntries.
+func WithArchiveEntry(name string, match EntryMatcher) Opt {
+	return func(u *upgrader) {
+		if match == nil {
+			delete(u.entryMatchers, name)
+			return
+		}
+		if u.entryMatchers == nil {
+			u.entryMatchers = make(map[string]EntryMatcher)
+		}
+		u.entryMatchers[name] = match
+	}
+}
+
+// entrySelector selects the archive entries holding the binaries to extract.
+type entrySelector struct {
+	names []string
+	// match is used for names without a matcher in matchers.
+	match    EntryMatcher
+	matchers map[string]EntryMatcher
+}
+
+// prefixEntries selects the binaries names with MatchEntryPrefix.
+func prefixEntries(names ...string) *entrySelector {
+	return &entrySelector{names: names, match: MatchEntryPrefix()}
+}
+
+// entrySelector returns the selector of the binaries and archive files to
+// extract from the release asset.
+func (u *upgrader) entrySelector() *entrySelector {
+	match := u.entryMatch
+	if match == nil {
+		match = MatchEntryPrefix()
+	}
+	sel := &entrySelector{names: u.binaryNames(), match: match, matchers: u.entryMatchers}
+	if len(u.archiveFiles) == 0 {
+		return sel
+	}
+	// archive files are extracted under their Path
+	sel.names = slices.Clone(sel.names)
+	sel.matchers = maps.Clone(sel.matchers)
+	if sel.matchers == nil {
+		sel.matchers = make(map[string]EntryMatcher, len(u.archiveFiles))
+	}
+	for _, f := range u.archiveFiles {
+		sel.names = append(sel.names, f.Path)
+		sel.matchers[f.Path] = f.entryMatcher()
+	}
+	return sel
+}
+
+func (s *entrySelector) matcher(name string) EntryMatcher {
+	if m, ok := s.matchers[name]; ok {
+		return m
+	}
+	return s.match
+}
+
+// pick returns the binary that entry should be extracted as, if any. exact
+// holds the binaries picked so far and whether their entry's base name is
+// the binary's name. An entry replaces a binary's earlier entry only if its
+// base name is the binary's name and the earlier one's isn't. Otherwise, an
+// entry goes to a binary with its own matcher before one matched by default,
+// so that e.g. "savvy.bash" goes to an archive file rather than to "savvy".
+func (s *entrySelector) pick(entry string, exact map[string]bool) (string, bool) {
+	base := filepath.Base(entry)
+	picked, pickedOwn := "", false
+	for _, name := range s.names {
+		isExact, found := exact[name]
+		if isExact || !s.matcher(name)(name, entry) {
+			continue
+		}
+		if base == name {
+			return name, true
+		}
+		if found {
+			continue
+		}
+		if _, own := s.matchers[name]; picked == "" || own && !pickedOwn {
+			picked, pickedOwn = name, own
+		}
+	}
+	return picked, picked != ""
+}
+
+// done reports whether no later entry can replace the entries picked so far.
+func (s *entrySelector) done(exact map[string]bool) bool {
+	for _, name := range s.names {
+		if !exact[name] {
+			return false
+		}
+	}
+	return true
+}
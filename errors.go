@@ -0,0 +1,92 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// Errors of the subpackages, re-exported so callers can branch on the
+// failure class with errors.Is without importing them.
+var (
+	// ErrNoAsset is returned when the release has no asset for the platform.
+	ErrNoAsset = asset.ErrNoAsset
+	// ErrNoCheckSumAsset is returned when the release publishes no checksums.
+	ErrNoCheckSumAsset = checksum.ErrNoCheckSumAsset
+	// ErrNotFound is returned when a release or one of its assets doesn't exist.
+	ErrNotFound = release.ErrNotFound
+	// ErrSizeMismatch is returned when a download is truncated or longer
+	// than expected. The returned error is a *SizeMismatchError.
+	ErrSizeMismatch = asset.ErrSizeMismatch
+	// ErrRateLimited is returned when GitHub rate limits the requests.
+	// The returned error is a *RateLimitError.
+	ErrRateLimited = release.ErrRateLimited
+	// ErrAssetTooLarge is returned when an asset is larger than allowed by
+	// WithMaxAssetSize. The returned error is an *AssetTooLargeError.
+	ErrAssetTooLarge = asset.ErrTooLarge
+)
+
+// SizeMismatchError describes a truncated or oversized download.
+type SizeMismatchError = asset.SizeMismatchError
+
+// RateLimitError describes a rate limited request, including when to retry.
+type RateLimitError = release.RateLimitError
+
+// AssetTooLargeError describes an asset larger than allowed by WithMaxAssetSize.
+type AssetTooLargeError = asset.TooLargeError
+
+// ErrChecksumMismatch is returned when the downloaded asset doesn't match
+// its published checksum. The returned error is a *ChecksumMismatchError.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrInvalidCheckSum is the former name of ErrChecksumMismatch.
+//
+// Deprecated: use ErrChecksumMismatch.
+var ErrInvalidCheckSum = ErrChecksumMismatch
+
+// ChecksumMismatchError describes a downloaded asset that doesn't match its published checksum.
+type ChecksumMismatchError struct {
+	Asset string
+	// Expected is empty if the checksums don't list the asset.
+	Expected string
+	Actual   string
+	// Key is the entry of the checksums Expected was listed under, if known.
+	Key string
+	// LookedUp and Available are the keys that were looked up and the file
+	// names the checksums list, if the checksums don't list the asset.
+	LookedUp  []string
+	Available []string
+	// Err is the *checksum.ValidationError the validator returned, if any.
+	Err error
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	if e.Expected == "" {
+		if len(e.LookedUp) > 0 {
+			return fmt.Sprintf("%s: no checksum published for %s: looked up %s, the checksums list %s", ErrChecksumMismatch, e.Asset, strings.Join(e.LookedUp, ", "), strings.Join(e.Available, ", "))
+		}
+		return fmt.Sprintf("%s: no checksum published for %s", ErrChecksumMismatch, e.Asset)
+	}
+	if e.Key != "" && e.Key != strings.ToLower(e.Asset) {
+		return fmt.Sprintf("%s: %s has checksum %s, expected %s listed for %s", ErrChecksumMismatch, e.Asset, e.Actual, e.Expected, e.Key)
+	}
+	return fmt.Sprintf("%s: %s has checksum %s, expected %s", ErrChecksumMismatch, e.Asset, e.Actual, e.Expected)
+}
+
+func (e *ChecksumMismatchError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrChecksumMismatch}
+	}
+	return []error{ErrChecksumMismatch, e.Err}
+}
+
+// ErrUnsupportedArchive is returned when the release asset is an archive format that can't be extracted.
+var ErrUnsupportedArchive = errors.New("unsupported archive format")
+
+// ErrReplaceFailed is returned when the installed binaries couldn't be
+// replaced. The previous binaries are restored where possible.
+var ErrReplaceFailed = errors.New("failed to replace binary")
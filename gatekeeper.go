@@ -0,0 +1,41 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+)
+
+// Gatekeeper configures how new binaries are prepared for macOS Gatekeeper.
+// It has no effect on other platforms.
+type Gatekeeper struct {
+	// StripQuarantine removes the com.apple.quarantine attribute, where permitted.
+	StripQuarantine bool
+	// VerifyCodeSign requires the new binary to pass `codesign --verify --strict`.
+	VerifyCodeSign bool
+	// AssessNotarization requires the new binary to pass `spctl --assess --type execute`.
+	AssessNotarization bool
+}
+
+// ErrGatekeeperRejected is returned when a new binary fails code signature or notarization checks.
+var ErrGatekeeperRejected = errors.New("binary rejected by gatekeeper")
+
+// WithGatekeeper prepares new binaries for macOS Gatekeeper before they replace the current ones,
+// so that upgraded binaries aren't killed when they are next run.
+func WithGatekeeper(g Gatekeeper) Opt {
+	return func(u *upgrader) {
+		u.gatekeeper = &g
+	}
+}
+
+// prepareForGatekeeper applies u.gatekeeper to every staged binary.
+func (u *upgrader) prepareForGatekeeper(ctx context.Context, binaries map[string]string) error {
+	if u.gatekeeper == nil {
+		return nil
+	}
+	for _, p := range binaries {
+		if err := prepareForGatekeeper(ctx, *u.gatekeeper, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
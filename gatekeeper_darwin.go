@@ -0,0 +1,28 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const quarantineAttr = "com.apple.quarantine"
+
+func prepareForGatekeeper(ctx context.Context, g Gatekeeper, path string) error {
+	if g.StripQuarantine {
+		// best effort: the attribute may be missing or we may not be allowed to remove it
+		_ = exec.CommandContext(ctx, "xattr", "-d", quarantineAttr, path).Run()
+	}
+	if g.VerifyCodeSign {
+		if out, err := exec.CommandContext(ctx, "codesign", "--verify", "--strict", path).CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: codesign: %s", ErrGatekeeperRejected, strings.TrimSpace(string(out)))
+		}
+	}
+	if g.AssessNotarization {
+		if out, err := exec.CommandContext(ctx, "spctl", "--assess", "--type", "execute", path).CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: spctl: %s", ErrGatekeeperRejected, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
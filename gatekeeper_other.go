@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package upgrade
+
+import "context"
+
+func prepareForGatekeeper(ctx context.Context, g Gatekeeper, path string) error {
+	return nil
+}
@@ -0,0 +1,93 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// WithGoInstallFallback builds the release with `go install module@<tag>`
+// if it has no asset for the platform, instead of failing with ErrNoAsset,
+// so users on platforms without prebuilt binaries aren't stuck on an old
+// version. module is the import path of the main package, e.g.
+// "github.com/getsavvyinc/savvy-cli" or ".../cmd/savvy", and the release
+// tag must be a version of it. It needs a Go toolchain on the PATH.
+//
+// The binary can't be verified against the release checksums, since it is
+// built locally, so the fallback is only used with ChecksumWarn, which
+// reports an ErrChecksumNotVerified warning, or ChecksumSkip. The go command
+// verifies the module source as configured by the environment, e.g. GOSUMDB,
+// GONOSUMDB and GOFLAGS. The fallback isn't used with WithTrustStore or
+// WithTUF, whose signatures only cover the release assets, nor with
+// WithBinaries or WithArchiveFiles, since go install only builds one binary.
+func WithGoInstallFallback(module string) Opt {
+	return func(u *upgrader) {
+		u.goInstallModule = module
+	}
+}
+
+// goInstall builds and stages update with go install after the release
+// turned out to have no asset for the platform, which noAsset reports.
+func (u *upgrader) goInstall(ctx context.Context, noAsset error, update *Update, installPath string, env HookEnv, result *UpgradeResult) (*DownloadedUpdate, error) {
+	if u.trustStore != nil || u.tufClient != nil {
+		return nil, noAsset
+	}
+	if u.checksumPolicy == ChecksumRequire {
+		return nil, fmt.Errorf("%w, and go install builds can't be verified against checksums, see WithChecksumPolicy", noAsset)
+	}
+	if len(u.binaries) > 0 || len(u.archiveFiles) > 0 {
+		return nil, fmt.Errorf("%w, and go install can't build the binaries and files of WithBinaries and WithArchiveFiles", noAsset)
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return nil, fmt.Errorf("%w, and no Go toolchain to build it: %w", noAsset, err)
+	}
+
+	var temps tempFiles
+	defer temps.removeAll()
+
+	gobin, err := os.MkdirTemp(u.tempDir(), "upgrade-go-install-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create go install dir: %w", err)
+	}
+	temps.add(gobin)
+	version := u.tagVersion(update.Release.TagName)
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	target := u.goInstallModule + "@" + version
+	cmd := exec.CommandContext(ctx, goBin, "install", target)
+	cmd.Env = append(os.Environ(), "GOBIN="+gobin)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("go install %s failed: %w: %s", target, err, strings.TrimSpace(string(out)))
+	}
+	entries, err := os.ReadDir(gobin)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("go install %s installed %d files, expected a binary", target, len(entries))
+	}
+	built := filepath.Join(gobin, entries[0].Name())
+
+	d, err := u.stage(&temps, update, installPath, map[string]string{filepath.Base(u.executablePath): built})
+	if err != nil {
+		return nil, err
+	}
+	d.BuiltFrom = target
+	if u.checksumPolicy == ChecksumWarn {
+		d.Warnings = append(d.Warnings, fmt.Errorf("%w: built from %s", ErrChecksumNotVerified, target))
+	}
+
+	smokeEnv := env
+	smokeEnv.BinaryPath = d.Binaries[installPath]
+	smokeEnv.Binaries = map[string]string{filepath.Base(installPath): smokeEnv.BinaryPath}
+	if err := u.runPhase(ctx, result, SmokeTest, smokeEnv); err != nil {
+		return nil, err
+	}
+	temps.keep(d.Dir)
+	return d, nil
+}
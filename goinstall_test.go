@@ -0,0 +1,120 @@
+package upgrade
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeModuleProxy writes a GOPROXY serving version of a module with a
+// main package printing output.
+func writeModuleProxy(t *testing.T, module, version, output string) string {
+	t.Helper()
+	dir := t.TempDir()
+	versions := filepath.Join(dir, module, "@v")
+	require.NoError(t, os.MkdirAll(versions, 0o755))
+	gomod := "module " + module + "\n\ngo 1.21\n"
+	files := map[string]string{
+		"list":            version + "\n",
+		version + ".info": `{"Version":"` + version + `"}`,
+		version + ".mod":  gomod,
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(versions, name), []byte(content), 0o644))
+	}
+	f, err := os.Create(filepath.Join(versions, version+".zip"))
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"go.mod":  gomod,
+		"main.go": "package main\n\nfunc main() { println(\"" + output + "\") }\n",
+	} {
+		w, err := zw.Create(module + "@" + version + "/" + name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+	return "file://" + filepath.ToSlash(dir)
+}
+
+func TestGoInstallFallback(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no Go toolchain")
+	}
+	ctx := context.Background()
+	t.Setenv("GOPROXY", writeModuleProxy(t, "example.com/savvy", "v0.2.0", "savvy v0.2.0"))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "-modcacherw")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	t.Setenv("GOTOOLCHAIN", "local")
+
+	newUpgrader := func(t *testing.T, opts ...Opt) (*upgrader, string) {
+		executablePath := filepath.Join(t.TempDir(), "savvy")
+		require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+		opts = append([]Opt{WithAllowManagedInstall(), WithChecksumPolicy(ChecksumWarn)}, opts...)
+		u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath, opts...).(*upgrader)
+		// the release has no asset for any platform
+		u.releaseGetter = &fakeReleaseGetter{info: &release.Info{TagName: "v0.2.0"}}
+		return u, executablePath
+	}
+
+	t.Run("Built", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, WithGoInstallFallback("example.com/savvy"), WithVersionCheck("version"))
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.Equal(t, "example.com/savvy@v0.2.0", result.BuiltFrom)
+		assert.Equal(t, "example.com/savvy@v0.2.0", UpgradeReport(result, nil).BuiltFrom)
+		require.Len(t, result.Warnings, 1)
+		assert.ErrorIs(t, result.Warnings[0], ErrChecksumNotVerified)
+		out, err := exec.Command(executablePath).CombinedOutput()
+		require.NoError(t, err)
+		assert.Equal(t, "savvy v0.2.0\n", string(out))
+	})
+	t.Run("Staged", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, WithGoInstallFallback("example.com/savvy"))
+		update, err := u.Check(ctx, "0.1.0")
+		require.NoError(t, err)
+		d, err := u.Download(ctx, update)
+		require.NoError(t, err)
+		require.Len(t, d.Warnings, 1)
+		assert.ErrorIs(t, d.Warnings[0], ErrChecksumNotVerified)
+
+		result, err := u.Apply(ctx, d)
+		require.NoError(t, err)
+		require.Len(t, result.Warnings, 1)
+		assert.ErrorIs(t, result.Warnings[0], ErrChecksumNotVerified)
+		assert.NotEqual(t, "old", readFile(t, executablePath))
+	})
+	t.Run("BuildFails", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, WithGoInstallFallback("example.com/other"))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorContains(t, err, "go install example.com/other@v0.2.0 failed")
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("ChecksumsRequired", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, WithGoInstallFallback("example.com/savvy"), WithChecksumPolicy(ChecksumRequire))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrNoAsset)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("Binaries", func(t *testing.T) {
+		u, _ := newUpgrader(t, WithGoInstallFallback("example.com/savvy"), WithBinaries("savvy", "savvy-helper"))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrNoAsset)
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		u, _ := newUpgrader(t)
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrNoAsset)
+	})
+}
@@ -0,0 +1,199 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// HookPhase identifies the point of an upgrade at which a hook runs.
+type HookPhase string
+
+const (
+	// PreUpgrade hooks run before the new release is downloaded.
+	PreUpgrade HookPhase = "pre-upgrade"
+	// SmokeTest hooks run against the extracted candidate binary before it replaces the current one.
+	SmokeTest HookPhase = "smoke-test"
+	// Migration hooks run after the binary was replaced, before PostUpgrade hooks.
+	Migration HookPhase = "migration"
+	// PostUpgrade hooks run after the binary was replaced.
+	PostUpgrade HookPhase = "post-upgrade"
+)
+
+// DefaultHookTimeout bounds hooks that don't set a Timeout.
+const DefaultHookTimeout = time.Minute
+
+// maxHookOutput caps the output captured from a single hook.
+const maxHookOutput = 64 << 10
+
+// hookWaitDelay bounds how long a CommandHook waits for its output once it
+// is killed, which processes it started can keep open.
+const hookWaitDelay = time.Second
+
+// HookEnv describes the upgrade a hook runs for.
+type HookEnv struct {
+	Phase       HookPhase
+	FromVersion string
+	ToVersion   string
+	// BinaryPath is the candidate binary for SmokeTest hooks and the installed binary otherwise.
+	BinaryPath string
+	// Binaries maps binary names to their candidates for SmokeTest hooks when
+	// upgrading several binaries with WithBinaries.
+	Binaries map[string]string
+}
+
+// Hook is user provided code run during an upgrade.
+//
+// Each run is bounded by Timeout, panics are recovered, and anything written
+// to out is captured in the HookResult.
+type Hook struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context, env HookEnv, out io.Writer) error
+}
+
+// HookResult describes a single hook run.
+type HookResult struct {
+	Name     string
+	Phase    HookPhase
+	Duration time.Duration
+	Output   string
+	Err      error
+}
+
+var (
+	ErrHookFailed  = errors.New("hook failed")
+	ErrHookTimeout = errors.New("hook timed out")
+	ErrHookPanic   = errors.New("hook panicked")
+)
+
+// HookError is returned when a hook fails, aborting the upgrade.
+type HookError struct {
+	Result HookResult
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s: %s hook %q: %v", ErrHookFailed, e.Result.Phase, e.Result.Name, e.Result.Err)
+}
+
+func (e *HookError) Unwrap() []error {
+	return []error{ErrHookFailed, e.Result.Err}
+}
+
+// WithHooks registers hooks to run in phase, in order.
+func WithHooks(phase HookPhase, hooks ...Hook) Opt {
+	return func(u *upgrader) {
+		if u.hooks == nil {
+			u.hooks = make(map[HookPhase][]Hook)
+		}
+		u.hooks[phase] = append(u.hooks[phase], hooks...)
+	}
+}
+
+// CommandHook returns a Hook that runs an external command.
+// The hook environment is exposed to the command as UPGRADE_PHASE,
+// UPGRADE_FROM_VERSION, UPGRADE_TO_VERSION and UPGRADE_BINARY_PATH.
+func CommandHook(name string, timeout time.Duration, command string, args ...string) Hook {
+	return Hook{
+		Name:    name,
+		Timeout: timeout,
+		Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+			cmd := exec.CommandContext(ctx, command, args...)
+			cmd.Stdout = out
+			cmd.Stderr = out
+			cmd.WaitDelay = hookWaitDelay
+			cmd.Env = append(os.Environ(),
+				"UPGRADE_PHASE="+string(env.Phase),
+				"UPGRADE_FROM_VERSION="+env.FromVersion,
+				"UPGRADE_TO_VERSION="+env.ToVersion,
+				"UPGRADE_BINARY_PATH="+env.BinaryPath,
+			)
+			return cmd.Run()
+		},
+	}
+}
+
+// runHooks runs the hooks registered for env.Phase, stopping at the first failure.
+func (u *upgrader) runHooks(ctx context.Context, env HookEnv) ([]HookResult, error) {
+	var results []HookResult
+	for _, h := range u.hooks[env.Phase] {
+		r := runHook(ctx, h, env)
+		results = append(results, r)
+		if r.Err != nil {
+			return results, &HookError{Result: r}
+		}
+	}
+	return results, nil
+}
+
+func runHook(ctx context.Context, h Hook, env HookEnv) HookResult {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out := &limitedBuffer{limit: maxHookOutput}
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("%w: %v", ErrHookPanic, r)
+			}
+		}()
+		done <- h.Run(ctx, env, out)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// the hook goroutine is abandoned; a hook that ignores ctx can't block the upgrade
+		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s", ErrHookTimeout, timeout)
+		}
+	}
+
+	return HookResult{
+		Name:     h.Name,
+		Phase:    env.Phase,
+		Duration: time.Since(start),
+		Output:   out.String(),
+		Err:      err,
+	}
+}
+
+// limitedBuffer is a goroutine safe buffer that drops writes beyond limit.
+type limitedBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,105 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHooks(t *testing.T) {
+	ctx := context.Background()
+	env := HookEnv{Phase: PostUpgrade, FromVersion: "0.1.0", ToVersion: "0.2.0"}
+
+	t.Run("CapturesOutput", func(t *testing.T) {
+		u := &upgrader{}
+		WithHooks(PostUpgrade, Hook{
+			Name: "migrate",
+			Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+				fmt.Fprintf(out, "migrating %s -> %s", env.FromVersion, env.ToVersion)
+				return nil
+			},
+		})(u)
+		results, err := u.runHooks(ctx, env)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "migrating 0.1.0 -> 0.2.0", results[0].Output)
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+		u := &upgrader{}
+		WithHooks(PostUpgrade, Hook{
+			Name:    "hang",
+			Timeout: 10 * time.Millisecond,
+			Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+				<-block
+				return nil
+			},
+		})(u)
+		_, err := u.runHooks(ctx, env)
+		assert.ErrorIs(t, err, ErrHookFailed)
+		assert.ErrorIs(t, err, ErrHookTimeout)
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+		ctx, cancel := context.WithCancel(ctx)
+		u := &upgrader{}
+		WithHooks(PostUpgrade, Hook{
+			Name: "hang",
+			Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+				cancel()
+				<-block
+				return nil
+			},
+		})(u)
+		_, err := u.runHooks(ctx, env)
+		assert.ErrorIs(t, err, ErrHookFailed)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrHookTimeout, "a cancelled upgrade isn't a timeout")
+	})
+	t.Run("Panic", func(t *testing.T) {
+		u := &upgrader{}
+		ran := false
+		WithHooks(PostUpgrade, Hook{
+			Name: "panic",
+			Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+				panic("boom")
+			},
+		}, Hook{
+			Name: "never",
+			Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+				ran = true
+				return nil
+			},
+		})(u)
+		results, err := u.runHooks(ctx, env)
+		assert.ErrorIs(t, err, ErrHookPanic)
+		var hookErr *HookError
+		require.True(t, errors.As(err, &hookErr))
+		assert.Equal(t, "panic", hookErr.Result.Name)
+		assert.Len(t, results, 1)
+		assert.False(t, ran)
+	})
+}
+
+func TestCommandHookTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	// the background sleep keeps the output open after sh is killed
+	h := CommandHook("hang", 0, "sh", "-c", "sleep 30 & sleep 30")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := h.Run(ctx, HookEnv{Phase: PostUpgrade}, io.Discard)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
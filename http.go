@@ -0,0 +1,233 @@
+package upgrade
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// ErrUnsupportedTransport is returned by all requests if the TLS, pinning or
+// proxy options can't be applied to the Transport of the WithHTTPClient
+// client, which must be an *http.Transport for them.
+var ErrUnsupportedTransport = errors.New("the HTTP client's transport can't be configured")
+
+// WithHTTPClient sends all requests with c instead of http.DefaultClient,
+// e.g. to route them through a proxy. It has no effect on replaced
+// components, e.g. a release.Getter set with WithReleaseGetter.
+func WithHTTPClient(c *http.Client) Opt {
+	return func(u *upgrader) {
+		u.baseClient = c
+	}
+}
+
+// WithTLSConfig sends all requests with config, e.g. to present a client
+// certificate to an internal artifact mirror that requires mTLS. All
+// requests fail with ErrUnsupportedTransport if the Transport of the
+// WithHTTPClient client isn't an *http.Transport, which it can't be applied to.
+func WithTLSConfig(config *tls.Config) Opt {
+	return func(u *upgrader) {
+		u.tlsConfig = config
+	}
+}
+
+// WithCACertPool verifies server certificates against pool instead of the
+// system roots, e.g. in corporate networks that intercept TLS with a private
+// CA. It overrides the RootCAs of WithTLSConfig, and like it needs an
+// *http.Transport.
+func WithCACertPool(pool *x509.CertPool) Opt {
+	return func(u *upgrader) {
+		u.rootCAs = pool
+	}
+}
+
+// WithProxyURL sends all requests through the proxy at proxy instead of the
+// one set by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables,
+// which are honored by default. Credentials in its user info, e.g.
+// url.UserPassword(user, password), are sent as Proxy-Authorization basic
+// auth. Like WithTLSConfig, it fails all requests with
+// ErrUnsupportedTransport if the Transport of the WithHTTPClient client isn't
+// an *http.Transport.
+func WithProxyURL(proxy *url.URL) Opt {
+	return func(u *upgrader) {
+		u.proxyURL = proxy
+	}
+}
+
+// WithUserAgent sets the User-Agent header of all requests. GitHub asks API
+// clients to identify themselves, e.g. with "savvy-cli/0.2.0".
+func WithUserAgent(userAgent string) Opt {
+	return func(u *upgrader) {
+		u.userAgent = userAgent
+	}
+}
+
+// WithHeader adds a header to the requests sent to the API host, i.e. the
+// host of WithGitHubBaseURL or api.github.com, e.g. for an artifact proxy
+// that requires an auth header. It is also sent to the hosts assets are
+// rewritten to with WithURLRewrite, and to those of WithHeaderHosts.
+// Requests to other hosts, e.g. webhooks or the hosts release assets
+// redirect to, don't get it, since it may carry credentials. Headers set for
+// a specific request, e.g. the Authorization header of WithGitHubToken,
+// take precedence.
+func WithHeader(key, value string) Opt {
+	return func(u *upgrader) {
+		if u.header == nil {
+			u.header = http.Header{}
+		}
+		u.header.Add(key, value)
+	}
+}
+
+// WithHeaderHosts sends the headers of WithHeader to hosts too, e.g. an
+// artifact proxy assets are downloaded from. Hosts match with or without
+// their port, case-insensitively.
+func WithHeaderHosts(hosts ...string) Opt {
+	return func(u *upgrader) {
+		u.headerHosts = append(u.headerHosts, hosts...)
+	}
+}
+
+// WithGitHubBaseURL sets the URL of the GitHub API, e.g.
+// "https://github.example.com/api/v3" for GitHub Enterprise Server.
+// It has no effect when combined with WithReleaseGetter.
+func WithGitHubBaseURL(url string) Opt {
+	return func(u *upgrader) {
+		u.releaseOpts = append(u.releaseOpts, release.WithBaseURL(url))
+		u.githubBaseURL = url
+	}
+}
+
+// newHTTPClient returns the client all requests are sent with.
+func (u *upgrader) newHTTPClient() (*http.Client, error) {
+	c := u.baseClient
+	if c == nil {
+		c = http.DefaultClient
+	}
+	if len(u.header) == 0 && u.userAgent == "" && u.tlsConfig == nil && u.rootCAs == nil && u.pinnedKeys == nil && u.proxyURL == nil && u.allowedHosts == nil {
+		return c, nil
+	}
+	clone := *c
+	if u.tlsConfig != nil || u.rootCAs != nil || u.pinnedKeys != nil || u.proxyURL != nil {
+		t, err := u.transport(c.Transport)
+		if err != nil {
+			return nil, err
+		}
+		clone.Transport = t
+	}
+	if u.allowedHosts != nil {
+		hosts := u.allowedHosts
+		if base, err := url.Parse(u.githubBaseURL); err == nil && base.Host != "" {
+			hosts = append(hosts[:len(hosts):len(hosts)], base.Hostname())
+		}
+		clone.Transport = &allowlistTransport{base: clone.Transport, hosts: hosts}
+	}
+	if len(u.header) > 0 || u.userAgent != "" {
+		clone.Transport = &headerTransport{base: clone.Transport, hosts: u.headerTargets(), header: u.header, userAgent: u.userAgent}
+	}
+	return &clone, nil
+}
+
+// headerTargets returns the hosts the headers of WithHeader are sent to.
+func (u *upgrader) headerTargets() []string {
+	host := "api.github.com"
+	if base, err := url.Parse(u.githubBaseURL); err == nil && base.Host != "" {
+		host = base.Host
+	}
+	hosts := []string{host}
+	for _, r := range u.urlRewrites {
+		if to, err := url.Parse(r.to); err == nil && to.Host != "" {
+			hosts = append(hosts, to.Host)
+		}
+	}
+	return append(hosts, u.headerHosts...)
+}
+
+// transport returns a copy of base using the TLS, pinning and proxy options.
+func (u *upgrader) transport(base http.RoundTripper) (http.RoundTripper, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedTransport, base)
+	}
+	t = t.Clone()
+	if u.tlsConfig != nil || u.rootCAs != nil || u.pinnedKeys != nil {
+		config := &tls.Config{}
+		if u.tlsConfig != nil {
+			config = u.tlsConfig.Clone()
+		}
+		if u.rootCAs != nil {
+			config.RootCAs = u.rootCAs
+		}
+		if u.pinnedKeys != nil {
+			verify := config.VerifyConnection
+			config.VerifyConnection = func(cs tls.ConnectionState) error {
+				if verify != nil {
+					if err := verify(cs); err != nil {
+						return err
+					}
+				}
+				return u.verifyPins(cs)
+			}
+		}
+		t.TLSClientConfig = config
+	}
+	if u.proxyURL != nil {
+		t.Proxy = http.ProxyURL(u.proxyURL)
+	}
+	return t, nil
+}
+
+// errTransport fails every request with err.
+type errTransport struct {
+	err error
+}
+
+func (t errTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// headerTransport adds the user agent to every request and headers to the
+// requests to hosts that don't set them already. The host is checked for every
+// request, so redirects to other hosts don't get the headers.
+type headerTransport struct {
+	base      http.RoundTripper
+	hosts     []string
+	header    http.Header
+	userAgent string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	if t.match(req.URL) {
+		for key, values := range t.header {
+			if _, ok := req.Header[key]; !ok {
+				req.Header[key] = slices.Clone(values)
+			}
+		}
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// match reports whether the headers are sent to u, whose host matches one of
+// hosts with or without its port.
+func (t *headerTransport) match(u *url.URL) bool {
+	return slices.ContainsFunc(t.hosts, func(h string) bool {
+		return strings.EqualFold(u.Host, h) || strings.EqualFold(u.Hostname(), h)
+	})
+}
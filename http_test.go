@@ -0,0 +1,260 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSOptions(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Client-Cert", "false")
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Header().Set("X-Client-Cert", "true")
+		}
+		json.NewEncoder(w).Encode(release.Info{TagName: "v0.2.0"})
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	_, err := NewUpgrader("getsavvyinc", "savvy", "savvy", WithGitHubBaseURL(srv.URL)).(*upgrader).Check(ctx, "0.1.0")
+	require.Error(t, err, "the server's CA isn't trusted by default")
+
+	update, err := NewUpgrader("getsavvyinc", "savvy", "savvy", WithGitHubBaseURL(srv.URL), WithCACertPool(pool)).(*upgrader).Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+
+	// the pool overrides the RootCAs of the TLS config, whatever the order
+	cert := srv.TLS.Certificates[0]
+	u := NewUpgrader("getsavvyinc", "savvy", "savvy",
+		WithGitHubBaseURL(srv.URL),
+		WithCACertPool(pool),
+		WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		WithHeader("X-Mirror", "a"),
+	).(*upgrader)
+	_, err = u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+
+	resp, err := u.httpClient.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "true", resp.Header.Get("X-Client-Cert"))
+}
+
+func TestAllowedHosts(t *testing.T) {
+	ctx := context.Background()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(plain.Close)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, plain.URL, http.StatusFound)
+			return
+		}
+		json.NewEncoder(w).Encode(release.Info{TagName: "v0.2.0"})
+	}))
+	t.Cleanup(srv.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	u := NewUpgrader("getsavvyinc", "savvy", "savvy", WithGitHubBaseURL(srv.URL), WithCACertPool(pool), WithAllowedHosts()).(*upgrader)
+	_, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err, "the GitHub API host is allowed")
+
+	_, err = u.httpClient.Get(srv.URL + "/redirect")
+	assert.ErrorIs(t, err, ErrDisallowedURL, "plain HTTP redirects are refused")
+	_, err = u.httpClient.Get("https://example.com/savvy.tar.gz")
+	assert.ErrorIs(t, err, ErrDisallowedURL)
+
+	allowlist := &allowlistTransport{hosts: []string{"*.example.com", "GitHub.com"}}
+	for rawURL, allowed := range map[string]bool{
+		"https://github.com/o/r/releases":   true,
+		"https://mirror.example.com/a":      true,
+		"https://example.com/a":             false,
+		"https://evil-example.com/a":        false,
+		"https://github.com.evil.com/a":     false,
+		"http://github.com/o/r/releases":    false,
+		"https://github.com:8443/o/r/a.zip": true,
+	} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		assert.Equal(t, allowed, allowlist.check(u) == nil, rawURL)
+	}
+}
+
+func TestHeaderHost(t *testing.T) {
+	headers := make(map[string]http.Header)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers["other"] = r.Header
+	}))
+	t.Cleanup(other.Close)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, other.URL, http.StatusFound)
+			return
+		}
+		headers["api"] = r.Header
+	}))
+	t.Cleanup(srv.Close)
+
+	u := NewUpgrader("getsavvyinc", "savvy", "savvy",
+		WithGitHubBaseURL(srv.URL),
+		WithUserAgent("savvy/0.1.0"),
+		WithHeader("X-Proxy-Token", "secret"),
+	).(*upgrader)
+	for _, rawURL := range []string{srv.URL, srv.URL + "/redirect"} {
+		resp, err := u.httpClient.Get(rawURL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, "secret", headers["api"].Get("X-Proxy-Token"))
+	assert.Empty(t, headers["other"].Get("X-Proxy-Token"), "headers aren't sent to other hosts")
+	assert.Equal(t, "savvy/0.1.0", headers["other"].Get("User-Agent"))
+}
+
+func TestHeaderRewrittenHost(t *testing.T) {
+	assetName := fmt.Sprintf("savvy_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	archive, err := os.ReadFile(writeTarGz(t, map[string]string{"savvy": "new"}))
+	require.NoError(t, err)
+	var tokens []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("X-Proxy-Token"))
+		switch r.URL.Path {
+		case "/" + assetName:
+			w.Write(archive)
+		case "/checksums.txt":
+			sum := sha256.Sum256(archive)
+			fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(sum[:]), assetName)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(mirror.Close)
+
+	const download = "https://github.com/getsavvyinc/savvy-cli/releases/download/v0.2.0/"
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+	u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath,
+		WithAllowManagedInstall(),
+		WithReleaseGetter(&fakeReleaseGetter{info: &release.Info{
+			TagName: "v0.2.0",
+			Assets: []release.Asset{
+				{Name: assetName, BrowserDownloadURL: download + assetName, Size: int64(len(archive))},
+				{Name: "checksums.txt", BrowserDownloadURL: download + "checksums.txt"},
+			},
+		}}),
+		WithURLRewrite(download, mirror.URL+"/"),
+		WithHeader("X-Proxy-Token", "secret"),
+	).(*upgrader)
+
+	// the assets are downloaded from the mirror, which gets the headers
+	result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "new", readFile(t, executablePath))
+	require.NotEmpty(t, tokens)
+	for _, token := range tokens {
+		assert.Equal(t, "secret", token)
+	}
+
+	// so do the hosts of WithHeaderHosts, with or without their port
+	other := &headerTransport{hosts: []string{"proxy.example.com"}}
+	for rawURL, match := range map[string]bool{
+		"https://proxy.example.com/a":      true,
+		"https://PROXY.example.com:8443/a": true,
+		"https://example.com/a":            false,
+	} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		assert.Equal(t, match, other.match(u), rawURL)
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	var proxied *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r
+		json.NewEncoder(w).Encode(release.Info{TagName: "v0.2.0"})
+	}))
+	t.Cleanup(proxy.Close)
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	proxyURL.User = url.UserPassword("user", "secret")
+
+	u := NewUpgrader("getsavvyinc", "savvy", "savvy", WithGitHubBaseURL("http://github.invalid"), WithProxyURL(proxyURL)).(*upgrader)
+	update, err := u.Check(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+	require.NotNil(t, proxied)
+	assert.Equal(t, "github.invalid", proxied.Host)
+	username, password, ok := (&http.Request{Header: http.Header{"Authorization": proxied.Header["Proxy-Authorization"]}}).BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "secret", password)
+}
+
+func TestPinnedKeys(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(release.Info{TagName: "v0.2.0"})
+	}))
+	t.Cleanup(srv.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	const otherPin = "sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+	// pins are matched on the server name, so the server is reached as
+	// example.com, which its certificate is valid for
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+	}}
+	check := func(opts ...Opt) error {
+		opts = append([]Opt{WithHTTPClient(client), WithGitHubBaseURL("https://example.com"), WithCACertPool(pool)}, opts...)
+		_, err := NewUpgrader("getsavvyinc", "savvy", "savvy", opts...).(*upgrader).Check(ctx, "0.1.0")
+		return err
+	}
+
+	require.NoError(t, check(WithPinnedKeys("example.com", otherPin, "sha256/"+pin)))
+	assert.ErrorIs(t, check(WithPinnedKeys("example.com", otherPin)), ErrPinMismatch, "a trusted certificate with another key is refused")
+	assert.ErrorIs(t, check(WithPinnedKeys("*.com", otherPin)), ErrPinMismatch)
+	assert.NoError(t, check(WithPinnedKeys("*.github.com", otherPin)), "hosts that aren't pinned aren't checked")
+
+	// a server can present the pinned certificate without it being part of the verified chain
+	u := NewUpgrader("getsavvyinc", "savvy", "savvy", WithPinnedKeys("example.com", pin)).(*upgrader)
+	assert.ErrorIs(t, u.verifyPins(tls.ConnectionState{ServerName: "example.com", PeerCertificates: []*x509.Certificate{srv.Certificate()}}), ErrPinMismatch)
+
+	// pins can't be applied to a custom transport
+	custom := &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)}
+	_, err := NewUpgrader("getsavvyinc", "savvy", "savvy", WithHTTPClient(custom), WithPinnedKeys("example.com", pin)).(*upgrader).Check(ctx, "0.1.0")
+	assert.ErrorIs(t, err, ErrUnsupportedTransport)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,180 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// Installer configures how platform installers are run, see WithInstaller.
+type Installer struct {
+	// Extensions are the installer types to download, in order of
+	// preference. The default is ".msi" on Windows and ".pkg", ".dmg" on macOS.
+	Extensions []string
+	// Command returns the command that runs the installer at path. The
+	// default is InstallerCommand.
+	Command func(ctx context.Context, path string) *exec.Cmd
+	// Elevate, if set, is called with the command before it runs, e.g. to
+	// run it through sudo or an elevation prompt. It may return cmd itself
+	// or a new command wrapping it.
+	Elevate func(cmd *exec.Cmd) (*exec.Cmd, error)
+}
+
+// ErrInstallerFailed is returned when the installer of an update exits with an error, see WithInstaller.
+var ErrInstallerFailed = errors.New("installer failed")
+
+// runInstallerCommand is a variable for tests.
+var runInstallerCommand = func(cmd *exec.Cmd) ([]byte, error) {
+	return cmd.CombinedOutput()
+}
+
+// WithInstaller downloads the installer of the release for the platform,
+// e.g. a ".msi" or ".pkg" file, and runs it instead of replacing the
+// installed binaries, for projects that only ship installers or that have to
+// be installed by one. The installer must match the release checksums, even
+// with ChecksumWarn or ChecksumSkip, since it may run elevated. Extraction and SmokeTest hooks are skipped,
+// the PreUpgrade and PostUpgrade hooks run before and after the installer.
+//
+// The default command for ".dmg" and ".pkg" files opens them, so the
+// installation is completed by the user after Apply returns.
+func WithInstaller(i Installer) Opt {
+	return func(u *upgrader) {
+		if len(i.Extensions) == 0 {
+			i.Extensions = defaultInstallerExtensions(runtime.GOOS)
+		}
+		if i.Command == nil {
+			i.Command = InstallerCommand
+		}
+		u.installer = &i
+		if len(i.Extensions) == 0 {
+			// refused by the download, there's nothing to select
+			return
+		}
+		u.assetOpts = append(u.assetOpts,
+			asset.WithInclude(installerPattern(i.Extensions)),
+			asset.WithArchivePreference(i.Extensions...),
+		)
+	}
+}
+
+// checkInstaller returns an error if WithInstaller is set on a platform
+// without installer types, e.g. Linux, unless Installer.Extensions are given.
+func (u *upgrader) checkInstaller() error {
+	if u.installer != nil && len(u.installer.Extensions) == 0 {
+		return fmt.Errorf("no installer types are known for %s, see Installer.Extensions", runtime.GOOS)
+	}
+	return nil
+}
+
+// defaultInstallerExtensions returns the installer types of goos.
+func defaultInstallerExtensions(goos string) []string {
+	switch goos {
+	case "windows":
+		return []string{".msi"}
+	case "darwin":
+		return []string{".pkg", ".dmg"}
+	}
+	return nil
+}
+
+// installerPattern matches the names of assets ending with one of exts.
+func installerPattern(exts []string) *regexp.Regexp {
+	quoted := make([]string, len(exts))
+	for i, ext := range exts {
+		quoted[i] = regexp.QuoteMeta(strings.ToLower(ext))
+	}
+	return regexp.MustCompile(`(?i)(` + strings.Join(quoted, "|") + `)$`)
+}
+
+// InstallerCommand returns the default command that runs the installer at
+// path: "msiexec /i path /quiet /norestart" for ".msi" files and "open path"
+// for other installers, e.g. ".dmg" and ".pkg" files.
+func InstallerCommand(ctx context.Context, path string) *exec.Cmd {
+	if strings.EqualFold(filepath.Ext(path), ".msi") {
+		return exec.CommandContext(ctx, "msiexec", "/i", path, "/quiet", "/norestart")
+	}
+	return exec.CommandContext(ctx, "open", path)
+}
+
+// stageInstaller moves the downloaded installer into a dedicated directory
+// that outlives the download, like stage does for binaries.
+func (u *upgrader) stageInstaller(temps *tempFiles, update *Update, installPath string, downloadInfo *asset.Info, verified bool, warning error) (*DownloadedUpdate, error) {
+	if !verified {
+		return nil, errUnverifiedInstaller(warning)
+	}
+	dir, err := u.newStageDir()
+	if err != nil {
+		return nil, err
+	}
+	temps.add(dir)
+
+	staged := filepath.Join(dir, filepath.Base(downloadInfo.Name))
+	if err := moveFile(downloadInfo.DownloadedBinaryFilePath, staged); err != nil {
+		return nil, fmt.Errorf("failed to stage %s: %w", downloadInfo.Name, err)
+	}
+	digest, err := fileSHA256(staged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", downloadInfo.Name, err)
+	}
+	d := &DownloadedUpdate{
+		Update:         update,
+		ExecutablePath: installPath,
+		Dir:            dir,
+		Installer:      staged,
+		BinarySHA256:   map[string]string{staged: digest},
+		URL:            downloadInfo.URL,
+		Checksum:       downloadInfo.Checksum,
+		Size:           downloadInfo.Size,
+		Verified:       verified,
+	}
+	if warning != nil {
+		d.Warnings = append(d.Warnings, warning)
+	}
+	temps.keep(dir)
+	return d, nil
+}
+
+// errUnverifiedInstaller is returned for an installer that wasn't verified
+// against the release checksums because of warning.
+func errUnverifiedInstaller(warning error) error {
+	if warning == nil {
+		warning = ErrChecksumNotVerified
+	}
+	return fmt.Errorf("installers may run elevated, so they must match the release checksums: %w", warning)
+}
+
+// runInstaller runs the installer staged in d.
+func (u *upgrader) runInstaller(ctx context.Context, d *DownloadedUpdate) error {
+	i := u.installer
+	if i == nil {
+		return fmt.Errorf("%w: it runs an installer, but WithInstaller isn't set", ErrInvalidUpdate)
+	}
+	if !d.Verified {
+		return errUnverifiedInstaller(nil)
+	}
+	path := d.Installer
+	return inPhase(ctx, "installation", u.timeouts.Replace, func(ctx context.Context) error {
+		cmd := i.Command(ctx, path)
+		if i.Elevate != nil {
+			var err error
+			if cmd, err = i.Elevate(cmd); err != nil {
+				return fmt.Errorf("%w: failed to elevate: %w", ErrInstallerFailed, err)
+			}
+		}
+		out, err := runInstallerCommand(cmd)
+		if err != nil {
+			if out := strings.TrimSpace(string(out)); out != "" {
+				return fmt.Errorf("%w: %w: %s", ErrInstallerFailed, err, out)
+			}
+			return fmt.Errorf("%w: %w", ErrInstallerFailed, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,115 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstaller(t *testing.T) {
+	ctx := context.Background()
+	platform := fmt.Sprintf("savvy_%s_%s", runtime.GOOS, runtime.GOARCH)
+	content := map[string][]byte{
+		platform + ".tar.gz": []byte("archive"),
+		platform + ".msi":    []byte("installer"),
+	}
+	var checksums string
+	for name, c := range content {
+		sum := sha256.Sum256(c)
+		checksums += fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	content["checksums.txt"] = []byte(checksums)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content[path.Base(r.URL.Path)])
+	}))
+	t.Cleanup(srv.Close)
+	info := &release.Info{TagName: "v0.2.0"}
+	for _, name := range []string{platform + ".tar.gz", platform + ".msi", "checksums.txt"} {
+		info.Assets = append(info.Assets, release.Asset{Name: name, BrowserDownloadURL: srv.URL + "/" + name})
+	}
+
+	var ran [][]string
+	runInstallerCommand = func(cmd *exec.Cmd) ([]byte, error) {
+		installer, err := os.ReadFile(cmd.Args[len(cmd.Args)-1])
+		require.NoError(t, err)
+		assert.Equal(t, "installer", string(installer))
+		ran = append(ran, cmd.Args)
+		return nil, nil
+	}
+	t.Cleanup(func() {
+		runInstallerCommand = func(cmd *exec.Cmd) ([]byte, error) { return cmd.CombinedOutput() }
+	})
+
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+	u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath,
+		WithAllowManagedInstall(),
+		WithReleaseGetter(&fakeReleaseGetter{info: info}),
+		WithInstaller(Installer{
+			Extensions: []string{".msi"},
+			Command: func(ctx context.Context, path string) *exec.Cmd {
+				return exec.CommandContext(ctx, "msiexec", "/i", path)
+			},
+			Elevate: func(cmd *exec.Cmd) (*exec.Cmd, error) {
+				return exec.Command("sudo", cmd.Args...), nil
+			},
+		})).(*upgrader)
+
+	result, err := u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.True(t, result.ChecksumVerified)
+	assert.Equal(t, srv.URL+"/"+platform+".msi", result.AssetURL)
+	require.Len(t, ran, 1)
+	assert.Equal(t, []string{"sudo", "msiexec", "/i"}, ran[0][:3])
+	assert.Equal(t, platform+".msi", filepath.Base(ran[0][3]))
+	// the installer is responsible for the installed binary
+	assert.Equal(t, "old", readFile(t, executablePath))
+
+	runInstallerCommand = func(cmd *exec.Cmd) ([]byte, error) {
+		return []byte("another installation is in progress\n"), errors.New("exit status 1618")
+	}
+	result, err = u.UpgradeWithResult(ctx, "0.1.0")
+	assert.ErrorIs(t, err, ErrInstallerFailed)
+	assert.ErrorContains(t, err, "another installation is in progress")
+	assert.False(t, result.Upgraded)
+
+	t.Run("Unverified", func(t *testing.T) {
+		unverified := &release.Info{TagName: "v0.2.0", Assets: info.Assets[:2]}
+		u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath,
+			WithAllowManagedInstall(),
+			WithChecksumPolicy(ChecksumWarn),
+			WithReleaseGetter(&fakeReleaseGetter{info: unverified}),
+			WithInstaller(Installer{Extensions: []string{".msi"}})).(*upgrader)
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrChecksumNotVerified)
+	})
+	t.Run("NoInstallerTypes", func(t *testing.T) {
+		u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath,
+			WithAllowManagedInstall(),
+			WithReleaseGetter(&fakeReleaseGetter{info: info})).(*upgrader)
+		u.installer = &Installer{Command: InstallerCommand}
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorContains(t, err, "no installer types")
+	})
+}
+
+func TestInstallerCommand(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, []string{"msiexec", "/i", "savvy.MSI", "/quiet", "/norestart"}, InstallerCommand(ctx, "savvy.MSI").Args)
+	assert.Equal(t, []string{"open", "savvy.pkg"}, InstallerCommand(ctx, "savvy.pkg").Args)
+}
@@ -0,0 +1,113 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrBinaryModified is returned by Verify when an installed binary doesn't
+// match the release it was installed from, e.g. because it was corrupted on
+// disk or tampered with.
+var ErrBinaryModified = errors.New("installed binary doesn't match the release")
+
+// IntegrityVerifier is implemented by the Upgrader NewUpgrader returns, to
+// check the installed binary against its release, e.g. for a doctor command.
+type IntegrityVerifier interface {
+	// Verify checks that the installed binary is the one released as
+	// currentVersion. It returns an error wrapping ErrBinaryModified if not.
+	Verify(ctx context.Context, currentVersion string) error
+	// Repair reinstalls currentVersion if Verify fails.
+	Repair(ctx context.Context, currentVersion string) (*UpgradeResult, error)
+}
+
+var _ IntegrityVerifier = (*upgrader)(nil)
+
+// Verify checks that the installed binaries are the ones released as
+// currentVersion. It downloads and verifies the release asset like Upgrade,
+// then compares the binaries in it with the installed ones. It returns an
+// error wrapping ErrBinaryModified if they differ, and runs no hooks.
+func (u *upgrader) Verify(ctx context.Context, currentVersion string) error {
+	// verifying installs nothing, so the upgrade hooks don't apply
+	v := *u
+	v.hooks = nil
+	d, err := v.downloadVersion(ctx, currentVersion, &UpgradeResult{})
+	if err != nil {
+		return err
+	}
+	defer d.Discard()
+	return compareInstalled(d)
+}
+
+// Repair reinstalls currentVersion if Verify finds the installed binaries
+// modified, even if no newer version exists. The result has Upgraded set to
+// false if the binaries are intact.
+func (u *upgrader) Repair(ctx context.Context, currentVersion string) (*UpgradeResult, error) {
+	result, err := u.repair(ctx, currentVersion)
+	u.record(ctx, actionRepair, u.executablePath, result, err)
+	return result, err
+}
+
+func (u *upgrader) repair(ctx context.Context, currentVersion string) (*UpgradeResult, error) {
+	start := time.Now()
+	result := &UpgradeResult{PreviousVersion: currentVersion, NewVersion: currentVersion}
+	defer func() { result.Duration = time.Since(start) }()
+
+	if err := u.checkManagedInstall(ctx); err != nil {
+		return result, err
+	}
+
+	lock, err := acquireLock(u.executablePath)
+	if err != nil {
+		return result, err
+	}
+	defer lock.release()
+
+	d, err := u.downloadVersion(ctx, currentVersion, result)
+	if err != nil {
+		return result, err
+	}
+	defer d.Discard()
+
+	err = compareInstalled(d)
+	if err == nil {
+		return result, nil
+	}
+	if !errors.Is(err, ErrBinaryModified) {
+		return result, err
+	}
+	if err := u.apply(ctx, d, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// downloadVersion downloads and stages the release tagged version for the current executable.
+func (u *upgrader) downloadVersion(ctx context.Context, version string, result *UpgradeResult) (*DownloadedUpdate, error) {
+	releaseInfo, err := releaseByTag(ctx, u.releaseGetter, u.tagPrefix, version)
+	if err != nil {
+		return nil, err
+	}
+	update := &Update{CurrentVersion: version, LatestVersion: u.tagVersion(releaseInfo.TagName), Release: releaseInfo}
+	return u.download(ctx, update, u.executablePath, result)
+}
+
+// compareInstalled returns an error wrapping ErrBinaryModified unless every
+// binary staged in d is installed unchanged.
+func compareInstalled(d *DownloadedUpdate) error {
+	for dst, staged := range d.Binaries {
+		digest, err := fileSHA256(dst)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s is missing", ErrBinaryModified, dst)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", dst, err)
+		}
+		if expected := d.BinarySHA256[staged]; digest != expected {
+			return fmt.Errorf("%w: %s has checksum %s, expected %s", ErrBinaryModified, dst, digest, expected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package upgrade
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyAndRepair(t *testing.T) {
+	ctx := context.Background()
+	hookRan := false
+	hook := WithHooks(PreUpgrade, Hook{Name: "pre", Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+		hookRan = true
+		return nil
+	}})
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "intact"}, hook, WithJournal(journalPath))
+
+	// the test binary holds "old", as if it was corrupted
+	err := u.Verify(ctx, "v0.2.0")
+	assert.ErrorIs(t, err, ErrBinaryModified)
+	assert.False(t, hookRan)
+
+	result, err := u.Repair(ctx, "v0.2.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "v0.2.0", result.NewVersion)
+	assert.Equal(t, "intact", readFile(t, executablePath))
+	assert.NoError(t, u.Verify(ctx, "v0.2.0"))
+
+	result, err = u.Repair(ctx, "v0.2.0")
+	require.NoError(t, err)
+	assert.False(t, result.Upgraded)
+	entries, err := journal.New(journalPath).Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "repair", entries[0].Action)
+
+	require.NoError(t, os.Remove(executablePath))
+	assert.ErrorIs(t, u.Verify(ctx, "v0.2.0"), ErrBinaryModified)
+	assert.ErrorIs(t, u.Verify(ctx, "v0.3.0"), ErrNotFound)
+}
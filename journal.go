@@ -0,0 +1,70 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/journal"
+)
+
+// Actions recorded in the journal.
+const (
+	actionUpgrade = "upgrade"
+	actionApply   = "apply"
+	actionInstall = "install"
+	actionFile    = "upgrade-from-file"
+	actionRepair  = "repair"
+)
+
+// WithJournal records every upgrade, including failed attempts, in the
+// journal at path. Read it with journal.New(path).Entries(). Failing to
+// write the journal doesn't fail the upgrade, but adds a warning to the result.
+func WithJournal(path string) Opt {
+	return func(u *upgrader) {
+		u.journal = journal.New(path)
+	}
+}
+
+// record records the outcome of action in the journal and sends it to the
+// webhooks, see WithWebhook.
+func (u *upgrader) record(ctx context.Context, action, executablePath string, result *UpgradeResult, err error) {
+	u.recordJournal(action, executablePath, result, err)
+	u.sendWebhooks(ctx, action, executablePath, result, err)
+}
+
+// recordJournal records the outcome of action in the journal, unless
+// nothing was attempted because the binary is up to date.
+func (u *upgrader) recordJournal(action, executablePath string, result *UpgradeResult, err error) {
+	if u.journal == nil || result == nil {
+		return
+	}
+	e := journal.Entry{
+		Time:             time.Now().Add(-result.Duration),
+		Action:           action,
+		ExecutablePath:   executablePath,
+		FromVersion:      result.PreviousVersion,
+		ToVersion:        result.TargetVersion,
+		AssetURL:         result.AssetURL,
+		Checksum:         result.Checksum,
+		ChecksumVerified: result.ChecksumVerified,
+		PackageManager:   string(result.PackageManager),
+		Duration:         result.Duration,
+	}
+	switch {
+	case err != nil:
+		e.Status = journal.Failed
+		e.Error = err.Error()
+	case result.PackageManager != "":
+		e.Status = journal.Delegated
+		e.ToVersion = result.NewVersion
+	case result.Upgraded:
+		e.Status = journal.Upgraded
+		e.ToVersion = result.NewVersion
+	default:
+		return
+	}
+	if jerr := u.journal.Append(e); jerr != nil {
+		result.Warnings = append(result.Warnings, fmt.Errorf("failed to record upgrade in journal: %w", jerr))
+	}
+}
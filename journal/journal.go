@@ -0,0 +1,156 @@
+// Package journal keeps an append-only local log of upgrades, answering when
+// and to what a machine was upgraded, including failed attempts.
+//
+// Entries are stored as JSON lines, one per upgrade.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of an upgrade.
+type Status string
+
+const (
+	// Upgraded means the binary was replaced.
+	Upgraded Status = "upgraded"
+	// Delegated means the upgrade was delegated to a package manager.
+	Delegated Status = "delegated"
+	// Failed means the upgrade failed, Entry.Error says why.
+	Failed Status = "failed"
+)
+
+// Entry records one upgrade.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Action is the upgrader method that ran, e.g. "upgrade" or "install".
+	Action         string `json:"action"`
+	ExecutablePath string `json:"executable_path"`
+	FromVersion    string `json:"from_version,omitempty"`
+	ToVersion      string `json:"to_version,omitempty"`
+	AssetURL       string `json:"asset_url,omitempty"`
+	// Checksum is the sha256 checksum of the release asset.
+	Checksum         string        `json:"checksum,omitempty"`
+	ChecksumVerified bool          `json:"checksum_verified,omitempty"`
+	PackageManager   string        `json:"package_manager,omitempty"`
+	Status           Status        `json:"status"`
+	Error            string        `json:"error,omitempty"`
+	Duration         time.Duration `json:"duration"`
+}
+
+// Journal is an append-only log of upgrades stored in a file.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+}
+
+// New returns a Journal stored in the file at path, which is created on the first Append.
+func New(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Append adds e to the journal, replacing an entry a crash cut short.
+func (j *Journal) Append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create journal dir: %w", err)
+	}
+	f, err := os.OpenFile(j.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	if err := truncateTorn(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to repair journal: %w", err)
+	}
+	// a single write keeps entries of concurrent processes from interleaving
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return f.Close()
+}
+
+// truncateTorn removes an unterminated last line from f, which a crash while
+// appending left behind, so the next entry doesn't continue it.
+func truncateTorn(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	end := fi.Size()
+	buf := make([]byte, 4096)
+	for off := end; off > 0; {
+		n := int64(len(buf))
+		if off < n {
+			n = off
+		}
+		off -= n
+		if _, err := f.ReadAt(buf[:n], off); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			if last := off + int64(i) + 1; last < end {
+				return f.Truncate(last)
+			}
+			return nil
+		}
+	}
+	// no line was ever completed
+	if end > 0 {
+		return f.Truncate(0)
+	}
+	return nil
+}
+
+// Entries returns every entry, oldest first. A journal that doesn't exist yet has no entries.
+func (j *Journal) Entries() ([]Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// an unterminated last line was cut short by a crash while appending
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("failed to parse journal %s line %d: %w", j.path, n, err)
+		}
+		entries = append(entries, e)
+	}
+}
@@ -0,0 +1,48 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "journal.jsonl")
+	j := New(path)
+
+	entries, err := j.Entries()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	first := Entry{Time: time.Unix(100, 0).UTC(), Action: "upgrade", FromVersion: "0.1.0", ToVersion: "0.2.0", Status: Upgraded}
+	second := Entry{Time: time.Unix(200, 0).UTC(), Action: "upgrade", FromVersion: "0.2.0", ToVersion: "0.3.0", Status: Failed, Error: "checksum mismatch"}
+	require.NoError(t, j.Append(first))
+	require.NoError(t, New(path).Append(second))
+
+	entries, err = j.Entries()
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{first, second}, entries)
+
+	t.Run("TruncatedEntry", func(t *testing.T) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"time":"2024-`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		entries, err := j.Entries()
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+
+		// the next entry replaces the truncated one
+		third := Entry{Time: time.Unix(300, 0).UTC(), Action: "upgrade", Status: Upgraded}
+		require.NoError(t, j.Append(third))
+		entries, err = j.Entries()
+		require.NoError(t, err)
+		assert.Equal(t, []Entry{first, second, third}, entries)
+	})
+}
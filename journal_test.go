@@ -0,0 +1,40 @@
+package upgrade
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithJournal(path))
+
+	_, err := u.Install(ctx, "v0.3.0", filepath.Join(t.TempDir(), "savvy"))
+	require.Error(t, err)
+	result, err := u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	require.True(t, result.Upgraded)
+	// checks that find no update aren't recorded
+	_, err = u.UpgradeWithResult(ctx, "0.2.0")
+	require.NoError(t, err)
+
+	entries, err := journal.New(path).Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, journal.Failed, entries[0].Status)
+	assert.Equal(t, "install", entries[0].Action)
+	assert.NotEmpty(t, entries[0].Error)
+
+	assert.Equal(t, journal.Upgraded, entries[1].Status)
+	assert.Equal(t, executablePath, entries[1].ExecutablePath)
+	assert.Equal(t, "0.1.0", entries[1].FromVersion)
+	assert.Equal(t, "v0.2.0", entries[1].ToVersion)
+	assert.Equal(t, result.Checksum, entries[1].Checksum)
+	assert.True(t, entries[1].ChecksumVerified)
+}
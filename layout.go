@@ -0,0 +1,404 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// Layout keeps every installed version in its own directory under Root,
+// e.g. Root/versions/1.2.3/savvy, and points the Root/current symlink at the
+// active one, like nvm or rustup. The executable is a symlink to
+// Root/current/<name>, so switching versions is a single atomic rename and
+// rolling back doesn't download anything.
+//
+// Symlinks are required, so Layout isn't supported on Windows. Previous
+// versions are kept until they are pruned, see WithRetention.
+type Layout struct {
+	Root string
+	// Scheme orders the installed versions, Semver if nil. WithVersionedLayout
+	// defaults it to the upgrader's version scheme.
+	Scheme VersionScheme
+	// Key, if set, signs layout.json, which records the digests of every
+	// installed version, with an HMAC-SHA256, like Slots.Key. Switch then
+	// also refuses versions without recorded digests, and a missing
+	// layout.json once a version is installed.
+	Key []byte
+}
+
+// layoutState is the state of a Layout, kept in Root/layout.json.
+type layoutState struct {
+	// Digests maps each version directory to the sha256 digests of its
+	// binaries, keyed on their name. Switch refuses a version that changed.
+	Digests map[string]map[string]string `json:"digests,omitempty"`
+	// MAC is the signature of the state, see Layout.Key.
+	MAC string `json:"mac,omitempty"`
+}
+
+const (
+	currentLink = "current"
+	versionsDir = "versions"
+	layoutFile  = "layout.json"
+)
+
+var (
+	// ErrVersionNotInstalled is returned by Layout.Switch for a version that isn't installed.
+	ErrVersionNotInstalled = errors.New("version is not installed")
+	// ErrVersionTampered is returned by Layout.Switch if layout.json doesn't
+	// match its signature, see Layout.Key, or the binaries of the version
+	// don't match the digests recorded when it was installed.
+	ErrVersionTampered = errors.New("the installed version was modified outside the upgrader")
+)
+
+// WithVersionedLayout installs upgrades into l instead of replacing the
+// executable. On the first upgrade, the executable is replaced with a
+// symlink and the binary it was is kept as the current version. Install to
+// another path replaces the binary there, without touching l. It can't be
+// combined with WithSlots.
+func WithVersionedLayout(l Layout) Opt {
+	return func(u *upgrader) {
+		u.layout = &l
+	}
+}
+
+// Versions returns the installed versions, newest first.
+func (l Layout) Versions() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(l.Root, versionsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+	var versions []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			versions = append(versions, e.Name())
+		}
+	}
+	scheme := l.Scheme
+	if scheme == nil {
+		scheme = Semver
+	}
+	slices.SortFunc(versions, func(a, b string) int {
+		va, errA := scheme.Parse(a)
+		vb, errB := scheme.Parse(b)
+		switch {
+		case errA == nil && errB == nil:
+			return scheme.Compare(vb, va)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			return strings.Compare(b, a)
+		}
+	})
+	return versions, nil
+}
+
+// Current returns the active version, or "" if none is installed yet.
+func (l Layout) Current() (string, error) {
+	target, err := os.Readlink(filepath.Join(l.Root, currentLink))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read current version: %w", err)
+	}
+	return filepath.Base(target), nil
+}
+
+// Switch makes the installed version v the active one, e.g. to roll back,
+// after verifying its binaries against the digests recorded when it was
+// installed.
+func (l Layout) Switch(v string) error {
+	dir, err := l.versionDir(v)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrVersionNotInstalled, v)
+	}
+	st, err := l.state()
+	if err != nil {
+		return err
+	}
+	if err := l.verify(filepath.Base(dir), st.Digests[filepath.Base(dir)]); err != nil {
+		return err
+	}
+	return l.activate(filepath.Base(dir))
+}
+
+// versionDir returns the directory version v is installed in.
+func (l Layout) versionDir(v string) (string, error) {
+	name := strings.TrimPrefix(v, "v")
+	if name == "" || name == "." || name == ".." || strings.HasPrefix(name, ".") || filepath.Base(name) != name {
+		return "", fmt.Errorf("invalid version %q", v)
+	}
+	return filepath.Join(l.Root, versionsDir, name), nil
+}
+
+// activate atomically points the current symlink at the version directory name.
+func (l Layout) activate(name string) error {
+	if err := symlinkAtomic(filepath.Join(versionsDir, name), filepath.Join(l.Root, currentLink)); err != nil {
+		return fmt.Errorf("failed to switch current version: %w", err)
+	}
+	return nil
+}
+
+// symlinkAtomic makes link a symlink to target, replacing it atomically.
+func symlinkAtomic(target, link string) error {
+	tmp := link + ".new"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(link))
+}
+
+// install installs the new binaries of version to, keyed on their
+// destination, activates it and links the destinations to it. A
+// destination that is a regular binary is kept as version from.
+func (l Layout) install(ctx context.Context, from, to string, binaries map[string]string) error {
+	dir, err := l.versionDir(to)
+	if err != nil {
+		return err
+	}
+	// read the state before the version directory exists, which would make
+	// a missing state look tampered with
+	st, err := l.state()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create version dir: %w", err)
+	}
+	inDir := make(map[string]string, len(binaries))
+	for dst, staged := range binaries {
+		inDir[filepath.Join(dir, filepath.Base(dst))] = staged
+	}
+	if err := replaceBinaries(ctx, inDir); err != nil {
+		return err
+	}
+	if err := l.record(st, filepath.Base(dir)); err != nil {
+		return err
+	}
+	if err := l.save(st); err != nil {
+		return err
+	}
+	if err := l.activate(filepath.Base(dir)); err != nil {
+		return err
+	}
+	adopted := false
+	for dst := range binaries {
+		ok, err := l.link(dst, from)
+		if err != nil {
+			return err
+		}
+		adopted = adopted || ok
+	}
+	// the binaries installed before the layout was used are recorded as
+	// they were adopted, so switching back to them is verified too
+	if fromDir, err := l.versionDir(from); adopted && err == nil {
+		if _, ok := st.Digests[filepath.Base(fromDir)]; !ok {
+			if err := l.record(st, filepath.Base(fromDir)); err != nil {
+				return err
+			}
+			return l.save(st)
+		}
+	}
+	return nil
+}
+
+// link makes dst a symlink to its binary in the current version. It
+// returns true if the binary at dst was adopted as version from.
+func (l Layout) link(dst, from string) (bool, error) {
+	target := filepath.Join(l.Root, currentLink, filepath.Base(dst))
+	if t, err := os.Readlink(dst); err == nil && t == target {
+		return false, nil
+	}
+	adopted := false
+	if fi, err := os.Lstat(dst); err == nil && fi.Mode().IsRegular() {
+		adopted = l.adopt(dst, from)
+	}
+	if err := symlinkAtomic(target, dst); err != nil {
+		return adopted, fmt.Errorf("failed to link %s: %w", dst, err)
+	}
+	return adopted, nil
+}
+
+// adopt keeps the binary at dst, installed before the layout was used, as
+// version from so that it can be switched back to. It is best effort and
+// returns whether it succeeded.
+func (l Layout) adopt(dst, from string) bool {
+	dir, err := l.versionDir(from)
+	if err != nil {
+		return false
+	}
+	p := filepath.Join(dir, filepath.Base(dst))
+	if _, err := os.Lstat(p); err == nil {
+		return false
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false
+	}
+	if err := os.Link(dst, p); err != nil {
+		return copyFile(dst, p, 0o755) == nil
+	}
+	return true
+}
+
+// state returns the state of the layout. It is empty if nothing was
+// installed into it yet. With Key set, a missing state is only accepted
+// before any version is installed, since deleting it would otherwise skip
+// the verification of every version.
+func (l Layout) state() (*layoutState, error) {
+	data, err := os.ReadFile(filepath.Join(l.Root, layoutFile))
+	if errors.Is(err, os.ErrNotExist) {
+		if l.Key != nil {
+			versions, err := l.Versions()
+			if err != nil {
+				return nil, err
+			}
+			if len(versions) > 0 {
+				return nil, fmt.Errorf("%w: %s is missing", ErrVersionTampered, layoutFile)
+			}
+		}
+		return &layoutState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout state: %w", err)
+	}
+	st := &layoutState{}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("failed to read layout state: %w", err)
+	}
+	if l.Key != nil {
+		ok, err := checkMAC(l.Key, st, &st.MAC)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: the signature of %s doesn't match", ErrVersionTampered, layoutFile)
+		}
+	}
+	return st, nil
+}
+
+// record records the digests of the binaries in the version directory name in st.
+func (l Layout) record(st *layoutState, name string) error {
+	digests, err := slotDigests(filepath.Join(l.Root, versionsDir, name))
+	if err != nil {
+		return fmt.Errorf("failed to hash version %s: %w", name, err)
+	}
+	if st.Digests == nil {
+		st.Digests = make(map[string]map[string]string)
+	}
+	st.Digests[name] = digests
+	return nil
+}
+
+// verify checks that the binaries in the version directory name match the
+// digests recorded for it. Without Key, versions installed before digests
+// were recorded aren't checked.
+func (l Layout) verify(name string, recorded map[string]string) error {
+	if recorded == nil {
+		if l.Key != nil {
+			return fmt.Errorf("%w: no digests are recorded for version %s", ErrVersionTampered, name)
+		}
+		return nil
+	}
+	digests, err := slotDigests(filepath.Join(l.Root, versionsDir, name))
+	if err != nil {
+		return fmt.Errorf("failed to hash version %s: %w", name, err)
+	}
+	if !maps.Equal(digests, recorded) {
+		return fmt.Errorf("%w: the binaries of version %s changed", ErrVersionTampered, name)
+	}
+	return nil
+}
+
+// save atomically writes st, signed with Key if set.
+func (l Layout) save(st *layoutState) error {
+	st.MAC = ""
+	if l.Key != nil {
+		mac, err := state.Sign(l.Key, st)
+		if err != nil {
+			return err
+		}
+		st.MAC = mac
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(l.Root, layoutFile), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write layout state: %w", err)
+	}
+	return nil
+}
+
+// prune removes the versions r doesn't retain, never the current one. The
+// age of a version is the time it was installed.
+func (l Layout) prune(r Retention, now time.Time) error {
+	versions, err := l.Versions()
+	if err != nil {
+		return err
+	}
+	current, err := l.Current()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	var removed []string
+	i := 0
+	for _, v := range versions {
+		if v == current {
+			continue
+		}
+		dir := filepath.Join(l.Root, versionsDir, v)
+		fi, err := os.Stat(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if r.expired(i, fi.ModTime(), now) {
+			if err := os.RemoveAll(dir); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed = append(removed, v)
+		}
+		i++
+	}
+	if len(removed) > 0 {
+		errs = append(errs, l.forget(removed))
+	}
+	return errors.Join(errs...)
+}
+
+// forget removes the digests recorded for the version directories names.
+func (l Layout) forget(names []string) error {
+	st, err := l.state()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		delete(st.Digests, name)
+	}
+	return l.save(st)
+}
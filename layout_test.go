@@ -0,0 +1,118 @@
+//go:build unix
+
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionedLayout(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("SwitchVersions", func(t *testing.T) {
+		l := Layout{Root: t.TempDir()}
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithVersionedLayout(l))
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+
+		target, err := os.Readlink(executablePath)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(l.Root, "current", "savvy"), target)
+		assert.Equal(t, "new", readFile(t, executablePath))
+
+		// the binary installed before is kept as the previous version
+		versions, err := l.Versions()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"0.2.0", "0.1.0"}, versions)
+		current, err := l.Current()
+		require.NoError(t, err)
+		assert.Equal(t, "0.2.0", current)
+
+		require.NoError(t, l.Switch("v0.1.0"))
+		assert.Equal(t, "old", readFile(t, executablePath))
+		assert.ErrorIs(t, l.Switch("0.3.0"), ErrVersionNotInstalled)
+		assert.Error(t, l.Switch("../0.1.0"))
+	})
+	t.Run("Tampered", func(t *testing.T) {
+		l := Layout{Root: t.TempDir(), Key: []byte("secret")}
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithVersionedLayout(l))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+
+		// the adopted binary is recorded, so swapping it is detected
+		previous := filepath.Join(l.Root, "versions", "0.1.0", "savvy")
+		require.NoError(t, os.Remove(previous))
+		require.NoError(t, os.WriteFile(previous, []byte("evil"), 0o755))
+		assert.ErrorIs(t, l.Switch("0.1.0"), ErrVersionTampered)
+		assert.Equal(t, "new", readFile(t, executablePath))
+
+		// so is editing the recorded digests
+		require.NoError(t, os.WriteFile(filepath.Join(l.Root, "layout.json"), []byte(`{"digests":{}}`), 0o644))
+		assert.ErrorIs(t, l.Switch("0.1.0"), ErrVersionTampered)
+		assert.Equal(t, "new", readFile(t, executablePath))
+
+		// and deleting them
+		require.NoError(t, os.Remove(filepath.Join(l.Root, "layout.json")))
+		assert.ErrorIs(t, l.Switch("0.1.0"), ErrVersionTampered)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("Unrecorded", func(t *testing.T) {
+		l := Layout{Root: t.TempDir(), Key: []byte("secret")}
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithVersionedLayout(l))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+
+		// a version that wasn't installed by the upgrader has no digests
+		planted := filepath.Join(l.Root, "versions", "0.0.9")
+		require.NoError(t, os.MkdirAll(planted, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(planted, "savvy"), []byte("evil"), 0o755))
+		assert.ErrorIs(t, l.Switch("0.0.9"), ErrVersionTampered)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("Retention", func(t *testing.T) {
+		l := Layout{Root: t.TempDir()}
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithVersionedLayout(l), WithRetention(Retention{KeepLast: 1}))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		versions, err := l.Versions()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"0.2.0"}, versions)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("InstallElsewhere", func(t *testing.T) {
+		l := Layout{Root: t.TempDir()}
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithVersionedLayout(l))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		require.NoError(t, l.Switch("0.1.0"))
+
+		// installing to another path leaves the layout and executable alone
+		dest := filepath.Join(t.TempDir(), "savvy")
+		_, err = u.Install(ctx, "v0.2.0", dest)
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, dest))
+		fi, err := os.Lstat(dest)
+		require.NoError(t, err)
+		assert.True(t, fi.Mode().IsRegular())
+		current, err := l.Current()
+		require.NoError(t, err)
+		assert.Equal(t, "0.1.0", current)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("VersionScheme", func(t *testing.T) {
+		l := Layout{Root: t.TempDir(), Scheme: CalVer}
+		for _, v := range []string{"2024_06_1", "2024_10_1", "2024_9_1"} {
+			require.NoError(t, os.MkdirAll(filepath.Join(l.Root, "versions", v), 0o755))
+		}
+		versions, err := l.Versions()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2024_10_1", "2024_9_1", "2024_06_1"}, versions)
+	})
+}
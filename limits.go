@@ -0,0 +1,90 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// DefaultMaxDecompressionRatio is how many times larger than the release
+// asset the files extracted from it may be, see WithMaxDecompressionRatio.
+// Binaries rarely compress more than 10x.
+const DefaultMaxDecompressionRatio = 100
+
+// ErrDecompressionLimit is returned when the files extracted from an archive
+// are larger than allowed by WithMaxDecompressionRatio.
+var ErrDecompressionLimit = errors.New("archive exceeds the decompression limit")
+
+// WithMaxAssetSize fails the upgrade with an *AssetTooLargeError if the
+// release asset is larger than max bytes, before downloading it if its size
+// is known, so that a broken release or a hijacked URL can't fill the disk.
+// It applies to the default asset downloader.
+func WithMaxAssetSize(max int64) Opt {
+	return func(u *upgrader) {
+		u.maxAssetSize = max
+		u.assetOpts = append(u.assetOpts, asset.WithMaxSize(max))
+	}
+}
+
+// WithMaxDecompressionRatio fails the upgrade with ErrDecompressionLimit if
+// the files extracted from the release archive are more than ratio times
+// larger than the archive, guarding against archive bombs. It is
+// DefaultMaxDecompressionRatio by default, and a ratio of zero or less
+// removes the limit.
+func WithMaxDecompressionRatio(ratio int) Opt {
+	return func(u *upgrader) {
+		u.maxRatio = ratio
+	}
+}
+
+// extractLimit returns how many bytes may be extracted from an archive of
+// size bytes, or 0 if there is no limit.
+func (u *upgrader) extractLimit(size int64) int64 {
+	if u.maxRatio <= 0 || size <= 0 {
+		return 0
+	}
+	return size * int64(u.maxRatio)
+}
+
+// limitedExtraction counts the bytes extracted from an archive and fails
+// once they exceed max, unless max is 0.
+type limitedExtraction struct {
+	max int64
+	n   int64
+}
+
+// reader returns r, reading from which fails with ErrDecompressionLimit
+// once the bytes read from every reader returned exceed the limit.
+func (l *limitedExtraction) reader(r io.Reader) io.Reader {
+	if l.max <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, l: l}
+}
+
+type limitedReader struct {
+	r io.Reader
+	l *limitedExtraction
+}
+
+func (lr *limitedReader) Read(b []byte) (int, error) {
+	if lr.l.n > lr.l.max {
+		return 0, lr.l.err()
+	}
+	// read at most one byte past the limit, to tell whether it's exceeded
+	if remaining := lr.l.max - lr.l.n + 1; int64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	n, err := lr.r.Read(b)
+	lr.l.n += int64(n)
+	if lr.l.n > lr.l.max {
+		return n, lr.l.err()
+	}
+	return n, err
+}
+
+func (l *limitedExtraction) err() error {
+	return fmt.Errorf("%w: extracted more than %d bytes", ErrDecompressionLimit, l.max)
+}
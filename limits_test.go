@@ -0,0 +1,47 @@
+package upgrade
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxAssetSize(t *testing.T) {
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithMaxAssetSize(16))
+	_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	var tooLarge *AssetTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.ErrorIs(t, err, ErrAssetTooLarge)
+	assert.Equal(t, int64(16), tooLarge.Max)
+	assert.Equal(t, "old", readFile(t, executablePath))
+}
+
+func TestMaxDecompressionRatio(t *testing.T) {
+	bomb := map[string]string{"savvy": strings.Repeat("\x00", 8<<20)}
+
+	t.Run("Streamed", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", bomb)
+		_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		assert.ErrorIs(t, err, ErrDecompressionLimit)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("Downloaded", func(t *testing.T) {
+		arPath := writeTarGz(t, bomb)
+		_, err := tryUnArchive(t.TempDir(), prefixEntries("savvy"), 1<<20, arPath, ".tar.gz")
+		assert.ErrorIs(t, err, ErrDecompressionLimit)
+
+		arPath = writeZip(t, bomb)
+		_, err = tryUnArchive(t.TempDir(), prefixEntries("savvy"), 1<<20, arPath, ".zip")
+		assert.ErrorIs(t, err, ErrDecompressionLimit)
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", bomb, WithMaxDecompressionRatio(0))
+		result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.Len(t, readFile(t, executablePath), 8<<20)
+	})
+}
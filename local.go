@@ -0,0 +1,416 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/getsavvyinc/upgrade-cli/trust"
+)
+
+// FileOpt configures UpgradeFromFile.
+type FileOpt func(*localSource)
+
+// FileVersion sets the version of the local asset, which is reported to hooks and receipts.
+func FileVersion(version string) FileOpt {
+	return func(s *localSource) {
+		s.version = version
+	}
+}
+
+// FileCurrentVersion sets the installed version. UpgradeFromFile refuses a
+// local asset older than it, see FileAllowDowngrade. With WithVersionedLayout
+// or WithSlots, it defaults to their active version.
+func FileCurrentVersion(version string) FileOpt {
+	return func(s *localSource) {
+		s.current = version
+	}
+}
+
+// FileAllowDowngrade lets UpgradeFromFile install a local asset that is
+// older than the installed version.
+func FileAllowDowngrade() FileOpt {
+	return func(s *localSource) {
+		s.downgrade = true
+	}
+}
+
+// FileChecksums verifies the local asset against the checksums file at path,
+// e.g. a checksums.txt or a "<asset>.sha256" file.
+func FileChecksums(path string) FileOpt {
+	return func(s *localSource) {
+		s.checksums = path
+	}
+}
+
+// FileSignature verifies the local asset against the signature at path, e.g.
+// "<asset>.minisig", with the keys of WithTrustStore.
+func FileSignature(path string) FileOpt {
+	return func(s *localSource) {
+		s.signature = path
+	}
+}
+
+// localSource describes a release asset on disk and the files to verify it with.
+type localSource struct {
+	asset     string
+	version   string
+	current   string
+	downgrade bool
+	checksums string
+	signature string
+	// digests are the SHA256 digests of the assets of a bundle, keyed on
+	// their name, see ImportAndUpgrade.
+	digests map[string]string
+}
+
+// FileUpgrader is implemented by the Upgrader NewUpgrader returns.
+type FileUpgrader interface {
+	// UpgradeFromFile upgrades the current binary from a release asset on
+	// disk instead of downloading it, e.g. in air-gapped networks.
+	UpgradeFromFile(ctx context.Context, path string, opts ...FileOpt) (*UpgradeResult, error)
+}
+
+var _ FileUpgrader = (*upgrader)(nil)
+
+// UpgradeFromFile upgrades the current binary from the release asset at path,
+// e.g. one copied to an air-gapped machine. If path is a directory, the asset
+// for the platform is selected from the files in it, and checksums and
+// signatures next to it are used unless set with FileChecksums and FileSignature.
+//
+// The asset is verified according to the checksum policy, WithTrustStore and
+// WithTUF, whose persisted metadata isn't refreshed, and installed like a
+// downloaded one. Its version, see FileVersion, is required with
+// WithVersionedLayout and WithSlots, and an older version than the installed
+// one fails with a *DowngradeError unless FileAllowDowngrade is passed.
+func (u *upgrader) UpgradeFromFile(ctx context.Context, path string, opts ...FileOpt) (*UpgradeResult, error) {
+	result, err := u.upgradeFromFile(ctx, path, opts...)
+	u.record(ctx, actionFile, u.executablePath, result, err)
+	return result, err
+}
+
+func (u *upgrader) upgradeFromFile(ctx context.Context, path string, opts ...FileOpt) (*UpgradeResult, error) {
+	start := time.Now()
+	result := &UpgradeResult{}
+	defer func() { result.Duration = time.Since(start) }()
+
+	src := &localSource{asset: path}
+	for _, opt := range opts {
+		opt(src)
+	}
+	result.NewVersion = src.version
+	if err := u.checkLocalVersion(src); err != nil {
+		return result, err
+	}
+	result.PreviousVersion = src.current
+	fi, err := os.Stat(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to open local asset: %w", err)
+	}
+	if fi.IsDir() {
+		if err := u.selectLocalAsset(ctx, src); err != nil {
+			return result, err
+		}
+	}
+
+	if err := u.checkManagedInstall(ctx); err != nil {
+		return result, err
+	}
+	lock, err := acquireLock(u.executablePath)
+	if err != nil {
+		return result, err
+	}
+	defer lock.release()
+
+	update := &Update{CurrentVersion: src.current, LatestVersion: src.version, Available: true, Release: &release.Info{TagName: src.version}}
+	d, err := u.prepareLocal(ctx, update, src, result)
+	if err != nil {
+		return result, err
+	}
+	defer d.Discard()
+
+	if err := u.apply(ctx, d, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// checkLocalVersion refuses to install src over a newer version unless
+// FileAllowDowngrade is set. The current version defaults to the active one
+// of the layout or slots, which install into a directory per version and
+// so need the version of src.
+func (u *upgrader) checkLocalVersion(src *localSource) error {
+	if src.version == "" {
+		if u.layout != nil || u.slots != nil {
+			return errors.New("the version of the local asset is required with a versioned layout or slots, see FileVersion")
+		}
+		return nil
+	}
+	if src.current == "" {
+		current, err := u.activeVersion()
+		if err != nil {
+			return err
+		}
+		src.current = current
+	}
+	if src.current == "" || src.downgrade {
+		return nil
+	}
+	curr, err := u.parseVersion(src.current)
+	if err != nil {
+		return fmt.Errorf("failed to parse current version: %s with err %w", src.current, err)
+	}
+	v, err := u.parseVersion(src.version)
+	if err != nil {
+		return fmt.Errorf("failed to parse version of the local asset: %s with err %w", src.version, err)
+	}
+	if u.versionScheme.Compare(v, curr) < 0 {
+		return &DowngradeError{CurrentVersion: curr.Original(), LatestVersion: v.Original()}
+	}
+	return nil
+}
+
+// activeVersion returns the active version of the layout or slots, or "".
+func (u *upgrader) activeVersion() (string, error) {
+	switch {
+	case u.layout != nil:
+		return u.layout.Current()
+	case u.slots != nil:
+		st, err := u.slots.State()
+		if err != nil {
+			return "", err
+		}
+		return st.Versions[st.Active], nil
+	}
+	return "", nil
+}
+
+// selectLocalAsset selects the asset for the platform from the directory
+// src.asset, and the checksums and signature published next to it.
+func (u *upgrader) selectLocalAsset(ctx context.Context, src *localSource) error {
+	selector, ok := u.assetDownloader.(asset.Selector)
+	if !ok {
+		return fmt.Errorf("%w: the asset downloader can't select assets from a directory", ErrNoAsset)
+	}
+	entries, err := os.ReadDir(src.asset)
+	if err != nil {
+		return fmt.Errorf("failed to read local assets: %w", err)
+	}
+	var assets []release.Asset
+	files := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		files[e.Name()] = true
+		p := filepath.Join(src.asset, e.Name())
+		assets = append(assets, release.Asset{Name: e.Name(), BrowserDownloadURL: filepath.ToSlash(p)})
+	}
+	a, err := selector.SelectAsset(ctx, assets)
+	if err != nil {
+		return err
+	}
+	dir := src.asset
+	src.asset = filepath.Join(dir, a.Name)
+	checksums, signature := u.localCompanions(dir, files, a.Name)
+	if src.checksums == "" {
+		src.checksums = checksums
+	}
+	if src.signature == "" {
+		src.signature = signature
+	}
+	return nil
+}
+
+// localCompanions returns the paths of the checksums and signature files of
+// the asset called name among the files in dir, or "" if there are none.
+func (u *upgrader) localCompanions(dir string, files map[string]bool, name string) (checksums, signature string) {
+	candidates := []string{name + ".sha256", name + ".sha256sum"}
+	var combined []string
+	for f := range files {
+		if strings.HasSuffix(strings.ToLower(f), "checksums.txt") {
+			combined = append(combined, f)
+		}
+	}
+	slices.Sort(combined)
+	for _, c := range append(candidates, combined...) {
+		if files[c] {
+			checksums = filepath.Join(dir, c)
+			break
+		}
+	}
+	if u.trustStore != nil {
+		for _, f := range u.signatureFormats() {
+			if files[name+f.Suffix()] {
+				signature = filepath.Join(dir, name+f.Suffix())
+				break
+			}
+		}
+	}
+	return checksums, signature
+}
+
+// prepareLocal verifies, extracts and stages the local asset of src.
+func (u *upgrader) prepareLocal(ctx context.Context, update *Update, src *localSource, result *UpgradeResult) (*DownloadedUpdate, error) {
+	result.TargetVersion = update.LatestVersion
+	if err := u.refuseYanked(ctx, src.version); err != nil {
+		return nil, err
+	}
+	env := HookEnv{FromVersion: update.CurrentVersion, ToVersion: update.LatestVersion, BinaryPath: u.executablePath}
+	if err := u.runPhase(ctx, result, PreUpgrade, env); err != nil {
+		return nil, err
+	}
+	if u.workDir != "" {
+		if err := os.MkdirAll(u.workDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create work dir: %w", err)
+		}
+	}
+
+	var temps tempFiles
+	defer temps.removeAll()
+
+	info, err := u.copyLocalAsset(src.asset)
+	if err != nil {
+		return nil, err
+	}
+	temps.add(info.DownloadedBinaryFilePath)
+	if src.digests != nil && src.digests[info.Name] != info.Checksum {
+		return nil, fmt.Errorf("%s: %w", BundleManifestName, &ChecksumMismatchError{Asset: info.Name, Expected: src.digests[info.Name], Actual: info.Checksum})
+	}
+
+	verified, err := u.verifyChecksum(ctx, func() (*checksum.Info, error) {
+		return loadLocalChecksums(src.checksums, info.Name)
+	}, info)
+	if err != nil && !errors.Is(err, ErrChecksumNotVerified) {
+		return nil, err
+	}
+	warning := err
+
+	signer, err := u.verifyLocalSignature(src.signature, info)
+	if err != nil {
+		return nil, err
+	}
+	target, err := u.verifyTUFTarget(info)
+	if err != nil {
+		return nil, err
+	}
+	d, err := u.prepare(ctx, &temps, update, u.executablePath, info, verified, warning, env, result)
+	if err != nil {
+		return nil, err
+	}
+	d.Verifiers = appendVerifier(appendVerifier(nil, signer), target)
+	return d, nil
+}
+
+// copyLocalAsset copies the asset at path to a temp file, since the pipeline consumes it.
+func (u *upgrader) copyLocalAsset(path string) (*asset.Info, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open local asset: %w", err)
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(u.workDir, filepath.Base(u.executablePath))
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), in)
+	if err == nil {
+		err = out.Chmod(0o755)
+	}
+	// the file is closed before it is removed, which fails on Windows otherwise
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return nil, fmt.Errorf("failed to copy local asset: %w", err)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	name := filepath.Base(path)
+	return &asset.Info{
+		Name:                     name,
+		URL:                      (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(),
+		Checksum:                 hex.EncodeToString(h.Sum(nil)),
+		DownloadedBinaryFilePath: out.Name(),
+		ArSuffix:                 asset.ArchiveSuffix(name),
+		Size:                     n,
+	}, nil
+}
+
+// loadLocalChecksums reads a checksums file, or a checksum file of the asset called name.
+func loadLocalChecksums(path, name string) (*checksum.Info, error) {
+	if path == "" {
+		return nil, checksum.ErrNoCheckSumAsset
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksums: %w", err)
+	}
+	info, err := checksum.Parse(strings.NewReader(string(data)))
+	if errors.Is(err, checksum.ErrInvalidChecksumFile) {
+		// e.g. "<asset>.sha256" files holding only the checksum
+		if fields := strings.Fields(string(data)); len(fields) == 1 {
+			return checksum.NewInfo(map[string]string{name: fields[0]}), nil
+		}
+	}
+	return info, err
+}
+
+// verifyLocalSignature verifies the local asset against the signature at path
+// with u.trustStore, and returns the verifier of the key that signed it.
+func (u *upgrader) verifyLocalSignature(path string, info *asset.Info) (string, error) {
+	if u.trustStore == nil {
+		return "", nil
+	}
+	if path == "" {
+		return "", fmt.Errorf("%w: %w: no signature found for %s", ErrUntrustedAsset, trust.ErrUnsigned, info.Name)
+	}
+	i := slices.IndexFunc(u.signatureFormats(), func(f trust.Format) bool {
+		return strings.HasSuffix(path, f.Suffix())
+	})
+	if i < 0 {
+		return "", fmt.Errorf("%w: %s isn't a signature in a trusted format", ErrUntrustedAsset, filepath.Base(path))
+	}
+	sig, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read signature: %w", err)
+	}
+	data, err := os.ReadFile(info.DownloadedBinaryFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read local asset: %w", err)
+	}
+	k, err := u.trustStore.VerifyKey(u.signatureFormats()[i], data, sig)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrUntrustedAsset, err)
+	}
+	return keyVerifier(k), nil
+}
+
+// signatureFormats returns the formats of the keys in u.trustStore.
+func (u *upgrader) signatureFormats() []trust.Format {
+	var formats []trust.Format
+	for _, k := range u.trustStore.Keys() {
+		if !slices.Contains(formats, k.Format()) {
+			formats = append(formats, k.Format())
+		}
+	}
+	return formats
+}
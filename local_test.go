@@ -0,0 +1,121 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/trust"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeFromFile(t *testing.T) {
+	ctx := context.Background()
+	archive, err := os.ReadFile(writeTarGz(t, map[string]string{"savvy": "new"}))
+	require.NoError(t, err)
+	sum := sha256.Sum256(archive)
+	assetName := fmt.Sprintf("savvy_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+
+	// bundle is a directory with assets for several platforms
+	bundle := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bundle, assetName), archive, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(bundle, "savvy_plan9_386.tar.gz"), []byte("other"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(bundle, "checksums.txt"), []byte(hex.EncodeToString(sum[:])+"  "+assetName+"\n"), 0o644))
+
+	newUpgrader := func(t *testing.T, opts ...Opt) (FileUpgrader, string) {
+		executablePath := filepath.Join(t.TempDir(), "savvy")
+		require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+		return NewUpgrader("getsavvyinc", "savvy", executablePath, append([]Opt{WithAllowManagedInstall()}, opts...)...).(FileUpgrader), executablePath
+	}
+
+	t.Run("Directory", func(t *testing.T) {
+		u, executablePath := newUpgrader(t)
+		result, err := u.UpgradeFromFile(ctx, bundle, FileVersion("v0.2.0"))
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.True(t, result.ChecksumVerified)
+		assert.Equal(t, "v0.2.0", result.NewVersion)
+		assert.Equal(t, "new", readFile(t, executablePath))
+		assert.FileExists(t, filepath.Join(bundle, assetName), "the local asset is kept")
+	})
+	t.Run("File", func(t *testing.T) {
+		u, executablePath := newUpgrader(t)
+		_, err := u.UpgradeFromFile(ctx, filepath.Join(bundle, assetName))
+		assert.ErrorIs(t, err, checksum.ErrNoCheckSumAsset)
+		assert.Equal(t, "old", readFile(t, executablePath))
+
+		sibling := filepath.Join(t.TempDir(), assetName+".sha256")
+		require.NoError(t, os.WriteFile(sibling, []byte(hex.EncodeToString(sum[:])+"\n"), 0o644))
+		_, err = u.UpgradeFromFile(ctx, filepath.Join(bundle, assetName), FileChecksums(sibling))
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("Downgrade", func(t *testing.T) {
+		u, executablePath := newUpgrader(t)
+		_, err := u.UpgradeFromFile(ctx, bundle, FileVersion("v0.2.0"), FileCurrentVersion("0.3.0"))
+		var downgrade *DowngradeError
+		require.ErrorAs(t, err, &downgrade)
+		assert.ErrorIs(t, err, ErrDowngrade)
+		assert.Equal(t, "old", readFile(t, executablePath))
+
+		result, err := u.UpgradeFromFile(ctx, bundle, FileVersion("v0.2.0"), FileCurrentVersion("0.3.0"), FileAllowDowngrade())
+		require.NoError(t, err)
+		assert.Equal(t, "0.3.0", result.PreviousVersion)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("LayoutWithoutVersion", func(t *testing.T) {
+		u, executablePath := newUpgrader(t, WithVersionedLayout(Layout{Root: t.TempDir()}))
+		_, err := u.UpgradeFromFile(ctx, bundle)
+		assert.ErrorContains(t, err, "FileVersion")
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		u, executablePath := newUpgrader(t)
+		other := filepath.Join(t.TempDir(), "checksums.txt")
+		require.NoError(t, os.WriteFile(other, []byte(hex.EncodeToString(make([]byte, 32))+"  "+assetName+"\n"), 0o644))
+		_, err := u.UpgradeFromFile(ctx, bundle, FileChecksums(other))
+		var mismatch *ChecksumMismatchError
+		assert.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("Signature", func(t *testing.T) {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(t, err)
+		key, err := trust.ParseCosignKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		require.NoError(t, err)
+
+		_, receiptKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		sink := &statementSink{}
+		u, executablePath := newUpgrader(t, WithTrustStore(trust.NewStore(key)), WithChecksumPolicy(ChecksumWarn), WithReceipts(receiptKey, "test", sink))
+		_, err = u.UpgradeFromFile(ctx, bundle)
+		assert.ErrorIs(t, err, trust.ErrUnsigned)
+		assert.Equal(t, "old", readFile(t, executablePath))
+
+		signed := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(signed, assetName), archive, 0o644))
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, archive))
+		require.NoError(t, os.WriteFile(filepath.Join(signed, assetName+".sig"), []byte(sig), 0o644))
+		result, err := u.UpgradeFromFile(ctx, signed)
+		require.NoError(t, err)
+		assert.False(t, result.ChecksumVerified)
+		assert.Equal(t, "new", readFile(t, executablePath))
+		// the receipt names the key that signed the asset
+		require.NotNil(t, sink.statement)
+		assert.Equal(t, []string{"cosign:" + key.ID()}, sink.statement.Predicate.Verifiers)
+	})
+}
@@ -0,0 +1,68 @@
+package upgrade
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrUpgradeInProgress is returned when another process of the same user is
+// upgrading the same binary.
+var ErrUpgradeInProgress = errors.New("another upgrade is in progress")
+
+// fileLock is an advisory lock held on a file. It is released when the file is closed,
+// including when the process exits.
+type fileLock struct {
+	f *os.File
+}
+
+// lockDir returns the directory lock files are kept in. It is a variable so
+// tests can keep lock files out of the user's cache directory.
+var lockDir = userLockDir
+
+// userLockDir returns the user's cache directory, or the temp directory if
+// there is none. Lock files aren't removed, since another process may be
+// waiting to lock them, so they are kept out of the directory of the binary,
+// e.g. /usr/local/bin. Being per user, the lock only excludes upgrades run by
+// the same user: an upgrade run with sudo and one run without it don't see
+// each other's lock, though the rename into place still leaves a whole binary.
+func userLockDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "upgrade-cli", "locks")
+	}
+	return filepath.Join(os.TempDir(), "upgrade-cli-locks")
+}
+
+// lockPath returns the path of the lock file guarding upgrades of the binary
+// at path, keyed on a hash of its absolute path.
+func lockPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(lockDir(), filepath.Base(path)+"-"+hex.EncodeToString(sum[:8])+".lock")
+}
+
+// acquireLock takes the upgrade lock for the binary at path without blocking.
+func acquireLock(path string) (*fileLock, error) {
+	p := lockPath(path)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create lock dir: %w", err)
+	}
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) release() error {
+	return l.f.Close()
+}
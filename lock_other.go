@@ -0,0 +1,10 @@
+//go:build (!unix && !windows) || solaris || aix
+
+package upgrade
+
+import "os"
+
+// lockFile is a no-op on platforms without flock, such as solaris and aix.
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build (unix && !solaris && !aix) || windows
+
+package upgrade
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withLockDir keeps the lock files of a test in a temp dir.
+func withLockDir(t *testing.T) {
+	dir := t.TempDir()
+	orig := lockDir
+	t.Cleanup(func() { lockDir = orig })
+	lockDir = func() string { return dir }
+}
+
+func TestAcquireLock(t *testing.T) {
+	withLockDir(t)
+	path := filepath.Join(t.TempDir(), "savvy")
+	lock, err := acquireLock(path)
+	require.NoError(t, err)
+
+	_, err = acquireLock(path)
+	assert.ErrorIs(t, err, ErrUpgradeInProgress)
+
+	require.NoError(t, lock.release())
+	lock, err = acquireLock(path)
+	require.NoError(t, err)
+	require.NoError(t, lock.release())
+}
+
+func TestLockPath(t *testing.T) {
+	withLockDir(t)
+	dir := t.TempDir()
+	p := lockPath(filepath.Join(dir, "savvy"))
+	assert.NotEqual(t, dir, filepath.Dir(p), "no lock file is left next to the binary")
+	assert.Equal(t, p, lockPath(filepath.Join(dir, ".", "savvy")))
+	assert.NotEqual(t, p, lockPath(filepath.Join(dir, "other", "savvy")))
+}
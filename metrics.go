@@ -0,0 +1,36 @@
+package upgrade
+
+import "time"
+
+// Metrics records what an upgrader does, e.g. to monitor a fleet of agents
+// that upgrade themselves, see WithMetrics. The metrics package implements it
+// for Prometheus. Methods are called synchronously and should return quickly.
+type Metrics interface {
+	// CheckPerformed is called after every release lookup, with its error if
+	// it failed.
+	CheckPerformed(err error)
+	// UpgradeAttempted is called when Upgrade, UpgradeWithResult, AutoUpgrade
+	// or Apply starts installing an available update.
+	UpgradeAttempted()
+	// UpgradeFinished is called after each attempt, with its error if it
+	// failed.
+	UpgradeFinished(err error)
+	// AssetDownloaded is called after a release asset was downloaded, with
+	// its size and how long the download took.
+	AssetDownloaded(bytes int64, duration time.Duration)
+}
+
+// WithMetrics records checks, upgrades and downloads in m.
+func WithMetrics(m Metrics) Opt {
+	return func(u *upgrader) {
+		u.metrics = m
+	}
+}
+
+// noMetrics is the Metrics of upgraders without WithMetrics.
+type noMetrics struct{}
+
+func (noMetrics) CheckPerformed(error)                 {}
+func (noMetrics) UpgradeAttempted()                    {}
+func (noMetrics) UpgradeFinished(error)                {}
+func (noMetrics) AssetDownloaded(int64, time.Duration) {}
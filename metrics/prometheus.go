@@ -0,0 +1,155 @@
+// Package metrics exports the metrics of an upgrader, see upgrade.WithMetrics.
+//
+// Prometheus records them in the Prometheus text format without depending on
+// the Prometheus client library, so agents can serve them on their metrics
+// endpoint or write them for the node_exporter textfile collector. Programs
+// that already use the client library can implement upgrade.Metrics with
+// their own collectors instead.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the download
+// duration histogram.
+var DefaultDurationBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Prometheus records checks, upgrades and downloads. It implements
+// upgrade.Metrics and http.Handler. It is safe for concurrent use.
+type Prometheus struct {
+	namespace string
+	buckets   []float64
+
+	mu             sync.Mutex
+	checks         map[string]uint64
+	attempted      uint64
+	succeeded      uint64
+	failed         uint64
+	downloadBytes  uint64
+	durationCounts []uint64
+	durationSum    float64
+	downloads      uint64
+}
+
+// PrometheusOpt configures NewPrometheus.
+type PrometheusOpt func(*Prometheus)
+
+// WithDurationBuckets sets the upper bounds, in seconds, of the download
+// duration histogram. The default is DefaultDurationBuckets.
+func WithDurationBuckets(buckets ...float64) PrometheusOpt {
+	return func(p *Prometheus) {
+		p.buckets = buckets
+	}
+}
+
+// NewPrometheus returns metrics named with namespace as prefix, e.g.
+// "savvy_upgrade_checks_total" for the namespace "savvy". Without a
+// namespace, metrics are named e.g. "upgrade_checks_total".
+func NewPrometheus(namespace string, opts ...PrometheusOpt) *Prometheus {
+	p := &Prometheus{
+		namespace: namespace,
+		buckets:   DefaultDurationBuckets,
+		checks:    map[string]uint64{"success": 0, "failure": 0},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.durationCounts = make([]uint64, len(p.buckets))
+	return p
+}
+
+func (p *Prometheus) CheckPerformed(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks[outcome(err)]++
+}
+
+func (p *Prometheus) UpgradeAttempted() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempted++
+}
+
+func (p *Prometheus) UpgradeFinished(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.failed++
+	} else {
+		p.succeeded++
+	}
+}
+
+func (p *Prometheus) AssetDownloaded(bytes int64, duration time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.downloadBytes += uint64(max(bytes, 0))
+	p.downloads++
+	seconds := duration.Seconds()
+	p.durationSum += seconds
+	for i, le := range p.buckets {
+		if seconds <= le {
+			p.durationCounts[i]++
+		}
+	}
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	p.mu.Lock()
+	checks := p.name("upgrade_checks_total")
+	header(&b, checks, "counter", "Release lookups, by result.")
+	for _, result := range []string{"failure", "success"} {
+		fmt.Fprintf(&b, "%s{result=%q} %d\n", checks, result, p.checks[result])
+	}
+	counter(&b, p.name("upgrades_attempted_total"), "Upgrades that started installing an update.", p.attempted)
+	counter(&b, p.name("upgrades_succeeded_total"), "Upgrades that installed an update.", p.succeeded)
+	counter(&b, p.name("upgrades_failed_total"), "Upgrades that failed.", p.failed)
+	counter(&b, p.name("upgrade_download_bytes_total"), "Bytes of release assets downloaded.", p.downloadBytes)
+	duration := p.name("upgrade_download_duration_seconds")
+	header(&b, duration, "histogram", "Duration of release asset downloads.")
+	for i, le := range p.buckets {
+		fmt.Fprintf(&b, "%s_bucket{le=\"%g\"} %d\n", duration, le, p.durationCounts[i])
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", duration, p.downloads)
+	fmt.Fprintf(&b, "%s_sum %g\n", duration, p.durationSum)
+	fmt.Fprintf(&b, "%s_count %d\n", duration, p.downloads)
+	p.mu.Unlock()
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+func (p *Prometheus) name(name string) string {
+	if p.namespace == "" {
+		return name
+	}
+	return p.namespace + "_" + name
+}
+
+func header(b *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func counter(b *bytes.Buffer, name, help string, v uint64) {
+	header(b, name, "counter", help)
+	fmt.Fprintf(b, "%s %d\n", name, v)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	upgrade "github.com/getsavvyinc/upgrade-cli"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ upgrade.Metrics = (*Prometheus)(nil)
+
+func TestPrometheus(t *testing.T) {
+	p := NewPrometheus("savvy", WithDurationBuckets(1, 10))
+	p.CheckPerformed(nil)
+	p.CheckPerformed(nil)
+	p.CheckPerformed(errors.New("rate limited"))
+	p.UpgradeAttempted()
+	p.AssetDownloaded(1024, 2*time.Second)
+	p.UpgradeFinished(nil)
+	p.UpgradeAttempted()
+	p.UpgradeFinished(errors.New("checksum mismatch"))
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE savvy_upgrade_checks_total counter",
+		`savvy_upgrade_checks_total{result="failure"} 1`,
+		`savvy_upgrade_checks_total{result="success"} 2`,
+		"savvy_upgrades_attempted_total 2",
+		"savvy_upgrades_succeeded_total 1",
+		"savvy_upgrades_failed_total 1",
+		"savvy_upgrade_download_bytes_total 1024",
+		"# TYPE savvy_upgrade_download_duration_seconds histogram",
+		`savvy_upgrade_download_duration_seconds_bucket{le="1"} 0`,
+		`savvy_upgrade_download_duration_seconds_bucket{le="10"} 1`,
+		`savvy_upgrade_download_duration_seconds_bucket{le="+Inf"} 1`,
+		"savvy_upgrade_download_duration_seconds_sum 2",
+		"savvy_upgrade_download_duration_seconds_count 1",
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+
+	var b strings.Builder
+	_, err := NewPrometheus("").WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Contains(t, b.String(), "\nupgrades_attempted_total 0\n")
+}
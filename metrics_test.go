@@ -0,0 +1,48 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMetrics struct {
+	checks     []error
+	attempts   int
+	finished   []error
+	downloaded []int64
+}
+
+func (m *recordingMetrics) CheckPerformed(err error)  { m.checks = append(m.checks, err) }
+func (m *recordingMetrics) UpgradeAttempted()         { m.attempts++ }
+func (m *recordingMetrics) UpgradeFinished(err error) { m.finished = append(m.finished, err) }
+func (m *recordingMetrics) AssetDownloaded(bytes int64, duration time.Duration) {
+	m.downloaded = append(m.downloaded, bytes)
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := &recordingMetrics{}
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithMetrics(m))
+
+	_, err := u.UpgradeWithResult(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, []error{nil}, m.checks)
+	assert.Zero(t, m.attempts, "no update available")
+
+	_, err = u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.Len(t, m.checks, 2)
+	assert.Equal(t, 1, m.attempts)
+	assert.Equal(t, []error{nil}, m.finished)
+	require.Len(t, m.downloaded, 1)
+	assert.Positive(t, m.downloaded[0])
+
+	_, err = u.UpgradeWithResult(ctx, "invalid")
+	assert.Error(t, err)
+	require.Len(t, m.checks, 3)
+	assert.Error(t, m.checks[2])
+}
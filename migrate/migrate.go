@@ -0,0 +1,142 @@
+// Package migrate imports state left behind by other self-update libraries into
+// this library's state store, so that switching libraries doesn't orphan
+// existing backups or forget versions the user chose to skip.
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// Adapter reads the state of another self-update library.
+type Adapter interface {
+	// Import returns the state found for executablePath.
+	// An adapter that finds nothing returns an empty state and no error.
+	Import(ctx context.Context, executablePath string) (*state.State, error)
+}
+
+// Migrate runs every adapter for executablePath and merges what they find into store.
+// It returns the merged state.
+func Migrate(ctx context.Context, store state.Store, executablePath string, adapters ...Adapter) (*state.State, error) {
+	s, err := store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range adapters {
+		imported, err := a.Import(ctx, executablePath)
+		if err != nil {
+			return nil, err
+		}
+		s.Merge(imported)
+	}
+	if err := store.Save(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type goUpdate struct {
+	oldSavePaths []string
+}
+
+var _ Adapter = (*goUpdate)(nil)
+
+// GoUpdate returns an Adapter for go-update based libraries
+// (inconshreveable/go-update, minio/selfupdate, rhysd/go-github-selfupdate and
+// creativeprojects/go-selfupdate).
+//
+// These libraries move the previous binary to ".<name>.old" next to the
+// executable. oldSavePaths lists any custom Options.OldSavePath values the
+// integration used. Backups that can't be read to record their digest are
+// skipped.
+func GoUpdate(oldSavePaths ...string) Adapter {
+	return &goUpdate{oldSavePaths: oldSavePaths}
+}
+
+func (g *goUpdate) Import(ctx context.Context, executablePath string) (*state.State, error) {
+	dir, name := filepath.Split(executablePath)
+	candidates := append([]string{filepath.Join(dir, "."+name+".old")}, g.oldSavePaths...)
+
+	s := &state.State{}
+	for _, p := range candidates {
+		fi, err := os.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat backup %s: %w", p, err)
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		b, err := state.NewBackup("", p)
+		if err != nil {
+			// an unreadable backup can't be verified before a rollback
+			continue
+		}
+		s.Backups = append(s.Backups, b)
+	}
+	return s, nil
+}
+
+// DefaultSkipKeys are the keys StateFile looks for when no keys are given.
+var DefaultSkipKeys = []string{"skipped_version", "skip_version", "skipped_versions", "ignored_versions"}
+
+type stateFile struct {
+	path     string
+	skipKeys []string
+}
+
+var _ Adapter = (*stateFile)(nil)
+
+// StateFile returns an Adapter that reads skipped versions from a JSON state
+// file written by another integration. Each key may hold a string or a list of
+// strings. If no keys are given DefaultSkipKeys is used.
+func StateFile(path string, skipKeys ...string) Adapter {
+	if len(skipKeys) == 0 {
+		skipKeys = DefaultSkipKeys
+	}
+	return &stateFile{path: path, skipKeys: skipKeys}
+}
+
+func (f *stateFile) Import(ctx context.Context, executablePath string) (*state.State, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &state.State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", f.path, err)
+	}
+
+	s := &state.State{}
+	for _, k := range f.skipKeys {
+		v, ok := raw[k]
+		if !ok {
+			continue
+		}
+		var one string
+		if err := json.Unmarshal(v, &one); err == nil {
+			if one != "" {
+				s.Merge(&state.State{SkippedVersions: []string{one}})
+			}
+			continue
+		}
+		var many []string
+		if err := json.Unmarshal(v, &many); err != nil {
+			return nil, fmt.Errorf("unexpected value for %q in %s", k, f.path)
+		}
+		s.Merge(&state.State{SkippedVersions: many})
+	}
+	return s, nil
+}
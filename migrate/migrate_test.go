@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	executablePath := filepath.Join(dir, "savvy")
+	backup := filepath.Join(dir, ".savvy.old")
+	require.NoError(t, os.WriteFile(backup, []byte("old"), 0o755))
+
+	stateFile := filepath.Join(dir, "old-state.json")
+	require.NoError(t, os.WriteFile(stateFile, []byte(`{"skipped_version": "1.2.0", "ignored_versions": ["1.3.0"]}`), 0o644))
+
+	store := state.NewFileStore(filepath.Join(dir, "state.json"))
+	s, err := Migrate(ctx, store, executablePath, GoUpdate(), StateFile(stateFile))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.2.0", "1.3.0"}, s.SkippedVersions)
+	require.Len(t, s.Backups, 1)
+	assert.Equal(t, backup, s.Backups[0].Path)
+
+	t.Run("Idempotent", func(t *testing.T) {
+		s, err := Migrate(ctx, store, executablePath, GoUpdate(), StateFile(stateFile))
+		require.NoError(t, err)
+		assert.Len(t, s.SkippedVersions, 2)
+		assert.Len(t, s.Backups, 1)
+	})
+}
+
+func TestMigrateNothingToImport(t *testing.T) {
+	dir := t.TempDir()
+	store := state.NewFileStore(filepath.Join(dir, "state.json"))
+	s, err := Migrate(context.Background(), store, filepath.Join(dir, "savvy"), GoUpdate(), StateFile(filepath.Join(dir, "missing.json")))
+	require.NoError(t, err)
+	assert.Empty(t, s.SkippedVersions)
+	assert.Empty(t, s.Backups)
+}
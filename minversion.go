@@ -0,0 +1,140 @@
+package upgrade
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// DefaultMinimumVersionAsset is the release asset WithMinimumVersion reads by default.
+const DefaultMinimumVersionAsset = "min-version.txt"
+
+// maxPolicySize bounds how much of a policy file is read.
+const maxPolicySize = 64 << 10
+
+// ErrBelowMinimumVersion is returned by Update.RequireMinimum when the
+// current version is older than the minimum supported version.
+var ErrBelowMinimumVersion = errors.New("version is no longer supported")
+
+// WithMinimumVersion makes Check read the minimum supported version from the
+// release asset name, DefaultMinimumVersionAsset if empty. Update.BelowMinimum
+// reports when the current version is older, so the CLI can refuse to run
+// until it is upgraded. Releases without the asset have no minimum.
+//
+// The asset holds a single version, e.g. "1.4.0". Blank lines and lines
+// starting with "#" are ignored.
+func WithMinimumVersion(name string) Opt {
+	return func(u *upgrader) {
+		if name == "" {
+			name = DefaultMinimumVersionAsset
+		}
+		u.minVersionAsset = name
+	}
+}
+
+// WithMinimumVersionURL is like WithMinimumVersion, but reads the minimum
+// supported version from url, e.g. a file in the repository, so it can be
+// raised without publishing a release.
+func WithMinimumVersionURL(url string) Opt {
+	return func(u *upgrader) {
+		u.minVersionURL = url
+	}
+}
+
+// RequireMinimum returns an error wrapping ErrBelowMinimumVersion if the
+// current version is older than the minimum supported version.
+func (up *Update) RequireMinimum() error {
+	if !up.BelowMinimum {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is older than %s, upgrade to %s", ErrBelowMinimumVersion, up.CurrentVersion, up.MinimumVersion, up.LatestVersion)
+}
+
+// checkMinimumVersion sets the minimum supported version of update, if one is published.
+func (u *upgrader) checkMinimumVersion(ctx context.Context, update *Update, curr Version) error {
+	url := u.minVersionURL
+	if url == "" && u.minVersionAsset != "" {
+		url = policyAssetURL(update.Release, u.minVersionAsset)
+	}
+	if url == "" {
+		return nil
+	}
+
+	min, err := u.fetchMinimumVersion(ctx, url)
+	if err != nil {
+		return fmt.Errorf("failed to get minimum version: %w", err)
+	}
+	if min == nil {
+		return nil
+	}
+	update.MinimumVersion = min.Original()
+	update.BelowMinimum = u.versionScheme.Compare(curr, min) < 0
+	return nil
+}
+
+// fetchMinimumVersion downloads and parses a minimum version file.
+// It returns nil if the file names no version.
+func (u *upgrader) fetchMinimumVersion(ctx context.Context, url string) (Version, error) {
+	line, err := u.fetchPolicy(ctx, url)
+	if err != nil || line == "" {
+		return nil, err
+	}
+	v, err := u.parseVersion(line)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse minimum version: %s with err %w", line, err)
+	}
+	return v, nil
+}
+
+// fetchPolicy downloads a small policy file, such as a minimum version, and
+// returns its first line that isn't blank or a "#" comment.
+func (u *upgrader) fetchPolicy(ctx context.Context, url string) (string, error) {
+	lines, err := u.fetchPolicyLines(ctx, url)
+	if err != nil || len(lines) == 0 {
+		return "", err
+	}
+	return lines[0], nil
+}
+
+// fetchPolicyLines downloads a small policy file and returns its lines,
+// trimmed and without blank lines and "#" comments.
+func (u *upgrader) fetchPolicyLines(ctx context.Context, url string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := release.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxPolicySize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// policyAssetURL returns the download URL of the asset name of r, or "" if r has none.
+func policyAssetURL(r *release.Info, name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.BrowserDownloadURL
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package upgrade
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinimumVersion(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/min-version.txt":
+			w.Write([]byte("# versions before 0.2.0 use the old API\n\nv0.2.0\n"))
+		case "/invalid.txt":
+			w.Write([]byte("latest\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	newUpgrader := func(opts ...Opt) *upgrader {
+		u := NewUpgrader("getsavvyinc", "savvy-cli", "savvy", opts...).(*upgrader)
+		u.releaseGetter = &fakeReleaseGetter{info: &release.Info{
+			TagName: "v0.3.0",
+			Assets:  []release.Asset{{Name: "min-version.txt", BrowserDownloadURL: srv.URL + "/min-version.txt"}},
+		}}
+		return u
+	}
+
+	update, err := newUpgrader(WithMinimumVersion("")).Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", update.MinimumVersion)
+	assert.True(t, update.BelowMinimum)
+	assert.ErrorIs(t, update.RequireMinimum(), ErrBelowMinimumVersion)
+
+	update, err = newUpgrader(WithMinimumVersion("")).Check(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.False(t, update.BelowMinimum)
+	assert.NoError(t, update.RequireMinimum())
+
+	t.Run("no asset", func(t *testing.T) {
+		update, err := newUpgrader(WithMinimumVersion("other.txt")).Check(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.Empty(t, update.MinimumVersion)
+		assert.False(t, update.BelowMinimum)
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		update, err := newUpgrader().Check(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.False(t, update.BelowMinimum)
+	})
+
+	t.Run("url", func(t *testing.T) {
+		update, err := newUpgrader(WithMinimumVersionURL(srv.URL+"/min-version.txt")).Check(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, update.BelowMinimum)
+
+		_, err = newUpgrader(WithMinimumVersionURL(srv.URL+"/missing.txt")).Check(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = newUpgrader(WithMinimumVersionURL(srv.URL+"/invalid.txt")).Check(ctx, "0.1.0")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,91 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// DefaultUploadDelay is the default for Nightly.UploadDelay.
+const DefaultUploadDelay = time.Hour
+
+// Nightly configures upgrades to bleeding-edge builds that aren't
+// versioned releases, see WithNightly. Set either Tag or Workflow.
+type Nightly struct {
+	// Tag is a rolling release tag whose assets every build replaces, e.g. "nightly".
+	Tag string
+	// Workflow is the file name of a GitHub Actions workflow, e.g.
+	// "nightly.yml", whose latest successful run's artifacts are installed,
+	// see release.NewArtifactGetter. Downloading artifacts requires a
+	// token, see WithGitHubAuth.
+	Workflow string
+	// Branch only considers Workflow runs on a branch, e.g. "main".
+	Branch string
+	// UploadDelay is the longest it takes for a build to be uploaded after
+	// it was built. Builds uploaded within UploadDelay of the running build
+	// are taken to be the same build. Zero means DefaultUploadDelay.
+	UploadDelay time.Duration
+}
+
+// WithNightly upgrades to the latest nightly build instead of the latest
+// release. Nightly builds have no version, so they are compared by the time
+// their assets were uploaded: the current version passed to Check, Upgrade
+// and the like is the time the running binary was built, formatted as
+// RFC 3339, e.g. "2024-06-01T03:04:05Z", and embedded when it is built,
+// e.g. with -ldflags "-X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)".
+// The version of a nightly build is the time its last asset was uploaded.
+//
+// Nightly builds have no checksums file, so with Nightly.Workflow the
+// artifacts are verified against the digests GitHub publishes for them. A
+// rolling tag needs a checksums file replaced along with the assets, or
+// ChecksumWarn.
+func WithNightly(n Nightly) Opt {
+	return func(u *upgrader) {
+		u.nightly = &n
+	}
+}
+
+// checkNightly looks up the latest nightly build, see WithNightly.
+func (u *upgrader) checkNightly(ctx context.Context, currentVersion string) (*Update, error) {
+	built, err := time.Parse(time.RFC3339, currentVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse current build time: %s with err %w", currentVersion, err)
+	}
+	var releaseInfo *release.Info
+	if u.nightly.Tag != "" {
+		releaseInfo, err = releaseByTag(ctx, u.releaseGetter, u.tagPrefix, u.nightly.Tag)
+	} else {
+		releaseInfo, err = u.releaseGetter.GetLatestRelease(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	uploaded := uploadTime(releaseInfo)
+	if uploaded.IsZero() {
+		return nil, errors.New("the nightly build doesn't report when its assets were uploaded")
+	}
+	delay := u.nightly.UploadDelay
+	if delay <= 0 {
+		delay = DefaultUploadDelay
+	}
+	return &Update{
+		CurrentVersion: currentVersion,
+		LatestVersion:  uploaded.UTC().Format(time.RFC3339),
+		Available:      uploaded.Sub(built) > delay,
+		Release:        releaseInfo,
+	}, nil
+}
+
+// uploadTime returns when the last asset of r was uploaded.
+func uploadTime(r *release.Info) time.Time {
+	var latest time.Time
+	for _, a := range r.Assets {
+		if a.UpdatedAt.After(latest) {
+			latest = a.UpdatedAt
+		}
+	}
+	return latest
+}
@@ -0,0 +1,44 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNightly(t *testing.T) {
+	ctx := context.Background()
+	uploaded := time.Date(2024, 6, 2, 3, 30, 0, 0, time.UTC)
+	u, executablePath := newTestUpgrader(t, "nightly", map[string]string{"savvy": "new"}, WithNightly(Nightly{Tag: "nightly"}))
+	info := u.releaseGetter.(*fakeReleaseGetter).info
+	for i := range info.Assets {
+		info.Assets[i].UpdatedAt = uploaded
+	}
+
+	// the feed's latest versioned release is no nightly build, even if the
+	// build time parses as a version
+	u.tagGetter = staticTagGetter("v0.1.0")
+	u.normalizeVersion = func(string) string { return "0.1.0" }
+	available, err := u.IsNewVersionAvailable(ctx, "2024-06-01T03:00:00Z")
+	require.NoError(t, err)
+	assert.True(t, available)
+
+	u.normalizeVersion = nil
+
+	// uploaded shortly after it was built
+	update, err := u.Check(ctx, "2024-06-02T03:00:00Z")
+	require.NoError(t, err)
+	assert.False(t, update.Available)
+
+	result, err := u.UpgradeWithResult(ctx, "2024-06-01T03:00:00Z")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "2024-06-02T03:30:00Z", result.NewVersion)
+	assert.Equal(t, "new", readFile(t, executablePath))
+
+	_, err = u.Check(ctx, "1.2.3")
+	assert.ErrorContains(t, err, "failed to parse current build time")
+}
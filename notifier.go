@@ -0,0 +1,63 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// Notifier tells the user about available updates, see WithNotifier.
+// *notify.Notifier raises native desktop notifications.
+type Notifier interface {
+	Notify(ctx context.Context, title, message string) error
+}
+
+// WithNotifier notifies the user through n when Check or
+// IsNewVersionAvailable finds a new version, e.g. from the background update
+// check of a developer tool that lives next to a GUI. Each version is only
+// notified once, across runs if WithStateStore is set, and versions the user
+// skipped or snoozed aren't notified. Notification errors are ignored.
+func WithNotifier(n Notifier) Opt {
+	return func(u *upgrader) {
+		u.notifier = n
+	}
+}
+
+// notifiedVersion is the version the user was last notified of. Concurrent
+// checks notify one at a time, so each version is notified once.
+type notifiedVersion struct {
+	mu      sync.Mutex
+	version string
+}
+
+// notify notifies the user of an available update they weren't notified of yet.
+func (u *upgrader) notify(ctx context.Context, update *Update) {
+	if u.notifier == nil || !update.Available {
+		return
+	}
+	u.notified.mu.Lock()
+	defer u.notified.mu.Unlock()
+	if update.LatestVersion == u.notified.version {
+		return
+	}
+	if u.stateStore != nil {
+		st, err := u.stateStore.Load(ctx)
+		if err != nil || st.NotifiedVersion == update.LatestVersion {
+			return
+		}
+	}
+	name := strings.TrimSuffix(filepath.Base(u.executablePath), ".exe")
+	title := fmt.Sprintf("%s %s is available", name, update.LatestVersion)
+	message := fmt.Sprintf("You're running %s.", update.CurrentVersion)
+	if err := u.notifier.Notify(ctx, title, message); err != nil {
+		return
+	}
+	u.notified.version = update.LatestVersion
+	if u.stateStore != nil {
+		_ = state.SetNotified(ctx, u.stateStore, update.LatestVersion)
+	}
+}
@@ -0,0 +1,83 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotifier struct {
+	titles []string
+	err    error
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, title, message string) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.titles = append(n.titles, title)
+	return nil
+}
+
+func TestNotifier(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	n := &fakeNotifier{}
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithNotifier(n), WithStateStore(store))
+
+	_, err := u.Check(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.Empty(t, n.titles, "up to date")
+
+	for i := 0; i < 2; i++ {
+		available, err := u.IsNewVersionAvailable(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, available)
+	}
+	assert.Equal(t, []string{"savvy v0.2.0 is available"}, n.titles)
+
+	// the notified version is persisted for the next run
+	u.notified.version = ""
+	_, err = u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.Len(t, n.titles, 1)
+	st, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", st.NotifiedVersion)
+
+	t.Run("Failed", func(t *testing.T) {
+		require.NoError(t, store.Save(ctx, &state.State{}))
+		u.notified.version = ""
+		n.err = errors.New("no notification service")
+		update, err := u.Check(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, update.Available)
+		st, err := store.Load(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, st.NotifiedVersion, "failed notifications are retried")
+	})
+}
+
+func TestNotifierConcurrent(t *testing.T) {
+	ctx := context.Background()
+	n := &fakeNotifier{}
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithNotifier(n))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := u.IsNewVersionAvailable(ctx, "0.1.0")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"savvy v0.2.0 is available"}, n.titles)
+}
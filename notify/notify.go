@@ -0,0 +1,88 @@
+// Package notify raises native desktop notifications: Notification Center on
+// macOS, toast notifications on Windows and libnotify on Linux and the BSDs.
+//
+// It lets background update checks of developer tools that live next to a
+// GUI tell the user about new versions, see upgrade.WithNotifier.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnsupported is returned on platforms without a supported notification
+// service, e.g. Linux without notify-send.
+var ErrUnsupported = errors.New("desktop notifications are not supported on this platform")
+
+type commandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// Notifier raises desktop notifications. It implements upgrade.Notifier.
+type Notifier struct {
+	app  string
+	goos string
+	run  commandRunner
+}
+
+// New returns a Notifier for the running platform that shows notifications
+// from app, e.g. "Savvy".
+func New(app string) *Notifier {
+	return &Notifier{
+		app:  app,
+		goos: runtime.GOOS,
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			return exec.CommandContext(ctx, name, args...).CombinedOutput()
+		},
+	}
+}
+
+// Notify shows a notification with title and message.
+func (n *Notifier) Notify(ctx context.Context, title, message string) error {
+	var name string
+	var args []string
+	switch n.goos {
+	case "darwin":
+		name, args = "osascript", []string{"-e", fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))}
+	case "windows":
+		name, args = "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", toastScript(n.app, title, message)}
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		name, args = "notify-send", []string{"--app-name=" + n.app, title, message}
+	default:
+		return ErrUnsupported
+	}
+	out, err := n.run(ctx, name, args...)
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal.
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// powerShellString quotes s as a PowerShell string literal, which doesn't
+// expand variables.
+func powerShellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// toastScript returns a PowerShell script showing a toast notification from app.
+func toastScript(app, title, message string) string {
+	return strings.Join([]string{
+		"$ErrorActionPreference = 'Stop'",
+		"[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null",
+		"$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)",
+		"$text = $xml.GetElementsByTagName('text')",
+		"$text.Item(0).AppendChild($xml.CreateTextNode(" + powerShellString(title) + ")) > $null",
+		"$text.Item(1).AppendChild($xml.CreateTextNode(" + powerShellString(message) + ")) > $null",
+		"[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(" + powerShellString(app) + ").Show([Windows.UI.Notifications.ToastNotification]::new($xml))",
+	}, "; ")
+}
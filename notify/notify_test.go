@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNotifier returns a notifier for goos that records the commands it runs.
+func fakeNotifier(goos string, err error) (*Notifier, *[][]string) {
+	var commands [][]string
+	return &Notifier{
+		app:  "Savvy",
+		goos: goos,
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			commands = append(commands, append([]string{name}, args...))
+			return []byte("output"), err
+		},
+	}, &commands
+}
+
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	const title, message = `savvy 0.2.0 is available`, `You're running "0.1.0"`
+
+	for goos, expected := range map[string][]string{
+		"darwin": {"osascript", "-e", `display notification "You're running \"0.1.0\"" with title "savvy 0.2.0 is available"`},
+		"linux":  {"notify-send", "--app-name=Savvy", title, message},
+	} {
+		n, commands := fakeNotifier(goos, nil)
+		require.NoError(t, n.Notify(ctx, title, message), goos)
+		assert.Equal(t, [][]string{expected}, *commands, goos)
+	}
+
+	n, commands := fakeNotifier("windows", nil)
+	require.NoError(t, n.Notify(ctx, title, message))
+	require.Len(t, *commands, 1)
+	assert.Equal(t, "powershell", (*commands)[0][0])
+	script := (*commands)[0][len((*commands)[0])-1]
+	assert.Contains(t, script, `CreateTextNode('You''re running "0.1.0"')`)
+	assert.Contains(t, script, `CreateToastNotifier('Savvy')`)
+
+	n, _ = fakeNotifier("plan9", nil)
+	assert.ErrorIs(t, n.Notify(ctx, title, message), ErrUnsupported)
+	n, _ = fakeNotifier("linux", exec.ErrNotFound)
+	assert.ErrorIs(t, n.Notify(ctx, title, message), ErrUnsupported)
+	n, _ = fakeNotifier("linux", errors.New("exit status 1"))
+	err := n.Notify(ctx, title, message)
+	assert.NotErrorIs(t, err, ErrUnsupported)
+	assert.ErrorContains(t, err, "output")
+}
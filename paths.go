@@ -0,0 +1,38 @@
+package upgrade
+
+import (
+	"github.com/getsavvyinc/upgrade-cli/journal"
+	"github.com/getsavvyinc/upgrade-cli/paths"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// WithPaths keeps the upgrader's files in the app's standard directories
+// returned by paths.New: release lookups are cached in p.ReleaseCache, the
+// user's preferences and backups are stored in p.StateFile, see
+// WithStateStore, and upgrades are recorded in p.Journal. WithReleaseCache,
+// WithStateStore and WithJournal override these locations. Downloads are
+// only cached with WithDownloadCache, e.g. in p.DownloadCache.
+func WithPaths(p *paths.Paths) Opt {
+	return func(u *upgrader) {
+		u.paths = p
+	}
+}
+
+// applyPaths sets the locations of WithPaths that no other option set, and
+// signs the state store with the key of WithStateKey.
+func (u *upgrader) applyPaths() {
+	if u.paths != nil {
+		// prepended, so WithReleaseCache takes precedence
+		u.releaseOpts = append([]release.GetterOpt{release.WithCache(u.paths.ReleaseCache())}, u.releaseOpts...)
+		if u.stateStore == nil {
+			u.stateStore = state.NewFileStore(u.paths.StateFile())
+		}
+		if u.journal == nil {
+			u.journal = journal.New(u.paths.Journal())
+		}
+	}
+	if u.stateKey != nil && u.stateStore != nil {
+		u.stateStore = state.NewSignedStore(u.stateStore, u.stateKey)
+	}
+}
@@ -0,0 +1,156 @@
+// Package paths returns where an app keeps its upgrade files: its config
+// file, caches, state and journal, in the platform's standard directories.
+//
+// On Linux and the BSDs, the XDG base directories are used: $XDG_CONFIG_HOME,
+// $XDG_CACHE_HOME and $XDG_STATE_HOME, defaulting to ~/.config, ~/.cache and
+// ~/.local/state. On macOS, ~/Library/Application Support and
+// ~/Library/Caches are used, and on Windows %AppData% and %LocalAppData%.
+//
+// The <APP>_UPGRADE_HOME environment variable moves all files into one
+// directory, e.g. a volume in a container.
+package paths
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Paths are the directories an app keeps its upgrade files in.
+type Paths struct {
+	// Config holds the config file.
+	Config string
+	// Cache holds release lookups and downloads, which may be deleted at any time.
+	Cache string
+	// State holds the state file and the journal.
+	State string
+}
+
+type resolver struct {
+	goos   string
+	getenv func(string) string
+	home   string
+}
+
+// Opt configures New.
+type Opt func(*resolver)
+
+// WithHome resolves the directories relative to home instead of the user's
+// home directory, e.g. in tests. Environment variables still apply.
+func WithHome(home string) Opt {
+	return func(r *resolver) {
+		r.home = home
+	}
+}
+
+// WithGetenv looks up environment variables with getenv instead of os.Getenv,
+// e.g. in tests.
+func WithGetenv(getenv func(string) string) Opt {
+	return func(r *resolver) {
+		r.getenv = getenv
+	}
+}
+
+// EnvPrefix returns the prefix of app's environment variables, e.g.
+// "SAVVY_UPGRADE_" for "savvy".
+func EnvPrefix(app string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(app)) + "_UPGRADE_"
+}
+
+// New returns the directories of app, e.g. "savvy", on the running platform.
+func New(app string, opts ...Opt) (*Paths, error) {
+	r := &resolver{goos: runtime.GOOS, getenv: os.Getenv}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r.resolve(app)
+}
+
+func (r *resolver) resolve(app string) (*Paths, error) {
+	if app == "" || strings.ContainsAny(app, `/\`) {
+		return nil, errors.New("invalid app name " + app)
+	}
+	if dir := r.getenv(EnvPrefix(app) + "HOME"); dir != "" {
+		return &Paths{
+			Config: filepath.Join(dir, "config"),
+			Cache:  filepath.Join(dir, "cache"),
+			State:  filepath.Join(dir, "state"),
+		}, nil
+	}
+
+	home := r.home
+	if home == "" {
+		var err error
+		if home, err = os.UserHomeDir(); err != nil {
+			return nil, err
+		}
+	}
+	switch r.goos {
+	case "darwin":
+		support := filepath.Join(home, "Library", "Application Support", app)
+		return &Paths{
+			Config: support,
+			Cache:  filepath.Join(home, "Library", "Caches", app),
+			State:  support,
+		}, nil
+	case "windows":
+		roaming := r.dir("AppData", home, "AppData", "Roaming")
+		local := r.dir("LocalAppData", home, "AppData", "Local")
+		return &Paths{
+			Config: filepath.Join(roaming, app),
+			Cache:  filepath.Join(local, app, "cache"),
+			State:  filepath.Join(local, app),
+		}, nil
+	default:
+		return &Paths{
+			Config: filepath.Join(r.dir("XDG_CONFIG_HOME", home, ".config"), app),
+			Cache:  filepath.Join(r.dir("XDG_CACHE_HOME", home, ".cache"), app),
+			State:  filepath.Join(r.dir("XDG_STATE_HOME", home, ".local", "state"), app),
+		}, nil
+	}
+}
+
+// dir returns the directory in the environment variable env, or home joined
+// with elem if it isn't set. Relative directories are ignored, as the XDG
+// base directory specification requires.
+func (r *resolver) dir(env, home string, elem ...string) string {
+	if dir := r.getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(append([]string{home}, elem...)...)
+}
+
+// ConfigFile returns the path of the config file, see config.Load.
+func (p *Paths) ConfigFile() string {
+	return filepath.Join(p.Config, "upgrade.toml")
+}
+
+// ReleaseCache returns the directory release lookups are cached in, see
+// upgrade.WithReleaseCache.
+func (p *Paths) ReleaseCache() string {
+	return filepath.Join(p.Cache, "releases")
+}
+
+// DownloadCache returns the directory verified downloads are cached in, see
+// upgrade.WithDownloadCache.
+func (p *Paths) DownloadCache() string {
+	return filepath.Join(p.Cache, "downloads")
+}
+
+// StateFile returns the path of the state file holding the user's
+// preferences, backups and auto-upgrade state, see state.NewFileStore.
+func (p *Paths) StateFile() string {
+	return filepath.Join(p.State, "state.json")
+}
+
+// Journal returns the path of the upgrade journal, see upgrade.WithJournal.
+func (p *Paths) Journal() string {
+	return filepath.Join(p.State, "journal.jsonl")
+}
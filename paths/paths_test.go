@@ -0,0 +1,60 @@
+package paths
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resolve(t *testing.T, goos string, env map[string]string) *Paths {
+	t.Helper()
+	r := &resolver{goos: goos, home: "/home/user", getenv: func(name string) string { return env[name] }}
+	p, err := r.resolve("savvy")
+	require.NoError(t, err)
+	return p
+}
+
+func TestPaths(t *testing.T) {
+	join := filepath.Join
+	assert.Equal(t, &Paths{
+		Config: join("/home/user", ".config", "savvy"),
+		Cache:  join("/home/user", ".cache", "savvy"),
+		State:  join("/home/user", ".local", "state", "savvy"),
+	}, resolve(t, "linux", nil))
+	assert.Equal(t, &Paths{
+		Config: join("/xdg/config", "savvy"),
+		Cache:  join("/home/user", ".cache", "savvy"),
+		State:  join("/xdg/state", "savvy"),
+	}, resolve(t, "freebsd", map[string]string{"XDG_CONFIG_HOME": "/xdg/config", "XDG_CACHE_HOME": "relative", "XDG_STATE_HOME": "/xdg/state"}))
+	assert.Equal(t, &Paths{
+		Config: join("/home/user", "Library", "Application Support", "savvy"),
+		Cache:  join("/home/user", "Library", "Caches", "savvy"),
+		State:  join("/home/user", "Library", "Application Support", "savvy"),
+	}, resolve(t, "darwin", map[string]string{"XDG_CONFIG_HOME": "/xdg/config"}))
+
+	appData, localAppData := filepath.Join(string(filepath.Separator), "Users", "user", "AppData", "Roaming"), filepath.Join(string(filepath.Separator), "Users", "user", "AppData", "Local")
+	windows := resolve(t, "windows", map[string]string{"AppData": appData, "LocalAppData": localAppData})
+	assert.Equal(t, &Paths{
+		Config: join(appData, "savvy"),
+		Cache:  join(localAppData, "savvy", "cache"),
+		State:  join(localAppData, "savvy"),
+	}, windows)
+
+	p := resolve(t, "linux", map[string]string{"SAVVY_UPGRADE_HOME": "/data/upgrade", "XDG_CONFIG_HOME": "/xdg/config"})
+	assert.Equal(t, &Paths{Config: join("/data/upgrade", "config"), Cache: join("/data/upgrade", "cache"), State: join("/data/upgrade", "state")}, p)
+	assert.Equal(t, join("/data/upgrade", "config", "upgrade.toml"), p.ConfigFile())
+	assert.Equal(t, join("/data/upgrade", "cache", "releases"), p.ReleaseCache())
+	assert.Equal(t, join("/data/upgrade", "cache", "downloads"), p.DownloadCache())
+	assert.Equal(t, join("/data/upgrade", "state", "state.json"), p.StateFile())
+	assert.Equal(t, join("/data/upgrade", "state", "journal.jsonl"), p.Journal())
+
+	_, err := New("../savvy", WithHome(t.TempDir()))
+	assert.Error(t, err)
+}
+
+func TestEnvPrefix(t *testing.T) {
+	assert.Equal(t, "SAVVY_UPGRADE_", EnvPrefix("savvy"))
+	assert.Equal(t, "MY_TOOL_UPGRADE_", EnvPrefix("my-tool"))
+}
@@ -0,0 +1,37 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/journal"
+	"github.com/getsavvyinc/upgrade-cli/paths"
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaths(t *testing.T) {
+	ctx := context.Background()
+	p, err := paths.New("savvy", paths.WithGetenv(func(string) string { return "" }), paths.WithHome(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, state.SkipVersion(ctx, state.NewFileStore(p.StateFile()), "0.2.0"))
+
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithPaths(p))
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Skipped)
+
+	_, err = u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	entries, err := journal.New(p.Journal()).Entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// explicit locations take precedence
+	other := state.NewFileStore(t.TempDir() + "/state.json")
+	u, _ = newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithStateStore(other), WithPaths(p))
+	update, err = u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+}
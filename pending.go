@@ -0,0 +1,158 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PendingSuffix is appended to the path of the executable to name the
+// directory an update waits in until the next start, see WithApplyOnNextStart.
+const PendingSuffix = ".pending"
+
+// pendingManifest describes the update in the pending directory.
+const pendingManifest = "update.json"
+
+// WithApplyOnNextStart makes Upgrade, UpgradeWithResult and AutoUpgrade stage
+// the verified update next to the executable instead of replacing it, for
+// programs that can't safely be replaced while they run, e.g. agents.
+// UpgradeResult.Pending is set when an update was staged, and a newer update
+// replaces a pending one.
+//
+// The update is installed by ApplyPending, which the program calls when it
+// starts, before doing anything else, or a small launcher that runs before it.
+func WithApplyOnNextStart() Opt {
+	return func(u *upgrader) {
+		u.applyOnStart = true
+	}
+}
+
+// HasPendingUpdate reports whether an update waits to be installed over the
+// executable at executablePath, see WithApplyOnNextStart. It is cheap enough
+// to call on every start before creating an Upgrader.
+func HasPendingUpdate(executablePath string) bool {
+	_, err := os.Stat(filepath.Join(executablePath+PendingSuffix, pendingManifest))
+	return err == nil
+}
+
+// PendingApplier is implemented by the Upgrader NewUpgrader returns, see
+// WithApplyOnNextStart.
+type PendingApplier interface {
+	// ApplyPending installs the update staged for the next start.
+	ApplyPending(ctx context.Context) (*UpgradeResult, error)
+}
+
+var _ PendingApplier = (*upgrader)(nil)
+
+// ApplyPending installs the update staged by WithApplyOnNextStart, like
+// Commit. The result has Upgraded set to false if no update is pending. A
+// pending update that can't be installed, e.g. because the executable was
+// replaced in the meantime, is discarded, and so is one that installs
+// anything but what the upgrader stages, see ErrInvalidUpdate.
+func (u *upgrader) ApplyPending(ctx context.Context) (*UpgradeResult, error) {
+	d, err := loadPending(u.executablePath + PendingSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return &UpgradeResult{}, nil
+	}
+	if err == nil {
+		// the manifest is writable by whoever can write next to the executable
+		err = u.checkDownloaded(d)
+	}
+	if err != nil {
+		os.RemoveAll(u.executablePath + PendingSuffix)
+		return &UpgradeResult{}, err
+	}
+	return u.applyUpdate(ctx, d, true)
+}
+
+// stagePending moves the update d into the pending directory instead of
+// installing it.
+func (u *upgrader) stagePending(d *DownloadedUpdate, result *UpgradeResult) error {
+	describeDownload(d, result)
+	dir := u.executablePath + PendingSuffix
+	err := u.movePending(d, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		d.Discard()
+		return fmt.Errorf("failed to stage the update for the next start: %w", err)
+	}
+	result.Pending = true
+	return nil
+}
+
+func (u *upgrader) movePending(d *DownloadedUpdate, dir string) error {
+	installed, err := installedDigest(u.executablePath)
+	if err != nil {
+		return err
+	}
+	d.InstalledSHA256 = installed
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.Rename(d.Dir, dir); err != nil {
+		// the staging dir is on another filesystem, staged files are all at its top
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(d.Dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := moveFile(filepath.Join(d.Dir, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+		d.Discard()
+	}
+
+	rebase := func(p string) string { return filepath.Join(dir, filepath.Base(p)) }
+	binarySHA256 := make(map[string]string, len(d.BinarySHA256))
+	for p, digest := range d.BinarySHA256 {
+		binarySHA256[rebase(p)] = digest
+	}
+	d.BinarySHA256 = binarySHA256
+	for dst, p := range d.Binaries {
+		d.Binaries[dst] = rebase(p)
+	}
+	for dst, p := range d.Files {
+		d.Files[dst] = rebase(p)
+	}
+	if d.Installer != "" {
+		d.Installer = rebase(d.Installer)
+	}
+	d.Dir = dir
+
+	// the manifest is renamed into place, so a pending update is always complete
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, pendingManifest+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, pendingManifest))
+}
+
+// loadPending reads the update pending in dir.
+func loadPending(dir string) (*DownloadedUpdate, error) {
+	data, err := os.ReadFile(filepath.Join(dir, pendingManifest))
+	if err != nil {
+		return nil, err
+	}
+	d := &DownloadedUpdate{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("failed to read the pending update: %w", err)
+	}
+	if d.Update == nil || d.Dir != dir {
+		return nil, fmt.Errorf("failed to read the pending update: it was staged in %s", d.Dir)
+	}
+	return d, nil
+}
@@ -0,0 +1,89 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyOnNextStart(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Applied", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithApplyOnNextStart())
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Pending)
+		assert.False(t, result.Upgraded)
+		assert.Equal(t, "v0.2.0", result.TargetVersion)
+		assert.Equal(t, ActionStaged, UpgradeReport(result, nil).Action)
+		assert.Equal(t, "old", readFile(t, executablePath))
+		assert.True(t, HasPendingUpdate(executablePath))
+
+		// the next start
+		result, err = u.ApplyPending(ctx)
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.Equal(t, "v0.2.0", result.NewVersion)
+		assert.Equal(t, "new", readFile(t, executablePath))
+		assert.False(t, HasPendingUpdate(executablePath))
+		assert.NoDirExists(t, executablePath+PendingSuffix)
+	})
+	t.Run("Upgrade", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithApplyOnNextStart())
+		require.NoError(t, u.Upgrade(ctx, "0.1.0"))
+		assert.Equal(t, "old", readFile(t, executablePath))
+		assert.True(t, HasPendingUpdate(executablePath))
+	})
+	t.Run("NothingPending", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+		result, err := u.ApplyPending(ctx)
+		require.NoError(t, err)
+		assert.False(t, result.Upgraded)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("Stale", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithApplyOnNextStart())
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+
+		// the executable was reinstalled before the next start
+		require.NoError(t, os.WriteFile(executablePath, []byte("reinstalled"), 0o755))
+		_, err = u.ApplyPending(ctx)
+		assert.ErrorIs(t, err, ErrStaleUpdate)
+		assert.Equal(t, "reinstalled", readFile(t, executablePath))
+		assert.False(t, HasPendingUpdate(executablePath))
+	})
+	t.Run("Edited", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithApplyOnNextStart())
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+
+		// the manifest was edited to run the staged binary as an installer
+		manifest := filepath.Join(executablePath+PendingSuffix, pendingManifest)
+		d, err := loadPending(executablePath + PendingSuffix)
+		require.NoError(t, err)
+		d.Installer = d.Binaries[executablePath]
+		data, err := json.Marshal(d)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(manifest, data, 0o600))
+
+		_, err = u.ApplyPending(ctx)
+		assert.ErrorIs(t, err, ErrInvalidUpdate)
+		assert.Equal(t, "old", readFile(t, executablePath))
+		assert.NoDirExists(t, executablePath+PendingSuffix)
+	})
+	t.Run("Corrupt", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+		require.NoError(t, os.Mkdir(executablePath+PendingSuffix, 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(executablePath+PendingSuffix, pendingManifest), []byte("{"), 0o600))
+		_, err := u.ApplyPending(ctx)
+		assert.Error(t, err)
+		assert.NoDirExists(t, executablePath+PendingSuffix)
+	})
+}
@@ -0,0 +1,70 @@
+package upgrade
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPinMismatch is returned when a pinned host presents a certificate chain
+// without any of its pinned keys, see WithPinnedKeys.
+var ErrPinMismatch = errors.New("certificate pin mismatch")
+
+// WithPinnedKeys pins the public keys host may present: connections to host
+// fail with ErrPinMismatch unless its verified certificate chain contains one of pins,
+// so a compromised CA or a TLS-intercepting middlebox can't serve a different
+// asset along with matching checksums. Pins are base64 encoded sha256 hashes
+// of a certificate's SubjectPublicKeyInfo, optionally prefixed with
+// "sha256/" like curl's --pinnedpubkey.
+//
+// Host may start with "*." to pin all subdomains. It is matched on the TLS
+// server name, so IP addresses can't be pinned. Pin an intermediate or a
+// backup key as well, since leaf keys change when certificates are renewed.
+// Hosts that aren't pinned, e.g. the hosts release assets redirect to, are
+// not checked; combine with WithAllowedHosts to refuse them. Like
+// WithTLSConfig, it fails all requests with ErrUnsupportedTransport if the
+// Transport of the WithHTTPClient client isn't an *http.Transport.
+func WithPinnedKeys(host string, pins ...string) Opt {
+	return func(u *upgrader) {
+		if u.pinnedKeys == nil {
+			u.pinnedKeys = make(map[string][]string)
+		}
+		for _, pin := range pins {
+			u.pinnedKeys[host] = append(u.pinnedKeys[host], strings.TrimPrefix(pin, "sha256/"))
+		}
+	}
+}
+
+// verifyPins checks the certificate chain of a connection against the keys
+// pinned for its host.
+func (u *upgrader) verifyPins(cs tls.ConnectionState) error {
+	var pins []string
+	for host, hostPins := range u.pinnedKeys {
+		if matchHost(host, cs.ServerName) {
+			pins = append(pins, hostPins...)
+		}
+	}
+	if len(pins) == 0 {
+		return nil
+	}
+	// only verified chains count, the server can append any certificate to
+	// the ones it presents
+	if len(cs.VerifiedChains) == 0 {
+		return fmt.Errorf("%w: the certificate chain of %s wasn't verified", ErrPinMismatch, cs.ServerName)
+	}
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			hash := base64.StdEncoding.EncodeToString(sum[:])
+			for _, pin := range pins {
+				if hash == pin {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s presented none of its pinned keys", ErrPinMismatch, cs.ServerName)
+}
@@ -0,0 +1,239 @@
+// Package pkgmgr detects executables that are owned by a system package manager.
+//
+// Replacing such an executable in place is either undone by the next package
+// manager run or corrupts the package database, so the upgrader refuses to
+// touch them unless explicitly told otherwise.
+package pkgmgr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Manager identifies a package manager.
+type Manager string
+
+const (
+	None     Manager = ""
+	Homebrew Manager = "homebrew"
+	Apt      Manager = "apt"
+	RPM      Manager = "rpm"
+	Snap     Manager = "snap"
+	Scoop    Manager = "scoop"
+	Nix      Manager = "nix"
+)
+
+// Guidance returns a human readable hint describing how to upgrade the named
+// package with the package manager.
+func (m Manager) Guidance(name string) string {
+	switch m {
+	case Homebrew:
+		return "run `brew upgrade " + name + "`"
+	case Apt:
+		return "run `sudo apt-get install --only-upgrade " + name + "`"
+	case RPM:
+		return "upgrade " + name + " with your system package manager (dnf, yum or zypper)"
+	case Snap:
+		return "run `sudo snap refresh " + name + "`"
+	case Scoop:
+		return "run `scoop update " + name + "`"
+	case Nix:
+		return "upgrade " + name + " through your nix profile or configuration"
+	default:
+		return "upgrade " + name + " with the tool that installed it"
+	}
+}
+
+type Detector interface {
+	// Detect returns the package manager that owns executablePath, or None.
+	Detect(ctx context.Context, executablePath string) (Manager, error)
+}
+
+type commandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+type detector struct {
+	run      commandRunner
+	lookPath func(string) (string, error)
+}
+
+var _ Detector = (*detector)(nil)
+
+func NewDetector() Detector {
+	return &detector{
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			return exec.CommandContext(ctx, name, args...).Output()
+		},
+		lookPath: exec.LookPath,
+	}
+}
+
+func (d *detector) Detect(ctx context.Context, executablePath string) (Manager, error) {
+	paths := []string{executablePath}
+	// Homebrew, nix and snap expose binaries through symlinks, so check where
+	// the executable actually lives as well.
+	if resolved, err := filepath.EvalSymlinks(executablePath); err == nil && resolved != executablePath {
+		paths = append(paths, resolved)
+	}
+
+	for _, p := range paths {
+		if m := detectFromPath(p); m != None {
+			return m, nil
+		}
+	}
+
+	if m := d.detectHomebrewPrefix(ctx, paths); m != None {
+		return m, nil
+	}
+
+	return d.detectSystemPackage(ctx, paths[len(paths)-1]), nil
+}
+
+// detectFromPath applies path heuristics that don't require running any commands.
+func detectFromPath(p string) Manager {
+	p = filepath.ToSlash(p)
+	lower := strings.ToLower(p)
+	switch {
+	case strings.HasPrefix(p, "/nix/store/"), strings.Contains(p, "/.nix-profile/"):
+		return Nix
+	case strings.HasPrefix(p, "/snap/"), strings.HasPrefix(p, "/var/lib/snapd/snap/"):
+		return Snap
+	case strings.Contains(p, "/Cellar/"), strings.Contains(p, "/Caskroom/"),
+		strings.HasPrefix(p, "/opt/homebrew/"), strings.HasPrefix(p, "/home/linuxbrew/.linuxbrew/"):
+		return Homebrew
+	case strings.Contains(lower, "/scoop/apps/"), strings.Contains(lower, "/scoop/shims/"):
+		return Scoop
+	}
+	return None
+}
+
+// detectHomebrewPrefix catches Homebrew installs with a custom prefix by
+// asking brew for it. Only the directories Homebrew keeps its packages in
+// count, since prefixes like /usr/local hold binaries installed by anyone.
+func (d *detector) detectHomebrewPrefix(ctx context.Context, paths []string) Manager {
+	if _, err := d.lookPath("brew"); err != nil {
+		return None
+	}
+	out, err := d.run(ctx, "brew", "--prefix")
+	if err != nil {
+		return None
+	}
+	prefix := strings.TrimSpace(string(out))
+	if prefix == "" {
+		return None
+	}
+	prefix = strings.TrimSuffix(prefix, string(os.PathSeparator))
+	for _, p := range paths {
+		for _, dir := range []string{"Cellar", "Caskroom", "opt"} {
+			if strings.HasPrefix(p, filepath.Join(prefix, dir)+string(os.PathSeparator)) {
+				return Homebrew
+			}
+		}
+	}
+	return None
+}
+
+// systemDirs are directories that are usually only written to by a system package manager.
+var systemDirs = []string{"/usr/bin", "/usr/sbin", "/bin", "/sbin", "/usr/libexec", "/usr/lib"}
+
+// detectSystemPackage asks dpkg and rpm whether they own p.
+func (d *detector) detectSystemPackage(ctx context.Context, p string) Manager {
+	inSystemDir := false
+	for _, dir := range systemDirs {
+		if strings.HasPrefix(p, dir+"/") {
+			inSystemDir = true
+			break
+		}
+	}
+	if !inSystemDir {
+		return None
+	}
+
+	if _, err := d.lookPath("dpkg-query"); err == nil {
+		if _, err := d.run(ctx, "dpkg-query", "-S", p); err == nil {
+			return Apt
+		}
+	}
+	if _, err := d.lookPath("rpm"); err == nil {
+		if _, err := d.run(ctx, "rpm", "-qf", p); err == nil {
+			return RPM
+		}
+	}
+	return None
+}
+
+// Upgrader upgrades a package using its package manager.
+type Upgrader interface {
+	Upgrade(ctx context.Context, pkg string) error
+}
+
+// VersionReader is implemented by Upgraders that can read the installed
+// version of a package, which may lag behind the latest release.
+type VersionReader interface {
+	InstalledVersion(ctx context.Context, pkg string) (string, error)
+}
+
+type homebrewUpgrader struct {
+	run commandRunner
+}
+
+var (
+	_ Upgrader      = (*homebrewUpgrader)(nil)
+	_ VersionReader = (*homebrewUpgrader)(nil)
+)
+
+// NewHomebrewUpgrader returns an Upgrader that runs `brew upgrade <formula>`.
+func NewHomebrewUpgrader() Upgrader {
+	return &homebrewUpgrader{
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			return exec.CommandContext(ctx, name, args...).CombinedOutput()
+		},
+	}
+}
+
+func (h *homebrewUpgrader) Upgrade(ctx context.Context, formula string) error {
+	out, err := h.run(ctx, "brew", "upgrade", formula)
+	if err != nil {
+		return fmt.Errorf("brew upgrade %s failed: %w: %s", formula, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// InstalledVersion returns the linked version of formula, without the
+// revision Homebrew appends to rebuilt bottles, e.g. "1.2.3" for "1.2.3_1".
+func (h *homebrewUpgrader) InstalledVersion(ctx context.Context, formula string) (string, error) {
+	out, err := h.run(ctx, "brew", "info", "--json=v2", formula)
+	if err != nil {
+		return "", fmt.Errorf("brew info %s failed: %w: %s", formula, err, strings.TrimSpace(string(out)))
+	}
+	var info struct {
+		Formulae []struct {
+			LinkedKeg string `json:"linked_keg"`
+			Installed []struct {
+				Version string `json:"version"`
+			} `json:"installed"`
+		} `json:"formulae"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return "", fmt.Errorf("failed to parse brew info %s: %w", formula, err)
+	}
+	if len(info.Formulae) == 0 {
+		return "", fmt.Errorf("formula %s isn't installed", formula)
+	}
+	f := info.Formulae[0]
+	v := f.LinkedKeg
+	if v == "" && len(f.Installed) > 0 {
+		v = f.Installed[len(f.Installed)-1].Version
+	}
+	if v == "" {
+		return "", fmt.Errorf("formula %s isn't installed", formula)
+	}
+	if i := strings.LastIndex(v, "_"); i > 0 {
+		v = v[:i]
+	}
+	return v, nil
+}
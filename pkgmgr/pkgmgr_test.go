@@ -0,0 +1,115 @@
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFromPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		expected Manager
+	}{
+		{name: "HomebrewCellar", path: "/usr/local/Cellar/savvy/0.1.0/bin/savvy", expected: Homebrew},
+		{name: "HomebrewAppleSilicon", path: "/opt/homebrew/bin/savvy", expected: Homebrew},
+		{name: "Linuxbrew", path: "/home/linuxbrew/.linuxbrew/bin/savvy", expected: Homebrew},
+		{name: "Nix", path: "/nix/store/abc-savvy-0.1.0/bin/savvy", expected: Nix},
+		{name: "Snap", path: "/snap/savvy/12/bin/savvy", expected: Snap},
+		{name: "Scoop", path: `C:/Users/me/scoop/apps/savvy/current/savvy.exe`, expected: Scoop},
+		{name: "SelfInstalled", path: "/home/me/.local/bin/savvy", expected: None},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, detectFromPath(tc.path))
+		})
+	}
+}
+
+func TestDetectSystemPackage(t *testing.T) {
+	ctx := context.Background()
+	lookPath := func(string) (string, error) { return "/usr/bin/tool", nil }
+	t.Run("OwnedByDpkg", func(t *testing.T) {
+		d := &detector{
+			lookPath: lookPath,
+			run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+				if name == "dpkg-query" {
+					return []byte("savvy: /usr/bin/savvy"), nil
+				}
+				return nil, errors.New("not found")
+			},
+		}
+		m, err := d.Detect(ctx, "/usr/bin/savvy")
+		assert.NoError(t, err)
+		assert.Equal(t, Apt, m)
+	})
+	t.Run("HomebrewPrefix", func(t *testing.T) {
+		d := &detector{
+			lookPath: func(name string) (string, error) { return "/custom/bin/" + name, nil },
+			run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+				if name == "brew" {
+					return []byte("/custom\n"), nil
+				}
+				return nil, errors.New("not found")
+			},
+		}
+		m, err := d.Detect(ctx, "/custom/opt/savvy/bin/savvy")
+		assert.NoError(t, err)
+		assert.Equal(t, Homebrew, m)
+		m, err = d.Detect(ctx, "/custom/bin/savvy")
+		assert.NoError(t, err)
+		assert.Equal(t, None, m, "binaries in the prefix aren't necessarily Homebrew's")
+	})
+	t.Run("NotInSystemDir", func(t *testing.T) {
+		d := &detector{
+			lookPath: lookPath,
+			run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+				t.Errorf("unexpected command: %s", name)
+				return nil, errors.New("unexpected")
+			},
+		}
+		d.lookPath = func(name string) (string, error) {
+			if name == "brew" {
+				return "", errors.New("not found")
+			}
+			return lookPath(name)
+		}
+		m, err := d.Detect(ctx, "/home/me/bin/savvy")
+		assert.NoError(t, err)
+		assert.Equal(t, None, m)
+	})
+}
+
+func TestHomebrewUpgrader(t *testing.T) {
+	var got []string
+	h := &homebrewUpgrader{
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			got = append([]string{name}, args...)
+			return []byte("Error: savvy not installed"), errors.New("exit status 1")
+		},
+	}
+	err := h.Upgrade(context.Background(), "savvy")
+	assert.Equal(t, []string{"brew", "upgrade", "savvy"}, got)
+	assert.ErrorContains(t, err, "savvy not installed")
+}
+
+func TestHomebrewInstalledVersion(t *testing.T) {
+	h := &homebrewUpgrader{
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			return []byte(`{"formulae":[{"name":"savvy","linked_keg":"0.2.0_1","installed":[{"version":"0.1.0"},{"version":"0.2.0_1"}]}],"casks":[]}`), nil
+		},
+	}
+	v, err := h.InstalledVersion(context.Background(), "savvy")
+	require.NoError(t, err)
+	assert.Equal(t, "0.2.0", v)
+
+	h.run = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return []byte(`{"formulae":[],"casks":[]}`), nil
+	}
+	_, err = h.InstalledVersion(context.Background(), "savvy")
+	assert.Error(t, err)
+}
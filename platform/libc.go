@@ -0,0 +1,102 @@
+package platform
+
+import (
+	"bufio"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Libc identifies the C library of a Linux system.
+type Libc string
+
+const (
+	LibcUnknown Libc = ""
+	Glibc       Libc = "glibc"
+	Musl        Libc = "musl"
+)
+
+// libcMarkers are the suffixes asset names use to mark builds for a C library.
+var libcMarkers = map[Libc][]string{
+	Musl:  {"musl", "alpine"},
+	Glibc: {"gnu", "glibc"},
+}
+
+// TrimLibc removes a trailing libc marker such as "_musl" or "-gnu" from
+// name and returns the libc it names.
+func TrimLibc(name string) (string, Libc) {
+	for libc, markers := range libcMarkers {
+		for _, m := range markers {
+			for _, sep := range Separators {
+				if t := strings.TrimSuffix(name, sep+m); t != name {
+					return t, libc
+				}
+			}
+		}
+	}
+	return name, LibcUnknown
+}
+
+// DetectLibc detects the C library of the running Linux system.
+// It returns LibcUnknown on other operating systems.
+func DetectLibc() Libc {
+	if runtime.GOOS != "linux" {
+		return LibcUnknown
+	}
+	// dynamically linked binaries name their loader
+	if libc := libcFromInterpreter("/proc/self/exe"); libc != LibcUnknown {
+		return libc
+	}
+	// static binaries don't, so look at the system instead
+	if matches, _ := filepath.Glob("/lib/ld-musl-*.so.1"); len(matches) > 0 {
+		return Musl
+	}
+	if osReleaseID("/etc/os-release") == "alpine" {
+		return Musl
+	}
+	return Glibc
+}
+
+// libcFromInterpreter inspects the ELF interpreter of the binary at path.
+func libcFromInterpreter(path string) Libc {
+	f, err := elf.Open(path)
+	if err != nil {
+		return LibcUnknown
+	}
+	defer f.Close()
+
+	interp := f.Section(".interp")
+	if interp == nil {
+		return LibcUnknown
+	}
+	data, err := interp.Data()
+	if err != nil {
+		return LibcUnknown
+	}
+	switch s := string(data); {
+	case strings.Contains(s, "musl"):
+		return Musl
+	case strings.Contains(s, "ld-linux"):
+		return Glibc
+	}
+	return LibcUnknown
+}
+
+// osReleaseID returns the ID field of an os-release file.
+func osReleaseID(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "ID="); ok {
+			return strings.Trim(v, `"'`)
+		}
+	}
+	return ""
+}
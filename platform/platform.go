@@ -0,0 +1,102 @@
+// Package platform maps GOOS/GOARCH values to the names release assets commonly use for them.
+package platform
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// osAliases groups names used for the same operating system. The first name is the GOOS value.
+var osAliases = [][]string{
+	{"darwin", "macos", "osx"},
+	{"windows", "win"},
+	{"linux"},
+	{"freebsd"},
+	{"openbsd"},
+	{"netbsd"},
+	{"solaris", "sunos"},
+}
+
+// archAliases groups names used for the same architecture. The first name is the GOARCH value.
+var archAliases = [][]string{
+	{"amd64", "x86_64", "x64"},
+	{"arm64", "aarch64", "armv8"},
+	{"386", "i386", "i686", "x86"},
+	{"arm", "armv7", "armhf", "armv7l"},
+	{"riscv64", "riscv64gc"},
+	{"ppc64le", "powerpc64le"},
+	{"loong64", "loongarch64"},
+}
+
+// Separators are the separators used between the os and arch in asset names.
+var Separators = []string{"_", "-"}
+
+// OSAliases returns the names used for os, starting with os itself.
+func OSAliases(os string) []string {
+	return aliases(osAliases, os)
+}
+
+// ArchAliases returns the names used for arch, starting with arch itself.
+func ArchAliases(arch string) []string {
+	return aliases(archAliases, arch)
+}
+
+func aliases(groups [][]string, name string) []string {
+	name = strings.ToLower(name)
+	for _, g := range groups {
+		if i := slices.Index(g, name); i >= 0 {
+			// keep name first so exact matches are preferred
+			return append([]string{name}, append(slices.Clone(g[:i]), g[i+1:]...)...)
+		}
+	}
+	return []string{name}
+}
+
+// Suffixes returns every "<os><sep><arch>" combination for os and arch, lowercased,
+// starting with "<os>_<arch>".
+func Suffixes(os, arch string) []string {
+	var suffixes []string
+	for _, o := range OSAliases(os) {
+		for _, a := range ArchAliases(arch) {
+			for _, sep := range Separators {
+				suffixes = append(suffixes, o+sep+a)
+			}
+		}
+	}
+	return suffixes
+}
+
+// HasSuffix reports whether name ends with one of suffixes on a word boundary,
+// so that "win_amd64" doesn't match "darwin_amd64". name is expected to be lowercase.
+func HasSuffix(name string, suffixes []string) bool {
+	for _, s := range suffixes {
+		if !strings.HasSuffix(name, s) {
+			continue
+		}
+		rest := name[:len(name)-len(s)]
+		if rest == "" || strings.ContainsAny(rest[len(rest)-1:], "_-./") {
+			return true
+		}
+	}
+	return false
+}
+
+// EmulatedArchs returns the architectures whose binaries os can run on arch
+// through emulation, for releases without a native build: Windows 11 on ARM
+// runs amd64 binaries.
+func EmulatedArchs(os, arch string) []string {
+	if os == "windows" && arch == "arm64" {
+		return []string{"amd64"}
+	}
+	return nil
+}
+
+// NativeArch returns the architecture of the machine, which differs from
+// runtime.GOARCH when an amd64 binary runs under Rosetta 2 on Apple Silicon.
+func NativeArch() string {
+	if runtime.GOARCH == "amd64" && IsTranslated() {
+		return "arm64"
+	}
+	return runtime.GOARCH
+}
@@ -0,0 +1,71 @@
+package platform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliases(t *testing.T) {
+	assert.Equal(t, []string{"amd64", "x86_64", "x64"}, ArchAliases("amd64"))
+	assert.Equal(t, []string{"x86_64", "amd64", "x64"}, ArchAliases("X86_64"))
+	assert.Equal(t, []string{"macos", "darwin", "osx"}, OSAliases("macos"))
+	assert.Equal(t, []string{"plan9"}, OSAliases("plan9"))
+	assert.Equal(t, []string{"riscv64", "riscv64gc"}, ArchAliases("riscv64"))
+}
+
+func TestEmulatedArchs(t *testing.T) {
+	assert.Equal(t, []string{"amd64"}, EmulatedArchs("windows", "arm64"))
+	assert.Empty(t, EmulatedArchs("linux", "arm64"))
+	assert.Empty(t, EmulatedArchs("windows", "amd64"))
+}
+
+func TestHasSuffix(t *testing.T) {
+	testCases := []struct {
+		name     string
+		os, arch string
+		expected bool
+	}{
+		{name: "savvy_darwin_amd64", os: "darwin", arch: "amd64", expected: true},
+		{name: "savvy-macos-x86_64", os: "darwin", arch: "amd64", expected: true},
+		{name: "savvy_osx-arm64", os: "darwin", arch: "arm64", expected: true},
+		{name: "savvy_linux_aarch64", os: "linux", arch: "arm64", expected: true},
+		{name: "savvy_win_x64", os: "windows", arch: "amd64", expected: true},
+		{name: "savvy_darwin_amd64", os: "windows", arch: "amd64", expected: false},
+		{name: "savvy_linux_arm64", os: "linux", arch: "arm", expected: false},
+		{name: "savvy_linux_x86_64", os: "linux", arch: "386", expected: false},
+		{name: "savvy_windows_arm64", os: "windows", arch: "arm64", expected: true},
+		{name: "savvy-windows-aarch64", os: "windows", arch: "arm64", expected: true},
+		{name: "savvy_freebsd_amd64", os: "freebsd", arch: "amd64", expected: true},
+		{name: "savvy_openbsd_arm64", os: "openbsd", arch: "arm64", expected: true},
+		{name: "savvy_linux_riscv64", os: "linux", arch: "riscv64", expected: true},
+		{name: "savvy_linux_riscv64gc", os: "linux", arch: "riscv64", expected: true},
+		{name: "savvy_linux_armv7l", os: "linux", arch: "arm", expected: true},
+		{name: "savvy_netbsd_amd64", os: "freebsd", arch: "amd64", expected: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name+"/"+tc.os+"_"+tc.arch, func(t *testing.T) {
+			assert.Equal(t, tc.expected, HasSuffix(tc.name, Suffixes(tc.os, tc.arch)))
+		})
+	}
+}
+
+func TestTrimLibc(t *testing.T) {
+	testCases := []struct {
+		name     string
+		trimmed  string
+		expected Libc
+	}{
+		{name: "savvy_linux_amd64_musl", trimmed: "savvy_linux_amd64", expected: Musl},
+		{name: "savvy-linux-amd64-alpine", trimmed: "savvy-linux-amd64", expected: Musl},
+		{name: "savvy_linux_amd64-gnu", trimmed: "savvy_linux_amd64", expected: Glibc},
+		{name: "savvy_linux_amd64", trimmed: "savvy_linux_amd64", expected: LibcUnknown},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			trimmed, libc := TrimLibc(tc.name)
+			assert.Equal(t, tc.trimmed, trimmed)
+			assert.Equal(t, tc.expected, libc)
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package platform
+
+import "syscall"
+
+// IsTranslated reports whether the process runs under Rosetta 2 translation on Apple Silicon.
+func IsTranslated() bool {
+	v, err := syscall.SysctlUint32("sysctl.proc_translated")
+	return err == nil && v == 1
+}
@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package platform
+
+// IsTranslated reports whether the process runs under Rosetta 2 translation on Apple Silicon.
+func IsTranslated() bool {
+	return false
+}
@@ -0,0 +1,191 @@
+// Package plugin upgrades a directory of plugin binaries, each released from its own repository.
+//
+// The installed version of every plugin is tracked in a JSON manifest in the
+// plugin directory.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	upgrade "github.com/getsavvyinc/upgrade-cli"
+)
+
+// Plugin is a binary installed in the plugin directory.
+type Plugin struct {
+	// Name is the file name of the plugin binary, also used to find it in release assets.
+	Name  string
+	Owner string
+	Repo  string
+	// Opts customize the upgrader for this plugin, e.g. its asset naming.
+	Opts []upgrade.Opt
+}
+
+// Manifest records the installed version of every plugin.
+type Manifest struct {
+	Plugins map[string]Entry `json:"plugins"`
+}
+
+type Entry struct {
+	Owner     string    `json:"owner"`
+	Repo      string    `json:"repo"`
+	Version   string    `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Result describes the outcome for a single plugin.
+type Result struct {
+	Name string
+	// PreviousVersion is empty if the plugin wasn't installed before.
+	PreviousVersion string
+	Version         string
+	Upgraded        bool
+	Err             error
+}
+
+// notInstalledVersion is used to compare against when a plugin isn't installed yet.
+const notInstalledVersion = "0.0.0"
+
+type upgraderFactory func(owner, repo, executablePath string, opts ...upgrade.Opt) upgrade.StagedUpgrader
+
+type Manager struct {
+	dir          string
+	manifestPath string
+	plugins      []Plugin
+	newUpgrader  upgraderFactory
+}
+
+type ManagerOpt func(*Manager)
+
+// WithManifestPath overrides the default manifest location, <dir>/plugins.json.
+func WithManifestPath(path string) ManagerOpt {
+	return func(m *Manager) {
+		m.manifestPath = path
+	}
+}
+
+func NewManager(dir string, plugins []Plugin, opts ...ManagerOpt) *Manager {
+	m := &Manager{
+		dir:          dir,
+		manifestPath: filepath.Join(dir, "plugins.json"),
+		plugins:      plugins,
+		newUpgrader:  newStagedUpgrader,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func newStagedUpgrader(owner, repo, executablePath string, opts ...upgrade.Opt) upgrade.StagedUpgrader {
+	return upgrade.NewUpgrader(owner, repo, executablePath, opts...).(upgrade.StagedUpgrader)
+}
+
+// Manifest returns the current manifest.
+func (m *Manager) Manifest() (*Manifest, error) {
+	data, err := os.ReadFile(m.manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Manifest{Plugins: map[string]Entry{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin manifest %s: %w", m.manifestPath, err)
+	}
+	if manifest.Plugins == nil {
+		manifest.Plugins = map[string]Entry{}
+	}
+	return &manifest, nil
+}
+
+func (m *Manager) saveManifest(manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin manifest: %w", err)
+	}
+	tmp := m.manifestPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write plugin manifest: %w", err)
+	}
+	if err := os.Rename(tmp, m.manifestPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write plugin manifest: %w", err)
+	}
+	return nil
+}
+
+// UpgradeAll installs or upgrades every plugin to its latest release.
+// A failing plugin doesn't stop the others; the returned error joins all failures.
+func (m *Manager) UpgradeAll(ctx context.Context) ([]Result, error) {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create plugin dir: %w", err)
+	}
+	manifest, err := m.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(m.plugins))
+	var errs []error
+	for _, p := range m.plugins {
+		r := m.upgrade(ctx, p, manifest)
+		results = append(results, r)
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", p.Name, r.Err))
+			continue
+		}
+		if !r.Upgraded {
+			continue
+		}
+		manifest.Plugins[p.Name] = Entry{Owner: p.Owner, Repo: p.Repo, Version: r.Version, UpdatedAt: time.Now().UTC()}
+		if err := m.saveManifest(manifest); err != nil {
+			return results, errors.Join(append(errs, err)...)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+func (m *Manager) upgrade(ctx context.Context, p Plugin, manifest *Manifest) Result {
+	path := filepath.Join(m.dir, p.Name)
+	r := Result{Name: p.Name}
+
+	current := notInstalledVersion
+	if e, ok := manifest.Plugins[p.Name]; ok {
+		if _, err := os.Stat(path); err == nil {
+			current = e.Version
+			r.PreviousVersion = e.Version
+		}
+	}
+	r.Version = r.PreviousVersion
+
+	u := m.newUpgrader(p.Owner, p.Repo, path, p.Opts...)
+	update, err := u.Check(ctx, current)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if !update.Available {
+		return r
+	}
+
+	d, err := u.Download(ctx, update)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if _, err := u.Apply(ctx, d); err != nil {
+		r.Err = err
+		return r
+	}
+
+	r.Version = update.LatestVersion
+	r.Upgraded = true
+	return r
+}
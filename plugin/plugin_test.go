@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	upgrade "github.com/getsavvyinc/upgrade-cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUpgrader "installs" latest by writing it to executablePath.
+type fakeUpgrader struct {
+	upgrade.Upgrader
+	executablePath string
+	latest         string
+	err            error
+}
+
+func (f *fakeUpgrader) Check(ctx context.Context, currentVersion string) (*upgrade.Update, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &upgrade.Update{CurrentVersion: currentVersion, LatestVersion: f.latest, Available: currentVersion != f.latest}, nil
+}
+
+func (f *fakeUpgrader) Download(ctx context.Context, update *upgrade.Update) (*upgrade.DownloadedUpdate, error) {
+	return &upgrade.DownloadedUpdate{Update: update}, nil
+}
+
+func (f *fakeUpgrader) Apply(ctx context.Context, d *upgrade.DownloadedUpdate) (*upgrade.UpgradeResult, error) {
+	return &upgrade.UpgradeResult{}, os.WriteFile(f.executablePath, []byte(d.Update.LatestVersion), 0o755)
+}
+
+func TestUpgradeAll(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	latest := map[string]string{"fmt": "1.1.0", "lint": "2.0.0"}
+	failing := errors.New("rate limited")
+
+	plugins := []Plugin{
+		{Name: "fmt", Owner: "acme", Repo: "fmt-plugin"},
+		{Name: "lint", Owner: "acme", Repo: "lint-plugin"},
+		{Name: "broken", Owner: "acme", Repo: "broken-plugin"},
+	}
+	m := NewManager(dir, plugins)
+	m.newUpgrader = func(owner, repo, executablePath string, opts ...upgrade.Opt) upgrade.StagedUpgrader {
+		name := filepath.Base(executablePath)
+		if name == "broken" {
+			return &fakeUpgrader{err: failing}
+		}
+		return &fakeUpgrader{executablePath: executablePath, latest: latest[name]}
+	}
+
+	results, err := m.UpgradeAll(ctx)
+	assert.ErrorIs(t, err, failing)
+	require.Len(t, results, 3)
+	assert.True(t, results[0].Upgraded)
+	assert.Equal(t, "", results[0].PreviousVersion)
+	assert.Equal(t, "1.1.0", results[0].Version)
+	assert.ErrorIs(t, results[2].Err, failing)
+
+	manifest, err := m.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.0", manifest.Plugins["fmt"].Version)
+	assert.Equal(t, "2.0.0", manifest.Plugins["lint"].Version)
+	assert.NotContains(t, manifest.Plugins, "broken")
+
+	t.Run("UpToDate", func(t *testing.T) {
+		latest["lint"] = "2.1.0"
+		results, err := m.UpgradeAll(ctx)
+		assert.ErrorIs(t, err, failing)
+		assert.False(t, results[0].Upgraded)
+		assert.True(t, results[1].Upgraded)
+		assert.Equal(t, "2.0.0", results[1].PreviousVersion)
+		assert.Equal(t, "2.1.0", results[1].Version)
+	})
+}
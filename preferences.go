@@ -0,0 +1,79 @@
+package upgrade
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// WithStateStore makes Check, IsNewVersionAvailable and AutoUpgrade respect
+// the versions the user skipped and snoozes stored in store, see
+// state.SkipVersion and state.Snooze, so CLIs don't nag about releases the
+// user declined. Upgrade and UpgradeWithResult ignore them, since running an
+// upgrade is an explicit request.
+func WithStateStore(store state.Store) Opt {
+	return func(u *upgrader) {
+		u.stateStore = store
+	}
+}
+
+// WithStateKey signs the state store of WithStateStore or WithPaths with key,
+// see state.NewSignedStore, so the state, e.g. the backups RestoreBackup
+// restores, can't be edited without the key. Loading state that doesn't match
+// its signature fails with state.ErrTampered.
+func WithStateKey(key []byte) Opt {
+	return func(u *upgrader) {
+		u.stateKey = key
+	}
+}
+
+// WithSkippedVersions holds back updates to versions, e.g. versions listed in
+// a config file, like versions the user skipped with state.SkipVersion. Like
+// those, they only apply to Check, IsNewVersionAvailable and AutoUpgrade.
+func WithSkippedVersions(versions ...string) Opt {
+	return func(u *upgrader) {
+		u.skippedVersions = append(u.skippedVersions, versions...)
+	}
+}
+
+// applyPreferences holds back an available update the user skipped or snoozed.
+// Installs below the minimum supported version or on a yanked version are
+// always offered the update.
+func (u *upgrader) applyPreferences(ctx context.Context, update *Update) error {
+	if u.stateStore == nil && len(u.skippedVersions) == 0 || !update.Available || update.BelowMinimum || update.CurrentYanked {
+		return nil
+	}
+	skipped := u.skippedVersions
+	if u.stateStore != nil {
+		st, err := u.stateStore.Load(ctx)
+		if err != nil {
+			return err
+		}
+		skipped = append(skipped[:len(skipped):len(skipped)], st.SkippedVersions...)
+		update.Snoozed = st.IsSnoozed(time.Now())
+	}
+	update.Skipped = u.isSkipped(skipped, update.LatestVersion)
+	if update.Skipped || update.Snoozed {
+		update.Available = false
+	}
+	return nil
+}
+
+// isSkipped reports whether v is one of skipped, ignoring differences such as a "v" prefix.
+func (u *upgrader) isSkipped(skipped []string, v string) bool {
+	if slices.Contains(skipped, v) {
+		return true
+	}
+	want, err := u.parseVersion(v)
+	if err != nil {
+		return false
+	}
+	for _, s := range skipped {
+		if other, err := u.parseVersion(s); err == nil && u.versionScheme.Compare(other, want) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package upgrade
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateStore(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithStateStore(store))
+
+	require.NoError(t, state.SkipVersion(ctx, store, "0.2.0"))
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Skipped)
+	assert.False(t, update.Available)
+	available, err := u.IsNewVersionAvailable(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.False(t, available)
+
+	result, err := u.AutoUpgrade(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.False(t, result.Upgraded)
+	assert.Equal(t, "old", readFile(t, executablePath))
+
+	t.Run("Snoozed", func(t *testing.T) {
+		require.NoError(t, store.Save(ctx, &state.State{}))
+		require.NoError(t, state.Snooze(ctx, store, time.Now().Add(time.Hour)))
+		update, err := u.Check(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, update.Snoozed)
+		assert.False(t, update.Available)
+
+		require.NoError(t, state.Snooze(ctx, store, time.Now().Add(-time.Second)))
+		update, err = u.Check(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, update.Available)
+	})
+
+	// explicit upgrades ignore the preferences
+	require.NoError(t, state.Snooze(ctx, store, time.Now().Add(time.Hour)))
+	result, err = u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "new", readFile(t, executablePath))
+}
+
+func TestSkippedVersions(t *testing.T) {
+	ctx := context.Background()
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithSkippedVersions("0.2.0"))
+
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Skipped)
+	assert.False(t, update.Available)
+
+	result, err := u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+}
@@ -0,0 +1,57 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// fileAttrs are the attributes of an installed binary that are carried over to its replacement.
+type fileAttrs struct {
+	mode     os.FileMode
+	hasOwner bool
+	uid, gid int
+	// xattrs holds extended attributes, including Linux file capabilities.
+	xattrs map[string][]byte
+}
+
+// captureAttrs returns the attributes of the file at path, or nil if it doesn't exist.
+func captureAttrs(path string) (*fileAttrs, error) {
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	a := &fileAttrs{mode: fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)}
+	a.uid, a.gid, a.hasOwner = fileOwner(fi)
+	if a.xattrs, err = getXattrs(path); err != nil {
+		return nil, fmt.Errorf("failed to read extended attributes of %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// applyTo applies a to the file at path.
+func (a *fileAttrs) applyTo(path string) error {
+	// chown clears setuid bits and capabilities, so it goes first
+	if a.hasOwner {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if uid, gid, ok := fileOwner(fi); !ok || uid != a.uid || gid != a.gid {
+			if err := os.Chown(path, a.uid, a.gid); err != nil {
+				return fmt.Errorf("failed to preserve ownership: %w", err)
+			}
+		}
+	}
+	if err := os.Chmod(path, a.mode); err != nil {
+		return fmt.Errorf("failed to preserve file mode: %w", err)
+	}
+	if err := setXattrs(path, a.xattrs); err != nil {
+		return fmt.Errorf("failed to preserve extended attributes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package upgrade
+
+import "os"
+
+func fileOwner(fi os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
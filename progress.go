@@ -0,0 +1,149 @@
+package upgrade
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// Progress describes a release asset being downloaded, see WithProgress.
+type Progress = asset.Progress
+
+// WithProgress calls fn as release assets are downloaded, e.g. to render a
+// progress bar. fn should return quickly. It replaces WithProgressBar.
+func WithProgress(fn func(Progress)) Opt {
+	return func(u *upgrader) {
+		u.assetOpts = append(u.assetOpts, asset.WithProgress(fn))
+	}
+}
+
+// WithProgressBar renders download progress to w, e.g. os.Stderr: a bar with
+// the percentage, speed and remaining time if w is a terminal, and a log line
+// every few seconds otherwise. It replaces WithProgress.
+func WithProgressBar(w io.Writer) Opt {
+	return WithProgress(newProgressBar(w).update)
+}
+
+const (
+	// redrawInterval limits how often the bar is redrawn on a terminal.
+	redrawInterval = 100 * time.Millisecond
+	// logInterval is the time between log lines when not on a terminal.
+	logInterval = 5 * time.Second
+	barWidth    = 30
+)
+
+// progressBar renders Progress reports.
+type progressBar struct {
+	w   io.Writer
+	tty bool
+	now func() time.Time
+
+	mu    sync.Mutex
+	start time.Time
+	last  time.Time
+	// width is the length of the last line drawn on the terminal.
+	width int
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	f, ok := w.(*os.File)
+	tty := false
+	if ok {
+		fi, err := f.Stat()
+		tty = err == nil && fi.Mode()&os.ModeCharDevice != 0
+	}
+	return &progressBar{w: w, tty: tty, now: time.Now}
+}
+
+func (b *progressBar) update(p Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if b.start.IsZero() {
+		b.start, b.last, b.width = now, time.Time{}, 0
+	}
+	interval := logInterval
+	if b.tty {
+		interval = redrawInterval
+	}
+	if !p.Done && now.Sub(b.last) < interval {
+		return
+	}
+	b.last = now
+
+	elapsed := now.Sub(b.start)
+	var speed float64
+	if elapsed > 0 {
+		speed = float64(p.Downloaded) / elapsed.Seconds()
+	}
+	if b.tty {
+		b.draw(p, speed)
+	} else {
+		b.log(p, elapsed, speed)
+	}
+	if p.Done {
+		b.start = time.Time{}
+	}
+}
+
+// draw redraws the bar in place.
+func (b *progressBar) draw(p Progress, speed float64) {
+	var line strings.Builder
+	line.WriteString(p.Name)
+	if p.Total > 0 {
+		filled := int(float64(barWidth) * float64(p.Downloaded) / float64(p.Total))
+		filled = min(filled, barWidth)
+		fmt.Fprintf(&line, " %3d%% [%s%s] %s/%s", percent(p), strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled),
+			formatBytes(uint64(p.Downloaded)), formatBytes(uint64(p.Total)))
+	} else {
+		fmt.Fprintf(&line, " %s", formatBytes(uint64(p.Downloaded)))
+	}
+	fmt.Fprintf(&line, " %s/s", formatBytes(uint64(speed)))
+	if eta, ok := remaining(p, speed); ok && !p.Done {
+		fmt.Fprintf(&line, " ETA %s", eta)
+	}
+
+	// pad with spaces to erase the rest of a longer previous line
+	s := line.String()
+	pad := max(b.width-len(s), 0)
+	b.width = len(s)
+	fmt.Fprintf(b.w, "\r%s%s", s, strings.Repeat(" ", pad))
+	if p.Done {
+		fmt.Fprintln(b.w)
+	}
+}
+
+// log writes a line describing the download.
+func (b *progressBar) log(p Progress, elapsed time.Duration, speed float64) {
+	if p.Done {
+		fmt.Fprintf(b.w, "downloaded %s: %s in %s (%s/s)\n", p.Name, formatBytes(uint64(p.Downloaded)), elapsed.Round(time.Second), formatBytes(uint64(speed)))
+		return
+	}
+	if p.Total <= 0 {
+		fmt.Fprintf(b.w, "downloading %s: %s (%s/s)\n", p.Name, formatBytes(uint64(p.Downloaded)), formatBytes(uint64(speed)))
+		return
+	}
+	fmt.Fprintf(b.w, "downloading %s: %d%% of %s (%s/s", p.Name, percent(p), formatBytes(uint64(p.Total)), formatBytes(uint64(speed)))
+	if eta, ok := remaining(p, speed); ok {
+		fmt.Fprintf(b.w, ", ETA %s", eta)
+	}
+	fmt.Fprintln(b.w, ")")
+}
+
+func percent(p Progress) int {
+	return int(100 * p.Downloaded / p.Total)
+}
+
+// remaining estimates the time left at speed bytes per second.
+func remaining(p Progress, speed float64) (time.Duration, bool) {
+	if p.Total <= 0 || speed <= 0 {
+		return 0, false
+	}
+	left := float64(p.Total-p.Downloaded) / speed
+	return (time.Duration(left * float64(time.Second))).Round(time.Second), true
+}
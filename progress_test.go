@@ -0,0 +1,57 @@
+package upgrade
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressBar(t *testing.T) {
+	const mib = 1 << 20
+	clock := time.Unix(0, 0)
+	var out strings.Builder
+	b := &progressBar{w: &out, now: func() time.Time { return clock }}
+
+	report := func(elapsed time.Duration, downloaded int64, done bool) {
+		clock = time.Unix(0, 0).Add(elapsed)
+		b.update(Progress{Name: "savvy.tar.gz", Downloaded: downloaded, Total: 10 * mib, Done: done})
+	}
+
+	t.Run("Log", func(t *testing.T) {
+		report(0, 0, false)
+		out.Reset()
+		report(time.Second, 1*mib, false)
+		report(5*time.Second, 5*mib, false)
+		report(10*time.Second, 10*mib, true)
+		assert.Equal(t, "downloading savvy.tar.gz: 50% of 10.0 MiB (1.0 MiB/s, ETA 5s)\n"+
+			"downloaded savvy.tar.gz: 10.0 MiB in 10s (1.0 MiB/s)\n", out.String())
+	})
+
+	t.Run("Terminal", func(t *testing.T) {
+		b.tty = true
+		out.Reset()
+		report(0, 0, false)
+		report(2*time.Second, 5*mib, false)
+		report(4*time.Second, 10*mib, true)
+		lines := strings.Split(out.String(), "\r")
+		require.Len(t, lines, 4)
+		assert.Equal(t, "savvy.tar.gz  50% [===============               ] 5.0 MiB/10.0 MiB 2.5 MiB/s ETA 2s", lines[2])
+		// padded to erase the ETA of the previous line
+		assert.Equal(t, "savvy.tar.gz 100% [==============================] 10.0 MiB/10.0 MiB 2.5 MiB/s      \n", lines[3])
+	})
+}
+
+func TestWithProgress(t *testing.T) {
+	var reports []Progress
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithProgress(func(p Progress) {
+		reports = append(reports, p)
+	}))
+	_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	require.NotEmpty(t, reports)
+	assert.True(t, reports[len(reports)-1].Done)
+}
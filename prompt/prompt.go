@@ -0,0 +1,159 @@
+// Package prompt asks the user to confirm an upgrade in the terminal, showing
+// the current and latest version and a summary of the release notes.
+package prompt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	upgrade "github.com/getsavvyinc/upgrade-cli"
+)
+
+// DefaultNotesLines is how many lines of release notes are shown by default.
+const DefaultNotesLines = 10
+
+// ErrNonInteractive is returned by Confirm when there is no terminal to ask
+// the user in and AssumeYes isn't set. CLIs can suggest their --yes flag then.
+var ErrNonInteractive = errors.New("can't ask for confirmation without a terminal")
+
+type prompter struct {
+	in         io.Reader
+	out        io.Writer
+	assumeYes  bool
+	notesLines int
+}
+
+// Opt configures Confirm.
+type Opt func(*prompter)
+
+// WithInput reads the answer from r instead of os.Stdin. It is treated as a terminal.
+func WithInput(r io.Reader) Opt {
+	return func(p *prompter) {
+		p.in = r
+	}
+}
+
+// WithOutput writes the prompt to w instead of os.Stderr.
+func WithOutput(w io.Writer) Opt {
+	return func(p *prompter) {
+		p.out = w
+	}
+}
+
+// AssumeYes confirms without asking if yes is true, e.g. for a --yes flag or in CI.
+func AssumeYes(yes bool) Opt {
+	return func(p *prompter) {
+		p.assumeYes = yes
+	}
+}
+
+// WithNotesLines shows up to n lines of release notes instead of
+// DefaultNotesLines. Release notes are hidden if n is 0.
+func WithNotesLines(n int) Opt {
+	return func(p *prompter) {
+		p.notesLines = n
+	}
+}
+
+// Confirm shows update and asks the user whether to install it. Anything but
+// "y" or "yes" declines. It returns ErrNonInteractive if stdin isn't a
+// terminal, unless AssumeYes is set.
+func Confirm(ctx context.Context, update *upgrade.Update, opts ...Opt) (bool, error) {
+	p := &prompter{out: os.Stderr, notesLines: DefaultNotesLines}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.assumeYes {
+		return true, nil
+	}
+	if p.in == nil {
+		if !isTerminal(os.Stdin) {
+			return false, ErrNonInteractive
+		}
+		p.in = os.Stdin
+	}
+
+	// the release is written by whoever publishes it, so it can't be trusted
+	// to leave the terminal alone
+	fmt.Fprintf(p.out, "A new version is available: %s → %s\n", sanitize(update.CurrentVersion), sanitize(update.LatestVersion))
+	if update.Release != nil {
+		if notes := summarize(sanitize(update.Release.Body), p.notesLines); notes != "" {
+			fmt.Fprintf(p.out, "\n%s\n", notes)
+			if update.Release.HTMLURL != "" {
+				fmt.Fprintf(p.out, "\nRelease notes: %s\n", sanitize(update.Release.HTMLURL))
+			}
+			fmt.Fprintln(p.out)
+		}
+	}
+	fmt.Fprint(p.out, "Upgrade now? [y/N] ")
+
+	// reading blocks until the user answers, so give up on it when ctx is done
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(p.in).ReadString('\n')
+		answer <- line
+	}()
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(p.out)
+		return false, ctx.Err()
+	case line := <-answer:
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+}
+
+// escapeSequence matches ANSI escape sequences: CSI sequences such as colors
+// and cursor movement, in their 7 and 8-bit forms, OSC sequences such as
+// window titles and hyperlinks, and two-character escapes.
+var escapeSequence = regexp.MustCompile(`(?:\x1b\[|\x{9b})[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)?|\x1b[@-_]?`)
+
+// sanitize strips escape sequences and control characters but newlines and
+// tabs from s, so that it can't rewrite the prompt or control the terminal.
+// Invalid UTF-8 is dropped too, since a terminal may read it as controls.
+func sanitize(s string) string {
+	s = escapeSequence.ReplaceAllString(strings.ToValidUTF8(s, ""), "")
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// summarize returns up to n non-blank lines of notes, marking elided lines with "…".
+func summarize(notes string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(notes, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(lines) == n {
+			lines = append(lines, "  …")
+			break
+		}
+		lines = append(lines, "  "+line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isTerminal reports whether f is a terminal, or a console on Windows.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,68 @@
+package prompt
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	upgrade "github.com/getsavvyinc/upgrade-cli"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = &upgrade.Update{
+	CurrentVersion: "0.1.0",
+	LatestVersion:  "v0.2.0",
+	Available:      true,
+	Release: &release.Info{
+		TagName: "v0.2.0",
+		Body:    "## Changes\r\n\r\n* faster startup\r\n* new `savvy ask` command\r\n* fixed a crash\r\n",
+		HTMLURL: "https://github.com/getsavvyinc/savvy-cli/releases/tag/v0.2.0",
+	},
+}
+
+func TestConfirm(t *testing.T) {
+	ctx := context.Background()
+	for answer, want := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false} {
+		var out strings.Builder
+		ok, err := Confirm(ctx, update, WithInput(strings.NewReader(answer)), WithOutput(&out), WithNotesLines(2))
+		require.NoError(t, err)
+		assert.Equal(t, want, ok, "answer %q", answer)
+		assert.Equal(t, "A new version is available: 0.1.0 → v0.2.0\n\n"+
+			"  ## Changes\n  * faster startup\n  …\n\n"+
+			"Release notes: https://github.com/getsavvyinc/savvy-cli/releases/tag/v0.2.0\n\n"+
+			"Upgrade now? [y/N] ", out.String())
+	}
+}
+
+func TestConfirmAssumeYes(t *testing.T) {
+	ok, err := Confirm(context.Background(), update, AssumeYes(true), WithOutput(io.Discard))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestConfirmCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, _ := io.Pipe()
+	_, err := Confirm(ctx, update, WithInput(r), WithOutput(io.Discard))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestConfirmSanitizes(t *testing.T) {
+	var out strings.Builder
+	hostile := &upgrade.Update{
+		CurrentVersion: "0.1.0",
+		LatestVersion:  "v0.2.0\x1b[2K",
+		Release: &release.Info{
+			Body: "\x1b[31mred\x1b[0m notes\r\n\x1b]0;title\x07* hidden\x1b[1A\x1b[2K\u009b2J\x08\xff line\n",
+		},
+	}
+	_, err := Confirm(context.Background(), hostile, WithInput(strings.NewReader("n\n")), WithOutput(&out))
+	require.NoError(t, err)
+	assert.Equal(t, "A new version is available: 0.1.0 → v0.2.0\n\n"+
+		"  red notes\n  * hidden line\n\n"+
+		"Upgrade now? [y/N] ", out.String())
+}
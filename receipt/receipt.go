@@ -0,0 +1,260 @@
+// Package receipt produces signed in-toto statements describing what the upgrader did.
+//
+// Receipts are wrapped in a DSSE envelope so they can be verified with
+// standard supply-chain tooling.
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	StatementType = "https://in-toto.io/Statement/v1"
+	PredicateType = "https://github.com/getsavvyinc/upgrade-cli/receipt/v1"
+	PayloadType   = "application/vnd.in-toto+json"
+)
+
+// Statement is an in-toto v1 statement about an upgraded binary.
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate describes a single upgrade.
+type Predicate struct {
+	PreviousVersion string            `json:"previousVersion"`
+	NewVersion      string            `json:"newVersion"`
+	PreviousDigest  map[string]string `json:"previousDigest,omitempty"`
+	// Source is the URL the new binary was downloaded from.
+	Source string `json:"source"`
+	// Verifiers identifies the checks the new binary passed before it was
+	// installed, e.g. "sha256:<checksum>", "minisign:<key ID>" for the
+	// trusted key that signed it, or "tuf:targets".
+	Verifiers  []string  `json:"verifiers"`
+	UpgradedAt time.Time `json:"upgradedAt"`
+}
+
+// Upgrade holds the facts recorded in a receipt.
+type Upgrade struct {
+	ExecutablePath  string
+	PreviousVersion string
+	NewVersion      string
+	// PreviousSHA256 and NewSHA256 are hex encoded digests of the old and new binaries.
+	PreviousSHA256 string
+	NewSHA256      string
+	Source         string
+	Verifiers      []string
+	UpgradedAt     time.Time
+}
+
+// NewStatement builds the in-toto statement for u.
+func NewStatement(u Upgrade) *Statement {
+	p := Predicate{
+		PreviousVersion: u.PreviousVersion,
+		NewVersion:      u.NewVersion,
+		Source:          u.Source,
+		Verifiers:       u.Verifiers,
+		UpgradedAt:      u.UpgradedAt.UTC(),
+	}
+	if u.PreviousSHA256 != "" {
+		p.PreviousDigest = map[string]string{"sha256": u.PreviousSHA256}
+	}
+	return &Statement{
+		Type: StatementType,
+		Subject: []Subject{{
+			Name:   filepath.Base(u.ExecutablePath),
+			Digest: map[string]string{"sha256": u.NewSHA256},
+		}},
+		PredicateType: PredicateType,
+		Predicate:     p,
+	}
+}
+
+// Envelope is a DSSE envelope.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// Sign encodes s and signs it with signer. Ed25519, ECDSA and RSA keys are supported.
+func Sign(s *Statement, signer crypto.Signer, keyID string) (*Envelope, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode statement: %w", err)
+	}
+
+	msg, opts := digest(signer.Public(), pae(PayloadType, payload))
+	sig, err := signer.Sign(rand.Reader, msg, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign receipt: %w", err)
+	}
+
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+var ErrInvalidSignature = errors.New("invalid receipt signature")
+
+// Verify checks that env carries a valid signature from pub and returns the statement.
+func Verify(env *Envelope, pub crypto.PublicKey) (*Statement, error) {
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidSignature)
+	}
+	msg, opts := digest(pub, pae(env.PayloadType, payload))
+
+	verified := false
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if verify(pub, msg, sig, opts) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+
+	var s Statement
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode statement: %w", err)
+	}
+	return &s, nil
+}
+
+// pae is the DSSE pre-authentication encoding.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// digest prepares msg for signing with a key of type pub.
+// Ed25519 signs the message itself, everything else signs its sha256 digest.
+func digest(pub crypto.PublicKey, msg []byte) ([]byte, crypto.SignerOpts) {
+	if _, ok := pub.(ed25519.PublicKey); ok {
+		return msg, crypto.Hash(0)
+	}
+	h := sha256.Sum256(msg)
+	return h[:], crypto.SHA256
+}
+
+func verify(pub crypto.PublicKey, msg, sig []byte, opts crypto.SignerOpts) bool {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, msg, sig)
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, msg, sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, opts.HashFunc(), msg, sig) == nil
+	}
+	return false
+}
+
+// Sink stores signed receipts.
+type Sink interface {
+	Store(ctx context.Context, env *Envelope, s *Statement) error
+}
+
+type dirSink struct {
+	dir string
+}
+
+// NewDirSink returns a Sink that writes each receipt as a JSON file in dir.
+func NewDirSink(dir string) Sink {
+	return &dirSink{dir: dir}
+}
+
+func (d *dirSink) Store(ctx context.Context, env *Envelope, s *Statement) error {
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create receipt dir: %w", err)
+	}
+	data, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.intoto.json", s.Predicate.UpgradedAt.UTC().Format("20060102T150405Z"), sanitize(s.Predicate.NewVersion))
+	if err := os.WriteFile(filepath.Join(d.dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write receipt: %w", err)
+	}
+	return nil
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink returns a Sink that POSTs each receipt as JSON to url.
+// If client is nil, http.DefaultClient is used.
+func NewHTTPSink(url string, client *http.Client) Sink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpSink{url: url, client: client}
+}
+
+func (h *httpSink) Store(ctx context.Context, env *Envelope, s *Statement) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receipt collector returned %s", resp.Status)
+	}
+	return nil
+}
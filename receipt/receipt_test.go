@@ -0,0 +1,91 @@
+package receipt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testUpgrade = Upgrade{
+	ExecutablePath:  "/usr/local/bin/savvy",
+	PreviousVersion: "0.1.0",
+	NewVersion:      "0.2.0",
+	PreviousSHA256:  "aaaa",
+	NewSHA256:       "bbbb",
+	Source:          "https://github.com/getsavvyinc/savvy-cli/releases/download/v0.2.0/savvy_linux_amd64",
+	Verifiers:       []string{"sha256:checksums.txt"},
+	UpgradedAt:      time.Unix(1700000000, 0),
+}
+
+func TestSignAndVerify(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	t.Run("Ed25519", func(t *testing.T) {
+		env, err := Sign(NewStatement(testUpgrade), edPriv, "ed")
+		require.NoError(t, err)
+		s, err := Verify(env, edPub)
+		require.NoError(t, err)
+		assert.Equal(t, "savvy", s.Subject[0].Name)
+		assert.Equal(t, "bbbb", s.Subject[0].Digest["sha256"])
+		assert.Equal(t, "aaaa", s.Predicate.PreviousDigest["sha256"])
+	})
+	t.Run("ECDSA", func(t *testing.T) {
+		env, err := Sign(NewStatement(testUpgrade), ecPriv, "ec")
+		require.NoError(t, err)
+		_, err = Verify(env, &ecPriv.PublicKey)
+		require.NoError(t, err)
+	})
+	t.Run("WrongKey", func(t *testing.T) {
+		env, err := Sign(NewStatement(testUpgrade), edPriv, "ed")
+		require.NoError(t, err)
+		otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		_, err = Verify(env, otherPub)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+}
+
+func TestSinks(t *testing.T) {
+	ctx := context.Background()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	s := NewStatement(testUpgrade)
+	env, err := Sign(s, priv, "")
+	require.NoError(t, err)
+
+	t.Run("Dir", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, NewDirSink(dir).Store(ctx, env, s))
+		data, err := os.ReadFile(filepath.Join(dir, "20231114T221320Z-0.2.0.intoto.json"))
+		require.NoError(t, err)
+		var got Envelope
+		require.NoError(t, json.Unmarshal(data, &got))
+		assert.Equal(t, *env, got)
+	})
+	t.Run("HTTP", func(t *testing.T) {
+		var got Envelope
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			w.WriteHeader(http.StatusCreated)
+		}))
+		t.Cleanup(srv.Close)
+		require.NoError(t, NewHTTPSink(srv.URL, nil).Store(ctx, env, s))
+		assert.Equal(t, *env, got)
+	})
+}
@@ -0,0 +1,86 @@
+package upgrade
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/receipt"
+)
+
+// WithReceipts signs an in-toto receipt with signer after every upgrade and
+// hands it to each sink, e.g. receipt.NewDirSink or receipt.NewHTTPSink.
+// A receipt that can't be signed or stored is added to the result's Warnings,
+// since the binary was replaced already.
+func WithReceipts(signer crypto.Signer, keyID string, sinks ...receipt.Sink) Opt {
+	return func(u *upgrader) {
+		u.receiptSigner = signer
+		u.receiptKeyID = keyID
+		u.receiptSinks = sinks
+	}
+}
+
+// newReceipt collects the facts for a receipt before the current binary is replaced.
+// The checksum is only listed as a verifier if it was verified, followed by
+// the other verifiers, see DownloadedUpdate.Verifiers.
+func newReceipt(executablePath, newBinaryPath, previousVersion, newVersion, source, checksum string, verified bool, others []string) (*receipt.Upgrade, error) {
+	prevDigest, err := fileSHA256(executablePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to hash current binary: %w", err)
+	}
+	newDigest, err := fileSHA256(newBinaryPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash new binary: %w", err)
+	}
+	var verifiers []string
+	if verified {
+		verifiers = []string{"sha256:" + checksum}
+	}
+	verifiers = append(verifiers, others...)
+	return &receipt.Upgrade{
+		ExecutablePath:  executablePath,
+		PreviousVersion: previousVersion,
+		NewVersion:      newVersion,
+		PreviousSHA256:  prevDigest,
+		NewSHA256:       newDigest,
+		Source:          source,
+		Verifiers:       verifiers,
+		UpgradedAt:      time.Now(),
+	}, nil
+}
+
+func (u *upgrader) recordReceipt(ctx context.Context, r *receipt.Upgrade) error {
+	s := receipt.NewStatement(*r)
+	env, err := receipt.Sign(s, u.receiptSigner, u.receiptKeyID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, sink := range u.receiptSinks {
+		if err := sink.Store(ctx, env, s); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fileSHA256 returns the hex encoded sha256 digest of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
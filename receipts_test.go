@@ -0,0 +1,54 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingSink is a receipt.Sink that can't store receipts.
+type failingSink struct{}
+
+func (failingSink) Store(ctx context.Context, env *receipt.Envelope, s *receipt.Statement) error {
+	return errors.New("disk full")
+}
+
+// statementSink is a receipt.Sink keeping the last statement.
+type statementSink struct {
+	statement *receipt.Statement
+}
+
+func (s *statementSink) Store(ctx context.Context, env *receipt.Envelope, st *receipt.Statement) error {
+	s.statement = st
+	return nil
+}
+
+func TestReceiptFailureIsWarning(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	ran := false
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"},
+		WithReceipts(key, "test", failingSink{}),
+		WithHooks(PostUpgrade, Hook{
+			Name: "notify",
+			Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+				ran = true
+				return nil
+			},
+		}))
+
+	// the binary was replaced, so the upgrade succeeds and the hooks still run
+	result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "new", readFile(t, executablePath))
+	assert.True(t, ran)
+	require.Len(t, result.Warnings, 1)
+	assert.ErrorContains(t, result.Warnings[0], "disk full")
+}
@@ -0,0 +1,54 @@
+package upgrade
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ReexecEnv is set to the new version in the environment of a binary
+// restarted by Reexec, so it can tell it was just upgraded.
+const ReexecEnv = "UPGRADE_CLI_REEXEC"
+
+// WithReexec restarts the upgraded binary with the original arguments and
+// environment after Upgrade, UpgradeWithResult or Apply replaced it, so
+// long-running CLIs and agents run the new version right away. See Reexec.
+func WithReexec() Opt {
+	return func(u *upgrader) {
+		u.reexec = true
+	}
+}
+
+// Reexec replaces the running process with the binary at executablePath,
+// passing the original arguments and environment, plus ReexecEnv set to
+// version, replacing the one a previous Reexec set.
+//
+// On Unix the process is replaced with execve, so Reexec only returns on
+// failure. On Windows the binary is started as a child process and the
+// current process exits with its exit code once it finishes.
+func Reexec(executablePath, version string) error {
+	// exec keeps the first of duplicate keys, which would be the old version
+	env := slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		return strings.HasPrefix(kv, ReexecEnv+"=")
+	})
+	env = append(env, ReexecEnv+"="+version)
+	if err := reexecProcess(executablePath, os.Args, env); err != nil {
+		return fmt.Errorf("failed to restart %s: %w", executablePath, err)
+	}
+	return nil
+}
+
+// reexecProcess is a variable for tests.
+var reexecProcess = execProcess
+
+// restart re-executes the upgraded binary if WithReexec is set.
+func (u *upgrader) restart(result *UpgradeResult, executablePath string) error {
+	if !u.reexec || !result.Upgraded || executablePath != u.executablePath {
+		return nil
+	}
+	if err := Reexec(executablePath, result.NewVersion); err != nil {
+		return fmt.Errorf("upgraded to %s but %w", result.NewVersion, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReexec(t *testing.T) {
+	ctx := context.Background()
+	orig := reexecProcess
+	t.Cleanup(func() { reexecProcess = orig })
+	var gotPath string
+	var gotArgs, gotEnv []string
+	reexecProcess = func(path string, args, env []string) error {
+		gotPath, gotArgs, gotEnv = path, args, env
+		return errors.New("exec format error")
+	}
+
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithReexec())
+	result, err := u.UpgradeWithResult(ctx, "0.1.0")
+	assert.ErrorContains(t, err, "upgraded to v0.2.0 but failed to restart")
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, executablePath, gotPath)
+	assert.Equal(t, os.Args, gotArgs)
+	assert.Contains(t, gotEnv, ReexecEnv+"=v0.2.0")
+
+	// nothing is restarted without an upgrade
+	gotPath = ""
+	_, err = u.UpgradeWithResult(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.Empty(t, gotPath)
+}
+
+func TestReexecTwice(t *testing.T) {
+	orig := reexecProcess
+	t.Cleanup(func() { reexecProcess = orig })
+	var gotEnv []string
+	reexecProcess = func(path string, args, env []string) error {
+		gotEnv = env
+		return nil
+	}
+
+	// the restarted binary inherits ReexecEnv, and upgrades again
+	require.NoError(t, Reexec("savvy", "v0.2.0"))
+	t.Setenv(ReexecEnv, "v0.2.0")
+	require.NoError(t, Reexec("savvy", "v0.3.0"))
+	var values []string
+	for _, kv := range gotEnv {
+		if v, ok := strings.CutPrefix(kv, ReexecEnv+"="); ok {
+			values = append(values, v)
+		}
+	}
+	assert.Equal(t, []string{"v0.3.0"}, values)
+}
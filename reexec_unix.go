@@ -0,0 +1,9 @@
+//go:build unix
+
+package upgrade
+
+import "syscall"
+
+func execProcess(path string, args, env []string) error {
+	return syscall.Exec(path, args, env)
+}
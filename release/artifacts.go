@@ -0,0 +1,156 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// artifactTagPrefix prefixes the run number in the tags of workflow runs.
+const artifactTagPrefix = "run-"
+
+type artifactGetter struct {
+	g                *githubReleaseGetter
+	workflow, branch string
+}
+
+var (
+	_ Getter      = (*artifactGetter)(nil)
+	_ ByTagGetter = (*artifactGetter)(nil)
+)
+
+// NewArtifactGetter returns a Getter for the artifacts of GitHub Actions
+// workflow runs, for nightly builds that aren't published as releases. The
+// latest release is the latest successful run of workflow, e.g.
+// "nightly.yml", on branch, or on any branch if branch is empty. Runs are
+// tagged "run-<number>" and their artifacts are the assets, named like the
+// artifact with a ".zip" suffix, since GitHub serves them zipped.
+//
+// Artifacts can only be downloaded through the API with a token, even from
+// public repositories, see Token and asset.WithAPIDownloads.
+func NewArtifactGetter(repo, owner, workflow, branch string, opts ...GetterOpt) *artifactGetter {
+	return &artifactGetter{g: NewReleaseGetter(repo, owner, opts...), workflow: workflow, branch: branch}
+}
+
+type workflowRuns struct {
+	WorkflowRuns []workflowRun `json:"workflow_runs"`
+}
+
+type workflowRun struct {
+	ID           int64     `json:"id"`
+	RunNumber    int       `json:"run_number"`
+	HTMLURL      string    `json:"html_url"`
+	DisplayTitle string    `json:"display_title"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type workflowArtifacts struct {
+	Artifacts []workflowArtifact `json:"artifacts"`
+}
+
+type workflowArtifact struct {
+	ID                 int64     `json:"id"`
+	Name               string    `json:"name"`
+	SizeInBytes        int64     `json:"size_in_bytes"`
+	ArchiveDownloadURL string    `json:"archive_download_url"`
+	Digest             string    `json:"digest"`
+	Expired            bool      `json:"expired"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// GetLatestRelease returns the artifacts of the latest successful run that
+// has artifacts that haven't expired.
+func (a *artifactGetter) GetLatestRelease(ctx context.Context) (*Info, error) {
+	runs, err := a.runs(ctx, 10)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		info, err := a.release(ctx, run)
+		if err != nil {
+			return nil, err
+		}
+		if len(info.Assets) > 0 {
+			return info, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no successful run of %s with artifacts", ErrReleaseNotFound, a.workflow)
+}
+
+// GetReleaseByTag returns the artifacts of the run tagged tag, e.g.
+// "run-42", among the 100 most recent successful runs.
+func (a *artifactGetter) GetReleaseByTag(ctx context.Context, tag string) (*Info, error) {
+	number, err := strconv.Atoi(strings.TrimPrefix(tag, artifactTagPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s isn't a run tag, e.g. %s42", ErrReleaseNotFound, tag, artifactTagPrefix)
+	}
+	runs, err := a.runs(ctx, 100)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if run.RunNumber == number {
+			return a.release(ctx, run)
+		}
+	}
+	return nil, fmt.Errorf("%w: no successful run %d of %s", ErrReleaseNotFound, number, a.workflow)
+}
+
+// Token returns the token API requests are authenticated with, if any.
+func (a *artifactGetter) Token(ctx context.Context) string {
+	return a.g.Token(ctx)
+}
+
+// runs returns the most recent successful runs of the workflow, newest first.
+func (a *artifactGetter) runs(ctx context.Context, limit int) ([]workflowRun, error) {
+	q := url.Values{"status": {"success"}, "per_page": {strconv.Itoa(limit)}}
+	if a.branch != "" {
+		q.Set("branch", a.branch)
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s/actions/workflows/%s/runs?%s", a.g.baseURL, a.g.owner, a.g.repo, url.PathEscape(a.workflow), q.Encode())
+	var runs workflowRuns
+	if _, err := a.g.getJSON(ctx, u, &runs); err != nil {
+		return nil, err
+	}
+	return runs.WorkflowRuns, nil
+}
+
+// release returns the artifacts of run that haven't expired as a release.
+func (a *artifactGetter) release(ctx context.Context, run workflowRun) (*Info, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s/actions/runs/%d/artifacts?per_page=100", a.g.baseURL, a.g.owner, a.g.repo, run.ID)
+	var artifacts workflowArtifacts
+	if _, err := a.g.getJSON(ctx, u, &artifacts); err != nil {
+		return nil, err
+	}
+	info := &Info{
+		ID:          run.ID,
+		TagName:     artifactTagPrefix + strconv.Itoa(run.RunNumber),
+		Name:        run.DisplayTitle,
+		Body:        run.DisplayTitle,
+		HTMLURL:     run.HTMLURL,
+		Prerelease:  true,
+		CreatedAt:   run.CreatedAt,
+		PublishedAt: run.CreatedAt,
+	}
+	for _, art := range artifacts.Artifacts {
+		if art.Expired {
+			continue
+		}
+		info.Assets = append(info.Assets, Asset{
+			ID:                 art.ID,
+			Name:               art.Name + ".zip",
+			BrowserDownloadURL: art.ArchiveDownloadURL,
+			URL:                art.ArchiveDownloadURL,
+			Digest:             art.Digest,
+			Size:               art.SizeInBytes,
+			ContentType:        "application/zip",
+			CreatedAt:          art.CreatedAt,
+			UpdatedAt:          art.UpdatedAt,
+		})
+	}
+	return info, nil
+}
@@ -0,0 +1,71 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactGetter(t *testing.T) {
+	ctx := context.Background()
+	uploaded := time.Date(2024, 6, 1, 3, 4, 5, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/getsavvyinc/savvy-cli/actions/workflows/nightly.yml/runs":
+			assert.Equal(t, "success", r.URL.Query().Get("status"))
+			assert.Equal(t, "main", r.URL.Query().Get("branch"))
+			json.NewEncoder(w).Encode(workflowRuns{WorkflowRuns: []workflowRun{
+				{ID: 12, RunNumber: 43, HTMLURL: "https://github.com/getsavvyinc/savvy-cli/actions/runs/12"},
+				{ID: 11, RunNumber: 42},
+			}})
+		case "/repos/getsavvyinc/savvy-cli/actions/runs/12/artifacts":
+			// the artifacts of the latest run expired
+			json.NewEncoder(w).Encode(workflowArtifacts{Artifacts: []workflowArtifact{{Name: "savvy_linux_amd64", Expired: true}}})
+		case "/repos/getsavvyinc/savvy-cli/actions/runs/11/artifacts":
+			json.NewEncoder(w).Encode(workflowArtifacts{Artifacts: []workflowArtifact{{
+				ID:                 7,
+				Name:               "savvy_linux_amd64",
+				SizeInBytes:        1024,
+				ArchiveDownloadURL: "https://api.github.com/repos/getsavvyinc/savvy-cli/actions/artifacts/7/zip",
+				Digest:             "sha256:abc",
+				UpdatedAt:          uploaded,
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	g := NewArtifactGetter("savvy-cli", "getsavvyinc", "nightly.yml", "main", WithBaseURL(srv.URL))
+	info, err := g.GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &Info{
+		ID:         11,
+		TagName:    "run-42",
+		Prerelease: true,
+		Assets: []Asset{{
+			ID:                 7,
+			Name:               "savvy_linux_amd64.zip",
+			BrowserDownloadURL: "https://api.github.com/repos/getsavvyinc/savvy-cli/actions/artifacts/7/zip",
+			URL:                "https://api.github.com/repos/getsavvyinc/savvy-cli/actions/artifacts/7/zip",
+			Digest:             "sha256:abc",
+			Size:               1024,
+			ContentType:        "application/zip",
+			UpdatedAt:          uploaded,
+		}},
+	}, info)
+
+	info, err = g.GetReleaseByTag(ctx, "run-43")
+	require.NoError(t, err)
+	assert.Empty(t, info.Assets)
+	_, err = g.GetReleaseByTag(ctx, "run-1")
+	assert.ErrorIs(t, err, ErrReleaseNotFound)
+	_, err = g.GetReleaseByTag(ctx, "v1.0.0")
+	assert.ErrorIs(t, err, ErrReleaseNotFound)
+}
@@ -0,0 +1,13 @@
+package asset
+
+import "context"
+
+// WithAPIDownloads downloads assets from their API endpoint, release.Asset.URL,
+// authenticated with the token returned by token, instead of from their
+// browser download URL, see release.OpenAsset. This is required for assets of
+// private repositories, and works behind proxies that only allow the API.
+func WithAPIDownloads(token func(ctx context.Context) string) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.apiToken = token
+	}
+}
@@ -0,0 +1,101 @@
+package asset
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// ErrDigestMismatch is returned when the server reports a digest for an
+// asset that differs from the digest published for it. The download is
+// aborted before its content is read. The returned error is a
+// *DigestMismatchError.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// DigestMismatchError describes an asset the server reported a different digest for.
+type DigestMismatchError struct {
+	Asset string
+	// Expected is the sha256 digest published for the asset, hex encoded.
+	Expected string
+	// Actual is the sha256 digest reported by the server, hex encoded.
+	Actual string
+	// Header is the response header Actual comes from, e.g. "Content-Digest".
+	Header string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s has digest %s according to %s, expected %s", ErrDigestMismatch, e.Asset, e.Actual, e.Header, e.Expected)
+}
+
+func (e *DigestMismatchError) Unwrap() error {
+	return ErrDigestMismatch
+}
+
+// checkDigestHeader compares the sha256 digest published for a, if any,
+// with the one reported in the response headers, if any.
+func checkDigestHeader(a release.Asset, resp *http.Response) error {
+	expected, ok := strings.CutPrefix(a.Digest, "sha256:")
+	// a transparently decompressed response has the digest of the compressed content
+	if !ok || expected == "" || resp.Uncompressed {
+		return nil
+	}
+	actual, header, ok := headerDigest(resp.Header)
+	if !ok || strings.EqualFold(actual, expected) {
+		return nil
+	}
+	return &DigestMismatchError{Asset: assetName(a), Expected: expected, Actual: actual, Header: header}
+}
+
+// headerDigest returns the hex encoded sha256 digest of the response content
+// reported in h, and the header it was found in. It understands
+// Content-Digest (RFC 9530), Digest (RFC 3230) and the checksum headers of
+// Artifactory and S3.
+func headerDigest(h http.Header) (string, string, bool) {
+	if v := h.Get("Content-Digest"); v != "" {
+		// e.g. sha-256=:<base64>:, sha-512=:<base64>:
+		for _, field := range strings.Split(v, ",") {
+			alg, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+			if strings.EqualFold(alg, "sha-256") {
+				if d, ok := fromBase64(strings.Trim(value, ":")); ok {
+					return d, "Content-Digest", true
+				}
+			}
+		}
+	}
+	if v := h.Get("Digest"); v != "" {
+		// e.g. SHA-256=<base64>, MD5=<base64>
+		for _, field := range strings.Split(v, ",") {
+			alg, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+			if strings.EqualFold(alg, "sha-256") {
+				if d, ok := fromBase64(value); ok {
+					return d, "Digest", true
+				}
+			}
+		}
+	}
+	if v := h.Get("X-Checksum-Sha256"); v != "" {
+		if b, err := hex.DecodeString(v); err == nil && len(b) == 32 {
+			return strings.ToLower(v), "X-Checksum-Sha256", true
+		}
+	}
+	if v := h.Get("X-Amz-Checksum-Sha256"); v != "" {
+		if d, ok := fromBase64(v); ok {
+			return d, "X-Amz-Checksum-Sha256", true
+		}
+	}
+	return "", "", false
+}
+
+// fromBase64 converts a base64 encoded sha256 digest to hex.
+func fromBase64(s string) (string, bool) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return "", false
+	}
+	return hex.EncodeToString(b), true
+}
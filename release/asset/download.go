@@ -6,36 +6,81 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+	"text/template"
 
+	"github.com/getsavvyinc/upgrade-cli/platform"
 	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/goreleaser"
 )
 
-type cleanupFn func() error
+// cleanupFn removes a downloaded asset. It is an alias, so that Downloaders
+// can be implemented outside of this package.
+type cleanupFn = func() error
 
 type Downloader interface {
 	DownloadAsset(ctx context.Context, ReleaseAssets []release.Asset) (*Info, cleanupFn, error)
 }
 
+// Streamer is implemented by Downloaders that can pass the selected asset to
+// a consumer as it is downloaded, without writing it to disk first.
+type Streamer interface {
+	Selector
+	StreamAsset(ctx context.Context, a release.Asset, consume func(io.Reader) error) (*Info, error)
+}
+
+// Selector is implemented by Downloaders that can tell which asset they
+// download without downloading it.
+type Selector interface {
+	SelectAsset(ctx context.Context, assets []release.Asset) (release.Asset, error)
+}
+
 type Info struct {
-	Checksum                 string
+	// Name and URL identify the downloaded release asset.
+	Name     string
+	URL      string
+	Checksum string
+	// DownloadedBinaryFilePath is empty for assets passed to StreamAsset.
 	DownloadedBinaryFilePath string
 	PlatformSuffix           string
 	ArSuffix                 string
+	// Size is the number of bytes downloaded.
+	Size int64
 }
 
 type downloader struct {
 	os             string
 	arch           string
 	executablePath string
+	matcher        Matcher
+	template       string
+	libc           platform.Libc
+	preference     []string
+	include        []*regexp.Regexp
+	exclude        []*regexp.Regexp
+	goreleaser     bool
+	client         *http.Client
+	beforeDownload func(release.Asset) error
+	progress       func(Progress)
+	tempDir        string
+	apiToken       func(ctx context.Context) string
+	maxSize        int64
 }
 
-var _ Downloader = (*downloader)(nil)
+var (
+	_ Downloader = (*downloader)(nil)
+	_ Selector   = (*downloader)(nil)
+	_ Streamer   = (*downloader)(nil)
+)
 
 type AssetDownloadOpt func(*downloader)
 
@@ -51,11 +96,132 @@ func WithArch(arch string) AssetDownloadOpt {
 	}
 }
 
+// Matcher reports whether a release asset is the one to download.
+type Matcher func(a release.Asset) bool
+
+// WithMatcher selects the first asset m matches instead of the default
+// "<os>_<arch>" suffix matching. Packaging assets, i.e. OS packages and
+// installers such as ".deb", ".rpm", ".apk", ".msi", ".dmg" and ".pkg" files, SBOMs (".sbom.json"),
+// signatures (".sig") and certificates (".pem"), are never selected unless
+// they are requested with WithInclude or WithTemplate.
+func WithMatcher(m Matcher) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.matcher = m
+	}
+}
+
+// WithTemplate selects the asset whose name matches tmpl, e.g.
+// "{{.Name}}_{{.Version}}_{{.OS}}_{{.Arch}}.tar.gz".
+//
+// Name is the executable name, OS and Arch the target platform. Version
+// matches any version, since it's only known once the release is fetched.
+// Matching is case-insensitive.
+func WithTemplate(tmpl string) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.template = tmpl
+	}
+}
+
+// WithLibc prefers Linux assets built for libc, e.g. "linux_amd64_musl" for
+// platform.Musl. By default the C library of the running system is detected.
+func WithLibc(libc platform.Libc) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.libc = libc
+	}
+}
+
+// WithArchivePreference decides between several assets for the platform,
+// e.g. "savvy_linux_amd64.tar.gz" and "savvy_linux_amd64.zip", by the
+// earliest of suffixes their name ends with, e.g. ".tar.gz", ".zip".
+// Assets ending with none of them come last. Matching is case-insensitive.
+// By default, the first asset of the release is selected.
+func WithArchivePreference(suffixes ...string) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.preference = suffixes
+	}
+}
+
+// WithInclude only selects assets whose name re matches. Unlike other
+// matchers, it can select packaging assets, e.g. ".deb" or ".msi" files, if
+// re matches their extension, e.g. `\.deb$`.
+// When given several times, assets have to match every pattern.
+func WithInclude(re *regexp.Regexp) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.include = append(d.include, re)
+	}
+}
+
+// WithExclude never selects assets whose name re matches, e.g. `\.(deb|rpm)$`
+// or `-debug`. When given several times, assets matching any pattern are excluded.
+func WithExclude(re *regexp.Regexp) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.exclude = append(d.exclude, re)
+	}
+}
+
+// WithGoReleaserMetadata selects the asset listed for the target platform in
+// goreleaser's artifacts.json if the release has one, instead of matching asset names.
+func WithGoReleaserMetadata() AssetDownloadOpt {
+	return func(d *downloader) {
+		d.goreleaser = true
+	}
+}
+
+// WithHTTPClient downloads assets with client instead of http.DefaultClient.
+func WithHTTPClient(client *http.Client) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.client = client
+	}
+}
+
+// WithTempDir downloads assets to dir instead of the default directory for temporary files.
+func WithTempDir(dir string) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.tempDir = dir
+	}
+}
+
+// WithBeforeDownload calls fn with the selected asset before downloading it.
+// If fn returns an error, the asset isn't downloaded and the error is returned.
+func WithBeforeDownload(fn func(release.Asset) error) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.beforeDownload = fn
+	}
+}
+
+// WithMaxSize fails downloads of assets larger than max bytes with a
+// *TooLargeError, before downloading them if their size is known.
+func WithMaxSize(max int64) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.maxSize = max
+	}
+}
+
+// Progress describes an asset being downloaded.
+type Progress struct {
+	Name string
+	// Downloaded is the number of bytes downloaded so far.
+	Downloaded int64
+	// Total is the size of the asset in bytes, or -1 if unknown.
+	Total int64
+	// Done is set on the last report of a download, unless it failed.
+	Done bool
+}
+
+// WithProgress calls fn as the asset is downloaded, after each chunk read.
+// fn is called on the downloading goroutine and should return quickly.
+func WithProgress(fn func(Progress)) AssetDownloadOpt {
+	return func(d *downloader) {
+		d.progress = fn
+	}
+}
+
 func NewAssetDownloader(executablePath string, opts ...AssetDownloadOpt) Downloader {
 	d := &downloader{
 		os:             runtime.GOOS,
 		arch:           runtime.GOARCH,
 		executablePath: executablePath,
+		client:         http.DefaultClient,
 	}
 	for _, opt := range opts {
 		opt(d)
@@ -65,84 +231,528 @@ func NewAssetDownloader(executablePath string, opts ...AssetDownloadOpt) Downloa
 
 var ErrNoAsset = errors.New("no asset found")
 
+// ErrSizeMismatch is returned when a download is shorter or longer than the
+// size reported by the server or the release. The returned error is a
+// *SizeMismatchError.
+var ErrSizeMismatch = errors.New("download size mismatch")
+
+// SizeMismatchError describes a truncated or oversized download.
+type SizeMismatchError struct {
+	Asset    string
+	Expected int64
+	Actual   int64
+	// Source is where Expected comes from: "Content-Length" or "release".
+	Source string
+}
+
+func (e *SizeMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s is %d bytes, expected %d (%s)", ErrSizeMismatch, e.Asset, e.Actual, e.Expected, e.Source)
+}
+
+func (e *SizeMismatchError) Unwrap() error {
+	return ErrSizeMismatch
+}
+
+// ErrTooLarge is returned when an asset is larger than allowed by
+// WithMaxSize. The returned error is a *TooLargeError.
+var ErrTooLarge = errors.New("asset too large")
+
+// TooLargeError describes an asset larger than allowed by WithMaxSize.
+type TooLargeError struct {
+	Asset string
+	// Size is the size of the asset, or the bytes read when the download was
+	// aborted if the size wasn't known beforehand.
+	Size int64
+	Max  int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%s: %s is %d bytes, the maximum is %d", ErrTooLarge, e.Asset, e.Size, e.Max)
+}
+
+func (e *TooLargeError) Unwrap() error {
+	return ErrTooLarge
+}
+
+// SelectAsset returns the asset DownloadAsset downloads.
+func (d *downloader) SelectAsset(ctx context.Context, assets []release.Asset) (release.Asset, error) {
+	if d.goreleaser {
+		a, err := d.selectFromMetadata(ctx, assets)
+		if err != nil && !errors.Is(err, goreleaser.ErrNoMetadata) {
+			return release.Asset{}, err
+		}
+		if err == nil && d.allowed(a) {
+			return a, nil
+		}
+	}
+	candidates, err := d.matchCandidates(assets)
+	if err != nil {
+		return release.Asset{}, err
+	}
+	return candidates[0], nil
+}
+
 func (d *downloader) DownloadAsset(ctx context.Context, assets []release.Asset) (*Info, cleanupFn, error) {
-	// iterate through the assets and find the one that matches the os and arch
-	suffix := d.os + "_" + d.arch
-	for _, asset := range assets {
-		u := strings.ToLower(asset.BrowserDownloadURL)
-		// Remove .tar.gz .tar .zip .gz from the end of the string
-		// and compare the suffix
-		// e.g. linux_amd64.tar.gz -> linux_amd64
-		var ar string
-		for _, s := range []string{".tar.gz", ".tar", ".zip", ".gz"} {
-			t := strings.TrimSuffix(u, s)
-			if t != u {
-				ar = s
-				u = t
+	asset, err := d.SelectAsset(ctx, assets)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.beforeDownload != nil {
+		if err := d.beforeDownload(asset); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	info, c, err := d.downloadAsset(ctx, asset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info.Name = assetName(asset)
+	info.URL = asset.BrowserDownloadURL
+	info.PlatformSuffix = d.os + "_" + d.arch
+	info.ArSuffix = ArchiveSuffix(asset.BrowserDownloadURL)
+
+	return info, c, nil
+}
+
+// matchCandidates returns the assets that match the target platform, best match first.
+func (d *downloader) matchCandidates(assets []release.Asset) ([]release.Asset, error) {
+	match, err := d.assetMatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// iterate through the assets and find the ones that match the os and arch
+	candidates := d.filter(assets, match)
+	if len(candidates) == 0 && d.matcher == nil && d.template == "" {
+		// fall back to builds the platform runs through emulation
+		for _, arch := range platform.EmulatedArchs(d.os, d.arch) {
+			if candidates = d.filter(assets, d.suffixMatcher(arch)); len(candidates) > 0 {
 				break
 			}
 		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: os:%s arch:%s", ErrNoAsset, d.os, d.arch)
+	}
+	if len(d.preference) > 0 {
+		d.rankByArchive(candidates)
+	}
+	if d.matcher == nil && d.template == "" && len(candidates) > 1 {
+		d.rankByLibc(candidates)
+	}
+	return candidates, nil
+}
+
+// filter returns the allowed assets that match.
+func (d *downloader) filter(assets []release.Asset, match Matcher) []release.Asset {
+	var matched []release.Asset
+	for _, asset := range assets {
+		if d.allowed(asset) && match(asset) {
+			matched = append(matched, asset)
+		}
+	}
+	return matched
+}
+
+// packagingSuffixes are the extensions of release assets that are neither
+// archives nor binaries, e.g. OS packages, SBOMs and signatures.
+var packagingSuffixes = []string{".deb", ".rpm", ".apk", ".msi", ".dmg", ".pkg", ".sbom.json", ".sig", ".pem"}
+
+// allowed reports whether the name of a passes the include and exclude
+// filters. It is checked before the platform is matched, so excluded variants
+// never compete with the asset for the platform. Packaging assets are only
+// allowed if they are requested explicitly, by an include filter matching
+// their suffix or the template.
+func (d *downloader) allowed(a release.Asset) bool {
+	name := assetName(a)
+	for _, re := range d.include {
+		if !re.MatchString(name) {
+			return false
+		}
+	}
+	for _, re := range d.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	lower := strings.ToLower(name)
+	for _, suffix := range packagingSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return d.includesSuffix(name, len(suffix)) || strings.HasSuffix(strings.ToLower(d.template), suffix)
+		}
+	}
+	return true
+}
+
+// includesSuffix reports whether an include filter matches the last n bytes
+// of name, e.g. `\.deb$` but not `linux` for "savvy_linux.deb".
+func (d *downloader) includesSuffix(name string, n int) bool {
+	for _, re := range d.include {
+		for _, loc := range re.FindAllStringIndex(name, -1) {
+			if loc[1] > len(name)-n {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-		if strings.HasSuffix(u, suffix) {
-			info, c, err := d.downloadAsset(ctx, asset.BrowserDownloadURL)
-			if err != nil {
-				return nil, nil, err
+// rankByArchive orders candidates by the archive preference, keeping the
+// release order of candidates that rank the same.
+func (d *downloader) rankByArchive(candidates []release.Asset) {
+	rank := func(a release.Asset) int {
+		name := strings.ToLower(assetName(a))
+		for i, suffix := range d.preference {
+			if strings.HasSuffix(name, strings.ToLower(suffix)) {
+				return i
 			}
+		}
+		return len(d.preference)
+	}
+	slices.SortStableFunc(candidates, func(a, b release.Asset) int {
+		return rank(a) - rank(b)
+	})
+}
 
-			info.PlatformSuffix = suffix
-			info.ArSuffix = ar
+// selectFromMetadata returns the asset goreleaser's artifacts.json lists for the target platform.
+func (d *downloader) selectFromMetadata(ctx context.Context, assets []release.Asset) (release.Asset, error) {
+	artifacts, err := goreleaser.Fetch(ctx, d.client, assets)
+	if err != nil {
+		return release.Asset{}, err
+	}
+	var goarm string
+	if d.os == runtime.GOOS && d.arch == runtime.GOARCH {
+		goarm = goreleaser.GOARM()
+	}
+	artifact, ok := goreleaser.Select(artifacts, d.os, d.arch, goarm)
+	if !ok {
+		return release.Asset{}, fmt.Errorf("%w: %s lists no artifact for os:%s arch:%s", ErrNoAsset, goreleaser.MetadataName, d.os, d.arch)
+	}
+	for _, a := range assets {
+		if assetName(a) == artifact.Name {
+			return a, nil
+		}
+	}
+	return release.Asset{}, fmt.Errorf("%w: %s isn't attached to the release", ErrNoAsset, artifact.Name)
+}
 
-			return info, c, nil
+// rankByLibc orders Linux candidates so that builds for the target C library come first.
+func (d *downloader) rankByLibc(candidates []release.Asset) {
+	if d.os != "linux" {
+		return
+	}
+	libc := d.libc
+	if libc == platform.LibcUnknown && d.os == runtime.GOOS {
+		libc = platform.DetectLibc()
+	}
+	rank := func(a release.Asset) int {
+		u, _ := trimArchiveSuffix(strings.ToLower(a.BrowserDownloadURL))
+		_, assetLibc := platform.TrimLibc(u)
+		switch {
+		case assetLibc == libc:
+			return 0
+		case assetLibc == platform.LibcUnknown:
+			return 1
+		// static musl builds run on glibc systems, but not the other way around
+		case libc != platform.Musl && assetLibc == platform.Musl:
+			return 2
+		default:
+			return 3
 		}
 	}
-	return nil, nil, fmt.Errorf("%w: os:%s arch:%s", ErrNoAsset, d.os, d.arch)
+	slices.SortStableFunc(candidates, func(a, b release.Asset) int {
+		return rank(a) - rank(b)
+	})
 }
 
-func (d *downloader) downloadAsset(ctx context.Context, url string) (*Info, cleanupFn, error) {
-	executable := filepath.Base(d.executablePath)
+// assetMatcher returns the Matcher for the configured matching strategy.
+func (d *downloader) assetMatcher() (Matcher, error) {
+	switch {
+	case d.matcher != nil:
+		return d.matcher, nil
+	case d.template != "":
+		return d.templateMatcher()
+	default:
+		return d.suffixMatcher(d.arch), nil
+	}
+}
+
+// suffixMatcher matches assets whose URL ends with <os>_<arch>, ignoring the archive extension.
+// Common aliases such as x86_64 for amd64 or macos for darwin, and "-" as separator are accepted too.
+func (d *downloader) suffixMatcher(arch string) Matcher {
+	suffixes := platform.Suffixes(d.os, arch)
+	return func(a release.Asset) bool {
+		// Remove .tar.gz .tar .zip .gz from the end of the string
+		// and compare the suffix
+		// e.g. linux_amd64.tar.gz -> linux_amd64
+		u, _ := trimArchiveSuffix(strings.ToLower(a.BrowserDownloadURL))
+		// e.g. windows_amd64.msi -> windows_amd64, see allowed for whether
+		// packaging assets are selected
+		u = trimPackagingSuffix(u)
+		// e.g. linux_amd64_musl -> linux_amd64
+		u, _ = platform.TrimLibc(u)
+		return platform.HasSuffix(u, suffixes)
+	}
+}
+
+// trimPackagingSuffix removes the extension of a packaging asset from u.
+func trimPackagingSuffix(u string) string {
+	for _, s := range packagingSuffixes {
+		if t := strings.TrimSuffix(u, s); t != u {
+			return t
+		}
+	}
+	return u
+}
+
+// ArchiveSuffix returns the lowercased extension of a supported archive
+// format that name or URL ends with, e.g. ".tar.gz", or "" for raw binaries.
+// ".tgz" archives are reported as ".tar.gz".
+func ArchiveSuffix(name string) string {
+	_, s := trimArchiveSuffix(strings.ToLower(name))
+	return s
+}
 
-	// Download the file
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// trimArchiveSuffix removes a supported archive extension from u and returns
+// the format, see ArchiveSuffix.
+func trimArchiveSuffix(u string) (string, string) {
+	if t := strings.TrimSuffix(u, ".tgz"); t != u {
+		return t, ".tar.gz"
+	}
+	for _, s := range []string{".tar.gz", ".tar", ".zip", ".gz"} {
+		if t := strings.TrimSuffix(u, s); t != u {
+			return t, s
+		}
+	}
+	return u, ""
+}
+
+// versionPlaceholder stands in for the version while rendering a template.
+const versionPlaceholder = "\x00version\x00"
+
+func (d *downloader) templateMatcher() (Matcher, error) {
+	tmpl, err := template.New("asset").Parse(d.template)
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("invalid asset template: %w", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(d.executablePath), ".exe")
+	var b strings.Builder
+	err = tmpl.Execute(&b, struct{ Name, Version, OS, Arch string }{
+		Name:    name,
+		Version: versionPlaceholder,
+		OS:      d.os,
+		Arch:    d.arch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid asset template: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	pattern := strings.ReplaceAll(regexp.QuoteMeta(b.String()), regexp.QuoteMeta(versionPlaceholder), `v?[0-9][^/]*?`)
+	re, err := regexp.Compile("(?i)^" + pattern + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid asset template: %w", err)
+	}
+	return func(a release.Asset) bool {
+		return re.MatchString(assetName(a))
+	}, nil
+}
+
+// assetName returns the file name of a, falling back to the last element of its download URL.
+func assetName(a release.Asset) string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return path.Base(a.BrowserDownloadURL)
+}
+
+// StreamAsset downloads a, e.g. as selected by SelectAsset, and passes it to
+// consume as it arrives instead of writing it to a temp file. consume
+// needn't read it to the end, the rest is read to compute the checksum.
+// The returned Info has no DownloadedBinaryFilePath.
+func (d *downloader) StreamAsset(ctx context.Context, a release.Asset, consume func(io.Reader) error) (*Info, error) {
+	if d.beforeDownload != nil {
+		if err := d.beforeDownload(a); err != nil {
+			return nil, err
+		}
+	}
+	ar, err := d.open(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	err = consume(ar)
+	if err == nil {
+		_, err = io.Copy(io.Discard, ar)
+	}
+	// a failed download explains a failed consumer
+	if ar.err != nil {
+		return nil, ar.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := ar.info()
+	info.URL = a.BrowserDownloadURL
+	info.PlatformSuffix = d.os + "_" + d.arch
+	info.ArSuffix = ArchiveSuffix(a.BrowserDownloadURL)
+	return info, nil
+}
+
+func (d *downloader) downloadAsset(ctx context.Context, asset release.Asset) (*Info, cleanupFn, error) {
+	executable := filepath.Base(d.executablePath)
+
+	ar, err := d.open(ctx, asset)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer resp.Body.Close()
+	defer ar.Close()
 
 	// Create a temporary file
-	tmpFile, err := os.CreateTemp("", executable)
+	tmpFile, err := os.CreateTemp(d.tempDir, executable)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer tmpFile.Close()
 
 	cleanupFn := func() error {
 		return os.Remove(tmpFile.Name())
 	}
 
-	// sha256 checksum
-	hasher := sha256.New()
-
-	// Write the response body to the temporary file and hasher
-	rd := io.TeeReader(resp.Body, hasher)
-	_, err = io.Copy(tmpFile, rd)
+	// Write the response body to the temporary file
+	_, err = io.Copy(tmpFile, ar)
+	if err == nil {
+		// Ensure the downloaded file has executable permissions
+		err = tmpFile.Chmod(0755)
+	}
+	// the file is closed before it is removed, which fails on Windows otherwise
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		cleanupFn()
 		return nil, nil, err
 	}
 
-	// Ensure the downloaded file has executable permissions
-	if err := os.Chmod(tmpFile.Name(), 0755); err != nil {
-		cleanupFn()
-		return nil, nil, err
+	info := ar.info()
+	info.DownloadedBinaryFilePath = tmpFile.Name()
+	return info, cleanupFn, nil
+}
+
+// open requests asset and returns a reader for its content.
+func (d *downloader) open(ctx context.Context, asset release.Asset) (*assetReader, error) {
+	resp, err := release.OpenAsset(ctx, d.client, asset, d.apiToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := release.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download asset: %w", err)
+	}
+	if err := checkDigestHeader(asset, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
 	}
 
+	// the size published with the release is checked against the response
+	// before downloading, and against the bytes read after it
+	name := assetName(asset)
+	expected, source := resp.ContentLength, "Content-Length"
+	if asset.Size > 0 {
+		if expected >= 0 && expected != asset.Size {
+			resp.Body.Close()
+			return nil, &SizeMismatchError{Asset: name, Expected: asset.Size, Actual: expected, Source: "release"}
+		}
+		expected, source = asset.Size, "release"
+	}
+
+	if d.maxSize > 0 && expected > d.maxSize {
+		resp.Body.Close()
+		return nil, &TooLargeError{Asset: name, Size: expected, Max: d.maxSize}
+	}
+
+	ar := &assetReader{body: resp.Body, r: resp.Body, hash: sha256.New(), name: name, expected: expected, source: source, max: d.maxSize}
+	if d.progress != nil {
+		ar.progress = &progressReader{r: resp.Body, fn: d.progress, p: Progress{Name: name, Total: expected}}
+		ar.r = ar.progress
+	}
+	return ar, nil
+}
+
+// assetReader reads a downloaded asset, hashing it and checking its size.
+// Reading past the expected size fails with a *SizeMismatchError, and past
+// the maximum size with a *TooLargeError.
+type assetReader struct {
+	body     io.ReadCloser
+	r        io.Reader
+	hash     hash.Hash
+	progress *progressReader
+	name     string
+	n        int64
+	expected int64
+	source   string
+	// max is the maximum size, if any, see WithMaxSize.
+	max int64
+	// err is the error reading the download failed with, if any.
+	err error
+}
+
+func (ar *assetReader) Read(b []byte) (int, error) {
+	if ar.err != nil {
+		return 0, ar.err
+	}
+	n, err := ar.r.Read(b)
+	ar.hash.Write(b[:n])
+	ar.n += int64(n)
+	if ar.expected >= 0 && (ar.n > ar.expected || errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF && ar.n != ar.expected) {
+		err = &SizeMismatchError{Asset: ar.name, Expected: ar.expected, Actual: ar.n, Source: ar.source}
+	}
+	if ar.max > 0 && ar.n > ar.max {
+		err = &TooLargeError{Asset: ar.name, Size: ar.n, Max: ar.max}
+	}
+	if err == io.EOF && ar.progress != nil {
+		ar.progress.done()
+		ar.progress = nil
+	}
+	if err != nil && err != io.EOF {
+		ar.err = err
+	}
+	return n, err
+}
+
+func (ar *assetReader) Close() error {
+	return ar.body.Close()
+}
+
+// info describes the asset read so far.
+func (ar *assetReader) info() *Info {
 	return &Info{
-		Checksum:                 hex.EncodeToString(hasher.Sum(nil)),
-		DownloadedBinaryFilePath: tmpFile.Name(),
-	}, cleanupFn, nil
+		Name:     ar.name,
+		Checksum: hex.EncodeToString(ar.hash.Sum(nil)),
+		Size:     ar.n,
+	}
+}
+
+// progressReader reports the bytes read from r.
+type progressReader struct {
+	r  io.Reader
+	fn func(Progress)
+	p  Progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	if n > 0 {
+		pr.p.Downloaded += int64(n)
+		pr.fn(pr.p)
+	}
+	return n, err
+}
+
+// done reports the download as complete.
+func (pr *progressReader) done() {
+	pr.p.Done = true
+	pr.p.Total = pr.p.Downloaded
+	pr.fn(pr.p)
 }
@@ -5,10 +5,14 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/getsavvyinc/upgrade-cli/platform"
 	"github.com/getsavvyinc/upgrade-cli/release"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // downloadData is the content of the file that is downloaded in the tests.
@@ -70,4 +74,359 @@ func TestAssetDownloader(t *testing.T) {
 			assert.NoFileExists(t, tmpFile)
 		})
 	})
+	t.Run("ReportProgress", func(t *testing.T) {
+		srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+		var reports []Progress
+		downloader := NewAssetDownloader(executablePath, WithOS("os"), WithArch("arch"), WithProgress(func(p Progress) {
+			reports = append(reports, p)
+		}))
+		_, cleanupFn, err := downloader.DownloadAsset(context.Background(), []release.Asset{
+			{Name: "savvy_os_arch", BrowserDownloadURL: srv.URL + "/download_os_arch"},
+		})
+		require.NoError(t, err)
+		defer cleanupFn()
+
+		require.GreaterOrEqual(t, len(reports), 2)
+		last := reports[len(reports)-1]
+		assert.Equal(t, Progress{Name: "savvy_os_arch", Downloaded: int64(len(downloadData)), Total: int64(len(downloadData)), Done: true}, last)
+		assert.Equal(t, int64(len(downloadData)), reports[0].Total)
+	})
+	t.Run("SizeMismatch", func(t *testing.T) {
+		truncated := setupTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "1000")
+			io.WriteString(w, downloadData)
+		}))
+		srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+		downloader := NewAssetDownloader(executablePath, WithOS("os"), WithArch("arch"))
+
+		for name, a := range map[string]release.Asset{
+			"Truncated":     {Name: "savvy_os_arch", BrowserDownloadURL: truncated.URL + "/download_os_arch"},
+			"ReleaseSize":   {Name: "savvy_os_arch", BrowserDownloadURL: srv.URL + "/download_os_arch", Size: 1000},
+			"ContentLength": {Name: "savvy_os_arch", BrowserDownloadURL: truncated.URL + "/download_os_arch", Size: int64(len(downloadData))},
+		} {
+			_, _, err := downloader.DownloadAsset(context.Background(), []release.Asset{a})
+			var mismatch *SizeMismatchError
+			require.ErrorAs(t, err, &mismatch, name)
+			assert.Equal(t, "savvy_os_arch", mismatch.Asset, name)
+		}
+
+		info, cleanupFn, err := downloader.DownloadAsset(context.Background(), []release.Asset{
+			{BrowserDownloadURL: srv.URL + "/download_os_arch", Size: int64(len(downloadData))},
+		})
+		require.NoError(t, err)
+		defer cleanupFn()
+		assert.Equal(t, int64(len(downloadData)), info.Size)
+	})
+	t.Run("TooLarge", func(t *testing.T) {
+		srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+		chunked := setupTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, downloadData[:4])
+			w.(http.Flusher).Flush()
+			io.WriteString(w, downloadData[4:])
+		}))
+		max := int64(len(downloadData) - 1)
+		downloader := NewAssetDownloader(executablePath, WithOS("os"), WithArch("arch"), WithMaxSize(max))
+
+		for name, a := range map[string]release.Asset{
+			"ReleaseSize":   {Name: "savvy_os_arch", BrowserDownloadURL: srv.URL + "/download_os_arch", Size: int64(len(downloadData))},
+			"ContentLength": {Name: "savvy_os_arch", BrowserDownloadURL: srv.URL + "/download_os_arch"},
+			"Unknown":       {Name: "savvy_os_arch", BrowserDownloadURL: chunked.URL + "/download_os_arch"},
+		} {
+			_, _, err := downloader.DownloadAsset(context.Background(), []release.Asset{a})
+			var tooLarge *TooLargeError
+			require.ErrorAs(t, err, &tooLarge, name)
+			assert.ErrorIs(t, err, ErrTooLarge, name)
+			assert.Equal(t, max, tooLarge.Max, name)
+			assert.Greater(t, tooLarge.Size, max, name)
+		}
+
+		_, cleanupFn, err := NewAssetDownloader(executablePath, WithOS("os"), WithArch("arch"), WithMaxSize(int64(len(downloadData)))).
+			DownloadAsset(context.Background(), []release.Asset{{BrowserDownloadURL: chunked.URL + "/download_os_arch"}})
+		require.NoError(t, err)
+		cleanupFn()
+	})
+}
+
+func TestDigestHeader(t *testing.T) {
+	const wrongDigest = "0000000000000000000000000000000000000000000000000000000000000000"
+	testCases := []struct {
+		name           string
+		header, value  string
+		digest         string
+		expectMismatch bool
+	}{
+		{name: "ContentDigest", header: "Content-Digest", value: "sha-512=:AAAA:, sha-256=:iP1gKpMLx8C7eMOF88tw6XagzcNRcCC+MvGaroyOuhc=:", digest: downloadDataChecksum},
+		{name: "ContentDigestMismatch", header: "Content-Digest", value: "sha-256=:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=:", digest: downloadDataChecksum, expectMismatch: true},
+		{name: "ArtifactoryMismatch", header: "X-Checksum-Sha256", value: wrongDigest, digest: downloadDataChecksum, expectMismatch: true},
+		{name: "NoPublishedDigest", header: "X-Checksum-Sha256", value: wrongDigest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := setupTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(tc.header, tc.value)
+				downloadDataHandler(w, r)
+			}))
+			a := release.Asset{Name: "savvy_os_arch", BrowserDownloadURL: srv.URL + "/savvy_os_arch"}
+			if tc.digest != "" {
+				a.Digest = "sha256:" + tc.digest
+			}
+			downloader := NewAssetDownloader("savvy", WithOS("os"), WithArch("arch"))
+			info, cleanupFn, err := downloader.DownloadAsset(context.Background(), []release.Asset{a})
+			if !tc.expectMismatch {
+				require.NoError(t, err)
+				defer cleanupFn()
+				assert.Equal(t, downloadDataChecksum, info.Checksum)
+				return
+			}
+			var mismatch *DigestMismatchError
+			require.ErrorAs(t, err, &mismatch)
+			assert.Equal(t, tc.header, mismatch.Header)
+			assert.Equal(t, tc.digest, mismatch.Expected)
+		})
+	}
+}
+
+func TestAssetMatching(t *testing.T) {
+	const executablePath = "savvy"
+	srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+	ctx := context.Background()
+	assets := []release.Asset{
+		{Name: "savvy_1.2.3_darwin_arm64.tar.gz", BrowserDownloadURL: srv.URL + "/savvy_1.2.3_darwin_arm64.tar.gz"},
+		{Name: "savvy-v1.2.3-macOS-x86_64.zip", BrowserDownloadURL: srv.URL + "/savvy-v1.2.3-macOS-x86_64.zip"},
+		{Name: "savvy_1.2.3_Linux_x86_64.tar.gz", BrowserDownloadURL: srv.URL + "/savvy_1.2.3_Linux_x86_64.tar.gz"},
+		{Name: "savvy_1.2.3_linux_arm64.tgz", BrowserDownloadURL: srv.URL + "/savvy_1.2.3_linux_arm64.tgz"},
+	}
+
+	testCases := []struct {
+		name        string
+		opts        []AssetDownloadOpt
+		expectedURL string
+		arSuffix    string
+	}{
+		{
+			name: "Template",
+			opts: []AssetDownloadOpt{
+				WithOS("linux"), WithArch("x86_64"),
+				WithTemplate("{{.Name}}_{{.Version}}_{{.OS}}_{{.Arch}}.tar.gz"),
+			},
+			expectedURL: assets[2].BrowserDownloadURL,
+			arSuffix:    ".tar.gz",
+		},
+		{
+			name:        "Alias",
+			opts:        []AssetDownloadOpt{WithOS("darwin"), WithArch("amd64")},
+			expectedURL: assets[1].BrowserDownloadURL,
+			arSuffix:    ".zip",
+		},
+		{
+			name: "Matcher",
+			opts: []AssetDownloadOpt{
+				WithMatcher(func(a release.Asset) bool { return strings.Contains(a.Name, "macOS-x86_64") }),
+			},
+			expectedURL: assets[1].BrowserDownloadURL,
+			arSuffix:    ".zip",
+		},
+		{
+			name:        "Tgz",
+			opts:        []AssetDownloadOpt{WithOS("linux"), WithArch("arm64")},
+			expectedURL: assets[3].BrowserDownloadURL,
+			arSuffix:    ".tar.gz",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			downloader := NewAssetDownloader(executablePath, tc.opts...)
+			info, cleanupFn, err := downloader.DownloadAsset(ctx, assets)
+			require.NoError(t, err)
+			defer cleanupFn()
+			assert.Equal(t, tc.expectedURL, info.URL)
+			assert.Equal(t, tc.arSuffix, info.ArSuffix)
+		})
+	}
+
+	t.Run("TemplateWithoutMatch", func(t *testing.T) {
+		downloader := NewAssetDownloader(executablePath, WithOS("windows"), WithArch("amd64"),
+			WithTemplate("{{.Name}}_{{.Version}}_{{.OS}}_{{.Arch}}.zip"))
+		_, _, err := downloader.DownloadAsset(ctx, assets)
+		assert.ErrorIs(t, err, ErrNoAsset)
+	})
+}
+
+func TestNichePlatforms(t *testing.T) {
+	srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+	ctx := context.Background()
+	var assets []release.Asset
+	for _, name := range []string{
+		"savvy_1.2.3_windows_amd64.zip",
+		"savvy_1.2.3_freebsd_amd64.tar.gz",
+		"savvy-1.2.3-FreeBSD-aarch64.tar.gz",
+		"savvy_1.2.3_openbsd_x86_64.tar.gz",
+		"savvy_1.2.3_netbsd_arm64.tar.gz",
+		"savvy_1.2.3_linux_riscv64.tar.gz",
+		"savvy_1.2.3_linux_ppc64le.tar.gz",
+		"savvy_1.2.3_linux_loongarch64.tar.gz",
+		"savvy_1.2.3_sunos_amd64.tar.gz",
+	} {
+		assets = append(assets, release.Asset{Name: name, BrowserDownloadURL: srv.URL + "/" + name})
+	}
+
+	for platform, expected := range map[string]string{
+		"freebsd_amd64":   "savvy_1.2.3_freebsd_amd64.tar.gz",
+		"freebsd_arm64":   "savvy-1.2.3-FreeBSD-aarch64.tar.gz",
+		"openbsd_amd64":   "savvy_1.2.3_openbsd_x86_64.tar.gz",
+		"netbsd_arm64":    "savvy_1.2.3_netbsd_arm64.tar.gz",
+		"linux_riscv64":   "savvy_1.2.3_linux_riscv64.tar.gz",
+		"linux_ppc64le":   "savvy_1.2.3_linux_ppc64le.tar.gz",
+		"linux_loong64":   "savvy_1.2.3_linux_loongarch64.tar.gz",
+		"solaris_amd64":   "savvy_1.2.3_sunos_amd64.tar.gz",
+		"windows_arm64":   "savvy_1.2.3_windows_amd64.zip",
+		"windows_amd64":   "savvy_1.2.3_windows_amd64.zip",
+		"openbsd_riscv64": "",
+	} {
+		os, arch, _ := strings.Cut(platform, "_")
+		info, cleanupFn, err := NewAssetDownloader("savvy", WithOS(os), WithArch(arch)).DownloadAsset(ctx, assets)
+		if expected == "" {
+			assert.ErrorIs(t, err, ErrNoAsset, platform)
+			continue
+		}
+		require.NoError(t, err, platform)
+		cleanupFn()
+		assert.Equal(t, srv.URL+"/"+expected, info.URL, platform)
+	}
+
+	t.Run("NativeWindowsARM64", func(t *testing.T) {
+		native := append(assets, release.Asset{Name: "savvy_1.2.3_windows_arm64.zip", BrowserDownloadURL: srv.URL + "/savvy_1.2.3_windows_arm64.zip"})
+		info, cleanupFn, err := NewAssetDownloader("savvy", WithOS("windows"), WithArch("arm64")).DownloadAsset(ctx, native)
+		require.NoError(t, err)
+		defer cleanupFn()
+		assert.Equal(t, srv.URL+"/savvy_1.2.3_windows_arm64.zip", info.URL)
+	})
+}
+
+func TestAssetPreference(t *testing.T) {
+	srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+	ctx := context.Background()
+	assets := []release.Asset{
+		{Name: "savvy_linux_amd64.zip", BrowserDownloadURL: srv.URL + "/savvy_linux_amd64.zip"},
+		{Name: "savvy-static_linux_amd64.tar.gz", BrowserDownloadURL: srv.URL + "/savvy-static_linux_amd64.tar.gz"},
+		{Name: "savvy_linux_amd64.tar.gz", BrowserDownloadURL: srv.URL + "/savvy_linux_amd64.tar.gz"},
+		{Name: "savvy_linux_amd64", BrowserDownloadURL: srv.URL + "/savvy_linux_amd64"},
+	}
+
+	testCases := []struct {
+		name     string
+		opts     []AssetDownloadOpt
+		expected string
+	}{
+		{name: "ReleaseOrder", expected: "savvy_linux_amd64.zip"},
+		{name: "Preference", opts: []AssetDownloadOpt{WithArchivePreference(".TAR.GZ", ".zip")}, expected: "savvy-static_linux_amd64.tar.gz"},
+		{name: "Exclude", opts: []AssetDownloadOpt{WithArchivePreference(".tar.gz"), WithExclude(regexp.MustCompile(`-static`))}, expected: "savvy_linux_amd64.tar.gz"},
+		{name: "Unlisted", opts: []AssetDownloadOpt{WithArchivePreference(".gz"), WithExclude(regexp.MustCompile(`\.gz$`))}, expected: "savvy_linux_amd64.zip"},
+		{name: "Include", opts: []AssetDownloadOpt{WithInclude(regexp.MustCompile(`^savvy_linux_amd64$`))}, expected: "savvy_linux_amd64"},
+		{name: "Combined", opts: []AssetDownloadOpt{WithInclude(regexp.MustCompile(`\.(zip|gz)$`)), WithInclude(regexp.MustCompile(`^savvy-`))}, expected: "savvy-static_linux_amd64.tar.gz"},
+		{name: "ExcludeAll", opts: []AssetDownloadOpt{WithExclude(regexp.MustCompile(`\.zip$`)), WithExclude(regexp.MustCompile(`-static`))}, expected: "savvy_linux_amd64.tar.gz"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]AssetDownloadOpt{WithOS("linux"), WithArch("amd64"), WithLibc(platform.Glibc)}, tc.opts...)
+			a, err := NewAssetDownloader("savvy", opts...).(Selector).SelectAsset(ctx, assets)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, a.Name)
+		})
+	}
+
+	_, err := NewAssetDownloader("savvy", WithOS("linux"), WithArch("amd64"), WithInclude(regexp.MustCompile(`\.deb$`))).(Selector).SelectAsset(ctx, assets)
+	assert.ErrorIs(t, err, ErrNoAsset)
+}
+
+func TestPackagingAssets(t *testing.T) {
+	ctx := context.Background()
+	assets := []release.Asset{
+		{Name: "savvy_1.2.3_linux_amd64.deb"},
+		{Name: "savvy_1.2.3_linux_amd64.rpm"},
+		{Name: "savvy_1.2.3_linux_amd64.tar.gz.sig"},
+		{Name: "savvy_1.2.3_linux_amd64.sbom.json"},
+		{Name: "savvy_1.2.3_linux_amd64.tar.gz"},
+	}
+	linux := WithMatcher(func(a release.Asset) bool { return strings.Contains(a.Name, "linux_amd64") })
+
+	testCases := []struct {
+		name     string
+		opts     []AssetDownloadOpt
+		expected string
+	}{
+		{name: "Matcher", opts: []AssetDownloadOpt{linux}, expected: "savvy_1.2.3_linux_amd64.tar.gz"},
+		{name: "Include", opts: []AssetDownloadOpt{linux, WithInclude(regexp.MustCompile(`\.rpm$`))}, expected: "savvy_1.2.3_linux_amd64.rpm"},
+		{name: "IncludeName", opts: []AssetDownloadOpt{linux, WithInclude(regexp.MustCompile(`^savvy_`))}, expected: "savvy_1.2.3_linux_amd64.tar.gz"},
+		{name: "Template", opts: []AssetDownloadOpt{WithOS("linux"), WithArch("amd64"), WithTemplate("{{.Name}}_{{.Version}}_{{.OS}}_{{.Arch}}.deb")}, expected: "savvy_1.2.3_linux_amd64.deb"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := NewAssetDownloader("savvy", tc.opts...).(Selector).SelectAsset(ctx, assets)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, a.Name)
+		})
+	}
+}
+
+func TestGoReleaserMetadata(t *testing.T) {
+	const artifacts = `[
+  {"name": "savvy_1.2.3_macOS_all.tar.gz", "goos": "darwin", "goarch": "arm64", "type": "Archive"},
+  {"name": "savvy_1.2.3_macOS_all.tar.gz", "goos": "darwin", "goarch": "amd64", "type": "Archive"}
+]`
+	srv := setupTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/artifacts.json" {
+			io.WriteString(w, artifacts)
+			return
+		}
+		downloadDataHandler(w, r)
+	}))
+	ctx := context.Background()
+	assets := []release.Asset{
+		{Name: "savvy_1.2.3_macOS_all.tar.gz", BrowserDownloadURL: srv.URL + "/savvy_1.2.3_macOS_all.tar.gz"},
+		{Name: "savvy_1.2.3_darwin_arm64.tar.gz", BrowserDownloadURL: srv.URL + "/savvy_1.2.3_darwin_arm64.tar.gz"},
+		{Name: "artifacts.json", BrowserDownloadURL: srv.URL + "/artifacts.json"},
+	}
+
+	downloader := NewAssetDownloader("savvy", WithOS("darwin"), WithArch("arm64"), WithGoReleaserMetadata())
+	info, cleanupFn, err := downloader.DownloadAsset(ctx, assets)
+	require.NoError(t, err)
+	defer cleanupFn()
+	assert.Equal(t, assets[0].BrowserDownloadURL, info.URL)
+
+	downloader = NewAssetDownloader("savvy", WithOS("linux"), WithArch("arm64"), WithGoReleaserMetadata())
+	_, _, err = downloader.DownloadAsset(ctx, assets)
+	assert.ErrorIs(t, err, ErrNoAsset)
+
+	// without artifacts.json, assets are matched by name
+	downloader = NewAssetDownloader("savvy", WithOS("darwin"), WithArch("arm64"), WithGoReleaserMetadata())
+	info, cleanupFn, err = downloader.DownloadAsset(ctx, assets[:2])
+	require.NoError(t, err)
+	defer cleanupFn()
+	assert.Equal(t, assets[1].BrowserDownloadURL, info.URL)
+}
+
+func TestLibcPreference(t *testing.T) {
+	srv := setupTestServer(t, http.HandlerFunc(downloadDataHandler))
+	ctx := context.Background()
+	assets := []release.Asset{
+		{BrowserDownloadURL: srv.URL + "/savvy_linux_amd64_musl.tar.gz"},
+		{BrowserDownloadURL: srv.URL + "/savvy_linux_amd64.tar.gz"},
+	}
+	testCases := []struct {
+		libc        platform.Libc
+		expectedURL string
+	}{
+		{libc: platform.Musl, expectedURL: assets[0].BrowserDownloadURL},
+		{libc: platform.Glibc, expectedURL: assets[1].BrowserDownloadURL},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.libc), func(t *testing.T) {
+			downloader := NewAssetDownloader("savvy", WithOS("linux"), WithArch("amd64"), WithLibc(tc.libc))
+			info, cleanupFn, err := downloader.DownloadAsset(ctx, assets)
+			require.NoError(t, err)
+			defer cleanupFn()
+			assert.Equal(t, tc.expectedURL, info.URL)
+		})
+	}
 }
@@ -0,0 +1,89 @@
+package release
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CredentialSource returns the token to authenticate requests to host with,
+// or "" if it has none, see WithCredentialSources.
+type CredentialSource func(ctx context.Context, host string) string
+
+// DefaultCredentialSources are the sources ResolveToken looks up tokens in.
+var DefaultCredentialSources = []CredentialSource{EnvCredentials(), GHCLICredentials()}
+
+// ResolveToken returns a GitHub token for host from the environment variables
+// the gh CLI reads, or from the credentials stored by `gh auth login`.
+// It returns "" if there is none.
+func ResolveToken(ctx context.Context, host string) string {
+	return resolveToken(ctx, host, DefaultCredentialSources)
+}
+
+// resolveToken returns the token of the first of sources that has one for host.
+func resolveToken(ctx context.Context, host string, sources []CredentialSource) string {
+	for _, source := range sources {
+		if token := strings.TrimSpace(source(ctx, host)); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// EnvCredentials reads the token from the GH_TOKEN or GITHUB_TOKEN
+// environment variables, or GH_ENTERPRISE_TOKEN and GITHUB_ENTERPRISE_TOKEN
+// for hosts other than github.com, like the gh CLI.
+func EnvCredentials() CredentialSource {
+	return func(ctx context.Context, host string) string {
+		envs := []string{"GH_TOKEN", "GITHUB_TOKEN"}
+		if host != "github.com" {
+			envs = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+		}
+		for _, env := range envs {
+			if token := strings.TrimSpace(os.Getenv(env)); token != "" {
+				return token
+			}
+		}
+		return ""
+	}
+}
+
+// GHCLICredentials reads the token stored by `gh auth login`.
+func GHCLICredentials() CredentialSource {
+	return func(ctx context.Context, host string) string {
+		return ghToken(ctx, host)
+	}
+}
+
+// ghToken asks the gh CLI for its stored token. It is a variable for tests.
+var ghToken = func(ctx context.Context, host string) string {
+	return runCredentialHelper(ctx, "gh", "auth", "token", "--hostname", host)
+}
+
+// runCredentialHelper runs a command printing a token and returns its output,
+// or "" if it isn't installed or fails.
+func runCredentialHelper(ctx context.Context, name string, args ...string) string {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// apiHost returns the GitHub host whose API is served at baseURL.
+func apiHost(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" || u.Host == "api.github.com" {
+		return "github.com"
+	}
+	return u.Host
+}
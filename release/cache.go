@@ -0,0 +1,64 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// cacheEntry is a cached API response.
+type cacheEntry struct {
+	URL  string          `json:"url"`
+	ETag string          `json:"etag"`
+	Body json.RawMessage `json:"body"`
+	// Next is the URL of the next page of a paginated response.
+	Next string `json:"next,omitempty"`
+}
+
+// cachePath returns the file caching the response for url.
+func (g *githubReleaseGetter) cachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(g.cacheDir, "release-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadCache returns the cached response for url, or nil.
+func (g *githubReleaseGetter) loadCache(url string) *cacheEntry {
+	if g.cacheDir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(g.cachePath(url))
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != url || e.ETag == "" {
+		return nil
+	}
+	return &e
+}
+
+// storeCache caches the response for url. The cache is best effort, so errors are ignored.
+func (g *githubReleaseGetter) storeCache(url, etag string, body []byte, next string) {
+	if g.cacheDir == "" || !json.Valid(body) {
+		return
+	}
+	data, err := json.Marshal(cacheEntry{URL: url, ETag: etag, Body: body, Next: next})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(g.cacheDir, 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(g.cacheDir, ".release-*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err != nil || closeErr != nil {
+		return
+	}
+	os.Rename(tmp.Name(), g.cachePath(url))
+}
@@ -0,0 +1,108 @@
+package release
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// NetrcCredentials reads the token from the password of the entry for the
+// host, or for its "api." subdomain, in the netrc file at path, e.g.:
+//
+//	machine github.com login savvy password ghp_...
+//
+// The default entry is used if no machine matches. If path is empty, the
+// file in $NETRC or ~/.netrc (~/_netrc on Windows) is read.
+func NetrcCredentials(path string) CredentialSource {
+	return func(ctx context.Context, host string) string {
+		p := path
+		if p == "" {
+			p = netrcPath()
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		passwords, err := parseNetrc(f)
+		if err != nil {
+			return ""
+		}
+		for _, machine := range []string{host, "api." + host, ""} {
+			if password, ok := passwords[machine]; ok {
+				return password
+			}
+		}
+		return ""
+	}
+}
+
+// netrcPath returns the default location of the netrc file.
+func netrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// parseNetrc returns the passwords of a netrc file keyed on the lowercased
+// machine name, with the default entry keyed on "". Macros are skipped.
+func parseNetrc(r io.Reader) (map[string]string, error) {
+	passwords := make(map[string]string)
+	s := bufio.NewScanner(r)
+	s.Split(bufio.ScanWords)
+	machine, inEntry, inMacro := "", false, false
+	for s.Scan() {
+		token := s.Text()
+		if inMacro {
+			// a macro definition ends with an empty line, which word
+			// splitting can't see, so it runs until the next entry
+			if token != "machine" && token != "default" {
+				continue
+			}
+			inMacro = false
+		}
+		switch token {
+		case "machine":
+			if !s.Scan() {
+				return passwords, s.Err()
+			}
+			machine, inEntry = strings.ToLower(s.Text()), true
+		case "default":
+			machine, inEntry = "", true
+		case "macdef":
+			inMacro, inEntry = true, false
+		case "login", "account":
+			s.Scan()
+		case "password":
+			if !s.Scan() {
+				return passwords, s.Err()
+			}
+			if _, ok := passwords[machine]; inEntry && !ok {
+				passwords[machine] = s.Text()
+			}
+		}
+	}
+	return passwords, s.Err()
+}
+
+// KeychainCredentials reads the token stored in the OS keychain for service,
+// with the host as account: a generic password in the macOS Keychain, a
+// generic credential named "service:host" in the Windows Credential Manager,
+// or a libsecret secret with the service and account attributes elsewhere.
+func KeychainCredentials(service string) CredentialSource {
+	return func(ctx context.Context, host string) string {
+		return keychainToken(ctx, service, host)
+	}
+}
@@ -0,0 +1,8 @@
+package release
+
+import "context"
+
+// keychainToken reads a generic password from the macOS Keychain.
+var keychainToken = func(ctx context.Context, service, host string) string {
+	return runCredentialHelper(ctx, "security", "find-generic-password", "-s", service, "-a", host, "-w")
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !windows
+
+package release
+
+import "context"
+
+// keychainToken reads a secret from the libsecret keyring, e.g. GNOME Keyring or KWallet.
+var keychainToken = func(ctx context.Context, service, host string) string {
+	return runCredentialHelper(ctx, "secret-tool", "lookup", "service", service, "account", host)
+}
@@ -0,0 +1,76 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := `machine api.github.com
+	login savvy
+	password ghp_api
+
+macdef init
+cd /pub
+password ignored
+
+machine GHE.example.com login savvy password ghe_token
+default login anonymous password fallback
+`
+	passwords, err := parseNetrc(strings.NewReader(netrc))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"api.github.com":  "ghp_api",
+		"ghe.example.com": "ghe_token",
+		"":                "fallback",
+	}, passwords)
+}
+
+func TestCredentialSources(t *testing.T) {
+	ctx := context.Background()
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	require.NoError(t, os.WriteFile(netrc, []byte("machine api.github.com login savvy password from-netrc\n"), 0o600))
+
+	assert.Equal(t, "from-netrc", NetrcCredentials(netrc)(ctx, "github.com"))
+	assert.Empty(t, NetrcCredentials(netrc)(ctx, "ghe.example.com"))
+	assert.Empty(t, NetrcCredentials(filepath.Join(t.TempDir(), "missing"))(ctx, "github.com"))
+
+	keychain := keychainToken
+	t.Cleanup(func() { keychainToken = keychain })
+	var keychainHost string
+	keychainToken = func(ctx context.Context, service, host string) string {
+		keychainHost = host
+		if service == "savvy" {
+			return "from-keychain"
+		}
+		return ""
+	}
+
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(Info{TagName: "v0.2.0"})
+	}))
+	t.Cleanup(srv.Close)
+
+	// the first source with a token wins
+	t.Setenv("GH_ENTERPRISE_TOKEN", "from-env")
+	g := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithCredentialSources(
+		func(context.Context, string) string { return "" },
+		KeychainCredentials("savvy"),
+		EnvCredentials(),
+	))
+	_, err := g.GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer from-keychain", auth)
+	assert.Equal(t, apiHost(srv.URL), keychainHost)
+}
@@ -0,0 +1,67 @@
+package release
+
+import (
+	"context"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	modadvapi32   = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW = modadvapi32.NewProc("CredReadW")
+	procCredFree  = modadvapi32.NewProc("CredFree")
+)
+
+const credTypeGeneric = 1
+
+// credential is the CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keychainToken reads a generic credential from the Windows Credential Manager.
+var keychainToken = func(ctx context.Context, service, host string) string {
+	target, err := syscall.UTF16PtrFromString(service + ":" + host)
+	if err != nil {
+		return ""
+	}
+	var cred *credential
+	r, _, _ := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		return ""
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	if cred.CredentialBlobSize == 0 {
+		return ""
+	}
+	return decodeCredentialBlob(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+}
+
+// decodeCredentialBlob decodes a credential stored as UTF-16, e.g. by
+// cmdkey, or as UTF-8, e.g. by Git Credential Manager. Tokens are ASCII, so
+// UTF-16 blobs have every other byte zero.
+func decodeCredentialBlob(blob []byte) string {
+	if len(blob)%2 != 0 {
+		return string(blob)
+	}
+	u := make([]uint16, len(blob)/2)
+	for i := range u {
+		if blob[2*i+1] != 0 {
+			return string(blob)
+		}
+		u[i] = uint16(blob[2*i])
+	}
+	return string(utf16.Decode(u))
+}
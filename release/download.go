@@ -0,0 +1,50 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// OpenAsset requests the content of a with client. If token is non-nil and
+// a has an API URL, it is requested from the API, authenticated with the
+// token, which is required for assets of private repositories. The token is
+// only sent to the API host: it is removed when the API redirects to another
+// host, e.g. the object store serving the asset. Otherwise a is requested
+// from its browser download URL.
+//
+// The response status isn't checked, see CheckResponse.
+func OpenAsset(ctx context.Context, client *http.Client, a Asset, token func(ctx context.Context) string) (*http.Response, error) {
+	if token == nil || a.URL == "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.BrowserDownloadURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		return client.Do(req)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	if t := token(ctx); t != "" {
+		req.Header.Set("Authorization", "Bearer "+t)
+	}
+	apiClient := *client
+	checkRedirect := client.CheckRedirect
+	apiClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		// http.Client keeps the header for redirects to subdomains
+		if req.URL.Host != via[0].URL.Host {
+			req.Header.Del("Authorization")
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return apiClient.Do(req)
+}
@@ -0,0 +1,59 @@
+package release
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAsset(t *testing.T) {
+	ctx := context.Background()
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"), "token sent to the object store")
+		io.WriteString(w, "content")
+	}))
+	t.Cleanup(store.Close)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/octet-stream", r.Header.Get("Accept"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		http.Redirect(w, r, store.URL+"/savvy_linux_amd64?signature=1", http.StatusFound)
+	}))
+	t.Cleanup(api.Close)
+
+	a := Asset{
+		Name:               "savvy_linux_amd64",
+		BrowserDownloadURL: store.URL + "/savvy_linux_amd64",
+		URL:                api.URL + "/repos/getsavvyinc/savvy-cli/releases/assets/1",
+	}
+	token := func(context.Context) string { return "secret" }
+
+	t.Run("API", func(t *testing.T) {
+		resp, err := OpenAsset(ctx, http.DefaultClient, a, token)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.NoError(t, CheckResponse(resp))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "content", string(body))
+		assert.Equal(t, "/savvy_linux_amd64", resp.Request.URL.Path)
+	})
+	t.Run("BrowserDownloadURL", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			a     Asset
+			token func(context.Context) string
+		}{
+			"NoToken":  {a: a},
+			"NoAPIURL": {a: Asset{Name: a.Name, BrowserDownloadURL: a.BrowserDownloadURL}, token: token},
+		} {
+			resp, err := OpenAsset(ctx, http.DefaultClient, tc.a, tc.token)
+			require.NoError(t, err, name)
+			resp.Body.Close()
+			assert.Equal(t, a.BrowserDownloadURL, resp.Request.URL.String(), name)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a release, asset or checksum file doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrReleaseNotFound is returned when a release doesn't exist. It wraps ErrNotFound.
+	ErrReleaseNotFound = fmt.Errorf("release %w", ErrNotFound)
+	// ErrRateLimited is returned when GitHub rejects a request because a rate
+	// limit was exceeded. The returned error is a *RateLimitError.
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// RateLimitError describes a request rejected by a rate limit.
+type RateLimitError struct {
+	URL string
+	// Reset is when requests are allowed again. It is zero if unknown.
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Reset.IsZero() {
+		return fmt.Sprintf("%s: %s", ErrRateLimited, e.URL)
+	}
+	return fmt.Sprintf("%s: %s, retry after %s", ErrRateLimited, e.URL, e.Reset.Format(time.RFC3339))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// rateLimitReset returns when a rate limited request can be retried, based on
+// the Retry-After and X-RateLimit-Reset headers.
+func rateLimitReset(h http.Header, now time.Time) time.Time {
+	if s, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return now.Add(time.Duration(s) * time.Second)
+	}
+	if s, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return time.Unix(s, 0)
+	}
+	return time.Time{}
+}
+
+// CheckResponse returns nil for successful responses and an error wrapping
+// ErrNotFound, or a *RateLimitError, where applicable, otherwise.
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	url := resp.Request.URL.Redacted()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, url)
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0",
+		resp.StatusCode == http.StatusForbidden && resp.Header.Get("Retry-After") != "":
+		return &RateLimitError{URL: url, Reset: rateLimitReset(resp.Header, time.Now())}
+	default:
+		return fmt.Errorf("unexpected response from %s: %s", url, resp.Status)
+	}
+}
@@ -0,0 +1,33 @@
+package release
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckResponse(t *testing.T) {
+	u, _ := url.Parse("https://api.github.com/repos/getsavvyinc/savvy-cli/releases/latest")
+	response := func(status int, header http.Header) *http.Response {
+		return &http.Response{StatusCode: status, Status: http.StatusText(status), Header: header, Request: &http.Request{URL: u}}
+	}
+
+	assert.NoError(t, CheckResponse(response(http.StatusOK, nil)))
+	assert.ErrorIs(t, CheckResponse(response(http.StatusNotFound, nil)), ErrNotFound)
+	assert.ErrorIs(t, CheckResponse(response(http.StatusTooManyRequests, nil)), ErrRateLimited)
+	assert.ErrorIs(t, CheckResponse(response(http.StatusForbidden, http.Header{"X-Ratelimit-Remaining": {"0"}})), ErrRateLimited)
+
+	var rateLimited *RateLimitError
+	err := CheckResponse(response(http.StatusForbidden, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1700000000"}}))
+	require.ErrorAs(t, err, &rateLimited)
+	assert.Equal(t, time.Unix(1700000000, 0), rateLimited.Reset)
+
+	err = CheckResponse(response(http.StatusForbidden, http.Header{}))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRateLimited)
+	assert.ErrorIs(t, ErrReleaseNotFound, ErrNotFound)
+}
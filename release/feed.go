@@ -0,0 +1,155 @@
+package release
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TagGetter returns the tag of the latest release without its assets.
+type TagGetter interface {
+	GetLatestTag(ctx context.Context) (string, error)
+}
+
+type feedGetter struct {
+	repo, owner string
+	baseURL     string
+	tagPrefix   string
+	compare     CompareFunc
+	client      *http.Client
+}
+
+var _ TagGetter = (*feedGetter)(nil)
+
+type FeedOpt func(*feedGetter)
+
+// WithFeedBaseURL sets the URL of the GitHub web server, e.g. for GitHub
+// Enterprise Server or a fake server in tests. The default is "https://github.com".
+func WithFeedBaseURL(url string) FeedOpt {
+	return func(g *feedGetter) {
+		g.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithFeedHTTPClient sends requests with client instead of http.DefaultClient.
+func WithFeedHTTPClient(client *http.Client) FeedOpt {
+	return func(g *feedGetter) {
+		g.client = client
+	}
+}
+
+// WithFeedTagPrefix only considers releases tagged with prefix, e.g. "cli/",
+// see WithTagPrefix.
+func WithFeedTagPrefix(prefix string) FeedOpt {
+	return func(g *feedGetter) {
+		g.tagPrefix = prefix
+	}
+}
+
+// WithFeedVersionCompare orders the versions of release tags with compare
+// instead of as semantic versions, see WithVersionCompare. The feed doesn't
+// mark pre-releases, so they are only skipped for semantic versions.
+func WithFeedVersionCompare(compare CompareFunc) FeedOpt {
+	return func(g *feedGetter) {
+		g.compare = compare
+	}
+}
+
+// NewFeedGetter returns a TagGetter reading the releases.atom feed of a
+// repository. Unlike the API, the feed isn't subject to the API rate limits,
+// but it has no assets, so it is only fit for checking for new versions.
+func NewFeedGetter(repo, owner string, opts ...FeedOpt) *feedGetter {
+	g := &feedGetter{
+		repo:    repo,
+		owner:   owner,
+		baseURL: "https://github.com",
+		client:  http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+type atomFeed struct {
+	Entries []struct {
+		ID    string `xml:"id"`
+		Links []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// maxFeedSize limits the size of the releases feed.
+const maxFeedSize = 4 << 20
+
+// GetLatestTag returns the highest version tagged in the feed. Like the
+// latest release of the API, pre-releases are ignored.
+func (g *feedGetter) GetLatestTag(ctx context.Context) (string, error) {
+	feedURL := fmt.Sprintf("%s/%s/%s/releases.atom", g.baseURL, g.owner, g.repo)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/atom+xml")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := CheckResponse(resp); err != nil {
+		return "", fmt.Errorf("failed to get releases feed: %w", err)
+	}
+
+	var feed atomFeed
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxFeedSize)).Decode(&feed); err != nil {
+		return "", fmt.Errorf("invalid releases feed: %w", err)
+	}
+	var tags, versions []string
+	for _, e := range feed.Entries {
+		tag := entryTag(e.ID)
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				tag = entryTag(l.Href)
+			}
+		}
+		if !strings.HasPrefix(tag, g.tagPrefix) {
+			continue
+		}
+		v := strings.TrimPrefix(tag, g.tagPrefix)
+		if g.compare == nil && isSemverPrerelease(v) {
+			continue
+		}
+		tags = append(tags, tag)
+		versions = append(versions, v)
+	}
+	i := latestVersion(versions, g.compare)
+	if i < 0 {
+		return "", fmt.Errorf("%w: no release in %s", ErrReleaseNotFound, feedURL)
+	}
+	return tags[i], nil
+}
+
+// entryTag returns the tag at the end of the id or link of a feed entry, e.g.
+// "tag:github.com,2008:Repository/1/v1.0.0" or "https://github.com/o/r/releases/tag/v1.0.0".
+// Tags may contain slashes, e.g. "cli/v1.0.0".
+func entryTag(s string) string {
+	tag := path.Base(s)
+	if _, after, ok := strings.Cut(s, "/releases/tag/"); ok {
+		tag = after
+	} else if _, after, ok := strings.Cut(s, ":Repository/"); ok {
+		if _, t, ok := strings.Cut(after, "/"); ok {
+			tag = t
+		}
+	}
+	if unescaped, err := url.PathUnescape(tag); err == nil {
+		tag = unescaped
+	}
+	return tag
+}
@@ -0,0 +1,131 @@
+// Package goreleaser reads the artifacts.json metadata that goreleaser
+// writes for a release, so assets can be selected by their exact platform
+// instead of by name.
+package goreleaser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"runtime/debug"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// MetadataName is the name of the release asset holding the artifacts.
+const MetadataName = "artifacts.json"
+
+// Artifact types that can be installed.
+const (
+	TypeArchive = "Archive"
+	TypeBinary  = "Binary"
+)
+
+// Artifact is an entry of artifacts.json.
+type Artifact struct {
+	Name    string         `json:"name"`
+	Path    string         `json:"path"`
+	GOOS    string         `json:"goos"`
+	GOARCH  string         `json:"goarch"`
+	GOARM   string         `json:"goarm"`
+	GOAMD64 string         `json:"goamd64"`
+	Type    string         `json:"type"`
+	Extra   map[string]any `json:"extra"`
+}
+
+// Checksum returns the sha256 checksum goreleaser recorded for a, if any.
+func (a Artifact) Checksum() string {
+	c, _ := a.Extra["Checksum"].(string)
+	c, ok := strings.CutPrefix(c, "sha256:")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(c)
+}
+
+// ErrNoMetadata is returned by Fetch when the release has no artifacts.json asset.
+var ErrNoMetadata = errors.New("no goreleaser metadata found")
+
+// Fetch downloads and parses the artifacts.json asset of a release with
+// client, or http.DefaultClient if client is nil.
+func Fetch(ctx context.Context, client *http.Client, assets []release.Asset) ([]Artifact, error) {
+	var url string
+	for _, a := range assets {
+		if a.Name == MetadataName || (a.Name == "" && path.Base(a.BrowserDownloadURL) == MetadataName) {
+			url = a.BrowserDownloadURL
+			break
+		}
+	}
+	if url == "" {
+		return nil, ErrNoMetadata
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := release.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", MetadataName, err)
+	}
+
+	var artifacts []Artifact
+	if err := json.NewDecoder(resp.Body).Decode(&artifacts); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", MetadataName, err)
+	}
+	return artifacts, nil
+}
+
+// Select returns the installable artifact built for goos and goarch,
+// preferring archives over raw binaries. goarm is only compared for arm and
+// ignored if empty.
+func Select(artifacts []Artifact, goos, goarch, goarm string) (Artifact, bool) {
+	var binary *Artifact
+	for i, a := range artifacts {
+		if a.GOOS != goos || a.GOARCH != goarch {
+			continue
+		}
+		if goarch == "arm" && goarm != "" && a.GOARM != "" && a.GOARM != goarm {
+			continue
+		}
+		switch a.Type {
+		case TypeArchive:
+			return a, true
+		case TypeBinary:
+			if binary == nil {
+				binary = &artifacts[i]
+			}
+		}
+	}
+	if binary != nil {
+		return *binary, true
+	}
+	return Artifact{}, false
+}
+
+// GOARM returns the GOARM the running binary was built with, or "" if unknown.
+func GOARM() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "GOARM" {
+			// e.g. "7" or "7,softfloat"
+			goarm, _, _ := strings.Cut(s.Value, ",")
+			return goarm
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package goreleaser
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const artifactsJSON = `[
+  {"name": "savvy_0.2.0_checksums.txt", "type": "Checksum"},
+  {"name": "savvy", "goos": "linux", "goarch": "amd64", "goamd64": "v1", "type": "Binary"},
+  {"name": "savvy_0.2.0_Linux_x86_64.tar.gz", "goos": "linux", "goarch": "amd64", "goamd64": "v1", "type": "Archive", "extra": {"Checksum": "sha256:ABC123"}},
+  {"name": "savvy_0.2.0_Linux_armv6.tar.gz", "goos": "linux", "goarch": "arm", "goarm": "6", "type": "Archive"},
+  {"name": "savvy_0.2.0_Linux_armv7.tar.gz", "goos": "linux", "goarch": "arm", "goarm": "7", "type": "Archive"},
+  {"name": "savvy_0.2.0_Darwin_arm64", "goos": "darwin", "goarch": "arm64", "type": "Binary"}
+]`
+
+func TestFetchAndSelect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, artifactsJSON)
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	_, err := Fetch(ctx, nil, []release.Asset{{Name: "savvy_0.2.0_Linux_x86_64.tar.gz"}})
+	assert.ErrorIs(t, err, ErrNoMetadata)
+
+	artifacts, err := Fetch(ctx, nil, []release.Asset{{BrowserDownloadURL: srv.URL + "/artifacts.json"}})
+	require.NoError(t, err)
+	require.Len(t, artifacts, 6)
+
+	testCases := []struct {
+		goos, goarch, goarm string
+		name                string
+	}{
+		{"linux", "amd64", "", "savvy_0.2.0_Linux_x86_64.tar.gz"},
+		{"linux", "arm", "7", "savvy_0.2.0_Linux_armv7.tar.gz"},
+		{"linux", "arm", "", "savvy_0.2.0_Linux_armv6.tar.gz"},
+		{"darwin", "arm64", "", "savvy_0.2.0_Darwin_arm64"},
+		{"windows", "amd64", "", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.goos+"_"+tc.goarch+tc.goarm, func(t *testing.T) {
+			a, ok := Select(artifacts, tc.goos, tc.goarch, tc.goarm)
+			assert.Equal(t, tc.name != "", ok)
+			assert.Equal(t, tc.name, a.Name)
+		})
+	}
+
+	a, _ := Select(artifacts, "linux", "amd64", "")
+	assert.Equal(t, "abc123", a.Checksum())
+	a, _ = Select(artifacts, "darwin", "arm64", "")
+	assert.Empty(t, a.Checksum())
+}
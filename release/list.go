@@ -0,0 +1,75 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Lister is implemented by Getters that can list all releases, e.g. to
+// select a channel or resolve a version constraint.
+type Lister interface {
+	// ListReleases returns the releases matching opts, newest first.
+	// Drafts are never listed.
+	ListReleases(ctx context.Context, opts ListOptions) ([]Info, error)
+}
+
+// ListOptions filters the releases returned by ListReleases.
+type ListOptions struct {
+	// Prereleases lists pre-releases as well.
+	Prereleases bool
+	// TagPrefix and TagSuffix only list releases whose tag has them, e.g.
+	// "cli/" or "-lts". The prefix set by WithTagPrefix always applies.
+	TagPrefix string
+	TagSuffix string
+	// Limit stops listing once that many releases matched. Zero lists all
+	// releases, which takes a request per 100 releases.
+	Limit int
+}
+
+var _ Lister = (*githubReleaseGetter)(nil)
+
+// ListReleases returns the releases of the repository matching opts, newest
+// first, following the pagination of the GitHub API.
+func (g *githubReleaseGetter) ListReleases(ctx context.Context, opts ListOptions) ([]Info, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=100", g.baseURL, g.owner, g.repo)
+	var releases []Info
+	for url != "" {
+		var page []Info
+		next, err := g.getJSON(ctx, url, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range page {
+			if r.Draft || r.Prerelease && !opts.Prereleases {
+				continue
+			}
+			if !strings.HasPrefix(r.TagName, g.tagPrefix+opts.TagPrefix) || !strings.HasSuffix(r.TagName, opts.TagSuffix) {
+				continue
+			}
+			releases = append(releases, r)
+			if len(releases) == opts.Limit {
+				return releases, nil
+			}
+		}
+		url = next
+	}
+	return releases, nil
+}
+
+// nextPage returns the URL of the next page in a Link header, e.g.
+// `<https://api.github.com/repositories/1/releases?page=2>; rel="next"`.
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(part), ";")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListReleases(t *testing.T) {
+	ctx := context.Background()
+	pages := [][]Info{
+		{
+			{TagName: "cli/v1.6.0", Draft: true},
+			{TagName: "cli/v1.5.0-rc.1", Prerelease: true},
+			{TagName: "agent/v2.1.0"},
+		},
+		{
+			{TagName: "cli/v1.4.0-lts"},
+			{TagName: "cli/v1.4.0"},
+		},
+		{
+			{TagName: "cli/v1.3.9"},
+		},
+	}
+	var requests []int
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+		requests = append(requests, page)
+		if page < len(pages) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repositories/1/releases?per_page=100&page=%d>; rel="next", <%s/repositories/1/releases?per_page=100&page=%d>; rel="last"`, srv.URL, page+1, srv.URL, len(pages)))
+		}
+		json.NewEncoder(w).Encode(pages[page-1])
+	}))
+	t.Cleanup(srv.Close)
+
+	tags := func(releases []Info) []string {
+		var tags []string
+		for _, r := range releases {
+			tags = append(tags, r.TagName)
+		}
+		return tags
+	}
+
+	g := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL))
+	releases, err := g.ListReleases(ctx, ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"agent/v2.1.0", "cli/v1.4.0-lts", "cli/v1.4.0", "cli/v1.3.9"}, tags(releases))
+	assert.Equal(t, []int{1, 2, 3}, requests)
+
+	releases, err = g.ListReleases(ctx, ListOptions{Prereleases: true, TagPrefix: "cli/"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cli/v1.5.0-rc.1", "cli/v1.4.0-lts", "cli/v1.4.0", "cli/v1.3.9"}, tags(releases))
+	assert.True(t, releases[0].Prerelease)
+
+	releases, err = NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithTagPrefix("cli/")).ListReleases(ctx, ListOptions{TagSuffix: "-lts"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cli/v1.4.0-lts"}, tags(releases))
+
+	// the latest release of a prefix may be past the first page
+	info, err := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithTagPrefix("cli/")).GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "cli/v1.4.0", info.TagName)
+
+	// the limit stops the pagination
+	requests = nil
+	releases, err = g.ListReleases(ctx, ListOptions{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"agent/v2.1.0", "cli/v1.4.0-lts"}, tags(releases))
+	assert.Equal(t, []int{1, 2}, requests)
+}
+
+func TestNextPage(t *testing.T) {
+	assert.Equal(t, "https://api.github.com/repositories/1/releases?page=2",
+		nextPage(`<https://api.github.com/repositories/1/releases?page=2>; rel="next", <https://api.github.com/repositories/1/releases?page=5>; rel="last"`))
+	assert.Empty(t, nextPage(`<https://api.github.com/repositories/1/releases?page=1>; rel="prev"`))
+	assert.Empty(t, nextPage(""))
+}
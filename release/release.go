@@ -3,58 +3,345 @@ package release
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Asset is a file attached to a release.
 type Asset struct {
+	// ID identifies the asset in the GitHub API.
+	ID                 int64  `json:"id,omitempty"`
 	Name               string `json:"name"`
 	BrowserDownloadURL string `json:"browser_download_url"`
+	// URL is the API endpoint of the asset, which serves its content to
+	// requests accepting "application/octet-stream", including for private
+	// repositories.
+	URL string `json:"url,omitempty"`
+	// Digest is the digest GitHub computed for the asset, e.g. "sha256:<hex>".
+	// It is empty for assets uploaded before GitHub started computing digests.
+	Digest string `json:"digest,omitempty"`
+	// Size is the size of the asset in bytes, or 0 if unknown.
+	Size int64 `json:"size,omitempty"`
+	// ContentType is the media type the asset was uploaded with, e.g.
+	// "application/gzip".
+	ContentType   string    `json:"content_type,omitempty"`
+	DownloadCount int       `json:"download_count,omitempty"`
+	CreatedAt     time.Time `json:"created_at,omitempty"`
+	// UpdatedAt is when the asset was last uploaded.
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
 }
 
 // Info holds information about a release.
 type Info struct {
+	// ID identifies the release in the GitHub API.
+	ID      int64   `json:"id,omitempty"`
 	TagName string  `json:"tag_name"`
 	Assets  []Asset `json:"assets"`
+	// Name is the title of the release, which is often the tag.
+	Name string `json:"name,omitempty"`
+	// Body holds the release notes, usually markdown.
+	Body string `json:"body,omitempty"`
+	// HTMLURL is the web page of the release.
+	HTMLURL string `json:"html_url,omitempty"`
+	// Prerelease is true if the release is marked as a pre-release.
+	Prerelease bool `json:"prerelease,omitempty"`
+	// Draft is true for unpublished releases, which are only visible with a
+	// token that can push to the repository. Getters don't return drafts.
+	Draft bool `json:"draft,omitempty"`
+	// CreatedAt is when the release's tag was created, PublishedAt when the
+	// release was published.
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	PublishedAt time.Time `json:"published_at,omitempty"`
 }
 
+// Getter looks up releases. The upgrader only looks up releases through a
+// Getter, so implementing it plugs in another release source, e.g. an
+// artifact registry or a mirror.
 type Getter interface {
+	// GetLatestRelease returns the latest release. Drafts and pre-releases
+	// aren't expected to be returned. It returns an error wrapping
+	// ErrReleaseNotFound if there is no release. Assets are downloaded from
+	// their BrowserDownloadURL.
 	GetLatestRelease(ctx context.Context) (*Info, error)
 }
 
+// ByTagGetter is implemented by Getters that can look up a release by its
+// tag, e.g. to install a pinned version or a rollback target.
+type ByTagGetter interface {
+	// GetReleaseByTag returns the release tagged tag, or an error wrapping
+	// ErrReleaseNotFound if there is no such release.
+	GetReleaseByTag(ctx context.Context, tag string) (*Info, error)
+}
+
 type githubReleaseGetter struct {
 	repo, owner string
+	baseURL     string
+	cacheDir    string
+	maxWait     time.Duration
+	client      *http.Client
+
+	tagPrefix    string
+	compare      CompareFunc
+	token        string
+	resolveToken bool
+	sources      []CredentialSource
+	resolveOnce  sync.Once
+}
+
+var (
+	_ Getter      = (*githubReleaseGetter)(nil)
+	_ ByTagGetter = (*githubReleaseGetter)(nil)
+)
+
+type GetterOpt func(*githubReleaseGetter)
+
+// WithBaseURL sets the URL of the GitHub API, e.g. for GitHub Enterprise
+// Server or a fake server in tests. The default is "https://api.github.com".
+func WithBaseURL(url string) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithCache caches responses in dir and revalidates them with conditional
+// requests. Unchanged releases are answered with 304 Not Modified, which
+// doesn't count against the GitHub API rate limit.
+func WithCache(dir string) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.cacheDir = dir
+	}
+}
+
+// WithRateLimitWait waits for a rate limit to reset and retries once, if it
+// resets within max. Otherwise the *RateLimitError is returned right away.
+func WithRateLimitWait(max time.Duration) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.maxWait = max
+	}
+}
+
+// WithHTTPClient sends requests with client instead of http.DefaultClient.
+func WithHTTPClient(client *http.Client) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.client = client
+	}
 }
 
-var _ Getter = (*githubReleaseGetter)(nil)
+// WithTagPrefix only considers releases tagged with prefix, e.g. "cli/" for
+// monorepos that tag releases of several tools as "cli/v1.4.0" and
+// "agent/v2.1.0". GetLatestRelease returns the release with the highest
+// version among all releases, which it lists page by page, and
+// GetReleaseByTag adds the prefix to tags without it.
+func WithTagPrefix(prefix string) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.tagPrefix = prefix
+	}
+}
+
+// WithVersionCompare orders the versions of release tags with compare
+// instead of as semantic versions, e.g. for calendar versions, see
+// WithTagPrefix.
+func WithVersionCompare(compare CompareFunc) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.compare = compare
+	}
+}
+
+// WithToken authenticates API requests with a GitHub token, which raises the
+// rate limit and gives access to private repositories.
+func WithToken(token string) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.token = token
+	}
+}
 
-func NewReleaseGetter(repo, owner string) *githubReleaseGetter {
-	return &githubReleaseGetter{
-		repo:  repo,
-		owner: owner,
+// WithTokenFromEnvironment authenticates API requests with the token found
+// by ResolveToken, if any. The token is looked up on the first request.
+// If GitHub rejects it, e.g. because it expired, the request is retried unauthenticated.
+func WithTokenFromEnvironment() GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.resolveToken = true
 	}
 }
 
+// WithCredentialSources is like WithTokenFromEnvironment, but looks up the
+// token in sources, in order, instead of DefaultCredentialSources.
+func WithCredentialSources(sources ...CredentialSource) GetterOpt {
+	return func(g *githubReleaseGetter) {
+		g.resolveToken = true
+		g.sources = sources
+	}
+}
+
+func NewReleaseGetter(repo, owner string, opts ...GetterOpt) *githubReleaseGetter {
+	g := &githubReleaseGetter{
+		repo:    repo,
+		owner:   owner,
+		baseURL: "https://api.github.com",
+		client:  http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
 func (g *githubReleaseGetter) GetLatestRelease(ctx context.Context) (*Info, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", g.owner, g.repo)
-	return getLatestRelease(ctx, url)
+	if g.tagPrefix != "" {
+		return g.getLatestWithPrefix(ctx)
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/releases/latest", g.baseURL, g.owner, g.repo)
+	return g.getRelease(ctx, url)
 }
 
-// getLatestRelease fetches the latest release from GitHub.
-func getLatestRelease(ctx context.Context, url string) (*Info, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// getLatestWithPrefix returns the release with the highest version tagged
+// with g.tagPrefix. Like the latest release, drafts and pre-releases are
+// ignored. Every release is listed, since the releases of other prefixes may
+// push it past the first page.
+func (g *githubReleaseGetter) getLatestWithPrefix(ctx context.Context) (*Info, error) {
+	releases, err := g.ListReleases(ctx, ListOptions{})
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	versions := make([]string, len(releases))
+	for i, r := range releases {
+		versions[i] = strings.TrimPrefix(r.TagName, g.tagPrefix)
+	}
+	i := latestVersion(versions, g.compare)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no release tagged %s* in %s/%s", ErrReleaseNotFound, g.tagPrefix, g.owner, g.repo)
+	}
+	return &releases[i], nil
+}
+
+// GetReleaseByTag returns the release tagged tag, with the prefix set by
+// WithTagPrefix added if it is missing. If no such release exists and the
+// version has no "v" prefix, it is tried with one as well.
+func (g *githubReleaseGetter) GetReleaseByTag(ctx context.Context, tag string) (*Info, error) {
+	v := strings.TrimPrefix(tag, g.tagPrefix)
+	info, err := g.getRelease(ctx, g.tagURL(g.tagPrefix+v))
+	if errors.Is(err, ErrReleaseNotFound) && !strings.HasPrefix(v, "v") {
+		return g.getRelease(ctx, g.tagURL(g.tagPrefix+"v"+v))
+	}
+	return info, err
+}
+
+// tagURL returns the API URL of the release tagged tag.
+func (g *githubReleaseGetter) tagURL(tag string) string {
+	return fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", g.baseURL, g.owner, g.repo, url.PathEscape(tag))
+}
+
+// get requests url from the GitHub API, revalidating cached responses.
+func (g *githubReleaseGetter) get(ctx context.Context, url, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cached := g.loadCache(url); cached != nil {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	return g.client.Do(req)
+}
 
+// getRelease fetches a release from GitHub.
+func (g *githubReleaseGetter) getRelease(ctx context.Context, url string) (*Info, error) {
 	var release Info
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+	if _, err := g.getJSON(ctx, url, &release); err != nil {
 		return nil, err
 	}
 	return &release, nil
 }
+
+// getJSON fetches url from GitHub into v, waiting for a rate limit to reset
+// if allowed. It returns the URL of the next page of paginated responses.
+func (g *githubReleaseGetter) getJSON(ctx context.Context, url string, v any) (string, error) {
+	next, err := g.fetchJSON(ctx, url, v)
+	var rateLimited *RateLimitError
+	if g.maxWait <= 0 || !errors.As(err, &rateLimited) || rateLimited.Reset.IsZero() {
+		return next, err
+	}
+	wait := time.Until(rateLimited.Reset)
+	if wait > g.maxWait {
+		return "", err
+	}
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-t.C:
+		}
+	}
+	return g.fetchJSON(ctx, url, v)
+}
+
+// Token returns the token API requests are authenticated with, if any, e.g.
+// to download assets through the API, see asset.WithAPIDownloads.
+func (g *githubReleaseGetter) Token(ctx context.Context) string {
+	return g.authToken(ctx)
+}
+
+// authToken returns the token to authenticate API requests with, if any.
+func (g *githubReleaseGetter) authToken(ctx context.Context) string {
+	g.resolveOnce.Do(func() {
+		if g.token == "" && g.resolveToken {
+			sources := g.sources
+			if sources == nil {
+				sources = DefaultCredentialSources
+			}
+			g.token = resolveToken(ctx, apiHost(g.baseURL), sources)
+		}
+	})
+	return g.token
+}
+
+// fetchJSON fetches url from GitHub into v. It returns the URL of the next
+// page of paginated responses.
+func (g *githubReleaseGetter) fetchJSON(ctx context.Context, url string, v any) (string, error) {
+	resp, err := g.get(ctx, url, g.authToken(ctx))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && g.resolveToken && g.token != "" {
+		// the token found in the environment may be stale, public releases don't need it
+		resp.Body.Close()
+		if resp, err = g.get(ctx, url, ""); err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+	cached := g.loadCache(url)
+
+	var body []byte
+	var next string
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		body, next = cached.Body, cached.Next
+	} else {
+		if resp.StatusCode == http.StatusNotFound {
+			return "", fmt.Errorf("%w: %s", ErrReleaseNotFound, url)
+		}
+		if err := CheckResponse(resp); err != nil {
+			return "", fmt.Errorf("failed to get release: %w", err)
+		}
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return "", err
+		}
+		next = nextPage(resp.Header.Get("Link"))
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			g.storeCache(url, etag, body, next)
+		}
+	}
+
+	return next, json.Unmarshal(body, v)
+}
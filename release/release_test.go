@@ -0,0 +1,296 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseCache(t *testing.T) {
+	ctx := context.Background()
+	latest := Info{TagName: "v0.2.0", Assets: []Asset{{Name: "savvy_linux_amd64.tar.gz"}}}
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		etag := `"` + latest.TagName + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(latest)
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	for i := 0; i < 3; i++ {
+		g := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithCache(dir))
+		info, err := g.GetLatestRelease(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, latest, *info)
+	}
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 2, notModified)
+
+	// a changed release is fetched again
+	latest.TagName = "v0.3.0"
+	info, err := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithCache(dir)).GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.3.0", info.TagName)
+	assert.Equal(t, 2, notModified)
+
+	// without a cache, every request is a full request
+	_, err = NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL)).GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, notModified)
+}
+
+func TestRateLimitWait(t *testing.T) {
+	ctx := context.Background()
+	var requests int
+	retryAfter := "0"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests%2 == 1 {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(Info{TagName: "v0.2.0"})
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL)).GetLatestRelease(ctx)
+	var rateLimited *RateLimitError
+	require.ErrorAs(t, err, &rateLimited)
+	assert.ErrorIs(t, err, ErrRateLimited)
+
+	requests = 0
+	info, err := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithRateLimitWait(time.Minute)).GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", info.TagName)
+	assert.Equal(t, 2, requests)
+
+	// resets beyond the budget fail right away
+	requests = 0
+	retryAfter = "3600"
+	_, err = NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithRateLimitWait(time.Minute)).GetLatestRelease(ctx)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, 1, requests)
+}
+
+func TestTokenFromEnvironment(t *testing.T) {
+	ctx := context.Background()
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if a := r.Header.Get("Authorization"); a != "" && a != "Bearer valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(Info{TagName: "v0.2.0"})
+	}))
+	t.Cleanup(srv.Close)
+
+	gh := ghToken
+	t.Cleanup(func() { ghToken = gh })
+	var ghHost string
+	ghToken = func(ctx context.Context, host string) string {
+		ghHost = host
+		return "valid"
+	}
+
+	// enterprise hosts don't read GH_TOKEN
+	t.Setenv("GH_TOKEN", "stale")
+	t.Setenv("GH_ENTERPRISE_TOKEN", "")
+	t.Setenv("GITHUB_ENTERPRISE_TOKEN", "")
+	g := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithTokenFromEnvironment())
+	_, err := g.GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer valid"}, auth)
+	assert.Equal(t, apiHost(srv.URL), ghHost)
+
+	// stale tokens fall back to unauthenticated requests
+	auth = nil
+	t.Setenv("GH_ENTERPRISE_TOKEN", "stale")
+	g = NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithTokenFromEnvironment())
+	_, err = g.GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer stale", ""}, auth)
+
+	// explicit tokens are sent as is
+	auth = nil
+	_, err = NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithToken("stale")).GetLatestRelease(ctx)
+	require.Error(t, err)
+	assert.Equal(t, []string{"Bearer stale"}, auth)
+
+	assert.Equal(t, "github.com", apiHost("https://api.github.com"))
+}
+
+func TestFeedGetter(t *testing.T) {
+	ctx := context.Background()
+	feed := `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" xml:lang="en-US">
+  <id>tag:github.com,2008:https://github.com/getsavvyinc/savvy-cli/releases</id>
+  <entry>
+    <id>tag:github.com,2008:Repository/1/v0.10.0-beta</id>
+    <link rel="alternate" type="text/html" href="https://github.com/getsavvyinc/savvy-cli/releases/tag/v0.10.0-beta"/>
+  </entry>
+  <entry>
+    <id>tag:github.com,2008:Repository/1/v0.9.0</id>
+    <link rel="alternate" type="text/html" href="https://github.com/getsavvyinc/savvy-cli/releases/tag/v0.9.0"/>
+  </entry>
+  <entry>
+    <id>tag:github.com,2008:Repository/1/v0.10.0</id>
+    <link rel="alternate" type="text/html" href="https://github.com/getsavvyinc/savvy-cli/releases/tag/v0.10.0"/>
+  </entry>
+  <entry>
+    <id>tag:github.com,2008:Repository/1/nightly</id>
+    <link rel="alternate" type="text/html" href="https://github.com/getsavvyinc/savvy-cli/releases/tag/nightly"/>
+  </entry>
+</feed>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/getsavvyinc/savvy-cli/releases.atom" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(feed))
+	}))
+	t.Cleanup(srv.Close)
+
+	tag, err := NewFeedGetter("savvy-cli", "getsavvyinc", WithFeedBaseURL(srv.URL)).GetLatestTag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.10.0", tag)
+
+	_, err = NewFeedGetter("other", "getsavvyinc", WithFeedBaseURL(srv.URL)).GetLatestTag(ctx)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTagPrefix(t *testing.T) {
+	ctx := context.Background()
+	releases := []Info{
+		{TagName: "agent/v2.1.0"},
+		{TagName: "cli/v1.5.0-rc.1", Prerelease: true},
+		{TagName: "cli/v1.4.0"},
+		{TagName: "cli/v1.10.0", Draft: true},
+		{TagName: "cli/v1.3.9"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/getsavvyinc/savvy-cli/releases":
+			json.NewEncoder(w).Encode(releases)
+		case "/repos/getsavvyinc/savvy-cli/releases/tags/cli/v1.3.9":
+			json.NewEncoder(w).Encode(releases[4])
+		case "/getsavvyinc/savvy-cli/releases.atom":
+			w.Write([]byte(`<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry><id>tag:github.com,2008:Repository/1/agent/v2.1.0</id></entry>
+  <entry><id>tag:github.com,2008:Repository/1/cli/v1.4.0</id></entry>
+  <entry><link rel="alternate" href="https://github.com/getsavvyinc/savvy-cli/releases/tag/cli%2Fv1.3.9"/></entry>
+</feed>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	g := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithTagPrefix("cli/"))
+	info, err := g.GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "cli/v1.4.0", info.TagName)
+
+	for _, tag := range []string{"cli/v1.3.9", "v1.3.9", "1.3.9"} {
+		info, err := g.GetReleaseByTag(ctx, tag)
+		require.NoError(t, err, tag)
+		assert.Equal(t, "cli/v1.3.9", info.TagName)
+	}
+
+	_, err = NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithTagPrefix("ctl/")).GetLatestRelease(ctx)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	tag, err := NewFeedGetter("savvy-cli", "getsavvyinc", WithFeedBaseURL(srv.URL), WithFeedTagPrefix("cli/")).GetLatestTag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "cli/v1.4.0", tag)
+	tag, err = NewFeedGetter("savvy-cli", "getsavvyinc", WithFeedBaseURL(srv.URL), WithFeedTagPrefix("agent/")).GetLatestTag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "agent/v2.1.0", tag)
+}
+
+func TestReleaseMetadata(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+  "id": 1,
+  "tag_name": "v1.0.0",
+  "name": "Savvy 1.0",
+  "body": "Notes",
+  "draft": false,
+  "prerelease": true,
+  "created_at": "2024-06-01T03:04:05Z",
+  "published_at": "2024-06-02T03:04:05Z",
+  "assets": [{
+    "id": 2,
+    "name": "savvy_linux_amd64.tar.gz",
+    "content_type": "application/gzip",
+    "size": 1024,
+    "download_count": 42,
+    "created_at": "2024-06-01T03:04:05Z",
+    "updated_at": "2024-06-01T04:04:05Z"
+  }]
+}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	info, err := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL)).GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), info.ID)
+	assert.Equal(t, "Savvy 1.0", info.Name)
+	assert.True(t, info.Prerelease)
+	assert.Equal(t, time.Date(2024, 6, 1, 3, 4, 5, 0, time.UTC), info.CreatedAt)
+	assert.Equal(t, time.Date(2024, 6, 2, 3, 4, 5, 0, time.UTC), info.PublishedAt)
+	require.Len(t, info.Assets, 1)
+	a := info.Assets[0]
+	assert.Equal(t, int64(2), a.ID)
+	assert.Equal(t, "application/gzip", a.ContentType)
+	assert.Equal(t, int64(1024), a.Size)
+	assert.Equal(t, 42, a.DownloadCount)
+	assert.Equal(t, time.Date(2024, 6, 1, 3, 4, 5, 0, time.UTC), a.CreatedAt)
+}
+
+func TestVersionCompare(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/getsavvyinc/savvy-cli/releases":
+			json.NewEncoder(w).Encode([]Info{{TagName: "cli/v1.4.0"}, {TagName: "cli/v1.3.9"}, {TagName: "cli/nightly"}})
+		case "/getsavvyinc/savvy-cli/releases.atom":
+			w.Write([]byte(`<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry><id>tag:github.com,2008:Repository/1/cli/v1.4.0</id></entry>
+  <entry><id>tag:github.com,2008:Repository/1/cli/v1.3.9</id></entry>
+  <entry><id>tag:github.com,2008:Repository/1/cli/nightly</id></entry>
+</feed>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	// oldest first
+	compare := func(a, b string) (int, error) {
+		cmp, err := compareSemver(a, b)
+		return -cmp, err
+	}
+
+	info, err := NewReleaseGetter("savvy-cli", "getsavvyinc", WithBaseURL(srv.URL), WithTagPrefix("cli/"), WithVersionCompare(compare)).GetLatestRelease(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "cli/v1.3.9", info.TagName)
+
+	tag, err := NewFeedGetter("savvy-cli", "getsavvyinc", WithFeedBaseURL(srv.URL), WithFeedTagPrefix("cli/"), WithFeedVersionCompare(compare)).GetLatestTag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "cli/v1.3.9", tag)
+}
@@ -0,0 +1,51 @@
+package release
+
+import "github.com/hashicorp/go-version"
+
+// CompareFunc compares the versions of two release tags, without their tag
+// prefix. It returns -1, 0 or +1 if a is older than, the same as or newer
+// than b, or an error if either isn't a version.
+type CompareFunc func(a, b string) (int, error)
+
+// compareSemver compares semantic versions. It is the default CompareFunc.
+func compareSemver(a, b string) (int, error) {
+	va, err := version.NewVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := version.NewVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// isSemverPrerelease reports whether v is a semantic pre-release version.
+func isSemverPrerelease(v string) bool {
+	parsed, err := version.NewVersion(v)
+	return err == nil && parsed.Prerelease() != ""
+}
+
+// latestVersion returns the index of the highest version in versions
+// according to compare, or semantic versioning if compare is nil, or -1 if
+// none is a version.
+func latestVersion(versions []string, compare CompareFunc) int {
+	if compare == nil {
+		compare = compareSemver
+	}
+	latest := -1
+	for i, v := range versions {
+		// a version compares to itself, anything else is skipped
+		if _, err := compare(v, v); err != nil {
+			continue
+		}
+		if latest < 0 {
+			latest = i
+			continue
+		}
+		if cmp, err := compare(v, versions[latest]); err == nil && cmp > 0 {
+			latest = i
+		}
+	}
+	return latest
+}
@@ -0,0 +1,178 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// placeNextTo moves the new binary at src to a ".new" file next to dst, so
+// that it can be renamed over dst atomically, and flushes it to disk. It
+// is copied if src is on another filesystem.
+func placeNextTo(src, dst string) (string, error) {
+	tmp := dst + ".new"
+	if err := os.Rename(src, tmp); err != nil {
+		perm := os.FileMode(0o755)
+		if fi, err := os.Stat(src); err == nil {
+			perm = fi.Mode().Perm()
+		}
+		if err := copyFile(src, tmp, perm); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+	}
+	if err := syncFile(tmp); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to sync %s: %w", tmp, err)
+	}
+	return tmp, nil
+}
+
+// syncFile flushes the file at path to disk.
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeFileAtomic writes data to the file at p by renaming a flushed
+// temporary file over it, so it holds either the old or the new data.
+func writeFileAtomic(p string, data []byte, perm os.FileMode) error {
+	tmp := p + ".new"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(p))
+}
+
+// replaceBinaries replaces every destination with its new binary, keyed on the
+// destination path. Either all binaries are replaced or, on failure, the
+// original binaries are restored.
+//
+// The new binaries are written and flushed next to their destination before
+// they are renamed over it, and the directories are flushed afterwards, so a
+// crash or power loss leaves either the old or the new binary in place,
+// never a truncated one. Once ctx is done, no binary is replaced anymore.
+func replaceBinaries(ctx context.Context, binaries map[string]string) error {
+	return replaceFiles(ctx, binaries, nil)
+}
+
+// replaceFiles is replaceBinaries, except that the new files whose
+// destination is in ownMode keep their mode instead of the one of the file
+// they replace, e.g. archive files with a Mode.
+func replaceFiles(ctx context.Context, binaries map[string]string, ownMode map[string]bool) error {
+	placed := make(map[string]string, len(binaries))
+	removePlaced := func() {
+		for _, tmp := range placed {
+			os.Remove(tmp)
+		}
+	}
+	for dst, src := range binaries {
+		if err := ctx.Err(); err != nil {
+			removePlaced()
+			return err
+		}
+		tmp, err := placeNextTo(src, dst)
+		if err != nil {
+			removePlaced()
+			return fmt.Errorf("failed to write %s: %w", dst, err)
+		}
+		placed[dst] = tmp
+		if _, err := os.Lstat(dst); err == nil {
+			if err := preserveAttrs(dst, tmp, ownMode[dst]); err != nil {
+				removePlaced()
+				return err
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		removePlaced()
+		return err
+	}
+
+	// keep the current binaries so they can be restored
+	backups := make(map[string]string, len(binaries))
+	var replaced []string
+	restore := func() error {
+		var errs []error
+		for _, dst := range replaced {
+			if _, ok := backups[dst]; !ok {
+				os.Remove(dst)
+			}
+		}
+		for dst, backup := range backups {
+			if err := os.Rename(backup, dst); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		removePlaced()
+		return errors.Join(errs...)
+	}
+
+	for dst := range binaries {
+		if _, err := os.Lstat(dst); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		backup := dst + ".old"
+		if err := backupBinary(dst, backup); err != nil {
+			return errors.Join(fmt.Errorf("failed to back up %s: %w", dst, err), restore())
+		}
+		backups[dst] = backup
+	}
+
+	dirs := make(map[string]bool, len(binaries))
+	for dst, tmp := range placed {
+		if err := os.Rename(tmp, dst); err != nil {
+			return errors.Join(fmt.Errorf("failed to replace binary: %w", err), restore())
+		}
+		replaced = append(replaced, dst)
+		dirs[filepath.Dir(dst)] = true
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return errors.Join(fmt.Errorf("failed to sync %s: %w", dir, err), restore())
+		}
+	}
+
+	for _, backup := range backups {
+		os.Remove(backup)
+	}
+	return nil
+}
+
+// preserveAttrs copies the mode, ownership and extended attributes of the
+// binary at from to the new binary at to. With keepMode, to keeps its mode.
+func preserveAttrs(from, to string, keepMode bool) error {
+	attrs, err := captureAttrs(from)
+	if err != nil || attrs == nil {
+		return err
+	}
+	if !keepMode {
+		return attrs.applyTo(to)
+	}
+	fi, err := os.Stat(to)
+	if err != nil {
+		return err
+	}
+	if err := attrs.applyTo(to); err != nil {
+		return err
+	}
+	return os.Chmod(to, fi.Mode())
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package upgrade
+
+import "os"
+
+// backupBinary moves the binary at dst to backup. A running executable can't
+// be replaced on Windows, but it can be renamed.
+func backupBinary(dst, backup string) error {
+	return os.Rename(dst, backup)
+}
+
+// syncDir is a no-op, directories can't be flushed on these platforms.
+func syncDir(dir string) error {
+	return nil
+}
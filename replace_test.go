@@ -0,0 +1,67 @@
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceBinaries(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o755))
+		return p
+	}
+	read := func(p string) string {
+		content, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("AllReplaced", func(t *testing.T) {
+		server, agent := write("server", "old"), write("agent", "old")
+		err := replaceBinaries(context.Background(), map[string]string{
+			server: write("server.new", "new"),
+			agent:  write("agent.new", "new"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "new", read(server))
+		assert.Equal(t, "new", read(agent))
+		assert.NoFileExists(t, server+".old")
+	})
+	t.Run("RollbackOnFailure", func(t *testing.T) {
+		server, agent := write("server", "old"), write("agent", "old")
+		err := replaceBinaries(context.Background(), map[string]string{
+			server: write("server.new", "new"),
+			agent:  filepath.Join(dir, "missing"),
+		})
+		require.Error(t, err)
+		assert.Equal(t, "old", read(server))
+		assert.Equal(t, "old", read(agent))
+	})
+	t.Run("PreservesMode", func(t *testing.T) {
+		server := write("server", "old")
+		require.NoError(t, os.Chmod(server, 0o750))
+		err := replaceBinaries(context.Background(), map[string]string{server: write("server.new", "new")})
+		require.NoError(t, err)
+		fi, err := os.Stat(server)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o750), fi.Mode().Perm())
+	})
+	t.Run("StagedElsewhere", func(t *testing.T) {
+		// the new binary is placed next to the destination before the rename
+		staged := filepath.Join(t.TempDir(), "server")
+		require.NoError(t, os.WriteFile(staged, []byte("new"), 0o755))
+		server := write("server", "old")
+		write("server.old", "stale backup of a crashed upgrade")
+		require.NoError(t, replaceBinaries(context.Background(), map[string]string{server: staged}))
+		assert.Equal(t, "new", read(server))
+		assert.NoFileExists(t, server+".new")
+		assert.NoFileExists(t, server+".old")
+	})
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package upgrade
+
+import (
+	"errors"
+	"os"
+)
+
+// backupBinary hard links the binary at dst to backup, so that dst exists
+// until the new binary is renamed over it. It falls back to renaming dst if
+// the filesystem doesn't support hard links.
+func backupBinary(dst, backup string) error {
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(dst, backup); err == nil {
+		return nil
+	}
+	return os.Rename(dst, backup)
+}
+
+// syncDir flushes the entries of dir, e.g. a rename, to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
@@ -0,0 +1,127 @@
+package upgrade
+
+// ReportSchemaVersion is the version of the Report format. It is only
+// increased for incompatible changes, fields may be added at any time.
+const ReportSchemaVersion = 1
+
+// ReportAction is what a check or upgrade did.
+type ReportAction string
+
+const (
+	// ActionUpToDate means the current version is the latest one available.
+	ActionUpToDate ReportAction = "up-to-date"
+	// ActionAvailable means a check found an update.
+	ActionAvailable ReportAction = "available"
+	// ActionUpgraded means the binary was replaced.
+	ActionUpgraded ReportAction = "upgraded"
+	// ActionStaged means the update was staged to be installed at the next
+	// start, see WithApplyOnNextStart.
+	ActionStaged ReportAction = "staged"
+	// ActionDelegated means the upgrade was delegated to a package manager.
+	ActionDelegated ReportAction = "delegated"
+	// ActionFailed means the check or upgrade failed, Report.Error says why.
+	ActionFailed ReportAction = "failed"
+)
+
+// Report is a stable, machine-readable description of a check or upgrade,
+// e.g. for a --json flag consumed by wrapper scripts and CI jobs. Create it
+// with CheckReport or UpgradeReport and encode it with encoding/json.
+type Report struct {
+	SchemaVersion  int          `json:"schema_version"`
+	Action         ReportAction `json:"action"`
+	CurrentVersion string       `json:"current_version"`
+	LatestVersion  string       `json:"latest_version,omitempty"`
+	// NewVersion is the version installed after an upgrade.
+	NewVersion     string `json:"new_version,omitempty"`
+	MinimumVersion string `json:"minimum_version,omitempty"`
+	BelowMinimum   bool   `json:"below_minimum,omitempty"`
+	HeldBack       bool   `json:"held_back,omitempty"`
+	Skipped        bool   `json:"skipped,omitempty"`
+	Snoozed        bool   `json:"snoozed,omitempty"`
+	CurrentYanked  bool   `json:"current_yanked,omitempty"`
+	LatestYanked   bool   `json:"latest_yanked,omitempty"`
+
+	ReleaseURL   string `json:"release_url,omitempty"`
+	ReleaseNotes string `json:"release_notes,omitempty"`
+
+	AssetURL         string `json:"asset_url,omitempty"`
+	Checksum         string `json:"checksum,omitempty"`
+	ChecksumVerified bool   `json:"checksum_verified,omitempty"`
+	BytesDownloaded  int64  `json:"bytes_downloaded,omitempty"`
+	DurationMS       int64  `json:"duration_ms,omitempty"`
+	PackageManager   string `json:"package_manager,omitempty"`
+
+	// BinaryChecksums maps the path of each installed binary to its sha256 checksum.
+	BinaryChecksums         map[string]string `json:"binary_checksums,omitempty"`
+	BinaryChecksumsVerified bool              `json:"binary_checksums_verified,omitempty"`
+
+	BuiltFrom string `json:"built_from,omitempty"`
+
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// CheckReport describes the result of Check.
+func CheckReport(currentVersion string, update *Update, err error) *Report {
+	r := &Report{SchemaVersion: ReportSchemaVersion, CurrentVersion: currentVersion}
+	if err != nil {
+		r.Action, r.Error = ActionFailed, err.Error()
+		return r
+	}
+	r.Action = ActionUpToDate
+	if update.Available {
+		r.Action = ActionAvailable
+	}
+	r.CurrentVersion = update.CurrentVersion
+	r.LatestVersion = update.LatestVersion
+	r.MinimumVersion = update.MinimumVersion
+	r.BelowMinimum = update.BelowMinimum
+	r.HeldBack = update.HeldBack
+	r.Skipped = update.Skipped
+	r.Snoozed = update.Snoozed
+	r.CurrentYanked = update.CurrentYanked
+	r.LatestYanked = update.LatestYanked
+	if update.Release != nil {
+		r.ReleaseURL = update.Release.HTMLURL
+		r.ReleaseNotes = update.Release.Body
+	}
+	return r
+}
+
+// UpgradeReport describes the result of UpgradeWithResult, Apply, Install
+// or UpgradeFromFile.
+func UpgradeReport(result *UpgradeResult, err error) *Report {
+	r := &Report{SchemaVersion: ReportSchemaVersion}
+	if result != nil {
+		r.CurrentVersion = result.PreviousVersion
+		r.LatestVersion = result.TargetVersion
+		r.NewVersion = result.NewVersion
+		r.AssetURL = result.AssetURL
+		r.Checksum = result.Checksum
+		r.ChecksumVerified = result.ChecksumVerified
+		r.BinaryChecksums = result.BinaryChecksums
+		r.BinaryChecksumsVerified = result.BinaryChecksumsVerified
+		r.BuiltFrom = result.BuiltFrom
+		r.BytesDownloaded = result.BytesDownloaded
+		r.DurationMS = result.Duration.Milliseconds()
+		r.PackageManager = string(result.PackageManager)
+		for _, w := range result.Warnings {
+			r.Warnings = append(r.Warnings, w.Error())
+		}
+	}
+	switch {
+	case err != nil:
+		r.Action, r.Error = ActionFailed, err.Error()
+	case result == nil:
+		r.Action = ActionUpToDate
+	case result.PackageManager != "":
+		r.Action = ActionDelegated
+	case result.Upgraded:
+		r.Action = ActionUpgraded
+	case result.Pending:
+		r.Action = ActionStaged
+	default:
+		r.Action = ActionUpToDate
+	}
+	return r
+}
@@ -0,0 +1,67 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReport(t *testing.T) {
+	update := &Update{
+		CurrentVersion: "0.1.0",
+		LatestVersion:  "v0.2.0",
+		Available:      true,
+		Release:        &release.Info{TagName: "v0.2.0", Body: "faster", HTMLURL: "https://github.com/getsavvyinc/savvy-cli/releases/tag/v0.2.0"},
+	}
+	data, err := json.Marshal(CheckReport("0.1.0", update, nil))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"schema_version": 1,
+		"action": "available",
+		"current_version": "0.1.0",
+		"latest_version": "v0.2.0",
+		"release_url": "https://github.com/getsavvyinc/savvy-cli/releases/tag/v0.2.0",
+		"release_notes": "faster"
+	}`, string(data))
+
+	data, err = json.Marshal(CheckReport("0.1.0", nil, errors.New("offline")))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"schema_version": 1, "action": "failed", "current_version": "0.1.0", "error": "offline"}`, string(data))
+}
+
+func TestUpgradeReport(t *testing.T) {
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+	result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+
+	r := UpgradeReport(result, err)
+	assert.Equal(t, ActionUpgraded, r.Action)
+	assert.Equal(t, "0.1.0", r.CurrentVersion)
+	assert.Equal(t, "v0.2.0", r.NewVersion)
+	assert.Equal(t, result.Checksum, r.Checksum)
+	assert.True(t, r.ChecksumVerified)
+
+	r = UpgradeReport(&UpgradeResult{
+		PreviousVersion: "0.1.0",
+		NewVersion:      "0.1.0",
+		Duration:        1500 * time.Millisecond,
+		Warnings:        []error{errors.New("slow mirror")},
+	}, errors.New("checksum mismatch"))
+	data, err := json.Marshal(r)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"schema_version": 1,
+		"action": "failed",
+		"current_version": "0.1.0",
+		"new_version": "0.1.0",
+		"duration_ms": 1500,
+		"warnings": ["slow mirror"],
+		"error": "checksum mismatch"
+	}`, string(data))
+}
@@ -0,0 +1,71 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// ErrNoBackup is returned by RestoreBackup when store has no backup to restore.
+var ErrNoBackup = errors.New("no backup to restore")
+
+// RestoreBackup rolls the executable at executablePath back to the newest
+// backup of version recorded in store, or the newest backup if version is
+// empty, and returns it. The backup must still match the digest recorded for
+// it, see state.Backup.Verify, so a swapped backup fails with
+// state.ErrTampered instead of being installed. Wrap store with
+// state.NewSignedStore, e.g. with WithStateKey, so the recorded backups can't
+// be edited either.
+//
+// Upgrades don't record a backup of the binary they replace, which is removed
+// once the new one is in place, so only the backups imported with the
+// migrate package or recorded by the program with state.NewBackup can be
+// restored. Use WithVersionedLayout or WithSlots to keep previous versions.
+func RestoreBackup(ctx context.Context, store state.Store, executablePath, version string) (*state.Backup, error) {
+	st, err := store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var backup *state.Backup
+	for i, b := range st.Backups {
+		if (version == "" || b.Version == version) && (backup == nil || b.CreatedAt.After(backup.CreatedAt)) {
+			backup = &st.Backups[i]
+		}
+	}
+	if backup == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNoBackup, version)
+	}
+	if err := backup.Verify(); err != nil {
+		return nil, err
+	}
+
+	lock, err := acquireLock(executablePath)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.release()
+
+	perm := os.FileMode(0o755)
+	if fi, err := os.Stat(backup.Path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	tmp := executablePath + ".restore"
+	if err := copyFile(backup.Path, tmp, perm); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to copy backup %s: %w", backup.Path, err)
+	}
+	defer os.Remove(tmp)
+	// the copy is what gets installed, the backup may have changed since
+	copied := *backup
+	copied.Path = tmp
+	if err := copied.Verify(); err != nil {
+		return nil, err
+	}
+	if err := replaceBinaries(ctx, map[string]string{executablePath: tmp}); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
@@ -0,0 +1,54 @@
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	executablePath := filepath.Join(dir, "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("v0.3.0"), 0o755))
+	var backups []state.Backup
+	for i, version := range []string{"0.1.0", "0.2.0"} {
+		p := filepath.Join(dir, "savvy-"+version)
+		require.NoError(t, os.WriteFile(p, []byte("v"+version), 0o755))
+		b, err := state.NewBackup(version, p)
+		require.NoError(t, err)
+		b.CreatedAt = time.Unix(int64(i), 0)
+		backups = append(backups, b)
+	}
+	u := NewUpgrader("getsavvyinc", "savvy", executablePath,
+		WithStateStore(state.NewFileStore(filepath.Join(dir, "state.json"))),
+		WithStateKey([]byte("secret")),
+	).(*upgrader)
+	require.NoError(t, u.stateStore.Save(ctx, &state.State{Backups: backups}))
+
+	b, err := RestoreBackup(ctx, u.stateStore, executablePath, "")
+	require.NoError(t, err)
+	assert.Equal(t, "0.2.0", b.Version)
+	assert.Equal(t, "v0.2.0", readFile(t, executablePath))
+	assert.FileExists(t, b.Path)
+
+	_, err = RestoreBackup(ctx, u.stateStore, executablePath, "0.0.1")
+	assert.ErrorIs(t, err, ErrNoBackup)
+
+	// the backup was swapped
+	require.NoError(t, os.WriteFile(backups[0].Path, []byte("evil"), 0o755))
+	_, err = RestoreBackup(ctx, u.stateStore, executablePath, "0.1.0")
+	assert.ErrorIs(t, err, state.ErrTampered)
+	assert.Equal(t, "v0.2.0", readFile(t, executablePath))
+
+	// the state was edited without the key
+	require.NoError(t, state.NewFileStore(filepath.Join(dir, "state.json")).Save(ctx, &state.State{Backups: backups[:1]}))
+	_, err = RestoreBackup(ctx, u.stateStore, executablePath, "")
+	assert.ErrorIs(t, err, state.ErrTampered)
+}
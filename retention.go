@@ -0,0 +1,119 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// Retention bounds the previous versions kept on disk: the versions of a
+// versioned install, see WithVersionedLayout, and the backups recorded in the
+// state store, see WithStateStore. A version is removed if either limit is exceeded.
+//
+// The upgrader doesn't record backups itself: the binary it replaces is only
+// kept until the new one is in place. The recorded backups are the ones
+// imported with the migrate package, or recorded by the program with
+// state.NewBackup.
+type Retention struct {
+	// KeepLast is how many versions to keep, including the current one.
+	// Zero keeps any number.
+	KeepLast int
+	// MaxAge removes versions installed longer ago. Zero keeps them at any age.
+	MaxAge time.Duration
+}
+
+// WithRetention prunes previous versions according to r after every
+// successful upgrade, and when Prune is called. The current version is never
+// removed, and neither are backups outside the directory of the executable.
+func WithRetention(r Retention) Opt {
+	return func(u *upgrader) {
+		u.retention = &r
+	}
+}
+
+// expired reports whether the previous version installed at t, which is the
+// i-th newest previous version, isn't retained at now.
+func (r Retention) expired(i int, t, now time.Time) bool {
+	return r.KeepLast > 0 && i >= r.KeepLast-1 || r.MaxAge > 0 && now.Sub(t) > r.MaxAge
+}
+
+// Pruner is implemented by the Upgrader NewUpgrader returns.
+type Pruner interface {
+	// Prune removes the previous versions that WithRetention doesn't retain.
+	// It runs after every successful upgrade.
+	Prune(ctx context.Context) error
+}
+
+var _ Pruner = (*upgrader)(nil)
+
+func (u *upgrader) Prune(ctx context.Context) error {
+	if u.retention == nil {
+		return nil
+	}
+	now := time.Now()
+	var errs []error
+	if u.layout != nil {
+		errs = append(errs, u.layout.prune(*u.retention, now))
+	}
+	if u.stateStore != nil {
+		errs = append(errs, pruneBackups(ctx, u.stateStore, filepath.Dir(u.executablePath), *u.retention, now))
+	}
+	return errors.Join(errs...)
+}
+
+// pruneBackups removes the backups in store that r doesn't retain, and their
+// files. Only files in dir are removed, since the state may not be signed:
+// a backup elsewhere is forgotten and reported instead.
+func pruneBackups(ctx context.Context, store state.Store, dir string, r Retention, now time.Time) error {
+	st, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	backups := slices.Clone(st.Backups)
+	slices.SortStableFunc(backups, func(a, b state.Backup) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	var kept []state.Backup
+	var errs []error
+	for i, b := range backups {
+		if !r.expired(i, b.CreatedAt, now) {
+			kept = append(kept, b)
+			continue
+		}
+		if !inDir(dir, b.Path) {
+			errs = append(errs, fmt.Errorf("refusing to remove backup %s outside %s", b.Path, dir))
+			continue
+		}
+		if err := os.Remove(b.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			kept = append(kept, b)
+		}
+	}
+	if len(kept) == len(st.Backups) {
+		return errors.Join(errs...)
+	}
+	st.Backups = kept
+	return errors.Join(append(errs, store.Save(ctx, st))...)
+}
+
+// inDir reports whether path is inside dir.
+func inDir(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
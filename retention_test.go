@@ -0,0 +1,58 @@
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Now()
+	r := Retention{KeepLast: 3, MaxAge: 24 * time.Hour}
+	assert.False(t, r.expired(0, now, now))
+	assert.False(t, r.expired(1, now.Add(-time.Hour), now))
+	assert.True(t, r.expired(2, now, now), "the current version counts towards KeepLast")
+	assert.True(t, r.expired(0, now.Add(-48*time.Hour), now))
+	assert.False(t, Retention{}.expired(100, time.Time{}, now))
+}
+
+func TestPruneBackups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now()
+	var backups []state.Backup
+	for i, age := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 30 * 24 * time.Hour} {
+		p := filepath.Join(dir, "savvy.backup"+string(rune('a'+i)))
+		require.NoError(t, os.WriteFile(p, []byte("old"), 0o755))
+		backups = append(backups, state.Backup{Path: p, CreatedAt: now.Add(-age)})
+	}
+	store := state.NewFileStore(filepath.Join(dir, "state.json"))
+	require.NoError(t, store.Save(ctx, &state.State{Backups: backups}))
+
+	u := NewUpgrader("getsavvyinc", "savvy-cli", filepath.Join(dir, "savvy"), WithStateStore(store), WithRetention(Retention{KeepLast: 3})).(*upgrader)
+	require.NoError(t, u.Prune(ctx))
+	st, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, st.Backups, 2)
+	assert.Equal(t, backups[0].Path, st.Backups[0].Path)
+	assert.Equal(t, backups[1].Path, st.Backups[1].Path)
+	assert.NoFileExists(t, backups[2].Path)
+	assert.NoFileExists(t, backups[3].Path)
+
+	// an edited state can't make pruning remove files elsewhere
+	outside := filepath.Join(t.TempDir(), "important")
+	require.NoError(t, os.WriteFile(outside, []byte("data"), 0o644))
+	st.Backups = append(st.Backups, state.Backup{Path: outside, CreatedAt: now.Add(-48 * time.Hour)}, state.Backup{Path: filepath.Join(dir, "..", "escaped"), CreatedAt: now.Add(-48 * time.Hour)})
+	require.NoError(t, store.Save(ctx, st))
+	assert.ErrorContains(t, u.Prune(ctx), "outside")
+	assert.FileExists(t, outside)
+	st, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.Len(t, st.Backups, 2)
+}
@@ -0,0 +1,82 @@
+package upgrade
+
+import (
+	"context"
+	"strings"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// urlRewrite replaces the prefix from of asset URLs with to.
+type urlRewrite struct {
+	from, to string
+}
+
+// WithURLRewrite downloads the assets whose URL starts with from from to
+// instead, e.g. from a CDN mirroring the release assets, while releases are
+// still looked up on GitHub:
+//
+//	WithURLRewrite("https://github.com/getsavvyinc/savvy-cli/releases/download/", "https://cdn.example.com/savvy/")
+//
+// It applies to every asset, so binaries, checksum files and signatures are
+// all downloaded from the mirror. Rules are tried in the order they were
+// added and the first matching one applies. Rewritten assets are never
+// downloaded through the API, see WithAPIAssetDownloads, and the host of to
+// has to be allowed by WithAllowedHosts if it is set.
+func WithURLRewrite(from, to string) Opt {
+	return func(u *upgrader) {
+		u.urlRewrites = append(u.urlRewrites, urlRewrite{from: from, to: to})
+	}
+}
+
+// rewriteGetter rewrites the asset URLs of the releases returned by g.
+type rewriteGetter struct {
+	g         release.Getter
+	rules     []urlRewrite
+	tagPrefix string
+}
+
+func (r *rewriteGetter) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	info, err := r.g.GetLatestRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.rewrite(info), nil
+}
+
+func (r *rewriteGetter) GetReleaseByTag(ctx context.Context, tag string) (*release.Info, error) {
+	info, err := releaseByTag(ctx, r.g, r.tagPrefix, tag)
+	if err != nil {
+		return nil, err
+	}
+	return r.rewrite(info), nil
+}
+
+func (r *rewriteGetter) ListReleases(ctx context.Context, opts release.ListOptions) ([]release.Info, error) {
+	releases, err := listReleases(ctx, r.g, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		releases[i] = *r.rewrite(&releases[i])
+	}
+	return releases, nil
+}
+
+// rewrite returns a copy of info with rewritten asset URLs, since getters may
+// return cached releases.
+func (r *rewriteGetter) rewrite(info *release.Info) *release.Info {
+	rewritten := *info
+	rewritten.Assets = make([]release.Asset, len(info.Assets))
+	for i, a := range info.Assets {
+		for _, rule := range r.rules {
+			if rest, ok := strings.CutPrefix(a.BrowserDownloadURL, rule.from); ok {
+				a.BrowserDownloadURL = rule.to + rest
+				a.URL = ""
+				break
+			}
+		}
+		rewritten.Assets[i] = a
+	}
+	return &rewritten
+}
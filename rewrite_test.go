@@ -0,0 +1,39 @@
+package upgrade
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLRewrite(t *testing.T) {
+	const github = "https://github.com/getsavvyinc/savvy-cli/releases/download/v0.2.0/"
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+	// the release points at GitHub, and the test server serves as the CDN
+	fake := u.releaseGetter.(*fakeReleaseGetter)
+	cdn := strings.TrimSuffix(fake.info.Assets[0].BrowserDownloadURL, fake.info.Assets[0].Name)
+	for i, a := range fake.info.Assets {
+		fake.info.Assets[i].BrowserDownloadURL = github + a.Name
+		fake.info.Assets[i].URL = "https://api.github.com/repos/getsavvyinc/savvy-cli/releases/assets/1"
+	}
+	u.releaseGetter = &rewriteGetter{g: fake, rules: []urlRewrite{
+		{from: "https://github.com/other/", to: "https://other.example.com/"},
+		{from: "https://github.com/getsavvyinc/savvy-cli/releases/download/v0.2.0/", to: cdn},
+	}}
+
+	result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.ChecksumVerified)
+	assert.Equal(t, cdn+fake.info.Assets[0].Name, result.AssetURL)
+	assert.Equal(t, "new", readFile(t, executablePath))
+	// cached releases aren't modified
+	assert.True(t, strings.HasPrefix(fake.info.Assets[0].BrowserDownloadURL, github))
+
+	info, err := releaseByTag(context.Background(), u.releaseGetter, "", "v0.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, release.Asset{Name: fake.info.Assets[1].Name, BrowserDownloadURL: cdn + fake.info.Assets[1].Name}, info.Assets[1])
+}
@@ -0,0 +1,73 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultRolloutAsset is the release asset WithRollout reads by default.
+const DefaultRolloutAsset = "rollout.txt"
+
+// WithRollout offers new releases only to the percentage of installs
+// published in the release asset name, DefaultRolloutAsset if empty, so bad
+// releases can be caught before every install upgrades. The asset holds a
+// percentage, e.g. "10" or "2.5%". Releases without the asset are offered to
+// every install.
+//
+// installID must be stable across runs, e.g. a random ID stored in the CLI's
+// config directory. Whether an install is included is derived from a hash of
+// installID and the release tag, so raising the percentage only adds installs,
+// and each release is rolled out to a different subset first. Installs below
+// the minimum supported version or on a yanked version are always offered
+// the release.
+func WithRollout(installID, name string) Opt {
+	return func(u *upgrader) {
+		if name == "" {
+			name = DefaultRolloutAsset
+		}
+		u.installID = installID
+		u.rolloutAsset = name
+	}
+}
+
+// checkRollout holds back an available update if the release isn't rolled out to this install yet.
+func (u *upgrader) checkRollout(ctx context.Context, update *Update) error {
+	if u.rolloutAsset == "" || !update.Available || update.BelowMinimum || update.CurrentYanked {
+		return nil
+	}
+	url := policyAssetURL(update.Release, u.rolloutAsset)
+	if url == "" {
+		return nil
+	}
+
+	line, err := u.fetchPolicy(ctx, url)
+	if err != nil {
+		return fmt.Errorf("failed to get rollout percentage: %w", err)
+	}
+	if line == "" {
+		return nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(line, "%")), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return fmt.Errorf("invalid rollout percentage: %s", line)
+	}
+
+	update.RolloutPercentage = percent
+	if !inRollout(u.installID, update.Release.TagName, percent) {
+		update.Available = false
+		update.HeldBack = true
+	}
+	return nil
+}
+
+// inRollout reports whether installID falls into the first percent of installs for tag.
+func inRollout(installID, tag string, percent float64) bool {
+	sum := sha256.Sum256([]byte(installID + "\x00" + tag))
+	// buckets of a hundredth of a percent
+	bucket := binary.BigEndian.Uint64(sum[:8]) % 10000
+	return float64(bucket) < percent*100
+}
@@ -0,0 +1,77 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInRollout(t *testing.T) {
+	included := 0
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprint("install-", i)
+		if inRollout(id, "v1.0.0", 20) {
+			included++
+			// raising the percentage keeps included installs
+			assert.True(t, inRollout(id, "v1.0.0", 50))
+		}
+	}
+	assert.InDelta(t, 200, included, 50)
+	assert.False(t, inRollout("install", "v1.0.0", 0))
+	assert.True(t, inRollout("install", "v1.0.0", 100))
+}
+
+func TestRollout(t *testing.T) {
+	ctx := context.Background()
+	percentage := "0%"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rollout.txt":
+			fmt.Fprintln(w, percentage)
+		case "/min-version.txt":
+			fmt.Fprintln(w, "0.1.0")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	newUpgrader := func(opts ...Opt) *upgrader {
+		u := NewUpgrader("getsavvyinc", "savvy-cli", "savvy", opts...).(*upgrader)
+		u.releaseGetter = &fakeReleaseGetter{info: &release.Info{
+			TagName: "v0.3.0",
+			Assets: []release.Asset{
+				{Name: "rollout.txt", BrowserDownloadURL: srv.URL + "/rollout.txt"},
+				{Name: "min-version.txt", BrowserDownloadURL: srv.URL + "/min-version.txt"},
+			},
+		}}
+		return u
+	}
+
+	update, err := newUpgrader(WithRollout("install", "")).Check(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.False(t, update.Available)
+	assert.True(t, update.HeldBack)
+
+	// installs below the minimum version upgrade regardless
+	update, err = newUpgrader(WithRollout("install", ""), WithMinimumVersion("")).Check(ctx, "0.0.9")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+
+	percentage = "100"
+	update, err = newUpgrader(WithRollout("install", "")).Check(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+	assert.False(t, update.HeldBack)
+	assert.Equal(t, float64(100), update.RolloutPercentage)
+
+	percentage = "all"
+	_, err = newUpgrader(WithRollout("install", "")).Check(ctx, "0.2.0")
+	assert.Error(t, err)
+}
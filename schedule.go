@@ -0,0 +1,128 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Window is a daily maintenance window, e.g. from 02:00 to 04:00.
+// Start and End are offsets from midnight. Windows ending before they start
+// span midnight, e.g. from 23:00 to 01:00.
+type Window struct {
+	Start, End time.Duration
+}
+
+// ParseWindow parses a window such as "02:00-04:00".
+func ParseWindow(s string) (Window, error) {
+	var startH, startM, endH, endM int
+	if _, err := fmt.Sscanf(s, "%d:%d-%d:%d", &startH, &startM, &endH, &endM); err != nil {
+		return Window{}, fmt.Errorf("invalid window %q, expected e.g. 02:00-04:00: %w", s, err)
+	}
+	for _, v := range []struct{ h, m int }{{startH, startM}, {endH, endM}} {
+		if v.h < 0 || v.h > 24 || v.m < 0 || v.m > 59 || v.h == 24 && v.m != 0 {
+			return Window{}, fmt.Errorf("invalid window %q: %02d:%02d is not a time of day", s, v.h, v.m)
+		}
+	}
+	w := Window{
+		Start: time.Duration(startH)*time.Hour + time.Duration(startM)*time.Minute,
+		End:   time.Duration(endH)*time.Hour + time.Duration(endM)*time.Minute,
+	}
+	if w.Start == w.End {
+		return Window{}, fmt.Errorf("invalid window %q: it is empty", s)
+	}
+	return w, nil
+}
+
+// Schedule restricts automatic upgrades to maintenance windows, see WithSchedule.
+type Schedule struct {
+	// Windows are the daily windows upgrades may run in.
+	// Without windows, upgrades may run at any time.
+	Windows []Window
+	// Jitter delays upgrades by a random duration of up to Jitter, so that
+	// installs don't all upgrade at the start of a window. The delay never
+	// extends past the end of the window.
+	Jitter time.Duration
+	// Location is the time zone of the windows, time.Local if nil.
+	Location *time.Location
+}
+
+// Next returns the next time at or after t that lies in a window, and the
+// end of that window. Jitter isn't applied.
+func (s *Schedule) Next(t time.Time) (start, end time.Time) {
+	if len(s.Windows) == 0 {
+		return t, time.Time{}
+	}
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	y, m, d := t.Date()
+	for _, w := range s.Windows {
+		// the window of the day before may still be open after midnight
+		for day := -1; day <= 1; day++ {
+			midnight := time.Date(y, m, d+day, 0, 0, 0, 0, loc)
+			ws, we := midnight.Add(w.Start), midnight.Add(w.End)
+			if w.End < w.Start {
+				we = we.Add(24 * time.Hour)
+			}
+			if !we.After(t) {
+				continue
+			}
+			if ws.Before(t) {
+				ws = t
+			}
+			if start.IsZero() || ws.Before(start) {
+				start, end = ws, we
+			}
+		}
+	}
+	return start, end
+}
+
+// Wait blocks until the next window opens, plus jitter, or ctx is done.
+func (s *Schedule) Wait(ctx context.Context) error {
+	now := time.Now()
+	start, end := s.Next(now)
+	if jitter := s.Jitter; jitter > 0 {
+		if !end.IsZero() && end.Sub(start) < jitter {
+			jitter = end.Sub(start)
+		}
+		start = start.Add(time.Duration(rand.Int63n(int64(jitter))))
+	}
+	return sleepUntil(ctx, start)
+}
+
+// WithSchedule restricts AutoUpgrade to the maintenance windows of s.
+// Upgrades started with Upgrade or UpgradeWithResult, e.g. by a user
+// running an upgrade command, aren't restricted.
+func WithSchedule(s *Schedule) Opt {
+	return func(u *upgrader) {
+		u.schedule = s
+	}
+}
+
+// AutoUpgrader is implemented by the Upgrader NewUpgrader returns, for
+// unattended upgrades, e.g. u.(upgrade.AutoUpgrader).AutoUpgrade(ctx, version).
+type AutoUpgrader interface {
+	// AutoUpgrade is UpgradeWithResult for unattended upgrades. It waits for
+	// the maintenance window set with WithSchedule first, and doesn't install
+	// versions the user skipped or snoozed, see WithStateStore.
+	AutoUpgrade(ctx context.Context, currentVersion string) (*UpgradeResult, error)
+}
+
+var _ AutoUpgrader = (*upgrader)(nil)
+
+// AutoUpgrade waits for the next maintenance window set with WithSchedule
+// and upgrades the current binary like UpgradeWithResult, unless the user
+// skipped the latest version or snoozed updates.
+func (u *upgrader) AutoUpgrade(ctx context.Context, currentVersion string) (*UpgradeResult, error) {
+	if u.schedule != nil {
+		if err := u.schedule.Wait(ctx); err != nil {
+			return &UpgradeResult{PreviousVersion: currentVersion, NewVersion: currentVersion}, err
+		}
+	}
+	return u.upgradeAndRestart(ctx, currentVersion, true)
+}
@@ -0,0 +1,76 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow("02:00-04:30")
+	require.NoError(t, err)
+	assert.Equal(t, Window{Start: 2 * time.Hour, End: 4*time.Hour + 30*time.Minute}, w)
+
+	for _, s := range []string{"2am-4am", "02:00-25:00", "02:60-04:00", "02:00-02:00"} {
+		_, err := ParseWindow(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 3, day, hour, min, 0, 0, time.UTC)
+	}
+	s := &Schedule{
+		Windows: []Window{
+			{Start: 2 * time.Hour, End: 4 * time.Hour},
+			{Start: 23 * time.Hour, End: time.Hour},
+		},
+		Location: time.UTC,
+	}
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		start, end time.Time
+	}{
+		{"before window", at(10, 1, 30), at(10, 2, 0), at(10, 4, 0)},
+		{"in window", at(10, 3, 0), at(10, 3, 0), at(10, 4, 0)},
+		{"after windows", at(10, 12, 0), at(10, 23, 0), at(11, 1, 0)},
+		{"past midnight", at(10, 0, 30), at(10, 0, 30), at(10, 1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := s.Next(tt.now)
+			assert.True(t, tt.start.Equal(start), "start %s", start)
+			assert.True(t, tt.end.Equal(end), "end %s", end)
+		})
+	}
+
+	now := time.Now()
+	start, _ := (&Schedule{}).Next(now)
+	assert.Equal(t, now, start)
+}
+
+func TestAutoUpgradeWaitsForWindow(t *testing.T) {
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	closed := now.Sub(midnight) + time.Hour
+	WithSchedule(&Schedule{Windows: []Window{{Start: closed, End: closed + time.Hour}}})(u)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := u.AutoUpgrade(ctx, "0.1.0")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, "old", readFile(t, executablePath))
+
+	// manual upgrades aren't restricted
+	result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+}
@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// launchAgentsDir returns the directory of the user's launchd agents.
+func launchAgentsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents"), nil
+}
+
+// launchdPlist returns the property list of a launchd agent running job.
+func launchdPlist(job Job) []byte {
+	var b bytes.Buffer
+	str := func(s string) {
+		b.WriteString("<string>")
+		xml.EscapeText(&b, []byte(s))
+		b.WriteString("</string>")
+	}
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	`)
+	str(job.Name)
+	b.WriteString("\n\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, a := range append([]string{job.Executable}, job.Args...) {
+		b.WriteString("\t\t")
+		str(a)
+		b.WriteString("\n")
+	}
+	b.WriteString("\t</array>\n\t<key>StartInterval</key>\n\t<integer>" + seconds(job.Interval) + "</integer>\n")
+	b.WriteString("\t<key>ProcessType</key>\n\t<string>Background</string>\n</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// launchdDomain is the launchd domain of the current user's agents.
+func launchdDomain() string {
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+func (s *scheduler) installLaunchd(ctx context.Context, job Job) error {
+	dir, err := s.unitDir(launchAgentsDir)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, job.Name+".plist")
+	// unload a previous version of the agent, which may not exist
+	s.run(ctx, "launchctl", "bootout", launchdDomain()+"/"+job.Name)
+	if err := os.WriteFile(path, launchdPlist(job), 0o644); err != nil {
+		return fmt.Errorf("failed to write launch agent: %w", err)
+	}
+	return s.runCommand(ctx, "launchctl", "bootstrap", launchdDomain(), path)
+}
+
+func (s *scheduler) uninstallLaunchd(ctx context.Context, name string) error {
+	dir, err := s.unitDir(launchAgentsDir)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name+".plist")
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	s.run(ctx, "launchctl", "bootout", launchdDomain()+"/"+name)
+	if err := removeFile(path); err != nil {
+		return fmt.Errorf("failed to remove launch agent: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// Package scheduler installs a background job that periodically runs a binary,
+// e.g. "savvy upgrade", with the platform's service manager: a systemd user
+// timer on Linux, a launchd agent on macOS or a scheduled task on Windows.
+//
+// It lets CLIs offer an "enable auto-updates" command without writing unit
+// files themselves. Jobs run as the current user.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned on platforms without a supported service manager.
+var ErrUnsupported = errors.New("background jobs are not supported on this platform")
+
+// Job is a command run periodically in the background.
+type Job struct {
+	// Name identifies the job, e.g. "com.getsavvy.savvy-upgrade". It may
+	// only contain letters, digits, ".", "_" and "-".
+	Name string
+	// Description is shown by the service manager.
+	Description string
+	// Executable is the binary to run, the current executable if empty.
+	Executable string
+	Args       []string
+	// Interval is the time between runs, at least a minute.
+	Interval time.Duration
+}
+
+// Scheduler installs and removes background jobs.
+type Scheduler interface {
+	// Install installs job and starts its schedule, replacing any job with the same name.
+	Install(ctx context.Context, job Job) error
+	// Uninstall stops and removes the job called name.
+	Uninstall(ctx context.Context, name string) error
+}
+
+type commandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+type scheduler struct {
+	goos string
+	// dir is where unit files are written, the service manager's user directory if empty.
+	dir string
+	run commandRunner
+}
+
+var _ Scheduler = (*scheduler)(nil)
+
+// New returns a Scheduler for the running platform.
+func New() Scheduler {
+	return &scheduler{
+		goos: runtime.GOOS,
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			return exec.CommandContext(ctx, name, args...).CombinedOutput()
+		},
+	}
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func (s *scheduler) Install(ctx context.Context, job Job) error {
+	if !validName.MatchString(job.Name) {
+		return fmt.Errorf("invalid job name %q", job.Name)
+	}
+	if job.Interval < time.Minute {
+		return fmt.Errorf("invalid job interval %s, it must be at least a minute", job.Interval)
+	}
+	if job.Executable == "" {
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find executable: %w", err)
+		}
+		job.Executable = executable
+	}
+	if job.Description == "" {
+		job.Description = "Run " + filepath.Base(job.Executable) + " " + strings.Join(job.Args, " ")
+	}
+	// unit files and property lists hold one line
+	job.Description = strings.Join(strings.Fields(job.Description), " ")
+
+	switch s.goos {
+	case "linux":
+		return s.installSystemd(ctx, job)
+	case "darwin":
+		return s.installLaunchd(ctx, job)
+	case "windows":
+		return s.installTask(ctx, job)
+	default:
+		return ErrUnsupported
+	}
+}
+
+func (s *scheduler) Uninstall(ctx context.Context, name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid job name %q", name)
+	}
+	switch s.goos {
+	case "linux":
+		return s.uninstallSystemd(ctx, name)
+	case "darwin":
+		return s.uninstallLaunchd(ctx, name)
+	case "windows":
+		return s.uninstallTask(ctx, name)
+	default:
+		return ErrUnsupported
+	}
+}
+
+// runCommand runs a service manager command, including its output in errors.
+func (s *scheduler) runCommand(ctx context.Context, name string, args ...string) error {
+	out, err := s.run(ctx, name, args...)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// unitDir returns the directory unit files are written to, creating it if necessary.
+func (s *scheduler) unitDir(defaultDir func() (string, error)) (string, error) {
+	dir := s.dir
+	if dir == "" {
+		var err error
+		if dir, err = defaultDir(); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// removeFile removes path, ignoring files that don't exist.
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
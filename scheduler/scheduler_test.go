@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeScheduler returns a scheduler for goos that records the commands it runs.
+func fakeScheduler(t *testing.T, goos string) (*scheduler, *[]string) {
+	var commands []string
+	return &scheduler{
+		goos: goos,
+		dir:  t.TempDir(),
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			commands = append(commands, name+" "+strings.Join(args, " "))
+			if name == "schtasks" && args[0] == "/Query" {
+				return nil, errors.New("not found")
+			}
+			return nil, nil
+		},
+	}, &commands
+}
+
+var testJob = Job{
+	Name:       "savvy-upgrade",
+	Executable: "/opt/savvy/bin/savvy",
+	Args:       []string{"upgrade", "--message", `50% "done"`},
+	Interval:   6 * time.Hour,
+}
+
+func TestSystemd(t *testing.T) {
+	ctx := context.Background()
+	s, commands := fakeScheduler(t, "linux")
+	require.NoError(t, s.Install(ctx, testJob))
+	assert.Equal(t, []string{"systemctl --user daemon-reload", "systemctl --user enable --now savvy-upgrade.timer"}, *commands)
+
+	service, err := os.ReadFile(filepath.Join(s.dir, "savvy-upgrade.service"))
+	require.NoError(t, err)
+	assert.Contains(t, string(service), `ExecStart="/opt/savvy/bin/savvy" "upgrade" "--message" "50%% \"done\""`)
+	timer, err := os.ReadFile(filepath.Join(s.dir, "savvy-upgrade.timer"))
+	require.NoError(t, err)
+	assert.Contains(t, string(timer), "OnUnitActiveSec=21600s")
+
+	*commands = nil
+	require.NoError(t, s.Uninstall(ctx, "savvy-upgrade"))
+	assert.Equal(t, []string{"systemctl --user disable --now savvy-upgrade.timer", "systemctl --user daemon-reload"}, *commands)
+	assert.NoFileExists(t, filepath.Join(s.dir, "savvy-upgrade.service"))
+	assert.NoFileExists(t, filepath.Join(s.dir, "savvy-upgrade.timer"))
+}
+
+func TestLaunchd(t *testing.T) {
+	ctx := context.Background()
+	s, commands := fakeScheduler(t, "darwin")
+	require.NoError(t, s.Install(ctx, testJob))
+	require.Len(t, *commands, 2)
+	assert.Contains(t, (*commands)[1], "launchctl bootstrap gui/")
+
+	plist, err := os.ReadFile(filepath.Join(s.dir, "savvy-upgrade.plist"))
+	require.NoError(t, err)
+	assert.Contains(t, string(plist), "<string>50% &#34;done&#34;</string>")
+	assert.Contains(t, string(plist), "<integer>21600</integer>")
+
+	require.NoError(t, s.Uninstall(ctx, "savvy-upgrade"))
+	assert.NoFileExists(t, filepath.Join(s.dir, "savvy-upgrade.plist"))
+}
+
+func TestSchtasks(t *testing.T) {
+	ctx := context.Background()
+	s, commands := fakeScheduler(t, "windows")
+	job := testJob
+	job.Executable = `C:\Program Files\savvy\savvy.exe`
+	require.NoError(t, s.Install(ctx, job))
+	assert.Equal(t, []string{`schtasks /Create /F /TN savvy-upgrade /TR "C:\Program Files\savvy\savvy.exe" upgrade --message "50% \"done\"" /SC HOURLY /MO 6`}, *commands)
+
+	for interval, schedule := range map[time.Duration]string{
+		48 * time.Hour:   "DAILY /MO 2",
+		90 * time.Minute: "MINUTE /MO 90",
+	} {
+		job.Interval = interval
+		args, err := schtasksArgs(job)
+		require.NoError(t, err)
+		assert.Equal(t, schedule, strings.Join(args[len(args)-3:], " "))
+	}
+	job.Interval = 25 * time.Hour
+	_, err := schtasksArgs(job)
+	assert.Error(t, err)
+}
+
+func TestInstallValidatesJob(t *testing.T) {
+	s, _ := fakeScheduler(t, "linux")
+	job := testJob
+	job.Name = "../savvy"
+	assert.Error(t, s.Install(context.Background(), job))
+	job = testJob
+	job.Interval = time.Second
+	assert.Error(t, s.Install(context.Background(), job))
+
+	s, _ = fakeScheduler(t, "plan9")
+	assert.ErrorIs(t, s.Install(context.Background(), testJob), ErrUnsupported)
+}
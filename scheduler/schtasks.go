@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTaskCommand is the longest command schtasks accepts for /TR.
+const maxTaskCommand = 261
+
+// schtasksArgs returns the arguments of schtasks creating a task running job.
+func schtasksArgs(job Job) ([]string, error) {
+	args := make([]string, 0, len(job.Args)+1)
+	for _, a := range append([]string{job.Executable}, job.Args...) {
+		args = append(args, taskQuote(a))
+	}
+	command := strings.Join(args, " ")
+	if len(command) > maxTaskCommand {
+		return nil, fmt.Errorf("command of job %s is longer than %d characters", job.Name, maxTaskCommand)
+	}
+
+	// schtasks repeats tasks every 1-1439 minutes, 1-23 hours or 1-365 days
+	var schedule string
+	var modifier int64
+	switch d := job.Interval; {
+	case d%(24*time.Hour) == 0 && d/(24*time.Hour) <= 365:
+		schedule, modifier = "DAILY", int64(d/(24*time.Hour))
+	case d%time.Hour == 0 && d < 24*time.Hour:
+		schedule, modifier = "HOURLY", int64(d/time.Hour)
+	case d%time.Minute == 0 && d < 24*time.Hour:
+		schedule, modifier = "MINUTE", int64(d/time.Minute)
+	default:
+		return nil, fmt.Errorf("interval %s of job %s can't be scheduled with Task Scheduler", job.Interval, job.Name)
+	}
+	return []string{"/Create", "/F", "/TN", job.Name, "/TR", command, "/SC", schedule, "/MO", strconv.FormatInt(modifier, 10)}, nil
+}
+
+// taskQuote quotes s as a single argument of a task command.
+func taskQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func (s *scheduler) installTask(ctx context.Context, job Job) error {
+	args, err := schtasksArgs(job)
+	if err != nil {
+		return err
+	}
+	return s.runCommand(ctx, "schtasks", args...)
+}
+
+func (s *scheduler) uninstallTask(ctx context.Context, name string) error {
+	if _, err := s.run(ctx, "schtasks", "/Query", "/TN", name); err != nil {
+		// the task doesn't exist
+		return nil
+	}
+	return s.runCommand(ctx, "schtasks", "/Delete", "/F", "/TN", name)
+}
@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// systemdUserDir returns the directory of systemd user units.
+func systemdUserDir() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "systemd", "user"), nil
+}
+
+// systemdUnits returns the service and timer units running job.
+func systemdUnits(job Job) (service, timer string) {
+	args := make([]string, 0, len(job.Args)+1)
+	for _, a := range append([]string{job.Executable}, job.Args...) {
+		args = append(args, systemdQuote(a))
+	}
+	service = fmt.Sprintf(`[Unit]
+Description=%s
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, job.Description, strings.Join(args, " "))
+	timer = fmt.Sprintf(`[Unit]
+Description=%s
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%ss
+RandomizedDelaySec=60
+
+[Install]
+WantedBy=timers.target
+`, job.Description, seconds(job.Interval))
+	return service, timer
+}
+
+// systemdQuote quotes s as a single argument of ExecStart.
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+	return `"` + r.Replace(s) + `"`
+}
+
+func (s *scheduler) installSystemd(ctx context.Context, job Job) error {
+	dir, err := s.unitDir(systemdUserDir)
+	if err != nil {
+		return err
+	}
+	service, timer := systemdUnits(job)
+	if err := os.WriteFile(filepath.Join(dir, job.Name+".service"), []byte(service), 0o644); err != nil {
+		return fmt.Errorf("failed to write service unit: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, job.Name+".timer"), []byte(timer), 0o644); err != nil {
+		return fmt.Errorf("failed to write timer unit: %w", err)
+	}
+	if err := s.runCommand(ctx, "systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	return s.runCommand(ctx, "systemctl", "--user", "enable", "--now", job.Name+".timer")
+}
+
+func (s *scheduler) uninstallSystemd(ctx context.Context, name string) error {
+	dir, err := s.unitDir(systemdUserDir)
+	if err != nil {
+		return err
+	}
+	timer := filepath.Join(dir, name+".timer")
+	if _, err := os.Stat(timer); err == nil {
+		if err := s.runCommand(ctx, "systemctl", "--user", "disable", "--now", name+".timer"); err != nil {
+			return err
+		}
+	}
+	for _, p := range []string{timer, filepath.Join(dir, name+".service")} {
+		if err := removeFile(p); err != nil {
+			return fmt.Errorf("failed to remove unit: %w", err)
+		}
+	}
+	return s.runCommand(ctx, "systemctl", "--user", "daemon-reload")
+}
@@ -0,0 +1,87 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// ErrNoBuildInfo is returned by CurrentBuild and Self when the running binary
+// doesn't record the repository or version it was built from.
+var ErrNoBuildInfo = errors.New("build info unavailable")
+
+// Build identifies the running binary and the repository it was released from.
+type Build struct {
+	Owner          string
+	Repo           string
+	Version        string
+	ExecutablePath string
+}
+
+// readBuildInfo and executable are variables for tests.
+var (
+	readBuildInfo = debug.ReadBuildInfo
+	executable    = os.Executable
+)
+
+// majorVersionSuffix matches the major version suffix of a module path, e.g. "/v2".
+var majorVersionSuffix = regexp.MustCompile(`/v[0-9]+$`)
+
+// CurrentBuild derives the Build of the running binary: the owner and repo
+// from the path of its main module, e.g. "github.com/getsavvyinc/savvy-cli",
+// the version from the module version Go embedded at build time and the
+// executable path from os.Executable.
+//
+// Go only embeds the module version when the binary is built with go install
+// or from a tagged VCS checkout. Binaries built otherwise, e.g. with the
+// version set through -ldflags, have to use NewUpgrader.
+func CurrentBuild() (*Build, error) {
+	info, ok := readBuildInfo()
+	if !ok {
+		return nil, fmt.Errorf("%w: the binary wasn't built with module support", ErrNoBuildInfo)
+	}
+	path := majorVersionSuffix.ReplaceAllString(info.Main.Path, "")
+	// the host is ignored so that GitHub Enterprise modules work with WithGitHubBaseURL
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("%w: module %q isn't hosted in a GitHub repository", ErrNoBuildInfo, info.Main.Path)
+	}
+	if v := info.Main.Version; v == "" || v == "(devel)" {
+		return nil, fmt.Errorf("%w: module %q has no version", ErrNoBuildInfo, info.Main.Path)
+	}
+	executablePath, err := executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find executable: %w", err)
+	}
+	return &Build{
+		Owner:          parts[1],
+		Repo:           parts[2],
+		Version:        info.Main.Version,
+		ExecutablePath: executablePath,
+	}, nil
+}
+
+// NewSelfUpgrader returns an Upgrader for the running binary, configured
+// from CurrentBuild, and the current version to pass to it.
+func NewSelfUpgrader(opts ...Opt) (Upgrader, string, error) {
+	b, err := CurrentBuild()
+	if err != nil {
+		return nil, "", err
+	}
+	return NewUpgrader(b.Owner, b.Repo, b.ExecutablePath, opts...), b.Version, nil
+}
+
+// Self upgrades the running binary to the latest release of the repository
+// it was built from, see CurrentBuild. Like UpgradeWithResult, the result has
+// Upgraded set to false if it is already up to date.
+func Self(ctx context.Context, opts ...Opt) (*UpgradeResult, error) {
+	u, version, err := NewSelfUpgrader(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return u.(ResultUpgrader).UpgradeWithResult(ctx, version)
+}
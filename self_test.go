@@ -0,0 +1,38 @@
+package upgrade
+
+import (
+	"context"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelf(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+
+	origReadBuildInfo, origExecutable := readBuildInfo, executable
+	t.Cleanup(func() { readBuildInfo, executable = origReadBuildInfo, origExecutable })
+	info := &debug.BuildInfo{Main: debug.Module{Path: "github.com/getsavvyinc/savvy-cli/v2", Version: "v0.1.0"}}
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return info, true }
+	executable = func() (string, error) { return executablePath, nil }
+
+	b, err := CurrentBuild()
+	require.NoError(t, err)
+	assert.Equal(t, &Build{Owner: "getsavvyinc", Repo: "savvy-cli", Version: "v0.1.0", ExecutablePath: executablePath}, b)
+
+	result, err := Self(ctx, WithAllowManagedInstall(), WithReleaseGetter(u.releaseGetter))
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "v0.1.0", result.PreviousVersion)
+	assert.Equal(t, "new", readFile(t, executablePath))
+
+	info.Main.Version = "(devel)"
+	_, err = Self(ctx)
+	assert.ErrorIs(t, err, ErrNoBuildInfo)
+	info.Main = debug.Module{Path: "example.com/savvy", Version: "v0.1.0"}
+	_, err = CurrentBuild()
+	assert.ErrorIs(t, err, ErrNoBuildInfo)
+}
@@ -0,0 +1,98 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+	"github.com/getsavvyinc/upgrade-cli/trust"
+	"github.com/getsavvyinc/upgrade-cli/tuf"
+)
+
+// ErrUntrustedAsset is returned when the release asset isn't signed by a key
+// in the trust store or doesn't match the TUF targets metadata.
+var ErrUntrustedAsset = errors.New("release asset is not signed by a trusted key")
+
+// WithTrustStore refuses to install release assets whose signature doesn't
+// verify against the keys in s, which are usually embedded at build time.
+// See the trust package for the supported signature formats and key rotation.
+func WithTrustStore(s *trust.Store) Opt {
+	return func(u *upgrader) {
+		u.trustStore = s
+	}
+}
+
+// WithTUF refuses to install release assets that aren't listed, with the
+// same length and hashes, by the targets metadata of the TUF repository c.
+// The metadata is refreshed before every download.
+func WithTUF(c *tuf.Client) Opt {
+	return func(u *upgrader) {
+		u.tufClient = c
+	}
+}
+
+// tufVerifier identifies TUF targets verification in DownloadedUpdate.Verifiers.
+const tufVerifier = "tuf:targets"
+
+// keyVerifier identifies the trusted key k in DownloadedUpdate.Verifiers,
+// e.g. "minisign:<key ID>".
+func keyVerifier(k trust.Key) string {
+	return string(k.Format()) + ":" + k.ID()
+}
+
+// verifySignature verifies the downloaded asset against u.trustStore. It
+// returns the verifier of the key that signed it, or "" without a trust store.
+func (u *upgrader) verifySignature(ctx context.Context, assets []release.Asset, downloadInfo *asset.Info) (string, error) {
+	if u.trustStore == nil {
+		return "", nil
+	}
+	data, err := os.ReadFile(downloadInfo.DownloadedBinaryFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read downloaded asset: %w", err)
+	}
+	k, err := u.trustStore.VerifyAssetKey(ctx, u.httpClient, assets, downloadInfo.Name, data)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrUntrustedAsset, err)
+	}
+	return keyVerifier(k), nil
+}
+
+// verifyTUF verifies the downloaded asset against the TUF targets metadata
+// of u.tufClient. It returns tufVerifier, or "" without a TUF client.
+func (u *upgrader) verifyTUF(ctx context.Context, downloadInfo *asset.Info) (string, error) {
+	if u.tufClient == nil {
+		return "", nil
+	}
+	if err := u.tufClient.Update(ctx); err != nil {
+		return "", fmt.Errorf("failed to update TUF metadata: %w", err)
+	}
+	return u.verifyTUFTarget(downloadInfo)
+}
+
+// verifyTUFTarget verifies the downloaded asset against the trusted TUF
+// targets metadata of u.tufClient, without refreshing it, see verifyTUF.
+func (u *upgrader) verifyTUFTarget(downloadInfo *asset.Info) (string, error) {
+	if u.tufClient == nil {
+		return "", nil
+	}
+	f, err := os.Open(downloadInfo.DownloadedBinaryFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read downloaded asset: %w", err)
+	}
+	defer f.Close()
+	if err := u.tufClient.VerifyTarget(downloadInfo.Name, f); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrUntrustedAsset, err)
+	}
+	return tufVerifier, nil
+}
+
+// appendVerifier appends verifier to verifiers unless it is empty.
+func appendVerifier(verifiers []string, verifier string) []string {
+	if verifier == "" {
+		return verifiers
+	}
+	return append(verifiers, verifier)
+}
@@ -0,0 +1,417 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/getsavvyinc/upgrade-cli/state"
+)
+
+// Slots installs upgrades A/B style, for appliances and embedded systems
+// that must always be able to boot a working binary. Root/a and Root/b each
+// hold a complete set of binaries and the Root/current symlink points at
+// the active slot. The executable is a symlink to Root/current/<name>.
+//
+// An upgrade is installed into the inactive slot, which becomes active but
+// pending. The program calls Boot when it starts and MarkGood once the new
+// binary passed its health check, see CheckHealth. If it is started more
+// than MaxBoots times without being marked good, e.g. because it crashes,
+// Boot switches back to the previous slot.
+//
+// Symlinks are required, so Slots aren't supported on Windows.
+type Slots struct {
+	Root string
+	// MaxBoots is how many times a pending slot may start without being
+	// marked good. Zero means once.
+	MaxBoots int
+	// Key, if set, signs slots.json with an HMAC-SHA256, so that State
+	// refuses a state that was changed outside the upgrader with
+	// ErrSlotTampered. A missing slots.json once slots are installed, and
+	// slots without recorded digests, are refused too. Set it before the
+	// first upgrade, and keep it where
+	// whoever can write Root can't read it, e.g. in a file only root can
+	// read; otherwise the signature only detects corruption.
+	Key []byte
+}
+
+// SlotState is the state of Slots, kept in Root/slots.json.
+type SlotState struct {
+	// Active is the slot current points at, "a" or "b".
+	Active string `json:"active"`
+	// Previous is the slot that was active before, which Rollback and Boot
+	// switch back to.
+	Previous string `json:"previous,omitempty"`
+	// Pending is true until the active slot is marked good.
+	Pending bool `json:"pending,omitempty"`
+	// Boots is how many times the pending slot started.
+	Boots int `json:"boots,omitempty"`
+	// Versions maps each slot to the version installed in it.
+	Versions map[string]string `json:"versions,omitempty"`
+	// Digests maps each slot to the sha256 digests of its binaries, keyed
+	// on their name. Rollback refuses to switch to a slot that changed.
+	Digests map[string]map[string]string `json:"digests,omitempty"`
+	// MAC is the signature of the state, see Slots.Key.
+	MAC string `json:"mac,omitempty"`
+}
+
+const (
+	slotA      = "a"
+	slotB      = "b"
+	slotsState = "slots.json"
+)
+
+var (
+	// ErrSlotPending is returned by an upgrade while the active slot isn't
+	// marked good yet, since it would overwrite the previous, working slot.
+	ErrSlotPending = errors.New("the active slot is not marked good yet")
+	// ErrNoPreviousSlot is returned by Slots.Rollback if no slot was active before.
+	ErrNoPreviousSlot = errors.New("no previous slot to roll back to")
+	// ErrSlotTampered is returned if the slot state doesn't match its
+	// signature, see Slots.Key, or the binaries of the slot Rollback would
+	// switch to don't match their recorded digests.
+	ErrSlotTampered = errors.New("the slots were modified outside the upgrader")
+	// ErrSlotsWithLayout is returned by an upgrade if both WithSlots and
+	// WithVersionedLayout are set, since both own the executable's symlink.
+	ErrSlotsWithLayout = errors.New("slots and a versioned layout can't be combined")
+)
+
+// WithSlots installs upgrades into the inactive slot of s instead of
+// replacing the executable. On the first upgrade, the executable is
+// replaced with a symlink and the binary it was is kept in the first slot.
+// Install to another path replaces the binary there, without touching s.
+// It can't be combined with WithVersionedLayout.
+func WithSlots(s Slots) Opt {
+	return func(u *upgrader) {
+		u.slots = &s
+	}
+}
+
+// checkSlots returns ErrSlotsWithLayout if both slots and a versioned layout are set.
+func (u *upgrader) checkSlots() error {
+	if u.slots != nil && u.layout != nil {
+		return ErrSlotsWithLayout
+	}
+	return nil
+}
+
+// State returns the state of the slots. It is empty if nothing was
+// installed into them yet.
+func (s Slots) State() (*SlotState, error) {
+	data, err := os.ReadFile(filepath.Join(s.Root, slotsState))
+	if errors.Is(err, os.ErrNotExist) {
+		if s.Key != nil {
+			for _, slot := range []string{slotA, slotB} {
+				if _, err := os.Lstat(filepath.Join(s.Root, slot)); err == nil {
+					return nil, fmt.Errorf("%w: %s is missing", ErrSlotTampered, slotsState)
+				}
+			}
+		}
+		return &SlotState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read slot state: %w", err)
+	}
+	st := &SlotState{}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("failed to read slot state: %w", err)
+	}
+	if s.Key != nil {
+		ok, err := checkMAC(s.Key, st, &st.MAC)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: the signature of %s doesn't match", ErrSlotTampered, slotsState)
+		}
+	}
+	return st, nil
+}
+
+// Boot records a start of the active slot. Call it when the program starts,
+// before anything else. If the pending slot started more than MaxBoots times
+// without being marked good, Boot switches back to the previous slot and
+// returns true; the running binary is the failed one then, so the program
+// should restart, e.g. with Reexec.
+func (s Slots) Boot() (bool, error) {
+	st, err := s.State()
+	if err != nil || st.Active == "" {
+		return false, err
+	}
+	if !st.Pending || st.Previous == "" {
+		// finish a rollback interrupted before current was switched
+		return false, s.activate(st.Active)
+	}
+	st.Boots++
+	maxBoots := s.MaxBoots
+	if maxBoots <= 0 {
+		maxBoots = 1
+	}
+	if st.Boots <= maxBoots {
+		if err := s.save(st); err != nil {
+			return false, err
+		}
+		// finish an upgrade interrupted before current was switched
+		return false, s.activate(st.Active)
+	}
+	if err := s.Rollback(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MarkGood marks the active slot as working, so Boot doesn't switch back to
+// the previous one and the next upgrade can be installed.
+func (s Slots) MarkGood() error {
+	st, err := s.State()
+	if err != nil || !st.Pending {
+		return err
+	}
+	st.Pending = false
+	st.Boots = 0
+	return s.save(st)
+}
+
+// Rollback switches back to the previous slot, after verifying its binaries
+// against the digests recorded when they were installed. The failed slot
+// becomes the inactive one, which the next upgrade overwrites.
+func (s Slots) Rollback() error {
+	st, err := s.State()
+	if err != nil {
+		return err
+	}
+	if st.Previous == "" {
+		return ErrNoPreviousSlot
+	}
+	if err := s.verify(st.Previous, st.Digests[st.Previous]); err != nil {
+		return err
+	}
+	st.Active, st.Previous = st.Previous, st.Active
+	st.Pending = false
+	st.Boots = 0
+	if err := s.save(st); err != nil {
+		return err
+	}
+	return s.activate(st.Active)
+}
+
+// CheckHealth runs check if the active slot is pending. It marks the slot
+// good if check succeeds, and switches back to the previous slot and
+// returns true if it fails, in which case the program should restart.
+func (s Slots) CheckHealth(ctx context.Context, check func(context.Context) error) (bool, error) {
+	st, err := s.State()
+	if err != nil || !st.Pending {
+		return false, err
+	}
+	if err := check(ctx); err != nil {
+		if rbErr := s.Rollback(); rbErr != nil {
+			return false, fmt.Errorf("health check failed: %w, and rolling back failed: %w", err, rbErr)
+		}
+		return true, nil
+	}
+	return false, s.MarkGood()
+}
+
+// install installs the new binaries of version to, keyed on their
+// destination, into the inactive slot, activates it as pending and links
+// the destinations to it. A destination that is a regular binary is kept
+// in the active slot as version from.
+func (s Slots) install(ctx context.Context, from, to string, binaries map[string]string) error {
+	st, err := s.State()
+	if err != nil {
+		return err
+	}
+	if st.Pending {
+		return fmt.Errorf("%w: %s", ErrSlotPending, st.Active)
+	}
+	if st.Versions == nil {
+		st.Versions = make(map[string]string)
+	}
+	if st.Active == "" {
+		adopted := false
+		for dst := range binaries {
+			ok, err := s.adopt(dst, slotA)
+			if err != nil {
+				return err
+			}
+			adopted = adopted || ok
+		}
+		if adopted {
+			st.Active = slotA
+			st.Versions[slotA] = from
+			if err := s.record(st, slotA); err != nil {
+				return err
+			}
+		}
+	}
+
+	slot := slotA
+	if st.Active == slotA {
+		slot = slotB
+	}
+	dir := filepath.Join(s.Root, slot)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clear slot %s: %w", slot, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create slot %s: %w", slot, err)
+	}
+	inSlot := make(map[string]string, len(binaries))
+	for dst, staged := range binaries {
+		inSlot[filepath.Join(dir, filepath.Base(dst))] = staged
+	}
+	if err := replaceBinaries(ctx, inSlot); err != nil {
+		return err
+	}
+
+	// the state is saved first, so Boot finishes an interrupted switch. With
+	// no previous slot there's nothing to fall back to, so it isn't pending.
+	st.Previous, st.Active = st.Active, slot
+	st.Pending = st.Previous != ""
+	st.Boots = 0
+	st.Versions[slot] = to
+	if err := s.record(st, slot); err != nil {
+		return err
+	}
+	if err := s.save(st); err != nil {
+		return err
+	}
+	if err := s.activate(slot); err != nil {
+		return err
+	}
+	for dst := range binaries {
+		target := filepath.Join(s.Root, currentLink, filepath.Base(dst))
+		if t, err := os.Readlink(dst); err == nil && t == target {
+			continue
+		}
+		if err := symlinkAtomic(target, dst); err != nil {
+			return fmt.Errorf("failed to link %s: %w", dst, err)
+		}
+	}
+	return nil
+}
+
+// adopt copies the binary at dst, installed before the slots were used,
+// into slot. It returns false if dst isn't a regular binary.
+func (s Slots) adopt(dst, slot string) (bool, error) {
+	fi, err := os.Lstat(dst)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !fi.Mode().IsRegular()) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	dir := filepath.Join(s.Root, slot)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, fmt.Errorf("failed to create slot %s: %w", slot, err)
+	}
+	p := filepath.Join(dir, filepath.Base(dst))
+	if err := os.Link(dst, p); err != nil {
+		if err := copyFile(dst, p, fi.Mode().Perm()); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// activate atomically points the current symlink at slot, unless it does already.
+func (s Slots) activate(slot string) error {
+	link := filepath.Join(s.Root, currentLink)
+	if t, err := os.Readlink(link); err == nil && t == slot {
+		return nil
+	}
+	if err := symlinkAtomic(slot, link); err != nil {
+		return fmt.Errorf("failed to switch to slot %s: %w", slot, err)
+	}
+	return nil
+}
+
+// record records the digests of the binaries in slot in st.
+func (s Slots) record(st *SlotState, slot string) error {
+	digests, err := slotDigests(filepath.Join(s.Root, slot))
+	if err != nil {
+		return fmt.Errorf("failed to hash slot %s: %w", slot, err)
+	}
+	if st.Digests == nil {
+		st.Digests = make(map[string]map[string]string)
+	}
+	st.Digests[slot] = digests
+	return nil
+}
+
+// verify checks that the binaries in slot match the digests recorded for
+// it. Slots installed before digests were recorded aren't checked, unless
+// Key is set.
+func (s Slots) verify(slot string, recorded map[string]string) error {
+	if recorded == nil {
+		if s.Key != nil {
+			return fmt.Errorf("%w: no digests are recorded for slot %s", ErrSlotTampered, slot)
+		}
+		return nil
+	}
+	digests, err := slotDigests(filepath.Join(s.Root, slot))
+	if err != nil {
+		return fmt.Errorf("failed to hash slot %s: %w", slot, err)
+	}
+	if !maps.Equal(digests, recorded) {
+		return fmt.Errorf("%w: the binaries in slot %s changed", ErrSlotTampered, slot)
+	}
+	return nil
+}
+
+// slotDigests returns the sha256 digests of the files in dir, keyed on their name.
+func slotDigests(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[string]string, len(entries))
+	for _, e := range entries {
+		digest, err := fileSHA256(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		digests[e.Name()] = digest
+	}
+	return digests, nil
+}
+
+// checkMAC reports whether *mac is the signature of v keyed with key, see
+// state.Sign. mac points into v and is cleared to sign it.
+func checkMAC(key []byte, v any, mac *string) (bool, error) {
+	signature := *mac
+	*mac = ""
+	expected, err := state.Sign(key, v)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal([]byte(signature), []byte(expected)), nil
+}
+
+// save atomically writes st, signed with Key if set.
+func (s Slots) save(st *SlotState) error {
+	st.MAC = ""
+	if s.Key != nil {
+		mac, err := state.Sign(s.Key, st)
+		if err != nil {
+			return err
+		}
+		st.MAC = mac
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Root, 0o755); err != nil {
+		return fmt.Errorf("failed to create slots dir: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(s.Root, slotsState), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write slot state: %w", err)
+	}
+	return nil
+}
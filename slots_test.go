@@ -0,0 +1,199 @@
+//go:build unix
+
+package upgrade
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlots(t *testing.T) {
+	ctx := context.Background()
+
+	// upgrade installs v0.2.0 into s, over the binary installed before
+	upgrade := func(t *testing.T, s Slots) string {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithSlots(s))
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+
+		target, err := os.Readlink(executablePath)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(s.Root, "current", "savvy"), target)
+		assert.Equal(t, "new", readFile(t, executablePath))
+
+		st, err := s.State()
+		require.NoError(t, err)
+		assert.Equal(t, "b", st.Active)
+		assert.Equal(t, "a", st.Previous)
+		assert.True(t, st.Pending)
+		assert.Equal(t, map[string]string{"a": "0.1.0", "b": "v0.2.0"}, st.Versions)
+		oldSum, newSum := sha256.Sum256([]byte("old")), sha256.Sum256([]byte("new"))
+		assert.Equal(t, map[string]map[string]string{
+			"a": {"savvy": hex.EncodeToString(oldSum[:])},
+			"b": {"savvy": hex.EncodeToString(newSum[:])},
+		}, st.Digests)
+
+		// the next upgrade would overwrite the working slot
+		_, err = u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrSlotPending)
+		return executablePath
+	}
+
+	t.Run("BootBack", func(t *testing.T) {
+		s := Slots{Root: t.TempDir()}
+		executablePath := upgrade(t, s)
+
+		rolledBack, err := s.Boot()
+		require.NoError(t, err)
+		assert.False(t, rolledBack)
+		assert.Equal(t, "new", readFile(t, executablePath))
+
+		// the new binary crashed before it was marked good
+		rolledBack, err = s.Boot()
+		require.NoError(t, err)
+		assert.True(t, rolledBack)
+		assert.Equal(t, "old", readFile(t, executablePath))
+		st, err := s.State()
+		require.NoError(t, err)
+		assert.Equal(t, "a", st.Active)
+		assert.False(t, st.Pending)
+	})
+	t.Run("Healthy", func(t *testing.T) {
+		s := Slots{Root: t.TempDir()}
+		executablePath := upgrade(t, s)
+
+		rolledBack, err := s.CheckHealth(ctx, func(context.Context) error { return nil })
+		require.NoError(t, err)
+		assert.False(t, rolledBack)
+		st, err := s.State()
+		require.NoError(t, err)
+		assert.False(t, st.Pending)
+
+		rolledBack, err = s.Boot()
+		require.NoError(t, err)
+		assert.False(t, rolledBack)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("Unhealthy", func(t *testing.T) {
+		s := Slots{Root: t.TempDir()}
+		executablePath := upgrade(t, s)
+
+		rolledBack, err := s.CheckHealth(ctx, func(context.Context) error { return errors.New("unhealthy") })
+		require.NoError(t, err)
+		assert.True(t, rolledBack)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("TamperedSlot", func(t *testing.T) {
+		s := Slots{Root: t.TempDir()}
+		executablePath := upgrade(t, s)
+
+		// the binary to roll back to was swapped
+		require.NoError(t, os.Remove(filepath.Join(s.Root, "a", "savvy")))
+		require.NoError(t, os.WriteFile(filepath.Join(s.Root, "a", "savvy"), []byte("evil"), 0o755))
+		assert.ErrorIs(t, s.Rollback(), ErrSlotTampered)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("SignedState", func(t *testing.T) {
+		s := Slots{Root: t.TempDir(), Key: []byte("secret")}
+		executablePath := upgrade(t, s)
+
+		// the state was edited to roll back to another slot
+		st, err := s.State()
+		require.NoError(t, err)
+		st.Previous, st.Digests = "c", nil
+		data, err := json.Marshal(st)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(s.Root, "slots.json"), data, 0o644))
+		_, err = s.Boot()
+		assert.ErrorIs(t, err, ErrSlotTampered)
+		assert.ErrorIs(t, s.Rollback(), ErrSlotTampered)
+		assert.Equal(t, "new", readFile(t, executablePath))
+
+		_, err = Slots{Root: s.Root, Key: []byte("other")}.State()
+		assert.ErrorIs(t, err, ErrSlotTampered)
+	})
+	t.Run("InstallElsewhere", func(t *testing.T) {
+		s := Slots{Root: t.TempDir()}
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithSlots(s))
+
+		// installing to another path leaves the slots and executable alone
+		dest := filepath.Join(t.TempDir(), "savvy")
+		_, err := u.Install(ctx, "v0.2.0", dest)
+		require.NoError(t, err)
+		assert.Equal(t, "new", readFile(t, dest))
+		fi, err := os.Lstat(dest)
+		require.NoError(t, err)
+		assert.True(t, fi.Mode().IsRegular())
+		st, err := s.State()
+		require.NoError(t, err)
+		assert.Empty(t, st.Active)
+		assert.NoDirExists(t, filepath.Join(s.Root, "a"))
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("MissingState", func(t *testing.T) {
+		s := Slots{Root: t.TempDir(), Key: []byte("secret")}
+		executablePath := upgrade(t, s)
+		require.NoError(t, s.MarkGood())
+
+		// without the state, the next upgrade would clear the active slot
+		require.NoError(t, os.Remove(filepath.Join(s.Root, "slots.json")))
+		_, err := s.State()
+		assert.ErrorIs(t, err, ErrSlotTampered)
+		u, _ := newTestUpgrader(t, "v0.3.0", map[string]string{"savvy": "newer"}, WithSlots(s))
+		u.executablePath = executablePath
+		_, err = u.UpgradeWithResult(ctx, "v0.2.0")
+		assert.ErrorIs(t, err, ErrSlotTampered)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("UnrecordedSlot", func(t *testing.T) {
+		s := Slots{Root: t.TempDir(), Key: []byte("secret")}
+		executablePath := upgrade(t, s)
+
+		// a signed state without digests doesn't skip the check
+		st, err := s.State()
+		require.NoError(t, err)
+		st.Digests = nil
+		require.NoError(t, s.save(st))
+		assert.ErrorIs(t, s.Rollback(), ErrSlotTampered)
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("NoPreviousSlot", func(t *testing.T) {
+		assert.ErrorIs(t, Slots{Root: t.TempDir()}.Rollback(), ErrNoPreviousSlot)
+	})
+	t.Run("FirstInstall", func(t *testing.T) {
+		dir := t.TempDir()
+		s := Slots{Root: filepath.Join(dir, "slots")}
+		staged := filepath.Join(dir, "staged")
+		require.NoError(t, os.WriteFile(staged, []byte("new"), 0o755))
+		executablePath := filepath.Join(dir, "savvy")
+		require.NoError(t, s.install(ctx, "", "v0.2.0", map[string]string{executablePath: staged}))
+
+		// there's nothing to roll back to, so booting never fails
+		st, err := s.State()
+		require.NoError(t, err)
+		assert.False(t, st.Pending)
+		for i := 0; i < 3; i++ {
+			rolledBack, err := s.Boot()
+			require.NoError(t, err)
+			assert.False(t, rolledBack)
+		}
+		assert.Equal(t, "new", readFile(t, executablePath))
+	})
+	t.Run("WithLayout", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"},
+			WithSlots(Slots{Root: t.TempDir()}), WithVersionedLayout(Layout{Root: t.TempDir()}))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrSlotsWithLayout)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+}
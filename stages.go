@@ -0,0 +1,989 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/receipt"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// Update is the result of Check.
+type Update struct {
+	CurrentVersion string `json:"current_version"`
+	LatestVersion  string `json:"latest_version"`
+	// Available is true if LatestVersion is newer than CurrentVersion.
+	Available bool          `json:"available"`
+	Release   *release.Info `json:"release"`
+	// MinimumVersion is the oldest supported version, if the release
+	// publishes one, see WithMinimumVersion.
+	MinimumVersion string `json:"minimum_version,omitempty"`
+	// BelowMinimum is true if CurrentVersion is older than MinimumVersion.
+	// The CLI should refuse to run until it is upgraded, see RequireMinimum.
+	BelowMinimum bool `json:"below_minimum,omitempty"`
+	// RolloutPercentage is the percentage of installs the release is
+	// offered to, if it is rolled out gradually, see WithRollout.
+	RolloutPercentage float64 `json:"rollout_percentage,omitempty"`
+	// HeldBack is true if LatestVersion is newer, but not rolled out to this
+	// install yet. Available is false then.
+	HeldBack bool `json:"held_back,omitempty"`
+	// Skipped and Snoozed are true if the user skipped LatestVersion or
+	// snoozed updates, see WithStateStore. Available is false then.
+	Skipped bool `json:"skipped,omitempty"`
+	Snoozed bool `json:"snoozed,omitempty"`
+	// CurrentYanked and LatestYanked are true if the versions were yanked,
+	// see WithYankedVersions.
+	CurrentYanked bool `json:"current_yanked,omitempty"`
+	LatestYanked  bool `json:"latest_yanked,omitempty"`
+}
+
+// DownloadedUpdate is a downloaded and verified update, returned by Download.
+//
+// It only refers to files on disk, so it can be serialized (e.g. as JSON) and
+// passed to Apply by a later process, for example after a restart.
+type DownloadedUpdate struct {
+	Update *Update `json:"update"`
+	// ExecutablePath is where the primary binary is installed.
+	ExecutablePath string `json:"executable_path"`
+	// Dir holds the staged binaries. It is removed by Apply or Discard.
+	Dir string `json:"dir"`
+	// Binaries maps each destination path to its staged binary.
+	Binaries map[string]string `json:"binaries"`
+	// Files maps each destination path to its staged archive file, see WithArchiveFiles.
+	Files map[string]string `json:"files,omitempty"`
+	// Installer is the staged installer, which Apply runs instead of
+	// installing Binaries, see WithInstaller.
+	Installer string `json:"installer,omitempty"`
+	// BinarySHA256 maps each staged binary, file and installer to its sha256
+	// digest. Apply refuses to install files that changed after they were verified.
+	BinarySHA256 map[string]string `json:"binary_sha256"`
+	// URL, Checksum and Size describe the downloaded release asset.
+	URL      string `json:"url"`
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+	// Verified is true if Checksum was verified against the release checksums.
+	Verified bool `json:"verified"`
+	// BinariesVerified is true if the binaries were verified against the
+	// binary checksums, see WithBinaryChecksums.
+	BinariesVerified bool `json:"binaries_verified,omitempty"`
+	// Verifiers identify the signatures and metadata that verified the
+	// asset besides Checksum, e.g. "minisign:<key ID>" for the trusted key
+	// of WithTrustStore that signed it, or "tuf:targets" with WithTUF.
+	Verifiers []string `json:"verifiers,omitempty"`
+	// BuiltFrom is the module version the binary was built from, e.g.
+	// "github.com/getsavvyinc/savvy-cli@v0.2.0", if the release had no asset
+	// for the platform, see WithGoInstallFallback.
+	BuiltFrom string `json:"built_from,omitempty"`
+	// InstalledSHA256 is the sha256 digest of the executable the update was
+	// staged for, which Commit checks, see ErrStaleUpdate.
+	InstalledSHA256 string `json:"installed_sha256,omitempty"`
+	// Warnings are the non-fatal problems found while downloading, see ChecksumWarn.
+	Warnings []error `json:"-"`
+	// Hooks are the results of the hooks that ran while downloading.
+	Hooks []HookResult `json:"-"`
+}
+
+// Discard removes the staged files of d.
+func (d *DownloadedUpdate) Discard() error {
+	return os.RemoveAll(d.Dir)
+}
+
+// discard discards d if its directory is one the upgrader stages updates
+// in, see ownsStageDir, and leaves anything else alone.
+func (u *upgrader) discard(d *DownloadedUpdate) {
+	if u.ownsStageDir(d.Dir) {
+		d.Discard()
+	}
+}
+
+// ownsStageDir reports whether dir was created by newStageDir, in the work
+// or staging directory, or is the pending directory of the executable.
+func (u *upgrader) ownsStageDir(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	dir = filepath.Clean(dir)
+	if dir == filepath.Clean(u.executablePath+PendingSuffix) {
+		return true
+	}
+	if !strings.HasPrefix(filepath.Base(dir), filepath.Base(u.executablePath)+"-update-") {
+		return false
+	}
+	parent := filepath.Dir(dir)
+	return parent == filepath.Clean(u.tempDir()) || u.stagingDir != "" && parent == filepath.Clean(u.stagingDir)
+}
+
+// tempDir returns the directory updates are downloaded to.
+func (u *upgrader) tempDir() string {
+	if u.workDir != "" {
+		return u.workDir
+	}
+	return os.TempDir()
+}
+
+// ErrStagedBinaryModified is returned by Apply when a staged binary changed after it was verified.
+var ErrStagedBinaryModified = errors.New("staged binary was modified")
+
+// ErrInvalidUpdate is returned by Apply when a DownloadedUpdate installs
+// something the upgrader wouldn't have staged, e.g. because a saved update
+// was edited, and by Download for an Update without a release.
+var ErrInvalidUpdate = errors.New("downloaded update doesn't match the upgrader")
+
+// StagedUpgrader is implemented by the Upgrader NewUpgrader returns. Check,
+// Download and Apply are the stages of Upgrade. They let callers download an
+// update ahead of time and apply it later, e.g. on restart.
+type StagedUpgrader interface {
+	// Check looks up the latest release.
+	Check(ctx context.Context, currentVersion string) (*Update, error)
+	// Download downloads, verifies and stages an update returned by Check.
+	Download(ctx context.Context, update *Update) (*DownloadedUpdate, error)
+	// Apply installs an update staged by Download.
+	Apply(ctx context.Context, d *DownloadedUpdate) (*UpgradeResult, error)
+}
+
+var _ StagedUpgrader = (*upgrader)(nil)
+
+func (u *upgrader) Check(ctx context.Context, currentVersion string) (*Update, error) {
+	update, err := u.check(ctx, currentVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.applyPreferences(ctx, update); err != nil {
+		return nil, err
+	}
+	u.notify(ctx, update)
+	return update, nil
+}
+
+// check looks up the latest release, ignoring the user's preferences.
+func (u *upgrader) check(ctx context.Context, currentVersion string) (*Update, error) {
+	update, err := u.checkLatest(ctx, currentVersion)
+	u.metrics.CheckPerformed(err)
+	return update, err
+}
+
+func (u *upgrader) checkLatest(ctx context.Context, currentVersion string) (*Update, error) {
+	if u.nightly != nil {
+		return u.checkNightly(ctx, currentVersion)
+	}
+	curr, err := u.parseVersion(currentVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse current version: %s with err %w", currentVersion, err)
+	}
+
+	releaseInfo, err := u.latestRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := u.parseVersion(u.tagVersion(releaseInfo.TagName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse latest version: %s with err %w", releaseInfo.TagName, err)
+	}
+
+	update := &Update{
+		CurrentVersion: curr.Original(),
+		LatestVersion:  latest.Original(),
+		Available:      u.versionScheme.Compare(latest, curr) > 0,
+		Release:        releaseInfo,
+	}
+	if err := u.checkMinimumVersion(ctx, update, curr); err != nil {
+		return nil, err
+	}
+	if err := u.checkYanked(ctx, update, curr, latest); err != nil {
+		return nil, err
+	}
+	if err := u.checkRollout(ctx, update); err != nil {
+		return nil, err
+	}
+	return update, nil
+}
+
+// checkFeed looks up the latest version in the release feed. The update has no Release.
+func (u *upgrader) checkFeed(ctx context.Context, currentVersion string) (*Update, error) {
+	update, err := u.checkLatestTag(ctx, currentVersion)
+	u.metrics.CheckPerformed(err)
+	return update, err
+}
+
+func (u *upgrader) checkLatestTag(ctx context.Context, currentVersion string) (*Update, error) {
+	curr, err := u.parseVersion(currentVersion)
+	if err != nil {
+		return nil, err
+	}
+	var tag string
+	err = inPhase(ctx, "release lookup", u.timeouts.Release, func(ctx context.Context) error {
+		tag, err = u.tagGetter.GetLatestTag(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	latest, err := u.parseVersion(u.tagVersion(tag))
+	if err != nil {
+		return nil, err
+	}
+	return &Update{
+		CurrentVersion: curr.Original(),
+		LatestVersion:  latest.Original(),
+		Available:      u.versionScheme.Compare(latest, curr) > 0,
+	}, nil
+}
+
+// Download downloads, verifies and stages update.
+// Package manager installs are reported as a *ManagedInstallError, WithHomebrewFallback only applies to Upgrade.
+// An available update without a release, e.g. one decoded from JSON that
+// Check didn't return, fails with ErrInvalidUpdate.
+func (u *upgrader) Download(ctx context.Context, update *Update) (*DownloadedUpdate, error) {
+	if update == nil || !update.Available {
+		return nil, ErrAlreadyUpToDate
+	}
+	if update.Release == nil {
+		return nil, fmt.Errorf("%w: the update has no release", ErrInvalidUpdate)
+	}
+	if err := u.checkManagedInstall(ctx); err != nil {
+		return nil, err
+	}
+	lock, err := acquireLock(u.executablePath)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.release()
+
+	installed, err := installedDigest(u.executablePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", u.executablePath, err)
+	}
+	result := &UpgradeResult{}
+	d, err := u.download(ctx, update, u.executablePath, result)
+	if err != nil {
+		return nil, err
+	}
+	d.InstalledSHA256 = installed
+	d.Hooks = result.Hooks
+	return d, nil
+}
+
+// Apply replaces the installed binaries with the binaries staged by Download.
+// It refuses with ErrInvalidUpdate an update that installs anything else,
+// and a managed install like Download does.
+func (u *upgrader) Apply(ctx context.Context, d *DownloadedUpdate) (*UpgradeResult, error) {
+	return u.applyUpdate(ctx, d, false)
+}
+
+// applyUpdate installs d, checking that the installed executable didn't
+// change since d was staged if checkInstalled is set, see Commit.
+func (u *upgrader) applyUpdate(ctx context.Context, d *DownloadedUpdate, checkInstalled bool) (*UpgradeResult, error) {
+	if d == nil {
+		return &UpgradeResult{}, fmt.Errorf("%w: it is nil", ErrInvalidUpdate)
+	}
+	u.metrics.UpgradeAttempted()
+	result, err := u.applyStaged(ctx, d, checkInstalled)
+	u.metrics.UpgradeFinished(err)
+	u.record(ctx, actionApply, d.ExecutablePath, result, err)
+	if err != nil {
+		return result, err
+	}
+	return result, u.restart(result, d.ExecutablePath)
+}
+
+func (u *upgrader) applyStaged(ctx context.Context, d *DownloadedUpdate, checkInstalled bool) (*UpgradeResult, error) {
+	start := time.Now()
+	result := &UpgradeResult{Hooks: d.Hooks}
+	defer func() { result.Duration = time.Since(start) }()
+
+	// d may come from anywhere, so nothing is locked or removed before it
+	// is known to be one the upgrader staged
+	if err := u.checkDownloaded(d); err != nil {
+		u.discard(d)
+		return result, err
+	}
+	lock, err := acquireLock(d.ExecutablePath)
+	if err != nil {
+		return result, err
+	}
+	defer lock.release()
+	defer u.discard(d)
+
+	if err := u.checkManagedInstall(ctx); err != nil {
+		return result, err
+	}
+	if checkInstalled {
+		if err := checkStale(d); err != nil {
+			return result, err
+		}
+	}
+	if err := u.apply(ctx, d, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// checkDownloaded checks that d, which may have been saved and loaded again,
+// only installs what the upgrader stages: the executable, the binaries of
+// WithBinaries and the files of WithArchiveFiles, from files directly in d.Dir,
+// or an installer if WithInstaller is set.
+func (u *upgrader) checkDownloaded(d *DownloadedUpdate) error {
+	if d.Update == nil {
+		return fmt.Errorf("%w: it has no update", ErrInvalidUpdate)
+	}
+	if filepath.Clean(d.ExecutablePath) != filepath.Clean(u.executablePath) {
+		return fmt.Errorf("%w: it installs %s instead of %s", ErrInvalidUpdate, d.ExecutablePath, u.executablePath)
+	}
+	if d.Installer != "" && u.installer == nil {
+		return fmt.Errorf("%w: it runs an installer, but WithInstaller isn't set", ErrInvalidUpdate)
+	}
+	installDir := filepath.Dir(u.executablePath)
+	binaries := map[string]bool{filepath.Clean(u.executablePath): true}
+	for _, name := range u.binaryNames() {
+		binaries[filepath.Join(installDir, name)] = true
+	}
+	files := make(map[string]bool, len(u.archiveFiles))
+	for _, f := range u.archiveFiles {
+		dst := f.Path
+		if !filepath.IsAbs(dst) {
+			dst = filepath.Join(installDir, dst)
+		}
+		files[filepath.Clean(dst)] = true
+	}
+
+	staged := make([]string, 0, len(d.Binaries)+len(d.Files)+1)
+	for dst, p := range d.Binaries {
+		if !binaries[filepath.Clean(dst)] {
+			return fmt.Errorf("%w: it installs the unexpected binary %s", ErrInvalidUpdate, dst)
+		}
+		staged = append(staged, p)
+	}
+	for dst, p := range d.Files {
+		if !files[filepath.Clean(dst)] {
+			return fmt.Errorf("%w: it installs the unexpected file %s", ErrInvalidUpdate, dst)
+		}
+		staged = append(staged, p)
+	}
+	if d.Installer != "" {
+		staged = append(staged, d.Installer)
+	}
+	for _, p := range staged {
+		if d.Dir == "" || filepath.Dir(filepath.Clean(p)) != filepath.Clean(d.Dir) {
+			return fmt.Errorf("%w: %s isn't staged in %s", ErrInvalidUpdate, p, d.Dir)
+		}
+	}
+	return nil
+}
+
+// PathInstaller is implemented by the Upgrader NewUpgrader returns.
+type PathInstaller interface {
+	// Install downloads and verifies a release and installs it at destPath
+	// instead of replacing the current executable.
+	Install(ctx context.Context, version, destPath string) (*UpgradeResult, error)
+}
+
+var _ PathInstaller = (*upgrader)(nil)
+
+// Install downloads the release tagged version, or the latest release if
+// version is empty or "latest", and installs it at destPath.
+// Unlike Upgrade, it doesn't compare versions or touch the current executable.
+func (u *upgrader) Install(ctx context.Context, version, destPath string) (*UpgradeResult, error) {
+	result, err := u.install(ctx, version, destPath)
+	u.record(ctx, actionInstall, destPath, result, err)
+	return result, err
+}
+
+func (u *upgrader) install(ctx context.Context, version, destPath string) (*UpgradeResult, error) {
+	start := time.Now()
+	result := &UpgradeResult{}
+	defer func() { result.Duration = time.Since(start) }()
+
+	var releaseInfo *release.Info
+	var err error
+	if version == "" || version == "latest" {
+		releaseInfo, err = u.releaseGetter.GetLatestRelease(ctx)
+	} else {
+		releaseInfo, err = releaseByTag(ctx, u.releaseGetter, u.tagPrefix, version)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return result, fmt.Errorf("failed to create install dir: %w", err)
+	}
+
+	lock, err := acquireLock(destPath)
+	if err != nil {
+		return result, err
+	}
+	defer lock.release()
+
+	update := &Update{LatestVersion: u.tagVersion(releaseInfo.TagName), Available: true, Release: releaseInfo}
+	d, err := u.download(ctx, update, destPath, result)
+	if err != nil {
+		return result, err
+	}
+	defer d.Discard()
+
+	if err := u.apply(ctx, d, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// download downloads and stages update for installation at installPath.
+// Additional binaries from WithBinaries are installed next to it.
+func (u *upgrader) download(ctx context.Context, update *Update, installPath string, result *UpgradeResult) (*DownloadedUpdate, error) {
+	result.TargetVersion = update.LatestVersion
+	if err := u.checkInstaller(); err != nil {
+		return nil, err
+	}
+	if err := u.checkSlots(); err != nil {
+		return nil, err
+	}
+	if err := u.refuseYanked(ctx, update.Release.TagName); err != nil {
+		return nil, err
+	}
+	env := HookEnv{FromVersion: update.CurrentVersion, ToVersion: update.LatestVersion, BinaryPath: installPath}
+	if err := u.runPhase(ctx, result, PreUpgrade, env); err != nil {
+		return nil, err
+	}
+	if u.workDir != "" {
+		if err := os.MkdirAll(u.workDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create work dir: %w", err)
+		}
+	}
+	d, err := u.downloadRelease(ctx, update, installPath, env, result)
+	if errors.Is(err, ErrNoAsset) && u.goInstallModule != "" {
+		return u.goInstall(ctx, err, update, installPath, env, result)
+	}
+	return d, err
+}
+
+// downloadRelease downloads, verifies and stages the release asset for the platform.
+func (u *upgrader) downloadRelease(ctx context.Context, update *Update, installPath string, env HookEnv, result *UpgradeResult) (*DownloadedUpdate, error) {
+	var temps tempFiles
+	defer temps.removeAll()
+
+	// the checksums are downloaded alongside the asset, and abort its
+	// download if they aren't available
+	assets := update.Release.Assets
+	downloadCtx, cancelDownload := context.WithCancel(ctx)
+	defer cancelDownload()
+	checksums, err := u.prefetchChecksums(downloadCtx, cancelDownload, assets)
+	if err != nil {
+		return nil, err
+	}
+	if u.checksumsFirst && checksums != nil {
+		if assets, err = u.confirmChecksums(checksums, assets); err != nil {
+			return nil, err
+		}
+	}
+
+	// from the releaseInfo, download the binary for the architecture
+	var deltaWarning error
+	downloadInfo, extracted, err := u.streamAsset(downloadCtx, assets)
+	if err == nil {
+		temps.addAll(extracted)
+		if downloadInfo == nil {
+			var cleanup func() error
+			downloadInfo, cleanup, deltaWarning, err = u.downloadAsset(downloadCtx, update.Release.TagName, assets, checksums)
+			if cleanup != nil {
+				defer cleanup()
+			}
+		}
+	}
+	if err != nil {
+		if ctx.Err() == nil && downloadCtx.Err() != nil {
+			_, err = checksums.wait()
+		}
+		var digestMismatch *asset.DigestMismatchError
+		if errors.As(err, &digestMismatch) {
+			return nil, &ChecksumMismatchError{Asset: digestMismatch.Asset, Expected: digestMismatch.Expected, Actual: digestMismatch.Actual}
+		}
+		return nil, err
+	}
+	temps.add(downloadInfo.DownloadedBinaryFilePath)
+
+	verified, err := u.verifyChecksum(ctx, func() (*checksum.Info, error) {
+		if checksums != nil && (checksums.assetURL == "" || checksums.assetURL == downloadInfo.URL) {
+			return checksums.wait()
+		}
+		return u.downloadChecksums(ctx, assets, downloadInfo.URL)
+	}, downloadInfo)
+	if err != nil && !errors.Is(err, ErrChecksumNotVerified) {
+		return nil, err
+	}
+	warning := err
+
+	signer, err := u.verifySignature(ctx, assets, downloadInfo)
+	if err != nil {
+		return nil, err
+	}
+	target, err := u.verifyTUF(ctx, downloadInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	var d *DownloadedUpdate
+	if extracted != nil {
+		d, err = u.prepareExtracted(ctx, &temps, update, installPath, downloadInfo, extracted, verified, warning, env, result)
+	} else {
+		if verified {
+			u.storeDownload(update.Release.TagName, downloadInfo)
+		}
+		d, err = u.prepare(ctx, &temps, update, installPath, downloadInfo, verified, warning, env, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deltaWarning != nil {
+		d.Warnings = append(d.Warnings, deltaWarning)
+	}
+	d.Verifiers = appendVerifier(appendVerifier(nil, signer), target)
+	return d, nil
+}
+
+// streamAsset downloads the asset for the platform and extracts it as it
+// arrives, so the archive is never written to disk. The binaries are only
+// staged once the checksum is verified. It returns a nil *asset.Info if the
+// asset has to be downloaded to a file instead: zip archives need random
+// access, raw binaries aren't extracted, and signatures, TUF, the download
+// cache and archive checksums read the whole asset. Archives of unknown size
+// are downloaded too, since extracting them is limited relative to their size.
+func (u *upgrader) streamAsset(ctx context.Context, assets []release.Asset) (*asset.Info, map[string]string, error) {
+	s, ok := u.assetDownloader.(asset.Streamer)
+	if !ok || u.trustStore != nil || u.tufClient != nil || u.downloadCacheDir != "" || u.archiveChecksums {
+		return nil, nil, nil
+	}
+	a, err := s.SelectAsset(ctx, assets)
+	if err != nil {
+		return nil, nil, err
+	}
+	arSuffix := asset.ArchiveSuffix(a.BrowserDownloadURL)
+	if !streamable(arSuffix) {
+		return nil, nil, nil
+	}
+	if u.maxRatio > 0 && a.Size <= 0 {
+		// the extraction limit depends on the size of the archive
+		return nil, nil, nil
+	}
+
+	var extracted map[string]string
+	var info *asset.Info
+	start := time.Now()
+	err = inPhase(ctx, "asset download", u.timeouts.Download, func(ctx context.Context) error {
+		info, err = s.StreamAsset(ctx, a, func(r io.Reader) error {
+			var err error
+			extracted, err = unArchiveStream(u.workDir, u.entrySelector(), u.extractLimit(a.Size), r, arSuffix)
+			if err != nil {
+				return fmt.Errorf("failed to unarchive: %w", err)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		removeAll(extracted)
+		return nil, nil, err
+	}
+	u.metrics.AssetDownloaded(info.Size, time.Since(start))
+	info.Name = assetName(a)
+	return info, extracted, nil
+}
+
+// prepare extracts, stages and smoke tests a downloaded and verified asset,
+// or stages it as is if it's an installer.
+// Intermediate files are tracked in temps.
+func (u *upgrader) prepare(ctx context.Context, temps *tempFiles, update *Update, installPath string, downloadInfo *asset.Info, verified bool, warning error, env HookEnv, result *UpgradeResult) (*DownloadedUpdate, error) {
+	if u.installer != nil {
+		return u.stageInstaller(temps, update, installPath, downloadInfo, verified, warning)
+	}
+	if ext, ok := unsupportedArchive(downloadInfo.Name); ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedArchive, ext)
+	}
+	extracted, err := tryUnArchive(u.workDir, u.entrySelector(), u.extractLimit(downloadInfo.Size), downloadInfo.DownloadedBinaryFilePath, downloadInfo.ArSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unarchive: %w", err)
+	}
+	temps.addAll(extracted)
+	if u.archiveChecksums && errors.Is(warning, checksum.ErrNoCheckSumAsset) {
+		if warning, err = u.checkArchiveChecksums(downloadInfo.Name, downloadInfo.DownloadedBinaryFilePath, downloadInfo.ArSuffix, extracted, warning); err != nil {
+			return nil, err
+		}
+	}
+	return u.prepareExtracted(ctx, temps, update, installPath, downloadInfo, extracted, verified, warning, env, result)
+}
+
+// prepareExtracted stages and smoke tests the binaries extracted from a verified asset.
+func (u *upgrader) prepareExtracted(ctx context.Context, temps *tempFiles, update *Update, installPath string, downloadInfo *asset.Info, extracted map[string]string, verified bool, warning error, env HookEnv, result *UpgradeResult) (*DownloadedUpdate, error) {
+	binariesVerified, binariesWarning, err := u.verifyBinaryChecksums(ctx, update.Release, extracted)
+	if err != nil {
+		return nil, err
+	}
+	d, err := u.stage(temps, update, installPath, extracted)
+	if err != nil {
+		return nil, err
+	}
+	d.URL = downloadInfo.URL
+	d.Checksum = downloadInfo.Checksum
+	d.Size = downloadInfo.Size
+	d.Verified = verified
+	d.BinariesVerified = binariesVerified
+	for _, w := range []error{warning, binariesWarning} {
+		if w != nil {
+			d.Warnings = append(d.Warnings, w)
+		}
+	}
+
+	smokeEnv := env
+	smokeEnv.BinaryPath = d.Binaries[installPath]
+	smokeEnv.Binaries = make(map[string]string, len(d.Binaries))
+	for dst, p := range d.Binaries {
+		smokeEnv.Binaries[filepath.Base(dst)] = p
+	}
+	if err := u.runPhase(ctx, result, SmokeTest, smokeEnv); err != nil {
+		return nil, err
+	}
+
+	temps.keep(d.Dir)
+	return d, nil
+}
+
+// checksumFetch is a download of the published checksums running in the background.
+type checksumFetch struct {
+	// asset is the asset the checksums are for, if it could be selected.
+	asset    *release.Asset
+	assetURL string
+	done     chan struct{}
+	info     *checksum.Info
+	err      error
+}
+
+// wait returns the checksums once they are downloaded.
+func (f *checksumFetch) wait() (*checksum.Info, error) {
+	<-f.done
+	return f.info, f.err
+}
+
+// prefetchChecksums starts downloading the checksums of the asset for the
+// platform, so that they are downloaded while the asset is. cancel is called
+// if they can't be downloaded and the checksum policy requires them, which
+// aborts the asset download early. It returns nil if the checksums aren't
+// needed, or can't be downloaded before the asset is selected.
+func (u *upgrader) prefetchChecksums(ctx context.Context, cancel context.CancelFunc, assets []release.Asset) (*checksumFetch, error) {
+	if u.checksumPolicy == ChecksumSkip {
+		return nil, nil
+	}
+	f := &checksumFetch{done: make(chan struct{})}
+	if selector, ok := u.assetDownloader.(asset.Selector); ok {
+		a, err := selector.SelectAsset(ctx, assets)
+		if err != nil {
+			return nil, err
+		}
+		f.asset = &a
+	}
+	if _, ok := u.checksumDownloader.(checksum.AssetDownloader); ok {
+		if f.asset == nil {
+			return nil, nil
+		}
+		f.assetURL = f.asset.BrowserDownloadURL
+	}
+	go func() {
+		defer close(f.done)
+		f.info, f.err = u.downloadChecksums(ctx, assets, f.assetURL)
+		if f.err != nil && !u.missingChecksumsAllowed(f.err) {
+			cancel()
+		}
+	}()
+	return f, nil
+}
+
+// confirmChecksums waits for the checksums before the asset is downloaded,
+// see WithChecksumsFirst. It returns assets with the published checksum set
+// as the digest of the selected asset, which the asset downloader compares
+// with the digest reported by the server.
+func (u *upgrader) confirmChecksums(f *checksumFetch, assets []release.Asset) ([]release.Asset, error) {
+	info, err := f.wait()
+	if err != nil && !u.missingChecksumsAllowed(err) {
+		return nil, err
+	}
+	finder, ok := u.checksumValidator.(checksum.ExpectedFinder)
+	if info == nil || f.asset == nil || !ok {
+		return assets, nil
+	}
+	name := assetName(*f.asset)
+	expected, ok := finder.ExpectedCheckSum(name, filepath.Base(u.executablePath), info)
+	if !ok {
+		// verifyChecksum reports the missing checksum
+		return assets, nil
+	}
+	if published, ok := strings.CutPrefix(f.asset.Digest, "sha256:"); ok && published != "" && !strings.EqualFold(published, expected) {
+		return nil, &ChecksumMismatchError{Asset: name, Expected: expected, Actual: published}
+	}
+	assets = slices.Clone(assets)
+	for i, a := range assets {
+		if a.BrowserDownloadURL == f.asset.BrowserDownloadURL {
+			assets[i].Digest = "sha256:" + expected
+		}
+	}
+	return assets, nil
+}
+
+// downloadChecksums downloads the published checksums, limited to the asset
+// at assetURL if the checksum downloader supports it.
+func (u *upgrader) downloadChecksums(ctx context.Context, assets []release.Asset, assetURL string) (*checksum.Info, error) {
+	var info *checksum.Info
+	err := inPhase(ctx, "checksum download", u.timeouts.Checksum, func(ctx context.Context) error {
+		var err error
+		if cd, ok := u.checksumDownloader.(checksum.AssetDownloader); ok {
+			info, err = cd.DownloadForAsset(ctx, assets, assetURL)
+		} else {
+			info, err = u.checksumDownloader.Download(ctx, assets)
+		}
+		return err
+	})
+	return info, err
+}
+
+// verifyChecksum verifies downloadInfo against the checksums returned by
+// load, according to the checksum policy.
+func (u *upgrader) verifyChecksum(ctx context.Context, load func() (*checksum.Info, error), downloadInfo *asset.Info) (bool, error) {
+	if u.checksumPolicy == ChecksumSkip {
+		return false, fmt.Errorf("%w: checksum verification is disabled", ErrChecksumNotVerified)
+	}
+
+	checksumInfo, err := load()
+	if u.missingChecksumsAllowed(err) {
+		return false, fmt.Errorf("%w: %w", ErrChecksumNotVerified, err)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	executableName := filepath.Base(u.executablePath)
+	// verify the checksum
+	if v, ok := u.checksumValidator.(checksum.Verifier); ok {
+		err := v.Validate(ctx, downloadInfo.Name, executableName, checksumInfo, downloadInfo.Checksum)
+		var invalid *checksum.ValidationError
+		if errors.As(err, &invalid) {
+			return false, &ChecksumMismatchError{
+				Asset:     downloadInfo.Name,
+				Expected:  invalid.Expected,
+				Actual:    downloadInfo.Checksum,
+				Key:       invalid.Key,
+				LookedUp:  invalid.LookedUp,
+				Available: invalid.Available,
+				Err:       invalid,
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	var valid bool
+	if v, ok := u.checksumValidator.(checksum.AssetValidator); ok {
+		valid = v.IsAssetCheckSumValid(ctx, downloadInfo.Name, executableName, checksumInfo, downloadInfo.Checksum)
+	} else {
+		valid = u.checksumValidator.IsCheckSumValid(ctx, executableName, checksumInfo, downloadInfo.Checksum)
+	}
+	if !valid {
+		mismatch := &ChecksumMismatchError{Asset: downloadInfo.Name, Actual: downloadInfo.Checksum}
+		if f, ok := u.checksumValidator.(checksum.ExpectedFinder); ok {
+			mismatch.Expected, _ = f.ExpectedCheckSum(downloadInfo.Name, executableName, checksumInfo)
+		}
+		return false, mismatch
+	}
+	return true, nil
+}
+
+// stage moves the extracted binaries into a dedicated directory that
+// outlives the download. The directory is tracked in temps until the
+// update is handed over.
+func (u *upgrader) stage(temps *tempFiles, update *Update, installPath string, extracted map[string]string) (*DownloadedUpdate, error) {
+	dir, err := u.newStageDir()
+	if err != nil {
+		return nil, err
+	}
+	temps.add(dir)
+
+	d := &DownloadedUpdate{
+		Update:         update,
+		ExecutablePath: installPath,
+		Dir:            dir,
+		Binaries:       make(map[string]string, len(extracted)),
+		BinarySHA256:   make(map[string]string, len(extracted)),
+	}
+	primary := filepath.Base(u.executablePath)
+	installDir := filepath.Dir(installPath)
+	for name, p := range extracted {
+		if _, ok := u.archiveFile(name); ok {
+			continue
+		}
+		staged := filepath.Join(dir, name)
+		if err := moveFile(p, staged); err != nil {
+			return nil, fmt.Errorf("failed to stage %s: %w", name, err)
+		}
+		digest, err := fileSHA256(staged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", name, err)
+		}
+		dst := filepath.Join(installDir, name)
+		if name == primary {
+			dst = installPath
+		}
+		d.Binaries[dst] = staged
+		d.BinarySHA256[staged] = digest
+	}
+	for i, f := range u.archiveFiles {
+		p, ok := extracted[f.Path]
+		if !ok {
+			continue
+		}
+		staged, dst, err := stageFile(dir, installDir, i, f, p)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := fileSHA256(staged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", f.Path, err)
+		}
+		if d.Files == nil {
+			d.Files = make(map[string]string, len(u.archiveFiles))
+		}
+		d.Files[dst] = staged
+		d.BinarySHA256[staged] = digest
+	}
+	return d, nil
+}
+
+// describeDownload records what was downloaded for d in result.
+func describeDownload(d *DownloadedUpdate, result *UpgradeResult) {
+	result.PreviousVersion = d.Update.CurrentVersion
+	result.NewVersion = d.Update.CurrentVersion
+	result.TargetVersion = d.Update.LatestVersion
+	result.AssetURL = d.URL
+	result.BuiltFrom = d.BuiltFrom
+	result.Checksum = d.Checksum
+	result.BytesDownloaded = d.Size
+	result.ChecksumVerified = d.Verified
+	result.BinaryChecksumsVerified = d.BinariesVerified
+	result.BinaryChecksums = make(map[string]string, len(d.Binaries))
+	for dst, p := range d.Binaries {
+		result.BinaryChecksums[dst] = d.BinarySHA256[p]
+	}
+	result.Warnings = append(result.Warnings, d.Warnings...)
+}
+
+func (u *upgrader) apply(ctx context.Context, d *DownloadedUpdate, result *UpgradeResult) error {
+	describeDownload(d, result)
+	if err := u.checkSlots(); err != nil {
+		return err
+	}
+
+	staged := make([]string, 0, len(d.Binaries)+len(d.Files)+1)
+	for _, p := range d.Binaries {
+		staged = append(staged, p)
+	}
+	for _, p := range d.Files {
+		staged = append(staged, p)
+	}
+	if d.Installer != "" {
+		staged = append(staged, d.Installer)
+	}
+	for _, p := range staged {
+		digest, err := fileSHA256(p)
+		if err != nil {
+			return fmt.Errorf("failed to read staged binary: %w", err)
+		}
+		if digest != d.BinarySHA256[p] {
+			return fmt.Errorf("%w: %s", ErrStagedBinaryModified, p)
+		}
+	}
+
+	if err := u.prepareForGatekeeper(ctx, d.Binaries); err != nil {
+		return err
+	}
+
+	from, to := d.Update.CurrentVersion, d.Update.LatestVersion
+	// the versioned layout and slots only manage the executable, an Install
+	// to another path just replaces the binary there
+	managed := d.ExecutablePath == u.executablePath
+	var rcpt *receipt.Upgrade
+	if tempFile := d.Binaries[d.ExecutablePath]; u.receiptSigner != nil && tempFile != "" {
+		var err error
+		if rcpt, err = newReceipt(d.ExecutablePath, tempFile, from, to, d.URL, d.Checksum, d.Verified, d.Verifiers); err != nil {
+			return err
+		}
+	}
+
+	if d.Installer != "" {
+		if err := u.runInstaller(ctx, d); err != nil {
+			return err
+		}
+	} else if err := inPhase(ctx, "replacement", u.timeouts.Replace, func(ctx context.Context) error {
+		// archive files get their Mode rather than the one of the file they replace
+		ownMode := make(map[string]bool, len(d.Files))
+		for dst := range d.Files {
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+				return fmt.Errorf("failed to create dir for %s: %w", dst, err)
+			}
+			ownMode[dst] = true
+		}
+		if u.layout != nil && managed {
+			if err := u.layout.install(ctx, from, to, d.Binaries); err != nil {
+				return err
+			}
+			return replaceFiles(ctx, d.Files, ownMode)
+		}
+		if u.slots != nil && managed {
+			if err := u.slots.install(ctx, from, to, d.Binaries); err != nil {
+				return err
+			}
+			return replaceFiles(ctx, d.Files, ownMode)
+		}
+		return replaceFiles(ctx, mergeFiles(d.Binaries, d.Files), ownMode)
+	}); err != nil {
+		return fmt.Errorf("%w: %w", ErrReplaceFailed, err)
+	}
+	result.Upgraded = true
+	result.NewVersion = to
+	if managed {
+		if err := u.Prune(ctx); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Errorf("failed to prune old versions: %w", err))
+		}
+	}
+
+	if rcpt != nil {
+		if err := u.recordReceipt(ctx, rcpt); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Errorf("upgraded to %s but failed to record receipt: %w", to, err))
+		}
+	}
+
+	env := HookEnv{FromVersion: from, ToVersion: to, BinaryPath: d.ExecutablePath}
+	for _, phase := range []HookPhase{Migration, PostUpgrade} {
+		if err := u.runPhase(ctx, result, phase, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeFiles returns the destinations of binaries and files in one map, so
+// that they are replaced all-or-nothing.
+func mergeFiles(binaries, files map[string]string) map[string]string {
+	if len(files) == 0 {
+		return binaries
+	}
+	all := maps.Clone(binaries)
+	maps.Copy(all, files)
+	return all
+}
@@ -0,0 +1,652 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/pkgmgr"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/trust"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReleaseGetter struct {
+	info *release.Info
+}
+
+func (f *fakeReleaseGetter) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	return f.info, nil
+}
+
+func (f *fakeReleaseGetter) GetReleaseByTag(ctx context.Context, tag string) (*release.Info, error) {
+	if tag != f.info.TagName {
+		return nil, release.ErrReleaseNotFound
+	}
+	return f.info, nil
+}
+
+// newTestUpgrader returns an upgrader for an installed "savvy" binary that
+// upgrades from a test server serving a release for the current platform.
+func newTestUpgrader(t *testing.T, tag string, files map[string]string, opts ...Opt) (*upgrader, string) {
+	t.Helper()
+	return newPlatformTestUpgrader(t, runtime.GOOS, runtime.GOARCH, tag, files, opts...)
+}
+
+// newPlatformTestUpgrader is like newTestUpgrader, but the release is for goos/goarch.
+func newPlatformTestUpgrader(t *testing.T, goos, goarch, tag string, files map[string]string, opts ...Opt) (*upgrader, string) {
+	t.Helper()
+	arPath := writeTarGz(t, files)
+	archive, err := os.ReadFile(arPath)
+	require.NoError(t, err)
+	sum := sha256.Sum256(archive)
+
+	assetName := fmt.Sprintf("savvy_%s_%s.tar.gz", goos, goarch)
+	checksums := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), assetName)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + assetName:
+			w.Write(archive)
+		case "/checksums.txt":
+			w.Write([]byte(checksums))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+
+	opts = append([]Opt{WithAllowManagedInstall()}, opts...)
+	u := NewUpgrader("getsavvyinc", "savvy-cli", executablePath, opts...).(*upgrader)
+	u.releaseGetter = &fakeReleaseGetter{info: &release.Info{
+		TagName: tag,
+		Assets: []release.Asset{
+			{Name: assetName, BrowserDownloadURL: srv.URL + "/" + assetName, Size: int64(len(archive))},
+			{Name: "checksums.txt", BrowserDownloadURL: srv.URL + "/checksums.txt"},
+		},
+	}}
+	return u, executablePath
+}
+
+func readFile(t *testing.T, p string) string {
+	t.Helper()
+	content, err := os.ReadFile(p)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestStagedUpgrade(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+	assert.Equal(t, "v0.2.0", update.LatestVersion)
+
+	d, err := u.Download(ctx, update)
+	require.NoError(t, err)
+	assert.Equal(t, "old", readFile(t, executablePath))
+
+	// the handle survives a round trip, e.g. through a file read on restart
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	var resumed DownloadedUpdate
+	require.NoError(t, json.Unmarshal(data, &resumed))
+
+	_, err = u.Apply(ctx, &resumed)
+	require.NoError(t, err)
+	assert.Equal(t, "new", readFile(t, executablePath))
+	assert.NoDirExists(t, d.Dir)
+}
+
+func TestApplyRejectsModifiedBinary(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	d, err := u.Download(ctx, update)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(d.Binaries[executablePath], []byte("evil"), 0o755))
+	_, err = u.Apply(ctx, d)
+	assert.ErrorIs(t, err, ErrStagedBinaryModified)
+	assert.Equal(t, "old", readFile(t, executablePath))
+}
+
+func TestApplyRejectsInvalidUpdate(t *testing.T) {
+	ctx := context.Background()
+	for name, edit := range map[string]func(d *DownloadedUpdate, dir string){
+		"Destination": func(d *DownloadedUpdate, dir string) {
+			staged := d.Binaries[d.ExecutablePath]
+			delete(d.Binaries, d.ExecutablePath)
+			d.Binaries[filepath.Join(dir, "bashrc")] = staged
+		},
+		"ExecutablePath": func(d *DownloadedUpdate, dir string) {
+			staged := d.Binaries[d.ExecutablePath]
+			d.ExecutablePath = filepath.Join(dir, "other")
+			d.Binaries = map[string]string{d.ExecutablePath: staged}
+		},
+		"OutsideDir": func(d *DownloadedUpdate, dir string) {
+			p := filepath.Join(dir, "elsewhere")
+			d.BinarySHA256[p] = d.BinarySHA256[d.Binaries[d.ExecutablePath]]
+			d.Binaries[d.ExecutablePath] = p
+		},
+		"Installer": func(d *DownloadedUpdate, dir string) {
+			d.Installer = d.Binaries[d.ExecutablePath]
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+			update, err := u.Check(ctx, "0.1.0")
+			require.NoError(t, err)
+			d, err := u.Download(ctx, update)
+			require.NoError(t, err)
+
+			edit(d, filepath.Dir(executablePath))
+			_, err = u.Apply(ctx, d)
+			assert.ErrorIs(t, err, ErrInvalidUpdate)
+			assert.Equal(t, "old", readFile(t, executablePath))
+		})
+	}
+}
+
+func TestApplyLeavesForeignDir(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+
+	_, err := u.Apply(ctx, nil)
+	assert.ErrorIs(t, err, ErrInvalidUpdate)
+
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	d, err := u.Download(ctx, update)
+	require.NoError(t, err)
+
+	// a handle pointing at a directory the upgrader didn't stage is
+	// rejected without touching that directory
+	foreign := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(foreign, "keep"), []byte("keep"), 0o644))
+	d.Dir = foreign
+	_, err = u.Apply(ctx, d)
+	assert.ErrorIs(t, err, ErrInvalidUpdate)
+	assert.FileExists(t, filepath.Join(foreign, "keep"))
+	require.NoError(t, u.Abort(d))
+	assert.FileExists(t, filepath.Join(foreign, "keep"))
+	assert.Equal(t, "old", readFile(t, executablePath))
+}
+
+func TestRosettaNative(t *testing.T) {
+	orig := isTranslated
+	t.Cleanup(func() { isTranslated = orig })
+	isTranslated = func() bool { return true }
+
+	u, executablePath := newPlatformTestUpgrader(t, "darwin", "arm64", "v0.2.0", map[string]string{"savvy": "native"}, WithRosettaPolicy(RosettaNative))
+	result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "native", readFile(t, executablePath))
+
+	// without the policy, the translated binary keeps its own architecture
+	u, _ = newPlatformTestUpgrader(t, "darwin", "arm64", "v0.2.0", map[string]string{"savvy": "native"})
+	_, err = u.UpgradeWithResult(context.Background(), "0.1.0")
+	assert.ErrorIs(t, err, ErrNoAsset)
+}
+
+func TestDownloadWithoutUpdate(t *testing.T) {
+	u, _ := newTestUpgrader(t, "v0.1.0", map[string]string{"savvy": "new"})
+	update, err := u.Check(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.False(t, update.Available)
+	_, err = u.Download(context.Background(), update)
+	assert.ErrorIs(t, err, ErrAlreadyUpToDate)
+}
+
+// fakeBrew is a Homebrew upgrader whose formula is at version.
+type fakeBrew struct {
+	version string
+}
+
+func (b *fakeBrew) Upgrade(ctx context.Context, formula string) error {
+	return nil
+}
+
+func (b *fakeBrew) InstalledVersion(ctx context.Context, formula string) (string, error) {
+	return b.version, nil
+}
+
+// brewDetector reports every executable as installed with Homebrew.
+type brewDetector struct{}
+
+func (brewDetector) Detect(ctx context.Context, executablePath string) (pkgmgr.Manager, error) {
+	return pkgmgr.Homebrew, nil
+}
+
+func TestHomebrewFallback(t *testing.T) {
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithPackageManagerDetector(brewDetector{}))
+	u.allowManaged = false
+
+	// the formula lags behind the release
+	u.brewUpgrader = &fakeBrew{version: "0.1.5"}
+	result, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, pkgmgr.Homebrew, result.PackageManager)
+	assert.Equal(t, "0.1.5", result.NewVersion)
+	require.Len(t, result.Warnings, 1)
+	assert.ErrorContains(t, result.Warnings[0], "not the latest release v0.2.0")
+
+	u.brewUpgrader = &fakeBrew{version: "0.2.0"}
+	result, err = u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "0.2.0", result.NewVersion)
+	assert.Empty(t, result.Warnings)
+}
+
+func TestDownloadWithoutRelease(t *testing.T) {
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+	update := &Update{CurrentVersion: "0.1.0", LatestVersion: "v0.2.0", Available: true}
+	_, err := u.Download(context.Background(), update)
+	assert.ErrorIs(t, err, ErrInvalidUpdate)
+}
+
+func TestInstall(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+	dest := filepath.Join(t.TempDir(), "bin", "savvy-dev")
+
+	_, err := u.Install(ctx, "v0.2.0", dest)
+	require.NoError(t, err)
+	assert.Equal(t, "new", readFile(t, dest))
+	assert.Equal(t, "old", readFile(t, executablePath))
+
+	_, err = u.Install(ctx, "v9.9.9", dest)
+	assert.ErrorIs(t, err, release.ErrReleaseNotFound)
+}
+
+func TestUpgradeWithResult(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Upgraded", func(t *testing.T) {
+		u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.Equal(t, "0.1.0", result.PreviousVersion)
+		assert.Equal(t, "v0.2.0", result.NewVersion)
+		assert.Contains(t, result.AssetURL, "savvy_"+runtime.GOOS)
+		assert.NotEmpty(t, result.Checksum)
+		assert.Positive(t, result.BytesDownloaded)
+		assert.Positive(t, result.Duration)
+		assert.True(t, result.ChecksumVerified)
+		assert.Empty(t, result.Warnings)
+	})
+	t.Run("AlreadyLatest", func(t *testing.T) {
+		u, _ := newTestUpgrader(t, "v0.1.0", map[string]string{"savvy": "new"})
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.False(t, result.Upgraded)
+		assert.Equal(t, "0.1.0", result.NewVersion)
+
+		assert.ErrorIs(t, u.Upgrade(ctx, "0.1.0"), ErrAlreadyUpToDate)
+	})
+}
+
+type rejectingValidator struct{}
+
+func (rejectingValidator) IsCheckSumValid(context.Context, string, *checksum.Info, string) bool {
+	return false
+}
+
+func TestChecksumPolicy(t *testing.T) {
+	ctx := context.Background()
+	// newWithoutChecksums returns an upgrader for a release that doesn't publish checksums.
+	newWithoutChecksums := func(t *testing.T, opts ...Opt) *upgrader {
+		u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, opts...)
+		info := u.releaseGetter.(*fakeReleaseGetter).info
+		info.Assets = info.Assets[:1]
+		return u
+	}
+
+	t.Run("Require", func(t *testing.T) {
+		u := newWithoutChecksums(t)
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, checksum.ErrNoCheckSumAsset)
+		assert.False(t, result.Upgraded)
+	})
+	t.Run("Warn", func(t *testing.T) {
+		u := newWithoutChecksums(t, WithChecksumPolicy(ChecksumWarn))
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.False(t, result.ChecksumVerified)
+		require.Len(t, result.Warnings, 1)
+		assert.ErrorIs(t, result.Warnings[0], ErrChecksumNotVerified)
+		assert.ErrorIs(t, result.Warnings[0], checksum.ErrNoCheckSumAsset)
+	})
+	t.Run("WarnMismatch", func(t *testing.T) {
+		u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithChecksumPolicy(ChecksumWarn), WithCheckSumValidator(rejectingValidator{}))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrInvalidCheckSum)
+	})
+	t.Run("Skip", func(t *testing.T) {
+		u := newWithoutChecksums(t, WithChecksumPolicy(ChecksumSkip))
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.False(t, result.ChecksumVerified)
+		require.Len(t, result.Warnings, 1)
+		assert.ErrorIs(t, result.Warnings[0], ErrChecksumNotVerified)
+	})
+}
+
+func TestTrustStoreRejectsUnsignedAsset(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	key, err := trust.ParseCosignKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithTrustStore(trust.NewStore(key)))
+	_, err = u.UpgradeWithResult(context.Background(), "0.1.0")
+	assert.ErrorIs(t, err, ErrUntrustedAsset)
+	assert.ErrorIs(t, err, trust.ErrUnsigned)
+	assert.Equal(t, "old", readFile(t, executablePath))
+}
+
+// staticChecksums is a checksum.Downloader returning fixed checksums.
+type staticChecksums struct {
+	info *checksum.Info
+}
+
+func (s staticChecksums) Download(context.Context, []release.Asset) (*checksum.Info, error) {
+	return s.info, nil
+}
+
+func TestChecksumMismatchError(t *testing.T) {
+	assetName := fmt.Sprintf("savvy_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	info := &checksum.Info{Files: map[string]string{assetName: "deadbeef"}}
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithCheckSumDownloader(staticChecksums{info}))
+
+	_, err := u.UpgradeWithResult(context.Background(), "0.1.0")
+	var mismatch *ChecksumMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	assert.ErrorIs(t, err, ErrInvalidCheckSum)
+	assert.Equal(t, assetName, mismatch.Asset)
+	assert.Equal(t, "deadbeef", mismatch.Expected)
+	assert.ErrorIs(t, err, checksum.ErrMismatch)
+	assert.NotEmpty(t, mismatch.Actual)
+	assert.Equal(t, "old", readFile(t, executablePath))
+
+	// the checksums don't list the asset
+	info.Files = map[string]string{"savvy_plan9_386.tar.gz": "deadbeef"}
+	_, err = u.UpgradeWithResult(context.Background(), "0.1.0")
+	require.ErrorAs(t, err, &mismatch)
+	assert.Empty(t, mismatch.Expected)
+	assert.Equal(t, assetName, mismatch.LookedUp[0])
+	assert.Equal(t, []string{"savvy_plan9_386.tar.gz"}, mismatch.Available)
+	assert.ErrorContains(t, err, "the checksums list savvy_plan9_386.tar.gz")
+	assert.ErrorIs(t, err, checksum.ErrNoEntry)
+	assert.NotErrorIs(t, err, checksum.ErrMismatch)
+}
+
+func TestStreamedDownload(t *testing.T) {
+	ctx := context.Background()
+	workDir := t.TempDir()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithWorkDir(workDir))
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+
+	info, extracted, err := u.streamAsset(ctx, update.Release.Assets)
+	require.NoError(t, err)
+	require.NotNil(t, info, "tar.gz assets are extracted while downloading")
+	assert.Empty(t, info.DownloadedBinaryFilePath)
+	require.Len(t, extracted, 1)
+	assert.Equal(t, "new", readFile(t, extracted["savvy"]))
+	removeAll(extracted)
+
+	// the extracted binaries are discarded if the checksum doesn't match
+	assetName := fmt.Sprintf("savvy_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	WithCheckSumDownloader(staticChecksums{&checksum.Info{Files: map[string]string{assetName: "deadbeef"}}})(u)
+	_, err = u.UpgradeWithResult(ctx, "0.1.0")
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Equal(t, "old", readFile(t, executablePath))
+	entries, err := os.ReadDir(workDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// fetchAssets returns the content of the assets of info, keyed on their name.
+func fetchAssets(t *testing.T, info *release.Info) map[string][]byte {
+	t.Helper()
+	content := make(map[string][]byte, len(info.Assets))
+	for _, a := range info.Assets {
+		resp, err := http.Get(a.BrowserDownloadURL)
+		require.NoError(t, err)
+		content[a.Name], err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+	}
+	return content
+}
+
+func TestConcurrentChecksumDownload(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+	info := u.releaseGetter.(*fakeReleaseGetter).info
+	content := fetchAssets(t, info)
+
+	// serve serves the assets, but the asset only once the checksums are requested
+	serve := func(checksumsStatus int) {
+		checksumsRequested := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := path.Base(r.URL.Path)
+			if name == "checksums.txt" {
+				close(checksumsRequested)
+				w.WriteHeader(checksumsStatus)
+				w.Write(content[name])
+				return
+			}
+			select {
+			case <-checksumsRequested:
+				w.Write(content[name])
+			case <-r.Context().Done():
+			}
+		}))
+		t.Cleanup(srv.Close)
+		for i, a := range info.Assets {
+			info.Assets[i].BrowserDownloadURL = srv.URL + "/" + a.Name
+		}
+	}
+
+	serve(http.StatusOK)
+	result, err := u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.ChecksumVerified)
+	assert.Equal(t, "new", readFile(t, executablePath))
+
+	// unavailable checksums abort the download
+	serve(http.StatusNotFound)
+	_, err = u.UpgradeWithResult(ctx, "0.1.0")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestChecksumsFirst(t *testing.T) {
+	ctx := context.Background()
+	const wrongDigest = "0000000000000000000000000000000000000000000000000000000000000000"
+
+	t.Run("APIDigest", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithChecksumsFirst(),
+			WithCheckSumDownloader(checksum.NewCheckSumDownloader(checksum.WithoutDigests())))
+		u.releaseGetter.(*fakeReleaseGetter).info.Assets[0].Digest = "sha256:" + wrongDigest
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		var mismatch *ChecksumMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, wrongDigest, mismatch.Actual)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("DigestHeader", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithChecksumsFirst())
+		info := u.releaseGetter.(*fakeReleaseGetter).info
+		content := fetchAssets(t, info)
+		var assetRequests atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := path.Base(r.URL.Path)
+			if name != "checksums.txt" {
+				assetRequests.Add(1)
+				w.Header().Set("X-Checksum-Sha256", wrongDigest)
+			}
+			w.Write(content[name])
+		}))
+		t.Cleanup(srv.Close)
+		for i, a := range info.Assets {
+			info.Assets[i].BrowserDownloadURL = srv.URL + "/" + a.Name
+		}
+
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		var mismatch *ChecksumMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, wrongDigest, mismatch.Actual)
+		assert.Equal(t, "old", readFile(t, executablePath))
+		assert.Equal(t, int32(1), assetRequests.Load())
+	})
+}
+
+func TestTagPrefix(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "cli/v0.2.0", map[string]string{"savvy": "new"}, WithTagPrefix("cli/"))
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+	assert.Equal(t, "v0.2.0", update.LatestVersion)
+
+	result, err := u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", result.NewVersion)
+	assert.Equal(t, "new", readFile(t, executablePath))
+}
+
+func TestReleaseGetter(t *testing.T) {
+	getter := &fakeReleaseGetter{info: &release.Info{TagName: "v0.2.0"}}
+	u := NewUpgrader("getsavvyinc", "savvy-cli", "savvy", WithReleaseGetter(getter), WithGitHubBaseURL("http://github.invalid")).(*upgrader)
+	update, err := u.Check(context.Background(), "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+	assert.Same(t, getter.info, update.Release)
+}
+
+func TestWorkDir(t *testing.T) {
+	ctx := context.Background()
+	workDir := filepath.Join(t.TempDir(), "work")
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithWorkDir(workDir))
+
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	d, err := u.Download(ctx, update)
+	require.NoError(t, err)
+	assert.Equal(t, workDir, filepath.Dir(d.Dir))
+	entries, err := os.ReadDir(workDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "only the staging dir is left")
+
+	_, err = u.Apply(ctx, d)
+	require.NoError(t, err)
+	assert.Equal(t, "new", readFile(t, executablePath))
+	entries, err = os.ReadDir(workDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// countingChecksums is a checksum.Downloader counting its downloads.
+type countingChecksums struct {
+	checksum.Downloader
+	n int
+}
+
+func (c *countingChecksums) Download(ctx context.Context, assets []release.Asset) (*checksum.Info, error) {
+	c.n++
+	return c.Downloader.Download(ctx, assets)
+}
+
+func TestDownloadCache(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithDownloadCache(cacheDir))
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+
+	d, err := u.Download(ctx, update)
+	require.NoError(t, err)
+	require.NoError(t, d.Discard())
+	cached, ok := u.downloadCachePath("v0.2.0", d.Checksum, u.releaseGetter.(*fakeReleaseGetter).info.Assets[0].Name)
+	require.True(t, ok)
+	assert.FileExists(t, cached)
+
+	// the asset can't be downloaded anymore, but is cached
+	archive := &u.releaseGetter.(*fakeReleaseGetter).info.Assets[0]
+	downloadURL := archive.BrowserDownloadURL
+	dir, file := path.Split(downloadURL)
+	archive.BrowserDownloadURL = dir + "gone/" + file
+	checksums := &countingChecksums{Downloader: u.checksumDownloader}
+	u.checksumDownloader = checksums
+	err = u.Upgrade(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "new", readFile(t, executablePath))
+	assert.FileExists(t, cached, "the cached asset is kept")
+	assert.Equal(t, 1, checksums.n, "the checksums are only downloaded once")
+
+	// corrupted entries aren't used
+	require.NoError(t, os.WriteFile(cached, []byte("corrupted"), 0o644))
+	d, err = u.Download(ctx, update)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, d)
+	assert.NoFileExists(t, cached)
+
+	archive.BrowserDownloadURL = downloadURL
+	d, err = u.Download(ctx, update)
+	require.NoError(t, err)
+	require.NoError(t, d.Discard())
+	assert.FileExists(t, cached)
+
+	_, ok = u.downloadCachePath("../v0.2.0", d.Checksum, "savvy.tar.gz")
+	assert.True(t, ok, "tags are escaped")
+	_, ok = u.downloadCachePath("..", d.Checksum, "savvy.tar.gz")
+	assert.False(t, ok)
+}
+
+func TestAssetFilter(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"},
+		WithAssetFilter(nil, regexp.MustCompile(`-(debug|fips|pgo)_`)))
+	// the variant would be picked first, and can't be downloaded
+	variant := fmt.Sprintf("savvy-debug_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	info := u.releaseGetter.(*fakeReleaseGetter).info
+	info.Assets = append([]release.Asset{{Name: variant, BrowserDownloadURL: "http://127.0.0.1:0/" + variant}}, info.Assets...)
+
+	result, err := u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "new", readFile(t, executablePath))
+}
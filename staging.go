@@ -0,0 +1,126 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrStaleUpdate is returned by Commit when the installed executable changed
+// after the update was staged, e.g. because another process upgraded it.
+var ErrStaleUpdate = errors.New("installed executable changed since the update was staged")
+
+// WithStagingDir stages downloaded updates in dir instead of the work
+// directory, see WithWorkDir. Updates staged by DownloadAndVerify may wait
+// there for a long time before they are committed, and temp directories
+// are cleaned up periodically on many systems. A directory on the same
+// filesystem as the executable also lets Commit move the binaries into
+// place without copying. dir is created if it doesn't exist.
+func WithStagingDir(dir string) Opt {
+	return func(u *upgrader) {
+		u.stagingDir = dir
+	}
+}
+
+// TwoPhaseUpgrader is implemented by the Upgrader NewUpgrader returns. Its
+// methods split an upgrade in two phases, e.g. to download in the
+// background and swap the binaries on shutdown.
+type TwoPhaseUpgrader interface {
+	// DownloadAndVerify checks for, downloads, verifies and stages the latest release.
+	DownloadAndVerify(ctx context.Context, currentVersion string) (*DownloadedUpdate, error)
+	// Commit installs a staged update, unless the installed executable changed since.
+	Commit(ctx context.Context, d *DownloadedUpdate) (*UpgradeResult, error)
+	// Abort discards a staged update.
+	Abort(d *DownloadedUpdate) error
+}
+
+var _ TwoPhaseUpgrader = (*upgrader)(nil)
+
+// DownloadAndVerify downloads, verifies and stages the latest release, so
+// that it can be installed with Commit at a safe moment, e.g. when the
+// program shuts down, or discarded with Abort. It returns
+// ErrAlreadyUpToDate if currentVersion is the latest version.
+func (u *upgrader) DownloadAndVerify(ctx context.Context, currentVersion string) (*DownloadedUpdate, error) {
+	update, err := u.Check(ctx, currentVersion)
+	if err != nil {
+		return nil, err
+	}
+	return u.Download(ctx, update)
+}
+
+// Commit installs an update staged by DownloadAndVerify or Download, like
+// Apply. It fails with ErrStaleUpdate if the installed executable changed
+// since the update was staged, and discards the update then.
+func (u *upgrader) Commit(ctx context.Context, d *DownloadedUpdate) (*UpgradeResult, error) {
+	return u.applyUpdate(ctx, d, true)
+}
+
+// Abort discards an update staged by DownloadAndVerify or Download without
+// installing it. Directories the upgrader doesn't stage updates in are left
+// alone.
+func (u *upgrader) Abort(d *DownloadedUpdate) error {
+	if d == nil || !u.ownsStageDir(d.Dir) {
+		return nil
+	}
+	return d.Discard()
+}
+
+// newStageDir creates the directory an update is staged in.
+func (u *upgrader) newStageDir() (string, error) {
+	parent := u.workDir
+	if u.stagingDir != "" {
+		if err := os.MkdirAll(u.stagingDir, 0o700); err != nil {
+			return "", fmt.Errorf("failed to create staging dir: %w", err)
+		}
+		parent = u.stagingDir
+	}
+	dir, err := os.MkdirTemp(parent, filepath.Base(u.executablePath)+"-update-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging dir: %w", err)
+	}
+	return dir, nil
+}
+
+// moveFile moves src to dst, copying it if they are on different filesystems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(src, dst, fi.Mode().Perm()); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// installedDigest returns the sha256 digest of the executable at path, or
+// "" if it isn't installed yet.
+func installedDigest(path string) (string, error) {
+	digest, err := fileSHA256(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return digest, err
+}
+
+// checkStale returns ErrStaleUpdate if the executable d is installed over
+// changed since d was staged.
+func checkStale(d *DownloadedUpdate) error {
+	if d.InstalledSHA256 == "" {
+		return nil
+	}
+	digest, err := installedDigest(d.ExecutablePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", d.ExecutablePath, err)
+	}
+	if digest != d.InstalledSHA256 {
+		return fmt.Errorf("%w: %s", ErrStaleUpdate, d.ExecutablePath)
+	}
+	return nil
+}
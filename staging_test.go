@@ -0,0 +1,56 @@
+package upgrade
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoPhaseUpgrade(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Commit", func(t *testing.T) {
+		stagingDir := filepath.Join(t.TempDir(), "staging")
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithStagingDir(stagingDir))
+		d, err := u.DownloadAndVerify(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.Equal(t, stagingDir, filepath.Dir(d.Dir))
+		assert.True(t, d.Verified)
+		assert.Equal(t, "old", readFile(t, executablePath))
+
+		result, err := u.Commit(ctx, d)
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		assert.Equal(t, "new", readFile(t, executablePath))
+		assert.NoDirExists(t, d.Dir)
+	})
+	t.Run("Abort", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+		d, err := u.DownloadAndVerify(ctx, "0.1.0")
+		require.NoError(t, err)
+		require.NoError(t, u.Abort(d))
+		assert.NoDirExists(t, d.Dir)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("Stale", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"})
+		d, err := u.DownloadAndVerify(ctx, "0.1.0")
+		require.NoError(t, err)
+
+		// another process upgraded the executable in the meantime
+		require.NoError(t, os.WriteFile(executablePath, []byte("newer"), 0o755))
+		_, err = u.Commit(ctx, d)
+		assert.ErrorIs(t, err, ErrStaleUpdate)
+		assert.Equal(t, "newer", readFile(t, executablePath))
+		assert.NoDirExists(t, d.Dir)
+	})
+	t.Run("UpToDate", func(t *testing.T) {
+		u, _ := newTestUpgrader(t, "v0.1.0", map[string]string{"savvy": "new"})
+		_, err := u.DownloadAndVerify(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrAlreadyUpToDate)
+	})
+}
@@ -0,0 +1,123 @@
+package state
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+// ErrTampered is returned when the state doesn't match its signature, or a
+// backup doesn't match the digest recorded for it.
+var ErrTampered = errors.New("state was modified outside the upgrader")
+
+type signedStore struct {
+	store Store
+	key   []byte
+}
+
+var _ Store = (*signedStore)(nil)
+
+// NewSignedStore returns a Store that signs the state it saves to store with
+// an HMAC-SHA256 keyed with key, and refuses to load state whose signature
+// doesn't match with ErrTampered, so that neither a broken disk nor a local
+// attacker can silently change it, e.g. to swap the binary a backup points at.
+// The latter only holds if the key can't be read by whoever can write the
+// state, e.g. because it lives in a file only root can read.
+func NewSignedStore(store Store, key []byte) Store {
+	return &signedStore{store: store, key: key}
+}
+
+func (s *signedStore) Load(ctx context.Context) (*State, error) {
+	st, err := s.store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mac := st.MAC
+	st.MAC = ""
+	if mac == "" && reflect.DeepEqual(st, &State{}) {
+		// nothing was stored yet
+		return st, nil
+	}
+	expected, err := Sign(s.key, st)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	if !hmac.Equal([]byte(mac), []byte(expected)) {
+		return nil, fmt.Errorf("%w: the signature doesn't match", ErrTampered)
+	}
+	return st, nil
+}
+
+func (s *signedStore) Save(ctx context.Context, st *State) error {
+	signed := *st
+	signed.MAC = ""
+	mac, err := Sign(s.key, &signed)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	signed.MAC = mac
+	return s.store.Save(ctx, &signed)
+}
+
+// Sign returns the hex HMAC-SHA256, keyed with key, of the JSON encoding of
+// v, whose own signature must be unset. It signs the State saved by
+// NewSignedStore, and the state files of the upgrader's install layouts.
+func Sign(key []byte, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewBackup returns a Backup of the binary at path, recording its digest.
+func NewBackup(version, path string) (Backup, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to stat backup %s: %w", path, err)
+	}
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return Backup{}, err
+	}
+	return Backup{Version: version, Path: path, CreatedAt: fi.ModTime(), SHA256: digest}, nil
+}
+
+// Verify checks that the backed up binary still matches the digest recorded
+// for it. Restore a backup only if it does.
+func (b Backup) Verify() error {
+	if b.SHA256 == "" {
+		return fmt.Errorf("no digest recorded for backup %s", b.Path)
+	}
+	digest, err := fileSHA256(b.Path)
+	if err != nil {
+		return err
+	}
+	if digest != b.SHA256 {
+		return fmt.Errorf("%w: backup %s changed", ErrTampered, b.Path)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex sha256 digest of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,193 @@
+// Package state persists upgrader state, such as backups and user preferences, between runs.
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// State is the upgrader state persisted between runs.
+type State struct {
+	// SkippedVersions are versions the user explicitly declined.
+	SkippedVersions []string `json:"skipped_versions,omitempty"`
+	// SnoozedUntil is when the user wants to be reminded of updates again.
+	SnoozedUntil time.Time `json:"snoozed_until"`
+	// NotifiedVersion is the latest version the user was notified of.
+	NotifiedVersion string `json:"notified_version,omitempty"`
+	// Backups are previous binaries kept around for rollback.
+	Backups []Backup `json:"backups,omitempty"`
+	// AutoUpgrade is the state of the auto-upgrade loop.
+	AutoUpgrade *AutoUpgrade `json:"auto_upgrade,omitempty"`
+	// Channel is the release channel the install follows, e.g. "beta".
+	Channel string `json:"channel,omitempty"`
+	// MAC is the signature of the state, see NewSignedStore.
+	MAC string `json:"mac,omitempty"`
+}
+
+// AutoUpgrade is the state of the auto-upgrade loop, kept so that restarts
+// don't reset its interval or backoff.
+type AutoUpgrade struct {
+	LastCheck   time.Time `json:"last_check,omitempty"`
+	LastUpgrade time.Time `json:"last_upgrade,omitempty"`
+	// NextAttempt is when to check for updates next.
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	// Failures counts the attempts that failed in a row.
+	Failures  int    `json:"failures,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Backup is a previous binary kept around for rollback.
+type Backup struct {
+	// Version is the version of the backed up binary, if known.
+	Version   string    `json:"version,omitempty"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	// SHA256 is the digest of the backed up binary, see Verify.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// IsSkipped reports whether version was skipped by the user.
+func (s *State) IsSkipped(version string) bool {
+	return slices.Contains(s.SkippedVersions, version)
+}
+
+// IsSnoozed reports whether the user snoozed updates at t.
+func (s *State) IsSnoozed(t time.Time) bool {
+	return t.Before(s.SnoozedUntil)
+}
+
+// Merge adds skipped versions and backups from other that aren't already
+// present in s, and keeps the later snooze.
+func (s *State) Merge(other *State) {
+	if other == nil {
+		return
+	}
+	if other.SnoozedUntil.After(s.SnoozedUntil) {
+		s.SnoozedUntil = other.SnoozedUntil
+	}
+	if s.NotifiedVersion == "" {
+		s.NotifiedVersion = other.NotifiedVersion
+	}
+	if s.Channel == "" {
+		s.Channel = other.Channel
+	}
+	for _, v := range other.SkippedVersions {
+		if !s.IsSkipped(v) {
+			s.SkippedVersions = append(s.SkippedVersions, v)
+		}
+	}
+	for _, b := range other.Backups {
+		if !slices.ContainsFunc(s.Backups, func(e Backup) bool { return e.Path == b.Path }) {
+			s.Backups = append(s.Backups, b)
+		}
+	}
+}
+
+// SkipVersion records in store that the user declined version.
+func SkipVersion(ctx context.Context, store Store, version string) error {
+	return update(ctx, store, func(s *State) {
+		if !s.IsSkipped(version) {
+			s.SkippedVersions = append(s.SkippedVersions, version)
+		}
+	})
+}
+
+// Snooze records in store that the user doesn't want to be reminded of updates until t.
+func Snooze(ctx context.Context, store Store, t time.Time) error {
+	return update(ctx, store, func(s *State) {
+		s.SnoozedUntil = t
+	})
+}
+
+// SetNotified records in store that the user was notified of version.
+func SetNotified(ctx context.Context, store Store, version string) error {
+	return update(ctx, store, func(s *State) {
+		s.NotifiedVersion = version
+	})
+}
+
+// SetChannel records in store that the install follows channel.
+func SetChannel(ctx context.Context, store Store, channel string) error {
+	return update(ctx, store, func(s *State) {
+		s.Channel = channel
+	})
+}
+
+// update applies fn to the state in store.
+func update(ctx context.Context, store Store, fn func(*State)) error {
+	s, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	fn(s)
+	return store.Save(ctx, s)
+}
+
+type Store interface {
+	// Load returns the stored state or an empty state if nothing was stored yet.
+	Load(ctx context.Context) (*State, error)
+	Save(ctx context.Context, s *State) error
+}
+
+type fileStore struct {
+	path string
+}
+
+var _ Store = (*fileStore)(nil)
+
+// NewFileStore returns a Store that keeps the state as JSON in the file at path.
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+func (f *fileStore) Load(ctx context.Context) (*State, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", f.path, err)
+	}
+	return &s, nil
+}
+
+func (f *fileStore) Save(ctx context.Context, s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+
+	// write to a temp file in the same directory so the rename is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path))
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package state
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "nested", "state.json"))
+
+	t.Run("LoadMissing", func(t *testing.T) {
+		s, err := store.Load(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, s.SkippedVersions)
+		assert.Empty(t, s.Backups)
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		want := &State{
+			SkippedVersions: []string{"1.2.3"},
+			Backups:         []Backup{{Version: "1.2.2", Path: "/tmp/savvy.old", CreatedAt: time.Unix(100, 0).UTC()}},
+		}
+		require.NoError(t, store.Save(ctx, want))
+		got, err := store.Load(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestMerge(t *testing.T) {
+	s := &State{
+		SkippedVersions: []string{"1.0.0"},
+		Backups:         []Backup{{Path: "/a"}},
+	}
+	s.Merge(&State{
+		SkippedVersions: []string{"1.0.0", "1.1.0"},
+		Backups:         []Backup{{Path: "/a"}, {Path: "/b"}},
+		Channel:         "beta",
+	})
+	assert.Equal(t, []string{"1.0.0", "1.1.0"}, s.SkippedVersions)
+	assert.Equal(t, []Backup{{Path: "/a"}, {Path: "/b"}}, s.Backups)
+	assert.Equal(t, "beta", s.Channel)
+}
+
+func TestSkipAndSnooze(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	require.NoError(t, SkipVersion(ctx, store, "1.2.0"))
+	require.NoError(t, SkipVersion(ctx, store, "1.2.0"))
+	until := time.Now().Add(24 * time.Hour)
+	require.NoError(t, Snooze(ctx, store, until))
+
+	s, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.2.0"}, s.SkippedVersions)
+	assert.True(t, s.IsSnoozed(time.Now()))
+	assert.False(t, s.IsSnoozed(until.Add(time.Second)))
+}
+
+func TestSignedStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewSignedStore(NewFileStore(path), []byte("secret"))
+
+	s, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, s.Backups)
+
+	backupPath := filepath.Join(t.TempDir(), "savvy.old")
+	require.NoError(t, os.WriteFile(backupPath, []byte("old"), 0o755))
+	b, err := NewBackup("1.2.2", backupPath)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, &State{Backups: []Backup{b}}))
+	s, err = store.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, s.Backups, 1)
+	require.NoError(t, s.Backups[0].Verify())
+	_, err = NewSignedStore(NewFileStore(path), []byte("other")).Load(ctx)
+	assert.ErrorIs(t, err, ErrTampered)
+
+	// the backup was swapped
+	require.NoError(t, os.WriteFile(backupPath, []byte("evil"), 0o755))
+	assert.ErrorIs(t, s.Backups[0].Verify(), ErrTampered)
+
+	// the state was edited to point at another binary
+	unsigned, err := NewFileStore(path).Load(ctx)
+	require.NoError(t, err)
+	unsigned.Backups[0].Path = "/tmp/evil"
+	require.NoError(t, NewFileStore(path).Save(ctx, unsigned))
+	_, err = store.Load(ctx)
+	assert.ErrorIs(t, err, ErrTampered)
+}
@@ -0,0 +1,45 @@
+package upgrade
+
+import (
+	"os"
+	"slices"
+)
+
+// tempFiles tracks the intermediate files of an update, e.g. the downloaded
+// asset and the binaries extracted from it. The pipeline removes them once
+// it returns, so no path out of it, including failures and cancellation,
+// leaves them behind. Files handed over to the caller, e.g. the staging
+// directory, are kept.
+type tempFiles struct {
+	paths []string
+}
+
+// add tracks paths, which may be files or directories.
+func (t *tempFiles) add(paths ...string) {
+	for _, p := range paths {
+		if p != "" {
+			t.paths = append(t.paths, p)
+		}
+	}
+}
+
+// addAll tracks the files extracted from an archive.
+func (t *tempFiles) addAll(extracted map[string]string) {
+	for _, p := range extracted {
+		t.add(p)
+	}
+}
+
+// keep stops tracking p, so that removeAll doesn't remove it.
+func (t *tempFiles) keep(p string) {
+	t.paths = slices.DeleteFunc(t.paths, func(q string) bool { return q == p })
+}
+
+// removeAll removes every tracked file that wasn't kept. Files that were
+// moved away in the meantime are ignored.
+func (t *tempFiles) removeAll() {
+	for _, p := range t.paths {
+		os.RemoveAll(p)
+	}
+	t.paths = nil
+}
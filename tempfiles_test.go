@@ -0,0 +1,56 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailedUpgradeLeavesNoTempFiles(t *testing.T) {
+	errSmokeTest := errors.New("smoke test failed")
+	failingSmokeTest := WithHooks(SmokeTest, Hook{Name: "smoke", Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+		return errSmokeTest
+	}})
+
+	// the upgrade is canceled while the new binary is smoke tested
+	var cancelUpgrade context.CancelFunc
+	canceling := WithHooks(SmokeTest, Hook{Name: "cancel", Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+		cancelUpgrade()
+		return ctx.Err()
+	}})
+
+	testCases := []struct {
+		name  string
+		files map[string]string
+		opts  []Opt
+	}{
+		{name: "MissingBinary", files: map[string]string{"other": "new"}},
+		{name: "SmokeTest", files: map[string]string{"savvy": "new"}, opts: []Opt{failingSmokeTest}},
+		{name: "Downloaded", files: map[string]string{"savvy": "new"}, opts: []Opt{failingSmokeTest, WithDownloadCache(t.TempDir())}},
+		{name: "Canceled", files: map[string]string{"savvy": "new"}, opts: []Opt{canceling}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			workDir := filepath.Join(t.TempDir(), "work")
+			opts := append([]Opt{WithWorkDir(workDir)}, tc.opts...)
+			u, executablePath := newTestUpgrader(t, "v0.2.0", tc.files, opts...)
+
+			var ctx context.Context
+			ctx, cancelUpgrade = context.WithCancel(context.Background())
+			defer cancelUpgrade()
+			_, err := u.UpgradeWithResult(ctx, "0.1.0")
+			require.Error(t, err)
+			assert.Equal(t, "old", readFile(t, executablePath))
+
+			entries, err := os.ReadDir(workDir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// Timeouts bounds the phases of an upgrade, independently of the context
+// passed by the caller, so that e.g. a stalled download fails instead of
+// hanging an interactive CLI. A zero duration means no timeout.
+type Timeouts struct {
+	// Release bounds each release lookup.
+	Release time.Duration
+	// Checksum bounds the download of the published checksums.
+	Checksum time.Duration
+	// Download bounds the download of the release asset, including its
+	// extraction if it is extracted while downloading.
+	Download time.Duration
+	// Replace bounds writing the new binaries next to the installed ones.
+	// It is checked before the binaries are swapped, so a timeout never
+	// leaves a partial upgrade behind.
+	Replace time.Duration
+}
+
+// ErrTimeout is returned when a phase of an upgrade exceeds its timeout, see WithTimeouts.
+var ErrTimeout = errors.New("timed out")
+
+// WithTimeouts bounds the phases of an upgrade with t. A phase that exceeds
+// its timeout fails with an error wrapping ErrTimeout.
+func WithTimeouts(t Timeouts) Opt {
+	return func(u *upgrader) {
+		u.timeouts = t
+	}
+}
+
+// inPhase runs fn with ctx bounded by d, if d is positive. The error of fn
+// is wrapped with ErrTimeout if the phase timed out, rather than ctx.
+func inPhase(ctx context.Context, phase string, d time.Duration, fn func(ctx context.Context) error) error {
+	if d <= 0 {
+		return fn(ctx)
+	}
+	phaseCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	err := fn(phaseCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(phaseCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s took longer than %s: %w", ErrTimeout, phase, d, err)
+	}
+	return err
+}
+
+// timeoutGetter bounds every release lookup of g.
+type timeoutGetter struct {
+	g         release.Getter
+	d         time.Duration
+	tagPrefix string
+}
+
+func (t *timeoutGetter) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	var info *release.Info
+	err := inPhase(ctx, "release lookup", t.d, func(ctx context.Context) error {
+		var err error
+		info, err = t.g.GetLatestRelease(ctx)
+		return err
+	})
+	return info, err
+}
+
+func (t *timeoutGetter) ListReleases(ctx context.Context, opts release.ListOptions) ([]release.Info, error) {
+	var releases []release.Info
+	err := inPhase(ctx, "release lookup", t.d, func(ctx context.Context) error {
+		var err error
+		releases, err = listReleases(ctx, t.g, opts)
+		return err
+	})
+	return releases, err
+}
+
+func (t *timeoutGetter) GetReleaseByTag(ctx context.Context, tag string) (*release.Info, error) {
+	var info *release.Info
+	err := inPhase(ctx, "release lookup", t.d, func(ctx context.Context) error {
+		var err error
+		info, err = releaseByTag(ctx, t.g, t.tagPrefix, tag)
+		return err
+	})
+	return info, err
+}
@@ -0,0 +1,65 @@
+package upgrade
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stalledGetter blocks until the lookup is canceled.
+type stalledGetter struct{}
+
+func (stalledGetter) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (stalledGetter) GetReleaseByTag(ctx context.Context, tag string) (*release.Info, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestTimeouts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Release", func(t *testing.T) {
+		u := NewUpgrader("getsavvyinc", "savvy-cli", "savvy", WithReleaseGetter(stalledGetter{}), WithTimeouts(Timeouts{Release: 10 * time.Millisecond})).(*upgrader)
+		_, err := u.Check(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrTimeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the caller's own deadline isn't reported as a timeout of the phase
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = u.Check(canceled, "0.1.0")
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrTimeout)
+	})
+	t.Run("Download", func(t *testing.T) {
+		stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		t.Cleanup(stalled.Close)
+
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithTimeouts(Timeouts{Download: 50 * time.Millisecond}))
+		info := u.releaseGetter.(*fakeReleaseGetter).info
+		info.Assets[0].BrowserDownloadURL = stalled.URL + "/" + info.Assets[0].Name
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.ErrorIs(t, err, ErrTimeout)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+	t.Run("Replace", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithTimeouts(Timeouts{Replace: time.Nanosecond}))
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.ErrorIs(t, err, ErrTimeout)
+		assert.ErrorIs(t, err, ErrReplaceFailed)
+		assert.Equal(t, "old", readFile(t, executablePath))
+		assert.NoFileExists(t, executablePath+".new")
+	})
+}
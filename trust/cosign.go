@@ -0,0 +1,74 @@
+package trust
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+type cosignKey struct {
+	id  string
+	pub crypto.PublicKey
+}
+
+var _ Key = (*cosignKey)(nil)
+
+// ParseCosignKey parses a PEM encoded ECDSA, Ed25519 or RSA public key, such
+// as the cosign.pub file written by `cosign generate-key-pair`.
+func ParseCosignKey(data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM public key found", ErrInvalidKey)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, pub)
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return &cosignKey{id: hex.EncodeToString(sum[:]), pub: pub}, nil
+}
+
+func (k *cosignKey) Format() Format {
+	return Cosign
+}
+
+// ID returns the hex encoded sha256 digest of the DER encoded key.
+func (k *cosignKey) ID() string {
+	return k.id
+}
+
+// Verify verifies a signature made with `cosign sign-blob`, which is base64
+// encoded. Raw signatures are accepted as well.
+func (k *cosignKey) Verify(message, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		sig = signature
+	}
+	digest := sha256.Sum256(message)
+	var ok bool
+	switch pub := k.pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, digest[:], sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, message, sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
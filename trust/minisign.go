@@ -0,0 +1,89 @@
+package trust
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+type minisignKey struct {
+	id  [8]byte
+	pub ed25519.PublicKey
+}
+
+var _ Key = (*minisignKey)(nil)
+
+// ParseMinisignKey parses a minisign public key, either the contents of a
+// minisign.pub file or only its base64 encoded key line.
+func ParseMinisignKey(data []byte) (Key, error) {
+	line := lastLine(data)
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, fmt.Errorf("%w: malformed minisign public key", ErrInvalidKey)
+	}
+	k := &minisignKey{pub: ed25519.PublicKey(raw[10:])}
+	copy(k.id[:], raw[2:10])
+	return k, nil
+}
+
+func (k *minisignKey) Format() Format {
+	return Minisign
+}
+
+// ID returns the key ID the way minisign prints it.
+func (k *minisignKey) ID() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(k.id[:]))
+}
+
+// Verify verifies a .minisig file. Both legacy and prehashed signatures are
+// accepted, and the trusted comment must be signed by the same key.
+func (k *minisignKey) Verify(message, signature []byte) error {
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(string(signature), "\r\n", "\n")), "\n")
+	if len(lines) < 4 {
+		return fmt.Errorf("%w: malformed minisign signature", ErrInvalidSignature)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed minisign signature", ErrInvalidSignature)
+	}
+	if !bytes.Equal(sig[2:10], k.id[:]) {
+		return fmt.Errorf("%w: signed by another minisign key", ErrInvalidSignature)
+	}
+
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		sum := blake2b512(message)
+		message = sum[:]
+	default:
+		return fmt.Errorf("%w: unsupported minisign algorithm %q", ErrInvalidSignature, sig[:2])
+	}
+	if !ed25519.Verify(k.pub, message, sig[10:]) {
+		return ErrInvalidSignature
+	}
+
+	comment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return fmt.Errorf("%w: missing minisign trusted comment", ErrInvalidSignature)
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	signed := append(append([]byte{}, sig[10:]...), comment...)
+	if err != nil || !ed25519.Verify(k.pub, signed, globalSig) {
+		return fmt.Errorf("%w: trusted comment doesn't verify", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of data, e.g. the key after an untrusted comment.
+func lastLine(data []byte) string {
+	var last string
+	for _, l := range strings.Split(string(data), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			last = l
+		}
+	}
+	return last
+}
@@ -0,0 +1,82 @@
+package trust
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// rotation is a keys manifest applied to a Store, with its signature.
+type rotation struct {
+	Format    Format `json:"format"`
+	Manifest  []byte `json:"manifest"`
+	Signature []byte `json:"signature"`
+}
+
+// NewPersistentStore returns a Store trusting keys, like NewStore, that
+// records the keys manifests it applies in the file at path and applies the
+// recorded ones again, so that keys revoked by an earlier release stay
+// revoked, e.g. after downgrading to a release that doesn't ship the
+// manifest anymore. The recorded manifests are verified like new ones, so
+// editing the file can't add keys, and it fails if one no longer verifies.
+func NewPersistentStore(path string, keys ...Key) (*Store, error) {
+	s := NewStore(keys...)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+	var rotations []rotation
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &rotations); err != nil {
+			return nil, fmt.Errorf("failed to parse trust store %s: %w", path, err)
+		}
+	}
+	for _, r := range rotations {
+		if err := s.Rotate(r.Format, r.Manifest, r.Signature); err != nil {
+			return nil, fmt.Errorf("trust store %s: %w", path, err)
+		}
+	}
+	s.path = path
+	s.rotations = rotations
+	return s, nil
+}
+
+// record persists the applied rotation r if the store is persistent and
+// hasn't recorded it yet. s.mu must be held.
+func (s *Store) record(r rotation) error {
+	if s.path == "" {
+		return nil
+	}
+	for _, o := range s.rotations {
+		if o.Format == r.Format && bytes.Equal(o.Manifest, r.Manifest) {
+			return nil
+		}
+	}
+	data, err := json.Marshal(append(s.rotations[:len(s.rotations):len(s.rotations)], r))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create trust store dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to persist trust store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist trust store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to persist trust store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to persist trust store: %w", err)
+	}
+	s.rotations = append(s.rotations, r)
+	return nil
+}
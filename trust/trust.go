@@ -0,0 +1,271 @@
+// Package trust verifies release assets against a set of trusted public keys
+// that the upgrading CLI embeds at build time.
+//
+// Signatures are published as release assets next to the signed asset, e.g.
+// "savvy_linux_amd64.tar.gz.minisig". Keys can be rotated by publishing a
+// keys manifest signed by a currently trusted key.
+package trust
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"sync"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// Format is a signature format.
+type Format string
+
+const (
+	// Minisign signatures are published with a ".minisig" suffix.
+	Minisign Format = "minisign"
+	// Cosign signatures made with `cosign sign-blob --key` are published with a ".sig" suffix.
+	Cosign Format = "cosign"
+)
+
+// Suffix returns the suffix of signature assets in format f.
+func (f Format) Suffix() string {
+	switch f {
+	case Minisign:
+		return ".minisig"
+	case Cosign:
+		return ".sig"
+	default:
+		return "." + string(f)
+	}
+}
+
+// Key is a trusted public key. Implement it to support other signature
+// formats, e.g. OpenPGP, which isn't built in since the standard library has
+// no OpenPGP implementation.
+type Key interface {
+	Format() Format
+	// ID identifies the key in a keys manifest.
+	ID() string
+	// Verify returns an error wrapping ErrInvalidSignature unless signature
+	// is a valid signature of message made with the key.
+	Verify(message, signature []byte) error
+}
+
+var (
+	ErrInvalidKey       = errors.New("invalid public key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrUnsigned is returned when an asset has no signature in a trusted format.
+	ErrUnsigned = errors.New("asset is not signed")
+)
+
+// ParseKey parses a public key in format.
+func ParseKey(format Format, data []byte) (Key, error) {
+	switch format {
+	case Minisign:
+		return ParseMinisignKey(data)
+	case Cosign:
+		return ParseCosignKey(data)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidKey, format)
+	}
+}
+
+// ManifestName is the name of the release asset holding the keys manifest.
+// It is signed like any other asset, e.g. "keys.json.minisig".
+const ManifestName = "keys.json"
+
+// Manifest lists the keys that sign releases from now on.
+type Manifest struct {
+	Keys []ManifestKey `json:"keys"`
+	// Revoked lists the IDs of keys that are no longer trusted.
+	Revoked []string `json:"revoked,omitempty"`
+}
+
+// ManifestKey is a public key in a Manifest.
+type ManifestKey struct {
+	Format Format `json:"format"`
+	Key    string `json:"key"`
+}
+
+// Store holds the trusted keys. It is safe for concurrent use.
+type Store struct {
+	mu   sync.Mutex
+	keys []Key
+	// path records the applied manifests, see NewPersistentStore.
+	path      string
+	rotations []rotation
+}
+
+// NewStore returns a Store trusting keys.
+func NewStore(keys ...Key) *Store {
+	return &Store{keys: keys}
+}
+
+// Keys returns the trusted keys.
+func (s *Store) Keys() []Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.keys)
+}
+
+// Verify verifies a signature in format against the trusted keys.
+func (s *Store) Verify(format Format, message, signature []byte) error {
+	_, err := s.VerifyKey(format, message, signature)
+	return err
+}
+
+// VerifyKey is like Verify, but returns the key that verified the signature.
+func (s *Store) VerifyKey(format Format, message, signature []byte) (Key, error) {
+	for _, k := range s.Keys() {
+		if k.Format() == format && k.Verify(message, signature) == nil {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no trusted %s key verifies it", ErrInvalidSignature, format)
+}
+
+// Rotate applies a keys manifest that is signed in format by a trusted key.
+// The keys of the manifest are added and the revoked keys removed. Stores
+// returned by NewPersistentStore record the manifest.
+func (s *Store) Rotate(format Format, manifest, signature []byte) error {
+	if err := s.Verify(format, manifest, signature); err != nil {
+		return fmt.Errorf("untrusted keys manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("invalid keys manifest: %w", err)
+	}
+	added := make([]Key, 0, len(m.Keys))
+	for _, mk := range m.Keys {
+		k, err := ParseKey(mk.Format, []byte(mk.Key))
+		if err != nil {
+			return fmt.Errorf("invalid keys manifest: %w", err)
+		}
+		added = append(added, k)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := s.keys[:0:0]
+	for _, k := range append(s.keys, added...) {
+		if slices.Contains(m.Revoked, k.ID()) || slices.ContainsFunc(keys, func(o Key) bool { return o.ID() == k.ID() }) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	s.keys = keys
+	return s.record(rotation{Format: format, Manifest: manifest, Signature: signature})
+}
+
+// VerifyAsset verifies the release asset called name, downloaded to message,
+// against the signatures published in assets, which are downloaded with
+// client, or http.DefaultClient if client is nil.
+//
+// If the release has a keys manifest signed by a trusted key, it is applied
+// first, so releases can be signed with a rotated key. A manifest that
+// doesn't verify is ignored.
+func (s *Store) VerifyAsset(ctx context.Context, client *http.Client, assets []release.Asset, name string, message []byte) error {
+	_, err := s.VerifyAssetKey(ctx, client, assets, name, message)
+	return err
+}
+
+// VerifyAssetKey is like VerifyAsset, but returns the key that verified the
+// asset's signature.
+func (s *Store) VerifyAssetKey(ctx context.Context, client *http.Client, assets []release.Asset, name string, message []byte) (Key, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	s.rotateFromRelease(ctx, client, assets)
+
+	var errs []error
+	for _, format := range s.formats() {
+		sigURL, ok := findAsset(assets, name+format.Suffix())
+		if !ok {
+			continue
+		}
+		sig, err := fetch(ctx, client, sigURL)
+		if err != nil {
+			// a signature in another format may still verify
+			errs = append(errs, err)
+			continue
+		}
+		k, err := s.VerifyKey(format, message, sig)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return k, nil
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w: no signature found for %s", ErrUnsigned, name)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// rotateFromRelease applies the keys manifest of a release, if any.
+func (s *Store) rotateFromRelease(ctx context.Context, client *http.Client, assets []release.Asset) {
+	manifestURL, ok := findAsset(assets, ManifestName)
+	if !ok {
+		return
+	}
+	for _, format := range s.formats() {
+		sigURL, ok := findAsset(assets, ManifestName+format.Suffix())
+		if !ok {
+			continue
+		}
+		manifest, err := fetch(ctx, client, manifestURL)
+		if err != nil {
+			return
+		}
+		sig, err := fetch(ctx, client, sigURL)
+		if err != nil {
+			return
+		}
+		if s.Rotate(format, manifest, sig) == nil {
+			return
+		}
+	}
+}
+
+// formats returns the formats of the trusted keys.
+func (s *Store) formats() []Format {
+	var formats []Format
+	for _, k := range s.Keys() {
+		if !slices.Contains(formats, k.Format()) {
+			formats = append(formats, k.Format())
+		}
+	}
+	return formats
+}
+
+// findAsset returns the download URL of the asset called name.
+func findAsset(assets []release.Asset, name string) (string, bool) {
+	for _, a := range assets {
+		if a.Name == name || (a.Name == "" && path.Base(a.BrowserDownloadURL) == name) {
+			return a.BrowserDownloadURL, true
+		}
+	}
+	return "", false
+}
+
+// maxFetchSize limits the size of signatures and manifests.
+const maxFetchSize = 1 << 20
+
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := release.CheckResponse(resp); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", path.Base(url), err)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxFetchSize))
+}
@@ -0,0 +1,192 @@
+package trust
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlake2b512(t *testing.T) {
+	testCases := map[string]string{
+		"":                       "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce",
+		"abc":                    "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923",
+		strings.Repeat("a", 128): "fc6c71f688f43ea7d60817478808f3cac753e61571865c95adbc2d9122c943a76b92c2cb1047ef3fe7bf6e436ec1d0a99a9e5b216780bf7fed9d7ca91d3a8f3b",
+		strings.Repeat("a", 129): "55e6e0eb418149a8af92fd9ddc99254781b2f522a131b4f4d984404b71a00e1167b8124d5dcddd4c6977b299392335d6edd303da6d344d74bbef2d38101b232b",
+	}
+	for msg, expected := range testCases {
+		sum := blake2b512([]byte(msg))
+		assert.Equal(t, expected, hex.EncodeToString(sum[:]), "len %d", len(msg))
+	}
+}
+
+// minisigner signs messages in the minisign format.
+type minisigner struct {
+	id   [8]byte
+	priv ed25519.PrivateKey
+	pub  []byte
+}
+
+func newMinisigner(t *testing.T) *minisigner {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	m := &minisigner{priv: priv}
+	_, err = rand.Read(m.id[:])
+	require.NoError(t, err)
+	key := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), m.id[:]...), pub...))
+	m.pub = []byte("untrusted comment: minisign public key\n" + key + "\n")
+	return m
+}
+
+func (m *minisigner) key(t *testing.T) Key {
+	t.Helper()
+	k, err := ParseMinisignKey(m.pub)
+	require.NoError(t, err)
+	return k
+}
+
+func (m *minisigner) sign(msg []byte, prehash bool) []byte {
+	alg := "Ed"
+	if prehash {
+		alg = "ED"
+		sum := blake2b512(msg)
+		msg = sum[:]
+	}
+	sig := ed25519.Sign(m.priv, msg)
+	const comment = "timestamp:1700000000"
+	global := ed25519.Sign(m.priv, append(sig, comment...))
+	line := base64.StdEncoding.EncodeToString(append(append([]byte(alg), m.id[:]...), sig...))
+	return []byte(fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		line, comment, base64.StdEncoding.EncodeToString(global)))
+}
+
+func TestMinisign(t *testing.T) {
+	m := newMinisigner(t)
+	k := m.key(t)
+	msg := []byte("release")
+
+	assert.NoError(t, k.Verify(msg, m.sign(msg, false)))
+	assert.NoError(t, k.Verify(msg, m.sign(msg, true)))
+	assert.ErrorIs(t, k.Verify([]byte("tampered"), m.sign(msg, true)), ErrInvalidSignature)
+	assert.ErrorIs(t, newMinisigner(t).key(t).Verify(msg, m.sign(msg, true)), ErrInvalidSignature)
+
+	tampered := strings.Replace(string(m.sign(msg, true)), "timestamp:", "timestamp:9", 1)
+	assert.ErrorIs(t, k.Verify(msg, []byte(tampered)), ErrInvalidSignature)
+
+	_, err := ParseMinisignKey([]byte("not a key"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestCosign(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	k, err := ParseCosignKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	msg := []byte("release")
+	digest := sha256.Sum256(msg)
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+	require.NoError(t, err)
+
+	assert.NoError(t, k.Verify(msg, []byte(base64.StdEncoding.EncodeToString(sig))))
+	assert.ErrorIs(t, k.Verify([]byte("tampered"), sig), ErrInvalidSignature)
+}
+
+func TestVerifyAssetWithRotation(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := newMinisigner(t), newMinisigner(t)
+	asset := []byte("savvy binary")
+
+	manifest, err := json.Marshal(Manifest{
+		Keys:    []ManifestKey{{Format: Minisign, Key: string(newKey.pub)}},
+		Revoked: []string{oldKey.key(t).ID()},
+	})
+	require.NoError(t, err)
+
+	files := map[string][]byte{
+		"/savvy_linux_amd64.tar.gz.minisig": newKey.sign(asset, true),
+		"/keys.json":                        manifest,
+		"/keys.json.minisig":                oldKey.sign(manifest, true),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	assets := func(names ...string) []release.Asset {
+		var assets []release.Asset
+		for _, name := range names {
+			assets = append(assets, release.Asset{Name: name, BrowserDownloadURL: srv.URL + "/" + name})
+		}
+		return assets
+	}
+
+	t.Run("Unsigned", func(t *testing.T) {
+		s := NewStore(oldKey.key(t))
+		err := s.VerifyAsset(ctx, nil, assets("savvy_linux_amd64.tar.gz"), "savvy_linux_amd64.tar.gz", asset)
+		assert.ErrorIs(t, err, ErrUnsigned)
+	})
+	t.Run("SignedByUntrustedKey", func(t *testing.T) {
+		s := NewStore(oldKey.key(t))
+		err := s.VerifyAsset(ctx, nil, assets("savvy_linux_amd64.tar.gz", "savvy_linux_amd64.tar.gz.minisig"), "savvy_linux_amd64.tar.gz", asset)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+	t.Run("RotatedKey", func(t *testing.T) {
+		s := NewStore(oldKey.key(t))
+		k, err := s.VerifyAssetKey(ctx, nil, assets("savvy_linux_amd64.tar.gz", "savvy_linux_amd64.tar.gz.minisig", "keys.json", "keys.json.minisig"), "savvy_linux_amd64.tar.gz", asset)
+		require.NoError(t, err)
+		assert.Equal(t, newKey.key(t).ID(), k.ID(), "the rotated key signed the asset")
+		require.Len(t, s.Keys(), 1)
+		assert.Equal(t, newKey.key(t).ID(), s.Keys()[0].ID())
+	})
+	t.Run("Persistent", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "trust.json")
+		s, err := NewPersistentStore(path, oldKey.key(t))
+		require.NoError(t, err)
+		require.NoError(t, s.VerifyAsset(ctx, nil, assets("savvy_linux_amd64.tar.gz.minisig", "keys.json", "keys.json.minisig"), "savvy_linux_amd64.tar.gz", asset))
+
+		// the old key stays revoked for releases without the manifest
+		s, err = NewPersistentStore(path, oldKey.key(t))
+		require.NoError(t, err)
+		require.Len(t, s.Keys(), 1)
+		assert.Equal(t, newKey.key(t).ID(), s.Keys()[0].ID())
+
+		other := newMinisigner(t)
+		forged, err := json.Marshal([]rotation{{Format: Minisign, Manifest: manifest, Signature: other.sign(manifest, true)}})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, forged, 0o644))
+		_, err = NewPersistentStore(path, oldKey.key(t))
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+	t.Run("UntrustedManifest", func(t *testing.T) {
+		s := NewStore(newMinisigner(t).key(t))
+		assert.ErrorIs(t, s.Rotate(Minisign, manifest, files["/keys.json.minisig"]), ErrInvalidSignature)
+		assert.Len(t, s.Keys(), 1)
+	})
+}
@@ -0,0 +1,403 @@
+// Package tuf is a minimal client for The Update Framework (TUF).
+//
+// It follows the client workflow of the TUF specification for the top-level
+// roles: root, timestamp, snapshot and targets. Delegated targets aren't
+// supported. Trusted metadata is persisted locally, so a compromised
+// repository can't roll clients back to older metadata or serve targets
+// that aren't listed by the current targets metadata.
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidMetadata  = errors.New("invalid TUF metadata")
+	ErrInvalidSignature = errors.New("invalid TUF metadata signature")
+	// ErrRollback is returned when the repository serves metadata older than the trusted metadata.
+	ErrRollback = errors.New("TUF metadata rollback")
+	// ErrExpired is returned when trusted metadata has expired.
+	ErrExpired      = errors.New("TUF metadata expired")
+	ErrHashMismatch = errors.New("TUF hash mismatch")
+	// ErrUnknownTarget is returned for targets that the targets metadata doesn't list.
+	ErrUnknownTarget = errors.New("unknown TUF target")
+)
+
+// maxMetadataSize limits the size of downloaded metadata.
+const maxMetadataSize = 16 << 20
+
+// maxRootRotations limits how many root versions Update walks through.
+const maxRootRotations = 256
+
+// Client verifies targets against the metadata of a TUF repository.
+// It is safe for concurrent use.
+type Client struct {
+	metadataURL string
+	dir         string
+	client      *http.Client
+	now         func() time.Time
+
+	mu        sync.Mutex
+	root      *Root
+	timestamp *Timestamp
+	snapshot  *Snapshot
+	targets   *Targets
+}
+
+type ClientOpt func(*Client)
+
+// WithHTTPClient sets the client used to download metadata.
+func WithHTTPClient(c *http.Client) ClientOpt {
+	return func(cl *Client) {
+		cl.client = c
+	}
+}
+
+// NewClient returns a client for the repository serving metadata at metadataURL.
+//
+// trustedRoot is the initial root metadata, usually embedded at build time.
+// Newer trusted metadata is persisted in dir and used instead once present.
+func NewClient(metadataURL string, trustedRoot []byte, dir string, opts ...ClientOpt) (*Client, error) {
+	c := &Client{
+		metadataURL: strings.TrimSuffix(metadataURL, "/"),
+		dir:         dir,
+		client:      http.DefaultClient,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "root.json")); err == nil {
+		trustedRoot = data
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read trusted root: %w", err)
+	}
+	var s Signed
+	if err := json.Unmarshal(trustedRoot, &s); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	var root Root
+	if err := json.Unmarshal(s.Signed, &root); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	// the trusted root must be signed by its own root role
+	if err := verifyRole(&s, &root, RoleRoot, &root); err != nil {
+		return nil, err
+	}
+	c.root = &root
+
+	// the remaining trusted metadata only guards against rollbacks, so it is
+	// dropped rather than failing if it no longer verifies
+	c.timestamp = loadTrusted[Timestamp](c, RoleTimestamp)
+	c.snapshot = loadTrusted[Snapshot](c, RoleSnapshot)
+	c.targets = loadTrusted[Targets](c, RoleTargets)
+	return c, nil
+}
+
+// loadTrusted reads the persisted metadata of role, or returns nil.
+func loadTrusted[T any](c *Client, role string) *T {
+	data, err := os.ReadFile(filepath.Join(c.dir, role+".json"))
+	if err != nil {
+		return nil
+	}
+	var s Signed
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil
+	}
+	var v T
+	if err := verifyRole(&s, c.root, role, &v); err != nil {
+		return nil
+	}
+	return &v
+}
+
+// Update refreshes the trusted metadata from the repository.
+func (c *Client) Update(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.updateRoot(ctx); err != nil {
+		return err
+	}
+	if err := c.updateTimestamp(ctx); err != nil {
+		return err
+	}
+	if err := c.updateSnapshot(ctx); err != nil {
+		return err
+	}
+	return c.updateTargets(ctx)
+}
+
+// Target returns the trusted description of the target called name.
+// Update must have been called before.
+func (c *Client) Target(name string) (TargetFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.targets == nil {
+		return TargetFile{}, fmt.Errorf("%w: %s, no trusted targets metadata", ErrUnknownTarget, name)
+	}
+	t, ok := c.targets.Targets[name]
+	if !ok {
+		return TargetFile{}, fmt.Errorf("%w: %s", ErrUnknownTarget, name)
+	}
+	return t, nil
+}
+
+// VerifyTarget checks that the content of r matches the trusted target called name.
+func (c *Client) VerifyTarget(name string, r io.Reader) error {
+	t, err := c.Target(name)
+	if err != nil {
+		return err
+	}
+	if len(t.Hashes) == 0 {
+		return fmt.Errorf("%w: %s lists no hashes", ErrInvalidMetadata, name)
+	}
+	if err := checkHashes(r, t.Length, t.Hashes); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// updateRoot walks through newer root versions, each signed by the previous and its own root role.
+func (c *Client) updateRoot(ctx context.Context) error {
+	for i := 0; i < maxRootRotations; i++ {
+		next := c.root.Version + 1
+		data, err := c.fetch(ctx, fmt.Sprintf("%d.root.json", next))
+		if errors.Is(err, errNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var s Signed
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+		}
+		var root Root
+		if err := verifyRole(&s, c.root, RoleRoot, &root); err != nil {
+			return err
+		}
+		if err := verifyRole(&s, &root, RoleRoot, &root); err != nil {
+			return err
+		}
+		if root.Type != RoleRoot || root.Version != next {
+			return fmt.Errorf("%w: expected root version %d, got %d", ErrRollback, next, root.Version)
+		}
+
+		// metadata signed by rotated keys can't be trusted for rollback checks anymore
+		if !sameRole(c.root, &root, RoleTimestamp) {
+			c.timestamp = nil
+			c.remove(RoleTimestamp)
+		}
+		if !sameRole(c.root, &root, RoleSnapshot) {
+			c.snapshot = nil
+			c.remove(RoleSnapshot)
+		}
+		c.root = &root
+		if err := c.persist(RoleRoot, data); err != nil {
+			return err
+		}
+	}
+	return c.checkExpiry(RoleRoot, c.root.Expires)
+}
+
+func (c *Client) updateTimestamp(ctx context.Context) error {
+	data, err := c.fetch(ctx, "timestamp.json")
+	if err != nil {
+		return err
+	}
+	var ts Timestamp
+	if err := c.verify(data, RoleTimestamp, &ts); err != nil {
+		return err
+	}
+	if c.timestamp != nil {
+		if ts.Version < c.timestamp.Version {
+			return fmt.Errorf("%w: timestamp version %d is older than %d", ErrRollback, ts.Version, c.timestamp.Version)
+		}
+		if ts.Meta["snapshot.json"].Version < c.timestamp.Meta["snapshot.json"].Version {
+			return fmt.Errorf("%w: snapshot version %d is older than %d", ErrRollback, ts.Meta["snapshot.json"].Version, c.timestamp.Meta["snapshot.json"].Version)
+		}
+	}
+	if err := c.checkExpiry(RoleTimestamp, ts.Expires); err != nil {
+		return err
+	}
+	c.timestamp = &ts
+	return c.persist(RoleTimestamp, data)
+}
+
+func (c *Client) updateSnapshot(ctx context.Context) error {
+	meta, ok := c.timestamp.Meta["snapshot.json"]
+	if !ok {
+		return fmt.Errorf("%w: timestamp doesn't list snapshot.json", ErrInvalidMetadata)
+	}
+	data, err := c.fetch(ctx, c.metaName("snapshot.json", meta.Version))
+	if err != nil {
+		return err
+	}
+	if err := checkHashes(bytes.NewReader(data), meta.Length, meta.Hashes); err != nil {
+		return fmt.Errorf("snapshot.json: %w", err)
+	}
+	var snap Snapshot
+	if err := c.verify(data, RoleSnapshot, &snap); err != nil {
+		return err
+	}
+	if snap.Version != meta.Version {
+		return fmt.Errorf("%w: expected snapshot version %d, got %d", ErrRollback, meta.Version, snap.Version)
+	}
+	if c.snapshot != nil {
+		for name, old := range c.snapshot.Meta {
+			if m, ok := snap.Meta[name]; !ok || m.Version < old.Version {
+				return fmt.Errorf("%w: %s version went back from %d", ErrRollback, name, old.Version)
+			}
+		}
+	}
+	if err := c.checkExpiry(RoleSnapshot, snap.Expires); err != nil {
+		return err
+	}
+	c.snapshot = &snap
+	return c.persist(RoleSnapshot, data)
+}
+
+func (c *Client) updateTargets(ctx context.Context) error {
+	meta, ok := c.snapshot.Meta["targets.json"]
+	if !ok {
+		return fmt.Errorf("%w: snapshot doesn't list targets.json", ErrInvalidMetadata)
+	}
+	data, err := c.fetch(ctx, c.metaName("targets.json", meta.Version))
+	if err != nil {
+		return err
+	}
+	if err := checkHashes(bytes.NewReader(data), meta.Length, meta.Hashes); err != nil {
+		return fmt.Errorf("targets.json: %w", err)
+	}
+	var targets Targets
+	if err := c.verify(data, RoleTargets, &targets); err != nil {
+		return err
+	}
+	if targets.Version != meta.Version {
+		return fmt.Errorf("%w: expected targets version %d, got %d", ErrRollback, meta.Version, targets.Version)
+	}
+	if err := c.checkExpiry(RoleTargets, targets.Expires); err != nil {
+		return err
+	}
+	c.targets = &targets
+	return c.persist(RoleTargets, data)
+}
+
+// verify verifies signed metadata of role against the trusted root and checks its type.
+func (c *Client) verify(data []byte, role string, v interface{ roleType() string }) error {
+	var s Signed
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	if err := verifyRole(&s, c.root, role, v); err != nil {
+		return err
+	}
+	if v.roleType() != role {
+		return fmt.Errorf("%w: expected %s metadata, got %q", ErrInvalidMetadata, role, v.roleType())
+	}
+	return nil
+}
+
+func (m *common) roleType() string {
+	return m.Type
+}
+
+// metaName returns the file name of versioned metadata for consistent snapshots.
+func (c *Client) metaName(name string, version int64) string {
+	if c.root.ConsistentSnapshot {
+		return fmt.Sprintf("%d.%s", version, name)
+	}
+	return name
+}
+
+func (c *Client) checkExpiry(role string, expires time.Time) error {
+	if !c.now().Before(expires) {
+		return fmt.Errorf("%w: %s expired at %s", ErrExpired, role, expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// sameRole reports whether role is assigned the same keys in both roots.
+func sameRole(a, b *Root, role string) bool {
+	ra, rb := a.Roles[role], b.Roles[role]
+	if ra.Threshold != rb.Threshold || len(ra.KeyIDs) != len(rb.KeyIDs) {
+		return false
+	}
+	for _, id := range ra.KeyIDs {
+		if !slices.Contains(rb.KeyIDs, id) {
+			return false
+		}
+	}
+	return true
+}
+
+var errNotFound = errors.New("not found")
+
+func (c *Client) fetch(ctx context.Context, name string) ([]byte, error) {
+	url := c.metadataURL + "/" + name
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		return nil, fmt.Errorf("%w: %s", errNotFound, name)
+	default:
+		return nil, fmt.Errorf("failed to download %s: %s", name, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMetadataSize {
+		return nil, fmt.Errorf("%w: %s is too large", ErrInvalidMetadata, name)
+	}
+	return data, nil
+}
+
+// persist atomically writes trusted metadata of role to the local store.
+func (c *Client) persist(role string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create TUF metadata dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.dir, role+".json.tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to persist %s metadata: %w", role, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist %s metadata: %w", role, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to persist %s metadata: %w", role, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, role+".json")); err != nil {
+		return fmt.Errorf("failed to persist %s metadata: %w", role, err)
+	}
+	return nil
+}
+
+func (c *Client) remove(role string) {
+	os.Remove(filepath.Join(c.dir, role+".json"))
+}
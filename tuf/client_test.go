@@ -0,0 +1,190 @@
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRepo is a TUF repository with one ed25519 key per role.
+type testRepo struct {
+	t     *testing.T
+	keys  map[string]ed25519.PrivateKey
+	files map[string][]byte
+	url   string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	r := &testRepo{t: t, keys: map[string]ed25519.PrivateKey{}, files: map[string][]byte{}}
+	for _, role := range []string{RoleRoot, RoleTimestamp, RoleSnapshot, RoleTargets} {
+		r.keys[role] = r.newKey()
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, ok := r.files[strings.TrimPrefix(req.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	r.url = srv.URL
+	return r
+}
+
+func (r *testRepo) newKey() ed25519.PrivateKey {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(r.t, err)
+	return priv
+}
+
+func keyID(priv ed25519.PrivateKey) string {
+	sum := sha256.Sum256(priv.Public().(ed25519.PublicKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// sign signs metadata with keys.
+func (r *testRepo) sign(signed any, keys ...ed25519.PrivateKey) []byte {
+	raw, err := json.Marshal(signed)
+	require.NoError(r.t, err)
+	msg, err := canonicalJSON(raw)
+	require.NoError(r.t, err)
+	s := Signed{Signed: raw}
+	for _, k := range keys {
+		s.Signatures = append(s.Signatures, Signature{KeyID: keyID(k), Sig: hex.EncodeToString(ed25519.Sign(k, msg))})
+	}
+	data, err := json.Marshal(s)
+	require.NoError(r.t, err)
+	return data
+}
+
+var expires = time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+// root returns root metadata for the current keys, signed by signers.
+func (r *testRepo) root(version int64, signers ...ed25519.PrivateKey) []byte {
+	root := Root{
+		common: common{Type: RoleRoot, Version: version, Expires: expires},
+		Keys:   map[string]Key{},
+		Roles:  map[string]Role{},
+	}
+	for role, priv := range r.keys {
+		var k Key
+		k.KeyType, k.Scheme = "ed25519", "ed25519"
+		k.KeyVal.Public = hex.EncodeToString(priv.Public().(ed25519.PublicKey))
+		root.Keys[keyID(priv)] = k
+		root.Roles[role] = Role{KeyIDs: []string{keyID(priv)}, Threshold: 1}
+	}
+	return r.sign(root, signers...)
+}
+
+// publish publishes version of the timestamp, snapshot and targets metadata.
+func (r *testRepo) publish(version int64, targets map[string][]byte) {
+	tm := Targets{common: common{Type: RoleTargets, Version: version, Expires: expires}, Targets: map[string]TargetFile{}}
+	for name, data := range targets {
+		sum := sha256.Sum256(data)
+		tm.Targets[name] = TargetFile{Length: int64(len(data)), Hashes: map[string]string{"sha256": hex.EncodeToString(sum[:])}}
+	}
+	r.files["targets.json"] = r.sign(tm, r.keys[RoleTargets])
+	snap := Snapshot{
+		common: common{Type: RoleSnapshot, Version: version, Expires: expires},
+		Meta:   map[string]MetaFile{"targets.json": {Version: version}},
+	}
+	r.files["snapshot.json"] = r.sign(snap, r.keys[RoleSnapshot])
+	sum := sha256.Sum256(r.files["snapshot.json"])
+	ts := Timestamp{
+		common: common{Type: RoleTimestamp, Version: version, Expires: expires},
+		Meta: map[string]MetaFile{"snapshot.json": {
+			Version: version,
+			Length:  int64(len(r.files["snapshot.json"])),
+			Hashes:  map[string]string{"sha256": hex.EncodeToString(sum[:])},
+		}},
+	}
+	r.files["timestamp.json"] = r.sign(ts, r.keys[RoleTimestamp])
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	trustedRoot := repo.root(1, repo.keys[RoleRoot])
+	asset := []byte("savvy v0.2.0")
+	repo.publish(2, map[string][]byte{"savvy_linux_amd64.tar.gz": asset})
+
+	dir := t.TempDir()
+	c, err := NewClient(repo.url, trustedRoot, dir)
+	require.NoError(t, err)
+	require.NoError(t, c.Update(ctx))
+
+	t.Run("VerifyTarget", func(t *testing.T) {
+		assert.NoError(t, c.VerifyTarget("savvy_linux_amd64.tar.gz", bytes.NewReader(asset)))
+		assert.ErrorIs(t, c.VerifyTarget("savvy_linux_amd64.tar.gz", strings.NewReader("tampered")), ErrHashMismatch)
+		assert.ErrorIs(t, c.VerifyTarget("savvy_linux_arm64.tar.gz", bytes.NewReader(asset)), ErrUnknownTarget)
+	})
+	t.Run("Rollback", func(t *testing.T) {
+		current := map[string][]byte{}
+		for name, data := range repo.files {
+			current[name] = data
+		}
+		repo.publish(1, map[string][]byte{"savvy_linux_amd64.tar.gz": []byte("savvy v0.1.0")})
+		t.Cleanup(func() { repo.files = current })
+
+		assert.ErrorIs(t, c.Update(ctx), ErrRollback)
+		// the trusted versions survive restarts
+		restarted, err := NewClient(repo.url, trustedRoot, dir)
+		require.NoError(t, err)
+		assert.ErrorIs(t, restarted.Update(ctx), ErrRollback)
+	})
+	t.Run("Expired", func(t *testing.T) {
+		expired, err := NewClient(repo.url, trustedRoot, t.TempDir())
+		require.NoError(t, err)
+		expired.now = func() time.Time { return expires.Add(time.Second) }
+		assert.ErrorIs(t, expired.Update(ctx), ErrExpired)
+	})
+	t.Run("UntrustedSigner", func(t *testing.T) {
+		other := newTestRepo(t)
+		other.publish(3, nil)
+		repo.files["timestamp.json"] = other.files["timestamp.json"]
+		t.Cleanup(func() { repo.publish(2, map[string][]byte{"savvy_linux_amd64.tar.gz": asset}) })
+		assert.ErrorIs(t, c.Update(ctx), ErrInvalidSignature)
+	})
+}
+
+func TestClientRootRotation(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepo(t)
+	trustedRoot := repo.root(1, repo.keys[RoleRoot])
+
+	// rotate the root and timestamp keys
+	oldRoot := repo.keys[RoleRoot]
+	repo.keys[RoleRoot] = repo.newKey()
+	repo.keys[RoleTimestamp] = repo.newKey()
+	repo.files["2.root.json"] = repo.root(2, oldRoot, repo.keys[RoleRoot])
+	repo.publish(1, map[string][]byte{"savvy": []byte("savvy")})
+
+	dir := t.TempDir()
+	c, err := NewClient(repo.url, trustedRoot, dir)
+	require.NoError(t, err)
+	require.NoError(t, c.Update(ctx))
+	assert.NoError(t, c.VerifyTarget("savvy", strings.NewReader("savvy")))
+
+	// a new root must be signed by the previous root keys too
+	repo.files["3.root.json"] = repo.root(3, repo.newKey())
+	assert.ErrorIs(t, c.Update(ctx), ErrInvalidSignature)
+
+	// the rotated root is persisted
+	delete(repo.files, "3.root.json")
+	restarted, err := NewClient(repo.url, trustedRoot, dir)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), restarted.root.Version)
+}
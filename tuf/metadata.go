@@ -0,0 +1,291 @@
+package tuf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Role names.
+const (
+	RoleRoot      = "root"
+	RoleTimestamp = "timestamp"
+	RoleSnapshot  = "snapshot"
+	RoleTargets   = "targets"
+)
+
+// Signed is a signed metadata file.
+type Signed struct {
+	Signatures []Signature     `json:"signatures"`
+	Signed     json.RawMessage `json:"signed"`
+}
+
+// Signature is a signature of the canonical JSON encoding of Signed.Signed.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Key is a public key in root metadata.
+type Key struct {
+	KeyType string `json:"keytype"`
+	Scheme  string `json:"scheme"`
+	KeyVal  struct {
+		Public string `json:"public"`
+	} `json:"keyval"`
+}
+
+// Role lists the keys trusted for a role and how many of them must sign.
+type Role struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// common holds the fields shared by every role.
+type common struct {
+	Type    string    `json:"_type"`
+	Version int64     `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+// Root is the root role metadata.
+type Root struct {
+	common
+	Keys               map[string]Key  `json:"keys"`
+	Roles              map[string]Role `json:"roles"`
+	ConsistentSnapshot bool            `json:"consistent_snapshot"`
+}
+
+// MetaFile describes a metadata file listed by timestamp or snapshot metadata.
+type MetaFile struct {
+	Version int64             `json:"version"`
+	Length  int64             `json:"length,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// Timestamp is the timestamp role metadata.
+type Timestamp struct {
+	common
+	Meta map[string]MetaFile `json:"meta"`
+}
+
+// Snapshot is the snapshot role metadata.
+type Snapshot struct {
+	common
+	Meta map[string]MetaFile `json:"meta"`
+}
+
+// TargetFile describes a target, e.g. a release asset.
+type TargetFile struct {
+	Length int64             `json:"length"`
+	Hashes map[string]string `json:"hashes"`
+	Custom json.RawMessage   `json:"custom,omitempty"`
+}
+
+// Targets is the targets role metadata.
+type Targets struct {
+	common
+	Targets map[string]TargetFile `json:"targets"`
+}
+
+// verifyRole checks that s is signed by at least threshold keys of role and decodes it into v.
+func verifyRole(s *Signed, root *Root, role string, v any) error {
+	r, ok := root.Roles[role]
+	if !ok || r.Threshold < 1 {
+		return fmt.Errorf("%w: root defines no %s role", ErrInvalidMetadata, role)
+	}
+	msg, err := canonicalJSON(s.Signed)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+
+	// valid is keyed on the public keys, so a key listed under several IDs
+	// only counts once towards the threshold
+	valid := map[string]bool{}
+	for _, sig := range s.Signatures {
+		if !slices.Contains(r.KeyIDs, sig.KeyID) {
+			continue
+		}
+		key, ok := root.Keys[sig.KeyID]
+		if !ok || valid[key.KeyVal.Public] {
+			continue
+		}
+		raw, err := hex.DecodeString(sig.Sig)
+		if err != nil {
+			continue
+		}
+		if key.verify(msg, raw) {
+			valid[key.KeyVal.Public] = true
+		}
+	}
+	if len(valid) < r.Threshold {
+		return fmt.Errorf("%w: %s metadata has %d of %d required signatures", ErrInvalidSignature, role, len(valid), r.Threshold)
+	}
+
+	if err := json.Unmarshal(s.Signed, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	return nil
+}
+
+// verify reports whether sig is a valid signature of msg made with k.
+func (k Key) verify(msg, sig []byte) bool {
+	switch k.Scheme {
+	case "ed25519":
+		pub, err := hex.DecodeString(k.KeyVal.Public)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return false
+		}
+		return ed25519.Verify(ed25519.PublicKey(pub), msg, sig)
+	case "ecdsa-sha2-nistp256":
+		pub, ok := k.parsePEM().(*ecdsa.PublicKey)
+		digest := sha256.Sum256(msg)
+		return ok && ecdsa.VerifyASN1(pub, digest[:], sig)
+	case "rsassa-pss-sha256":
+		pub, ok := k.parsePEM().(*rsa.PublicKey)
+		digest := sha256.Sum256(msg)
+		return ok && rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, nil) == nil
+	default:
+		return false
+	}
+}
+
+func (k Key) parsePEM() crypto.PublicKey {
+	block, _ := pem.Decode([]byte(k.KeyVal.Public))
+	if block == nil {
+		return nil
+	}
+	pub, _ := x509.ParsePKIXPublicKey(block.Bytes)
+	return pub
+}
+
+// canonicalJSON re-encodes data as OLPC canonical JSON, which TUF signs:
+// objects have sorted keys, there is no insignificant whitespace, numbers
+// are integers, and strings only escape backslashes and quotes.
+func canonicalJSON(data []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := writeCanonical(&b, v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeCanonical(b *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return fmt.Errorf("canonical JSON has no number %s", v)
+		}
+		b.WriteString(strconv.FormatInt(n, 10))
+	case string:
+		b.WriteByte('"')
+		for i := 0; i < len(v); i++ {
+			if v[i] == '\\' || v[i] == '"' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(v[i])
+		}
+		b.WriteByte('"')
+	case []any:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonical(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonical(b, k); err != nil {
+				return err
+			}
+			b.WriteByte(':')
+			if err := writeCanonical(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("canonical JSON can't encode %T", v)
+	}
+	return nil
+}
+
+// newHash returns the hash for a hash algorithm name used in metadata.
+func newHash(alg string) hash.Hash {
+	switch alg {
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+// checkHashes checks the content of r against length, if set, and the
+// listed hashes. At least one listed hash algorithm must be supported.
+func checkHashes(r io.Reader, length int64, hashes map[string]string) error {
+	hashers := map[string]hash.Hash{}
+	writers := []io.Writer{}
+	for alg := range hashes {
+		if h := newHash(alg); h != nil {
+			hashers[alg] = h
+			writers = append(writers, h)
+		}
+	}
+	if len(hashes) > 0 && len(hashers) == 0 {
+		return fmt.Errorf("%w: no supported hash algorithm", ErrHashMismatch)
+	}
+
+	n, err := io.Copy(io.MultiWriter(writers...), r)
+	if err != nil {
+		return err
+	}
+	if length != 0 && n != length {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrHashMismatch, length, n)
+	}
+	for alg, h := range hashers {
+		if hex.EncodeToString(h.Sum(nil)) != hashes[alg] {
+			return fmt.Errorf("%w: %s mismatch", ErrHashMismatch, alg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package tuf
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	b, err := canonicalJSON([]byte(`{"b": [1, true, null], "a": "x\n\"y\"\\ <é>"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"a\":\"x\n\\\"y\\\"\\\\ <é>\",\"b\":[1,true,null]}", string(b))
+
+	_, err = canonicalJSON([]byte(`{"a": 1.5}`))
+	assert.Error(t, err, "floats aren't canonical")
+}
+
+func TestVerifyRoleThreshold(t *testing.T) {
+	r := newTestRepo(t)
+	priv := r.newKey()
+	var k Key
+	k.KeyType, k.Scheme = "ed25519", "ed25519"
+	k.KeyVal.Public = hex.EncodeToString(priv.Public().(ed25519.PublicKey))
+	// the same key listed under two IDs
+	root := &Root{
+		Keys:  map[string]Key{"a": k, "b": k},
+		Roles: map[string]Role{RoleTargets: {KeyIDs: []string{"a", "b"}, Threshold: 2}},
+	}
+	raw, err := json.Marshal(Targets{common: common{Type: RoleTargets, Version: 1, Expires: expires}})
+	require.NoError(t, err)
+	msg, err := canonicalJSON(raw)
+	require.NoError(t, err)
+	sig := hex.EncodeToString(ed25519.Sign(priv, msg))
+	s := &Signed{Signed: raw, Signatures: []Signature{{KeyID: "a", Sig: sig}, {KeyID: "b", Sig: sig}}}
+
+	assert.ErrorIs(t, verifyRole(s, root, RoleTargets, &Targets{}), ErrInvalidSignature)
+	root.Roles[RoleTargets] = Role{KeyIDs: []string{"a", "b"}, Threshold: 1}
+	assert.NoError(t, verifyRole(s, root, RoleTargets, &Targets{}))
+}
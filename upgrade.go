@@ -1,29 +1,87 @@
 package upgrade
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
 	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
-	"io"
-	"os"
+	"net/http"
+	"net/url"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/journal"
+	"github.com/getsavvyinc/upgrade-cli/paths"
+	"github.com/getsavvyinc/upgrade-cli/pkgmgr"
+	"github.com/getsavvyinc/upgrade-cli/platform"
+	"github.com/getsavvyinc/upgrade-cli/receipt"
 	"github.com/getsavvyinc/upgrade-cli/release"
 	"github.com/getsavvyinc/upgrade-cli/release/asset"
-	"github.com/hashicorp/go-version"
+	"github.com/getsavvyinc/upgrade-cli/state"
+	"github.com/getsavvyinc/upgrade-cli/trust"
+	"github.com/getsavvyinc/upgrade-cli/tuf"
 )
 
 type Upgrader interface {
 	IsNewVersionAvailable(ctx context.Context, currentVersion string) (bool, error)
 	// Upgrade upgrades the current binary to the latest version.
+	// It returns ErrAlreadyUpToDate if currentVersion is the latest version.
 	Upgrade(ctx context.Context, currentVersion string) error
 }
 
+// ResultUpgrader is implemented by the Upgrader NewUpgrader returns.
+type ResultUpgrader interface {
+	// UpgradeWithResult upgrades the current binary to the latest version and describes what happened.
+	// If currentVersion is the latest version, the result has Upgraded set to false and no error is returned.
+	UpgradeWithResult(ctx context.Context, currentVersion string) (*UpgradeResult, error)
+}
+
+var _ ResultUpgrader = (*upgrader)(nil)
+
+// UpgradeResult describes an upgrade.
+type UpgradeResult struct {
+	PreviousVersion string
+	// NewVersion is the version installed after the upgrade. It equals
+	// PreviousVersion if nothing was upgraded, and is empty if the upgrade
+	// was delegated to a package manager that can't report it.
+	NewVersion string
+	// TargetVersion is the version the upgrade tried to install, if it got that far.
+	TargetVersion string
+	// Upgraded is true if the binary was replaced.
+	Upgraded bool
+	// Pending is true if the update was staged to be installed at the next
+	// start instead, see WithApplyOnNextStart.
+	Pending bool
+	// PackageManager is set if the upgrade was delegated to a package manager.
+	PackageManager pkgmgr.Manager
+	// AssetURL is the URL of the downloaded release asset.
+	AssetURL string
+	// BuiltFrom is set if the binary was built with go install instead,
+	// see WithGoInstallFallback.
+	BuiltFrom string
+	// Checksum is the sha256 checksum of the downloaded release asset.
+	Checksum        string
+	BytesDownloaded int64
+	Duration        time.Duration
+	// ChecksumVerified is true if Checksum was verified against the release checksums.
+	ChecksumVerified bool
+	// BinaryChecksums maps the path of each installed binary to its sha256
+	// checksum, so that what got installed can be verified independently.
+	BinaryChecksums map[string]string
+	// BinaryChecksumsVerified is true if BinaryChecksums were verified
+	// against the binary checksums of the release, see WithBinaryChecksums.
+	BinaryChecksumsVerified bool
+	// Hooks are the results of every hook that ran, in order.
+	Hooks []HookResult
+	// Warnings are non-fatal problems, e.g. an unverified checksum with ChecksumWarn.
+	Warnings []error
+}
+
 type upgrader struct {
 	executablePath     string
 	repo               string
@@ -32,12 +90,201 @@ type upgrader struct {
 	assetDownloader    asset.Downloader
 	checksumDownloader checksum.Downloader
 	checksumValidator  checksum.CheckSumValidator
+	pkgDetector        pkgmgr.Detector
+	allowManaged       bool
+	brewUpgrader       pkgmgr.Upgrader
+	brewFormula        string
+	goInstallModule    string
+	receiptSigner      crypto.Signer
+	receiptKeyID       string
+	receiptSinks       []receipt.Sink
+	hooks              map[HookPhase][]Hook
+	binaries           []string
+	entryMatch         EntryMatcher
+	entryMatchers      map[string]EntryMatcher
+	archiveFiles       []ArchiveFile
+	maxRatio           int
+	maxAssetSize       int64
+	deltaUpdates       bool
+	gatekeeper         *Gatekeeper
+	channel            Channel
+	nightly            *Nightly
+	layout             *Layout
+	slots              *Slots
+	retention          *Retention
+	trustStore         *trust.Store
+	tufClient          *tuf.Client
+	baseClient         *http.Client
+	header             http.Header
+	headerHosts        []string
+	userAgent          string
+	tlsConfig          *tls.Config
+	rootCAs            *x509.CertPool
+	pinnedKeys         map[string][]string
+	proxyURL           *url.URL
+	allowedHosts       []string
+	githubBaseURL      string
+	workDir            string
+	applyOnStart       bool
+	stagingDir         string
+	downloadCacheDir   string
+	reexec             bool
+	minVersionAsset    string
+	minVersionURL      string
+	installID          string
+	rolloutAsset       string
+	yankedURL          string
+	schedule           *Schedule
+	journal            *journal.Journal
+	stateStore         state.Store
+	stateKey           []byte
+	httpClient         *http.Client
+	releaseOpts        []release.GetterOpt
+	tagGetter          release.TagGetter
+	feedOpts           []release.FeedOpt
+	releaseFeed        bool
+	tagPrefix          string
+	versionScheme      VersionScheme
+	normalizeVersion   func(string) string
+	timeouts           Timeouts
+	checksumsFirst     bool
+	installer          *Installer
+	archiveChecksums   bool
+	binaryChecksums    string
+	apiAssetDownloads  bool
+	urlRewrites        []urlRewrite
+	metrics            Metrics
+	notifier           Notifier
+	notified           *notifiedVersion
+	webhooks           []Webhook
+	skippedVersions    []string
+	paths              *paths.Paths
+	assetOpts          []asset.AssetDownloadOpt
+	checksumOpts       []checksum.DownloadOpt
+	rosettaPolicy      RosettaPolicy
+	checksumPolicy     ChecksumPolicy
 }
 
 var _ Upgrader = (*upgrader)(nil)
 
 type Opt func(*upgrader)
 
+// WithReleaseGetter looks up releases with g instead of the GitHub releases
+// API, e.g. to upgrade from another release source. All release lookups go
+// through g, so the options configuring the GitHub API and WithReleaseFeed
+// have no effect.
+func WithReleaseGetter(g release.Getter) Opt {
+	return func(u *upgrader) {
+		u.releaseGetter = g
+	}
+}
+
+// WithReleaseCache caches release lookups in dir and revalidates them with
+// conditional requests, which keeps frequent checks within the GitHub API
+// rate limit. It has no effect when combined with WithReleaseGetter.
+func WithReleaseCache(dir string) Opt {
+	return func(u *upgrader) {
+		u.releaseOpts = append(u.releaseOpts, release.WithCache(dir))
+	}
+}
+
+// WithRateLimitWait waits up to max for a GitHub API rate limit to reset
+// instead of failing with ErrRateLimited right away. It has no effect when
+// combined with WithReleaseGetter.
+func WithRateLimitWait(max time.Duration) Opt {
+	return func(u *upgrader) {
+		u.releaseOpts = append(u.releaseOpts, release.WithRateLimitWait(max))
+	}
+}
+
+// WithGitHubAuth authenticates GitHub API calls with the token in the
+// GH_TOKEN or GITHUB_TOKEN environment variables or the credentials stored by
+// the gh CLI, if any. Authenticated calls have a higher rate limit and can see
+// private repositories. It has no effect when combined with WithReleaseGetter.
+func WithGitHubAuth() Opt {
+	return func(u *upgrader) {
+		u.releaseOpts = append(u.releaseOpts, release.WithTokenFromEnvironment())
+	}
+}
+
+// WithCredentialSources authenticates GitHub API calls with the token of the
+// first of sources that has one, e.g. to read it from the netrc file or the
+// OS keychain instead of environment variables:
+//
+//	upgrade.WithCredentialSources(release.NetrcCredentials(""), release.KeychainCredentials("savvy"))
+//
+// Like WithGitHubAuth, requests are sent unauthenticated if GitHub rejects the
+// token. It has no effect when combined with WithReleaseGetter.
+func WithCredentialSources(sources ...release.CredentialSource) Opt {
+	return func(u *upgrader) {
+		u.releaseOpts = append(u.releaseOpts, release.WithCredentialSources(sources...))
+	}
+}
+
+// WithGitHubToken authenticates GitHub API calls with token.
+// It has no effect when combined with WithReleaseGetter.
+func WithGitHubToken(token string) Opt {
+	return func(u *upgrader) {
+		u.releaseOpts = append(u.releaseOpts, release.WithToken(token))
+	}
+}
+
+// WithAPIAssetDownloads downloads release assets through the GitHub API
+// instead of from their browser download URL, authenticated with the token
+// of WithGitHubAuth, WithGitHubToken or WithCredentialSources. This is
+// required to upgrade from private repositories, and works behind proxies
+// that block github.com's download URLs. The token isn't sent to the object
+// store the API redirects to. It has no effect when combined with
+// WithReleaseGetter or WithAssetDownloader.
+func WithAPIAssetDownloads() Opt {
+	return func(u *upgrader) {
+		u.apiAssetDownloads = true
+	}
+}
+
+// WithTagPrefix upgrades from the releases tagged with prefix, e.g. "cli/"
+// for a monorepo that tags releases of several tools as "cli/v1.4.0" and
+// "agent/v2.1.0". Versions are reported without the prefix, and tags passed
+// to Install may omit it. The latest one is looked up among all releases,
+// which are listed page by page.
+func WithTagPrefix(prefix string) Opt {
+	return func(u *upgrader) {
+		u.tagPrefix = prefix
+		u.releaseOpts = append(u.releaseOpts, release.WithTagPrefix(prefix))
+		u.feedOpts = append(u.feedOpts, release.WithFeedTagPrefix(prefix))
+	}
+}
+
+// tagVersion returns the version tag is released as, without the tag prefix.
+func (u *upgrader) tagVersion(tag string) string {
+	return strings.TrimPrefix(tag, u.tagPrefix)
+}
+
+// WithWorkDir downloads, extracts and stages updates in dir instead of the
+// default directory for temporary files, e.g. when /tmp is small or mounted
+// noexec in containers and CI. A directory on the same filesystem as the
+// executable also lets updates be moved into place without copying.
+// dir is created if it doesn't exist.
+func WithWorkDir(dir string) Opt {
+	return func(u *upgrader) {
+		u.workDir = dir
+		u.assetOpts = append(u.assetOpts, asset.WithTempDir(dir))
+	}
+}
+
+// WithReleaseFeed makes IsNewVersionAvailable read the repository's
+// releases.atom feed, which isn't subject to the GitHub API rate limits.
+// If the feed can't be read, the API is used instead. Check and Upgrade
+// always use the API, since the feed has no assets, and so do installs
+// following a channel other than ChannelStable or WithNightly builds. The
+// feed is a GitHub one, so it is ignored with WithReleaseGetter.
+func WithReleaseFeed(opts ...release.FeedOpt) Opt {
+	return func(u *upgrader) {
+		u.releaseFeed = true
+		u.feedOpts = append(u.feedOpts, opts...)
+	}
+}
+
 func WithAssetDownloader(d asset.Downloader) Opt {
 	return func(u *upgrader) {
 		u.assetDownloader = d
@@ -56,237 +303,439 @@ func WithCheckSumValidator(c checksum.CheckSumValidator) Opt {
 	}
 }
 
-func NewUpgrader(owner string, repo string, executablePath string, opts ...Opt) Upgrader {
-	u := &upgrader{
-		repo:               repo,
-		owner:              owner,
-		executablePath:     executablePath,
-		releaseGetter:      release.NewReleaseGetter(repo, owner),
-		assetDownloader:    asset.NewAssetDownloader(executablePath),
-		checksumDownloader: checksum.NewCheckSumDownloader(),
-		checksumValidator:  checksum.NewCheckSumValidator(),
-	}
-	for _, opt := range opts {
-		opt(u)
+// WithAssetMatcher selects the release asset with m instead of matching the
+// "<os>_<arch>" suffix. It has no effect when combined with WithAssetDownloader.
+func WithAssetMatcher(m asset.Matcher) Opt {
+	return func(u *upgrader) {
+		u.assetOpts = append(u.assetOpts, asset.WithMatcher(m))
 	}
-	return u
 }
 
-var ErrInvalidCheckSum = errors.New("invalid checksum")
-
-func (u *upgrader) IsNewVersionAvailable(ctx context.Context, currentVersion string) (bool, error) {
-	curr, err := version.NewVersion(currentVersion)
-	if err != nil {
-		return false, fmt.Errorf("failed to parse current version: %s with err %w", currentVersion, err)
+// WithAssetTemplate selects the release asset whose name matches tmpl, e.g.
+// "{{.Name}}_{{.Version}}_{{.OS}}_{{.Arch}}.tar.gz". See asset.WithTemplate.
+// It has no effect when combined with WithAssetDownloader.
+func WithAssetTemplate(tmpl string) Opt {
+	return func(u *upgrader) {
+		u.assetOpts = append(u.assetOpts, asset.WithTemplate(tmpl))
 	}
+}
 
-	releaseInfo, err := u.releaseGetter.GetLatestRelease(ctx)
-	if err != nil {
-		return false, err
+// WithArchivePreference decides between several release assets for the
+// platform by the earliest of suffixes their name ends with, e.g. ".tar.gz",
+// ".zip". See asset.WithArchivePreference. It has no effect when combined
+// with WithAssetDownloader.
+func WithArchivePreference(suffixes ...string) Opt {
+	return func(u *upgrader) {
+		u.assetOpts = append(u.assetOpts, asset.WithArchivePreference(suffixes...))
 	}
+}
 
-	latest, err := version.NewVersion(releaseInfo.TagName)
-	if err != nil {
-		return false, fmt.Errorf("failed to parse latest version: %s with err %w", releaseInfo.TagName, err)
+// WithAssetFilter only selects release assets whose name include matches and
+// exclude doesn't, e.g. to ignore "-debug", "-fips" or "-pgo" variants.
+// Either may be nil. The filters apply before assets are matched to the
+// platform, and combine with those of other WithAssetFilter options.
+// It has no effect when combined with WithAssetDownloader.
+func WithAssetFilter(include, exclude *regexp.Regexp) Opt {
+	return func(u *upgrader) {
+		if include != nil {
+			u.assetOpts = append(u.assetOpts, asset.WithInclude(include))
+		}
+		if exclude != nil {
+			u.assetOpts = append(u.assetOpts, asset.WithExclude(exclude))
+		}
 	}
+}
 
-	return latest.GreaterThan(curr), nil
+// WithLibc prefers Linux release assets built for libc instead of the detected C library.
+// It has no effect when combined with WithAssetDownloader.
+func WithLibc(libc platform.Libc) Opt {
+	return func(u *upgrader) {
+		u.assetOpts = append(u.assetOpts, asset.WithLibc(libc))
+	}
 }
 
-func (u *upgrader) Upgrade(ctx context.Context, currentVersion string) error {
-	curr, err := version.NewVersion(currentVersion)
-	if err != nil {
-		return err
+// WithGoReleaserMetadata selects the release asset and its checksum from
+// goreleaser's artifacts.json if the release has one, instead of matching
+// asset names. It has no effect when combined with WithAssetDownloader or
+// WithCheckSumDownloader.
+func WithGoReleaserMetadata() Opt {
+	return func(u *upgrader) {
+		u.assetOpts = append(u.assetOpts, asset.WithGoReleaserMetadata())
+		u.checksumOpts = append(u.checksumOpts, checksum.WithGoReleaserMetadata())
 	}
+}
 
-	releaseInfo, err := u.releaseGetter.GetLatestRelease(ctx)
-	if err != nil {
-		return err
+// RosettaPolicy decides which build to upgrade to when an amd64 binary runs
+// under Rosetta 2 on Apple Silicon.
+type RosettaPolicy int
+
+const (
+	// RosettaKeep keeps upgrading to the architecture of the running binary.
+	RosettaKeep RosettaPolicy = iota
+	// RosettaNative switches to the native darwin_arm64 build.
+	RosettaNative
+)
+
+// isTranslated reports whether the process runs under Rosetta 2. It is a
+// variable for tests.
+var isTranslated = platform.IsTranslated
+
+// WithRosettaPolicy sets how upgrades behave under Rosetta 2. The default is RosettaKeep.
+// It has no effect on the asset downloader or checksum validator set with
+// WithAssetDownloader or WithCheckSumValidator.
+func WithRosettaPolicy(p RosettaPolicy) Opt {
+	return func(u *upgrader) {
+		u.rosettaPolicy = p
 	}
+}
 
-	latest, err := version.NewVersion(releaseInfo.TagName)
-	if err != nil {
-		return err
+// ChecksumPolicy decides what happens when a release doesn't publish checksums.
+type ChecksumPolicy int
+
+const (
+	// ChecksumRequire fails the upgrade with checksum.ErrNoCheckSumAsset.
+	ChecksumRequire ChecksumPolicy = iota
+	// ChecksumWarn continues the upgrade and reports an error wrapping
+	// ErrChecksumNotVerified in UpgradeResult.Warnings.
+	ChecksumWarn
+	// ChecksumSkip doesn't download or verify checksums at all.
+	// The skipped verification is reported in UpgradeResult.Warnings.
+	ChecksumSkip
+)
+
+// WithChecksumPolicy sets how releases without checksums are handled. The default is ChecksumRequire.
+// A checksum that doesn't match always fails the upgrade with ErrInvalidCheckSum.
+func WithChecksumPolicy(p ChecksumPolicy) Opt {
+	return func(u *upgrader) {
+		u.checksumPolicy = p
 	}
+}
 
-	if latest.LessThanOrEqual(curr) {
-		return nil
+// WithChecksumsFirst downloads the checksums before the asset, so that a
+// release whose checksums are unavailable fails before any transfer. The
+// published checksum of the asset is then compared with the digest GitHub
+// computed for it, and with the digest the download server reports in the
+// Content-Digest, Digest, X-Checksum-Sha256 or X-Amz-Checksum-Sha256 header,
+// so that a mismatch fails with a *ChecksumMismatchError before the asset is
+// transferred.
+func WithChecksumsFirst() Opt {
+	return func(u *upgrader) {
+		u.checksumsFirst = true
 	}
+}
 
-	// from the releaseInfo, download the binary for the architecture
+// WithPackageManagerDetector overrides how package manager installs are detected.
+func WithPackageManagerDetector(d pkgmgr.Detector) Opt {
+	return func(u *upgrader) {
+		u.pkgDetector = d
+	}
+}
 
-	downloadInfo, cleanup, err := u.assetDownloader.DownloadAsset(ctx, releaseInfo.Assets)
-	if err != nil {
-		return err
+// WithAllowManagedInstall disables the package manager check and replaces the
+// executable even if it is owned by a package manager.
+func WithAllowManagedInstall() Opt {
+	return func(u *upgrader) {
+		u.allowManaged = true
 	}
+}
 
-	if cleanup != nil {
-		defer cleanup()
+// WithHomebrewFallback runs `brew upgrade <formula>` instead of failing with
+// ErrManagedInstall when the executable was installed with Homebrew.
+// If formula is empty, the executable name is used.
+// The result reports the version Homebrew installed, which may be older than
+// the latest release.
+func WithHomebrewFallback(formula string) Opt {
+	return func(u *upgrader) {
+		u.brewUpgrader = pkgmgr.NewHomebrewUpgrader()
+		u.brewFormula = formula
 	}
+}
 
-	// download the checksum file
-	checksumInfo, err := u.checksumDownloader.Download(ctx, releaseInfo.Assets)
-	if err != nil {
-		return err
+// WithBinaries upgrades a set of binaries shipped in the same release archive,
+// e.g. "server", "agent" and "ctl", instead of only the current executable.
+// The binaries live next to the current executable and are replaced all-or-nothing.
+func WithBinaries(names ...string) Opt {
+	return func(u *upgrader) {
+		u.binaries = names
 	}
+}
 
-	executableName := filepath.Base(u.executablePath)
-	// verify the checksum
-	if !u.checksumValidator.IsCheckSumValid(ctx, executableName, checksumInfo, downloadInfo.Checksum) {
-		return ErrInvalidCheckSum
+func NewUpgrader(owner string, repo string, executablePath string, opts ...Opt) Upgrader {
+	u := &upgrader{
+		repo:           repo,
+		owner:          owner,
+		executablePath: executablePath,
+		pkgDetector:    pkgmgr.NewDetector(),
+		metrics:        noMetrics{},
+		maxRatio:       DefaultMaxDecompressionRatio,
+		notified:       &notifiedVersion{},
+	}
+	for _, opt := range opts {
+		opt(u)
 	}
 
-	tempFile, err := tryUnArchive(executableName, downloadInfo.DownloadedBinaryFilePath, downloadInfo.ArSuffix)
+	if u.versionScheme == nil {
+		u.versionScheme = Semver
+	}
+	if u.layout != nil && u.layout.Scheme == nil {
+		u.layout.Scheme = u.versionScheme
+	}
+	if u.versionScheme != Semver {
+		u.releaseOpts = append(u.releaseOpts, release.WithVersionCompare(u.compareVersions))
+		u.feedOpts = append(u.feedOpts, release.WithFeedVersionCompare(u.compareVersions))
+	}
+	// the defaults depend on options, so they're built last
+	u.applyPaths()
+	client, err := u.newHTTPClient()
 	if err != nil {
-		return fmt.Errorf("failed to unarchive: %w", err)
+		// NewUpgrader can't fail, so the requests do rather than silently
+		// going out without the TLS, pinning or proxy options
+		client = &http.Client{Transport: errTransport{err: err}}
 	}
-	defer os.Remove(tempFile)
-
-	if err := replaceBinary(tempFile, u.executablePath); err != nil {
-		return fmt.Errorf("failed to replace binary: %w", err)
+	u.httpClient = client
+	u.releaseOpts = append([]release.GetterOpt{release.WithHTTPClient(u.httpClient)}, u.releaseOpts...)
+	u.feedOpts = append([]release.FeedOpt{release.WithFeedHTTPClient(u.httpClient)}, u.feedOpts...)
+	u.assetOpts = append([]asset.AssetDownloadOpt{asset.WithHTTPClient(u.httpClient), asset.WithBeforeDownload(u.checkDiskSpace)}, u.assetOpts...)
+	u.checksumOpts = append([]checksum.DownloadOpt{checksum.WithHTTPClient(u.httpClient)}, u.checksumOpts...)
+	var validatorOpts []checksum.ValidatorOption
+	if u.rosettaPolicy == RosettaNative && isTranslated() {
+		u.assetOpts = append(u.assetOpts, asset.WithOS("darwin"), asset.WithArch("arm64"))
+		validatorOpts = append(validatorOpts, checksum.WithOS("darwin"), checksum.WithArch("arm64"))
+	}
+	// a custom getter may not publish to GitHub, so its feed isn't read
+	feed := u.releaseFeed && u.releaseGetter == nil
+	if u.releaseGetter == nil && u.nightly != nil && u.nightly.Workflow != "" {
+		g := release.NewArtifactGetter(repo, owner, u.nightly.Workflow, u.nightly.Branch, u.releaseOpts...)
+		// artifacts can only be downloaded through the API
+		u.assetOpts = append(u.assetOpts, asset.WithAPIDownloads(g.Token))
+		u.checksumOpts = append(u.checksumOpts, checksum.WithAPIDownloads(g.Token))
+		u.releaseGetter = g
+	}
+	if u.releaseGetter == nil {
+		g := release.NewReleaseGetter(repo, owner, u.releaseOpts...)
+		if u.apiAssetDownloads {
+			u.assetOpts = append(u.assetOpts, asset.WithAPIDownloads(g.Token))
+			u.checksumOpts = append(u.checksumOpts, checksum.WithAPIDownloads(g.Token))
+		}
+		u.releaseGetter = g
+	}
+	if len(u.urlRewrites) > 0 {
+		u.releaseGetter = &rewriteGetter{g: u.releaseGetter, rules: u.urlRewrites, tagPrefix: u.tagPrefix}
+	}
+	if u.timeouts.Release > 0 {
+		u.releaseGetter = &timeoutGetter{g: u.releaseGetter, d: u.timeouts.Release, tagPrefix: u.tagPrefix}
 	}
+	if feed {
+		u.tagGetter = release.NewFeedGetter(repo, owner, u.feedOpts...)
+	}
+	if u.assetDownloader == nil {
+		u.assetDownloader = asset.NewAssetDownloader(executablePath, u.assetOpts...)
+	}
+	if u.checksumDownloader == nil {
+		u.checksumDownloader = checksum.NewCheckSumDownloader(u.checksumOpts...)
+	}
+	if u.checksumValidator == nil {
+		u.checksumValidator = checksum.NewCheckSumValidator(validatorOpts...)
+	}
+	return u
+}
 
-	return nil
+// ErrChecksumNotVerified is reported as a warning when an asset is installed without checksum verification.
+var ErrChecksumNotVerified = errors.New("checksum not verified")
+
+// ErrAlreadyUpToDate is returned when the current version is already the latest version.
+var ErrAlreadyUpToDate = errors.New("already up to date")
+
+// ErrManagedInstall is returned when the executable is owned by a package manager.
+// The returned error is a *ManagedInstallError.
+var ErrManagedInstall = errors.New("executable is managed by a package manager")
+
+// ManagedInstallError describes a package manager install that the upgrader refused to replace.
+type ManagedInstallError struct {
+	Manager        pkgmgr.Manager
+	ExecutablePath string
 }
 
-// tryUnArchive unarchives the downloaded update and returns the path to the unarchived temp file.
-func tryUnArchive(prefix, arPath, arSuffix string) (string, error) {
-	f, err := os.Open(arPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
-	}
-	switch arSuffix {
-	case ".tar.gz":
-		return unTarGz(prefix, f)
-	case ".zip":
-		return unZip(prefix, f)
-	case ".tar":
-		return unTar(prefix, f)
-	case ".gz":
-		return unGz(prefix, f)
-	case "": // no extension - assume it's a binary
-		return arPath, nil
-	default:
-		return "", fmt.Errorf("unsupported file type: %s", filepath.Ext(arPath))
-	}
-}
-
-// unTarGz unarchives a .tar.gz file.
-func unTarGz(prefix string, r io.Reader) (string, error) {
-	gzr, err := gzip.NewReader(r)
+func (e *ManagedInstallError) Error() string {
+	name := filepath.Base(e.ExecutablePath)
+	return fmt.Sprintf("%s: %s was installed with %s, %s instead", ErrManagedInstall, e.ExecutablePath, e.Manager, e.Manager.Guidance(name))
+}
+
+func (e *ManagedInstallError) Unwrap() error {
+	return ErrManagedInstall
+}
+
+func (u *upgrader) IsNewVersionAvailable(ctx context.Context, currentVersion string) (bool, error) {
+	// the feed lists tags only, so it can't tell about yanked versions, and
+	// updates it finds may be held back by a gradual rollout. Its latest
+	// release is the stable one, and nightly builds have no versioned tags.
+	if u.tagGetter != nil && u.yankedURL == "" && u.nightly == nil && u.followsStable(ctx) {
+		if update, err := u.checkFeed(ctx, currentVersion); err == nil && (!update.Available || u.rolloutAsset == "") {
+			if err := u.applyPreferences(ctx, update); err != nil {
+				return false, err
+			}
+			u.notify(ctx, update)
+			return update.Available, nil
+		}
+	}
+	update, err := u.Check(ctx, currentVersion)
 	if err != nil {
-		return "", fmt.Errorf("failed to read gzip: %w", err)
+		return false, err
 	}
-	defer gzr.Close()
-	return unTar(prefix, gzr)
+	return update.Available, nil
 }
 
-// unTar unarchives a .tar file.
-func unTar(prefix string, r io.Reader) (string, error) {
-	tarr := tar.NewReader(r)
-	out, err := os.CreateTemp("", prefix)
+func (u *upgrader) Upgrade(ctx context.Context, currentVersion string) error {
+	result, err := u.UpgradeWithResult(ctx, currentVersion)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
+		return err
 	}
-	defer out.Close()
-
-	for {
-		hdr, err := tarr.Next()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return "", fmt.Errorf("failed to read next header: %w", err)
-		}
-		if hdr.Typeflag != tar.TypeReg {
-			continue
-		}
-		if !strings.HasPrefix(filepath.Base(hdr.Name), prefix) {
-			continue
-		}
-
-		if _, err := io.Copy(out, tarr); err != nil {
-			return "", fmt.Errorf("failed to copy file: %w", err)
-		}
+	if !result.Upgraded && !result.Pending {
+		return ErrAlreadyUpToDate
+	}
+	return nil
+}
 
-		if err := os.Chmod(out.Name(), 0755); err != nil {
-			return "", fmt.Errorf("failed to change file permissions: %w", err)
-		}
+func (u *upgrader) UpgradeWithResult(ctx context.Context, currentVersion string) (*UpgradeResult, error) {
+	return u.upgradeAndRestart(ctx, currentVersion, false)
+}
 
-		return out.Name(), nil
+// upgradeAndRestart upgrades the current binary and restarts it if WithReexec is set.
+// Unattended upgrades respect the user's preferences, see WithStateStore.
+func (u *upgrader) upgradeAndRestart(ctx context.Context, currentVersion string, unattended bool) (*UpgradeResult, error) {
+	result, err := u.upgradeWithResult(ctx, currentVersion, unattended)
+	u.record(ctx, actionUpgrade, u.executablePath, result, err)
+	if err != nil {
+		return result, err
 	}
-
-	return "", fmt.Errorf("file not found in archive")
+	return result, u.restart(result, u.executablePath)
 }
 
-// unZip unarchives a .zip file.
-func unZip(prefix string, r io.ReaderAt) (string, error) {
-	zr, err := zip.NewReader(r, 0)
+func (u *upgrader) upgradeWithResult(ctx context.Context, currentVersion string, unattended bool) (*UpgradeResult, error) {
+	start := time.Now()
+	result := &UpgradeResult{PreviousVersion: currentVersion, NewVersion: currentVersion}
+	defer func() { result.Duration = time.Since(start) }()
+
+	update, err := u.check(ctx, currentVersion)
 	if err != nil {
-		return "", fmt.Errorf("failed to create zip reader: %w", err)
+		return result, err
 	}
-	for _, f := range zr.File {
-		if !strings.HasPrefix(filepath.Base(f.Name), prefix) {
-			continue
+	if unattended {
+		if err := u.applyPreferences(ctx, update); err != nil {
+			return result, err
 		}
+	}
 
-		rc, err := f.Open()
-		if err != nil {
-			return "", fmt.Errorf("failed to open file: %w", err)
-		}
-		defer rc.Close()
-		out, err := os.CreateTemp("", prefix)
-		if err != nil {
-			return "", fmt.Errorf("failed to create temp file: %w", err)
-		}
-		defer out.Close()
+	if !update.Available {
+		return result, nil
+	}
 
-		if _, err := io.Copy(out, rc); err != nil {
-			return "", fmt.Errorf("failed to copy file: %w", err)
-		}
+	u.metrics.UpgradeAttempted()
+	err = u.upgradeTo(ctx, update, result)
+	u.metrics.UpgradeFinished(err)
+	return result, err
+}
 
-		if err := os.Chmod(out.Name(), 0755); err != nil {
-			return "", fmt.Errorf("failed to change file permissions: %w", err)
+// upgradeTo replaces the current binary with the available update.
+func (u *upgrader) upgradeTo(ctx context.Context, update *Update, result *UpgradeResult) error {
+	if handled, err := u.handleManagedInstall(ctx); err != nil || handled {
+		if handled {
+			result.PackageManager = pkgmgr.Homebrew
+			result.Upgraded = true
+			u.readBrewVersion(ctx, update.LatestVersion, result)
 		}
-
-		return out.Name(), nil
+		return err
 	}
 
-	return "", fmt.Errorf("no file found with prefix: %s", prefix)
-}
+	lock, err := acquireLock(u.executablePath)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
 
-// unGz unarchives a .gz file.
-// It returns the path to the unarchived temp file.
-func unGz(prefix string, r io.Reader) (string, error) {
-	gzr, err := gzip.NewReader(r)
+	d, err := u.download(ctx, update, u.executablePath, result)
 	if err != nil {
-		return "", fmt.Errorf("failed to create gzip reader: %w", err)
+		return err
 	}
-	defer gzr.Close()
+	if u.applyOnStart {
+		return u.stagePending(d, result)
+	}
+	defer d.Discard()
+
+	return u.apply(ctx, d, result)
+}
 
-	out, err := os.CreateTemp("", prefix)
+// runPhase runs the hooks for phase and records their results.
+func (u *upgrader) runPhase(ctx context.Context, result *UpgradeResult, phase HookPhase, env HookEnv) error {
+	env.Phase = phase
+	hookResults, err := u.runHooks(ctx, env)
+	result.Hooks = append(result.Hooks, hookResults...)
+	return err
+}
+
+// checkManagedInstall returns a *ManagedInstallError if the executable is owned by a package manager.
+func (u *upgrader) checkManagedInstall(ctx context.Context) error {
+	if u.allowManaged || u.pkgDetector == nil {
+		return nil
+	}
+	m, err := u.pkgDetector.Detect(ctx, u.executablePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
+		return fmt.Errorf("failed to detect package manager: %w", err)
+	}
+	if m == pkgmgr.None {
+		return nil
 	}
-	defer out.Close()
+	return &ManagedInstallError{Manager: m, ExecutablePath: u.executablePath}
+}
 
-	if _, err := io.Copy(out, gzr); err != nil {
-		return "", fmt.Errorf("failed to copy file: %w", err)
+// handleManagedInstall checks whether the executable is owned by a package manager.
+// It returns true if the upgrade was delegated to the package manager, and a
+// *ManagedInstallError if the executable is managed and can't be upgraded.
+func (u *upgrader) handleManagedInstall(ctx context.Context) (bool, error) {
+	err := u.checkManagedInstall(ctx)
+	var managed *ManagedInstallError
+	if !errors.As(err, &managed) || managed.Manager != pkgmgr.Homebrew || u.brewUpgrader == nil {
+		return false, err
 	}
 
-	if err := os.Chmod(out.Name(), 0755); err != nil {
-		return "", fmt.Errorf("failed to change file permissions: %w", err)
+	if err := u.brewUpgrader.Upgrade(ctx, u.formula()); err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	return out.Name(), nil
+// formula returns the Homebrew formula of the executable, see WithHomebrewFallback.
+func (u *upgrader) formula() string {
+	if u.brewFormula != "" {
+		return u.brewFormula
+	}
+	return filepath.Base(u.executablePath)
 }
 
-// replaceBinary replaces the current executable with the downloaded update.
-func replaceBinary(tmpFilePath, currentBinaryPath string) error {
-	// Replace the current binary with the new binary
-	if err := os.Rename(tmpFilePath, currentBinaryPath); err != nil {
-		return fmt.Errorf("failed to replace binary: %w", err)
+// readBrewVersion sets NewVersion to the version Homebrew installed, since
+// the formula may lag behind latest, the latest release. If it can't be
+// read, NewVersion stays empty and a warning is added.
+func (u *upgrader) readBrewVersion(ctx context.Context, latest string, result *UpgradeResult) {
+	r, ok := u.brewUpgrader.(pkgmgr.VersionReader)
+	if !ok {
+		result.Warnings = append(result.Warnings, fmt.Errorf("upgraded %s with Homebrew, but can't tell which version it installed", u.formula()))
+		return
 	}
+	v, err := r.InstalledVersion(ctx, u.formula())
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Errorf("upgraded %s with Homebrew, but can't tell which version it installed: %w", u.formula(), err))
+		return
+	}
+	result.NewVersion = v
+	if NormalizeVersion(v) != NormalizeVersion(latest) {
+		result.Warnings = append(result.Warnings, fmt.Errorf("Homebrew installed %s, not the latest release %s", v, latest))
+	}
+}
 
-	return nil
+// binaryNames returns the names of the binaries to extract from the release asset.
+func (u *upgrader) binaryNames() []string {
+	if len(u.binaries) > 0 {
+		return u.binaries
+	}
+	return []string{filepath.Base(u.executablePath)}
 }
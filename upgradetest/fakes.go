@@ -0,0 +1,180 @@
+// Package upgradetest provides fakes for testing code that embeds the upgrader:
+// in-memory implementations of its extension points and a fake GitHub
+// releases server that serves generated archives and checksum files.
+package upgradetest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/getsavvyinc/upgrade-cli/release/asset"
+)
+
+// ReleaseGetter is a release.Getter returning fixed releases.
+type ReleaseGetter struct {
+	// Releases are ordered from oldest to latest.
+	Releases []*release.Info
+	// Err is returned by every call if set.
+	Err error
+}
+
+var _ release.Getter = (*ReleaseGetter)(nil)
+
+func (g *ReleaseGetter) GetLatestRelease(ctx context.Context) (*release.Info, error) {
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	if len(g.Releases) == 0 {
+		return nil, release.ErrReleaseNotFound
+	}
+	return g.Releases[len(g.Releases)-1], nil
+}
+
+func (g *ReleaseGetter) GetReleaseByTag(ctx context.Context, tag string) (*release.Info, error) {
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	for _, r := range g.Releases {
+		if r.TagName == tag || r.TagName == "v"+tag {
+			return r, nil
+		}
+	}
+	return nil, release.ErrReleaseNotFound
+}
+
+// AssetDownloader is an asset.Downloader that "downloads" Content.
+type AssetDownloader struct {
+	// Name is the name of the asset, its extension selects how it is extracted,
+	// e.g. "savvy_linux_amd64.tar.gz" for an archive created with TarGz.
+	Name    string
+	Content []byte
+	// Err is returned by every call if set.
+	Err error
+
+	mu    sync.Mutex
+	calls int
+}
+
+var _ asset.Downloader = (*AssetDownloader)(nil)
+
+func (d *AssetDownloader) DownloadAsset(ctx context.Context, assets []release.Asset) (*asset.Info, func() error, error) {
+	d.mu.Lock()
+	d.calls++
+	d.mu.Unlock()
+	if d.Err != nil {
+		return nil, nil, d.Err
+	}
+
+	f, err := os.CreateTemp("", "upgradetest-asset-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	cleanup := func() error { return os.Remove(f.Name()) }
+	if _, err := f.Write(d.Content); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if err := f.Chmod(0o755); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return &asset.Info{
+		Name:                     d.Name,
+		URL:                      "https://example.invalid/" + d.Name,
+		Checksum:                 SHA256(d.Content),
+		DownloadedBinaryFilePath: f.Name(),
+		ArSuffix:                 archiveSuffix(d.Name),
+		Size:                     int64(len(d.Content)),
+	}, cleanup, nil
+}
+
+// Calls returns how often DownloadAsset was called.
+func (d *AssetDownloader) Calls() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls
+}
+
+// ChecksumDownloader is a checksum.Downloader returning fixed checksums.
+type ChecksumDownloader struct {
+	// Checksums maps file names to their sha256 checksum.
+	Checksums map[string]string
+	// Err is returned by every call if set, e.g. checksum.ErrNoCheckSumAsset.
+	Err error
+}
+
+var _ checksum.Downloader = (*ChecksumDownloader)(nil)
+
+func (d *ChecksumDownloader) Download(ctx context.Context, assets []release.Asset) (*checksum.Info, error) {
+	if d.Err != nil {
+		return nil, d.Err
+	}
+	return checksum.NewInfo(d.Checksums), nil
+}
+
+// CheckSumValidator is a checksum.CheckSumValidator with a fixed verdict.
+type CheckSumValidator struct {
+	Valid bool
+}
+
+var _ checksum.CheckSumValidator = CheckSumValidator{}
+
+func (v CheckSumValidator) IsCheckSumValid(ctx context.Context, binary string, checksums *checksum.Info, downloadedChecksum string) bool {
+	return v.Valid
+}
+
+// TarGz returns a .tar.gz archive of files, keyed on their path in the archive.
+func TarGz(files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	gzw := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gzw)
+	for _, name := range names {
+		content := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// SHA256 returns the hex encoded sha256 checksum of data.
+func SHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func archiveSuffix(name string) string {
+	for _, s := range []string{".tar.gz", ".tar", ".zip", ".gz"} {
+		if strings.HasSuffix(strings.ToLower(name), s) {
+			return s
+		}
+	}
+	return ""
+}
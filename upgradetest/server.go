@@ -0,0 +1,195 @@
+package upgradetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	upgrade "github.com/getsavvyinc/upgrade-cli"
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// Release is a release published by Server.
+type Release struct {
+	Tag string
+	// Binaries are the files of the release archives, keyed on their path in the archive.
+	Binaries map[string][]byte
+	// Platforms are the "<os>_<arch>" pairs archives are published for.
+	// The default is the running platform.
+	Platforms []string
+	// WithoutChecksums doesn't publish a checksums.txt asset.
+	WithoutChecksums bool
+}
+
+// Server is a fake GitHub releases API serving releases of one repository.
+// Each release has a "<repo>_<os>_<arch>.tar.gz" archive per platform and a
+// checksums.txt asset.
+type Server struct {
+	*httptest.Server
+	t           testing.TB
+	owner, repo string
+
+	mu       sync.Mutex
+	releases []*release.Info
+	files    map[string][]byte
+	requests map[string]int
+	headers  map[string]http.Header
+}
+
+// NewServer starts a Server publishing releases, the last being the latest.
+// It is closed when the test finishes.
+func NewServer(t testing.TB, owner, repo string, releases ...Release) *Server {
+	t.Helper()
+	s := &Server{t: t, owner: owner, repo: repo, files: map[string][]byte{}, requests: map[string]int{}, headers: map[string]http.Header{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	for _, r := range releases {
+		s.Publish(r)
+	}
+	return s
+}
+
+// Publish publishes r as the latest release.
+func (s *Server) Publish(r Release) {
+	s.t.Helper()
+	platforms := r.Platforms
+	if len(platforms) == 0 {
+		platforms = []string{runtime.GOOS + "_" + runtime.GOARCH}
+	}
+	archive, err := TarGz(r.Binaries)
+	if err != nil {
+		s.t.Fatalf("upgradetest: failed to create archive: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := &release.Info{ID: int64(len(s.releases) + 1), TagName: r.Tag, Name: r.Tag}
+	var checksums strings.Builder
+	for _, p := range platforms {
+		name := s.AssetName(p)
+		info.Assets = append(info.Assets, s.addFile(r.Tag, name, archive))
+		fmt.Fprintf(&checksums, "%s  %s\n", SHA256(archive), name)
+	}
+	if !r.WithoutChecksums {
+		info.Assets = append(info.Assets, s.addFile(r.Tag, "checksums.txt", []byte(checksums.String())))
+	}
+	s.releases = append(s.releases, info)
+}
+
+// addFile serves data as a release asset.
+func (s *Server) addFile(tag, name string, data []byte) release.Asset {
+	p := "/download/" + tag + "/" + name
+	s.files[p] = data
+	return release.Asset{Name: name, BrowserDownloadURL: s.URL + p, Size: int64(len(data)), ContentType: http.DetectContentType(data)}
+}
+
+// AssetName returns the name of the archive published for platform, e.g. "linux_amd64".
+func (s *Server) AssetName(platform string) string {
+	return s.repo + "_" + platform + ".tar.gz"
+}
+
+// Getter returns a release.Getter for the server.
+func (s *Server) Getter() release.Getter {
+	return release.NewReleaseGetter(s.repo, s.owner, release.WithBaseURL(s.URL))
+}
+
+// Opt configures an upgrader to use the server as its GitHub API, see
+// upgrade.WithGitHubBaseURL.
+func (s *Server) Opt() upgrade.Opt {
+	return upgrade.WithGitHubBaseURL(s.URL)
+}
+
+// FeedOpt configures an upgrader to check for new versions with the
+// server's releases.atom feed, see upgrade.WithReleaseFeed.
+func (s *Server) FeedOpt() upgrade.Opt {
+	return upgrade.WithReleaseFeed(release.WithFeedBaseURL(s.URL))
+}
+
+// Requests returns how often path was requested, e.g. "/download/v1.0.0/checksums.txt".
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Header returns the headers of the last request for path, or nil if it wasn't requested.
+func (s *Server) Header(path string) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[path]
+}
+
+// Paths returns every requested path, sorted.
+func (s *Server) Paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := make([]string, 0, len(s.requests))
+	for p := range s.requests {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[r.URL.Path]++
+	s.headers[r.URL.Path] = r.Header.Clone()
+
+	if data, ok := s.files[r.URL.Path]; ok {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+		return
+	}
+
+	if r.URL.Path == "/"+s.owner+"/"+s.repo+"/releases.atom" {
+		s.serveFeed(w)
+		return
+	}
+
+	prefix := "/repos/" + s.owner + "/" + s.repo + "/releases/"
+	rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var info *release.Info
+	if rest == "latest" && len(s.releases) > 0 {
+		info = s.releases[len(s.releases)-1]
+	} else if tag, ok := strings.CutPrefix(rest, "tags/"); ok {
+		for _, rel := range s.releases {
+			if rel.TagName == tag {
+				info = rel
+			}
+		}
+	}
+	if info == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// serveFeed serves the releases as an atom feed, newest first.
+func (s *Server) serveFeed(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/atom+xml")
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<feed xmlns="http://www.w3.org/2005/Atom">`)
+	for i := len(s.releases) - 1; i >= 0; i-- {
+		tag := s.releases[i].TagName
+		fmt.Fprintf(w, "<entry><id>tag:github.com,2008:Repository/1/%s</id>", html.EscapeString(tag))
+		fmt.Fprintf(w, `<link rel="alternate" type="text/html" href="%s/%s/%s/releases/tag/%s"/>`, s.URL, s.owner, s.repo, url.PathEscape(tag))
+		fmt.Fprintf(w, "<title>%s</title></entry>\n", html.EscapeString(tag))
+	}
+	fmt.Fprintln(w, "</feed>")
+}
@@ -0,0 +1,195 @@
+package upgradetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	upgrade "github.com/getsavvyinc/upgrade-cli"
+	"github.com/getsavvyinc/upgrade-cli/checksum"
+	"github.com/getsavvyinc/upgrade-cli/release"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(t, "getsavvyinc", "savvy",
+		Release{Tag: "v0.1.0", Binaries: map[string][]byte{"savvy": []byte("v0.1.0")}},
+		Release{Tag: "v0.2.0", Binaries: map[string][]byte{"savvy": []byte("v0.2.0")}},
+	)
+
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("v0.1.0"), 0o755))
+	u := upgrade.NewUpgrader("getsavvyinc", "savvy", executablePath, s.Opt(), upgrade.WithAllowManagedInstall()).(upgrade.ResultUpgrader)
+
+	result, err := u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.True(t, result.ChecksumVerified)
+	content, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", string(content))
+	assert.Equal(t, 1, s.Requests("/download/v0.2.0/checksums.txt"))
+
+	_, err = u.(upgrade.PathInstaller).Install(ctx, "0.1.0", filepath.Join(t.TempDir(), "savvy"))
+	assert.NoError(t, err)
+	_, err = u.(upgrade.PathInstaller).Install(ctx, "0.3.0", filepath.Join(t.TempDir(), "savvy"))
+	assert.ErrorIs(t, err, upgrade.ErrNotFound)
+}
+
+func TestFakes(t *testing.T) {
+	ctx := context.Background()
+	archive, err := TarGz(map[string][]byte{"savvy": []byte("new")})
+	require.NoError(t, err)
+
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old"), 0o755))
+	newUpgrader := func(opts ...upgrade.Opt) upgrade.Upgrader {
+		opts = append([]upgrade.Opt{
+			upgrade.WithAllowManagedInstall(),
+			upgrade.WithReleaseGetter(&ReleaseGetter{}),
+		}, opts...)
+		return upgrade.NewUpgrader("getsavvyinc", "savvy", executablePath, opts...)
+	}
+
+	_, err = newUpgrader().(upgrade.StagedUpgrader).Check(ctx, "0.1.0")
+	assert.Error(t, err)
+
+	getter := &ReleaseGetter{}
+	getter.Releases = append(getter.Releases, &release.Info{TagName: "v0.2.0"})
+	downloader := &AssetDownloader{Name: "savvy_linux_amd64.tar.gz", Content: archive}
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		u := newUpgrader(upgrade.WithReleaseGetter(getter), upgrade.WithAssetDownloader(downloader),
+			upgrade.WithCheckSumDownloader(&ChecksumDownloader{Checksums: map[string]string{downloader.Name: SHA256([]byte("other"))}})).(upgrade.ResultUpgrader)
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, upgrade.ErrChecksumMismatch)
+	})
+	t.Run("NoChecksums", func(t *testing.T) {
+		u := newUpgrader(upgrade.WithReleaseGetter(getter), upgrade.WithAssetDownloader(downloader),
+			upgrade.WithCheckSumDownloader(&ChecksumDownloader{Err: checksum.ErrNoCheckSumAsset})).(upgrade.ResultUpgrader)
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, upgrade.ErrNoCheckSumAsset)
+	})
+	t.Run("Upgraded", func(t *testing.T) {
+		u := newUpgrader(upgrade.WithReleaseGetter(getter), upgrade.WithAssetDownloader(downloader),
+			upgrade.WithCheckSumDownloader(&ChecksumDownloader{Checksums: map[string]string{downloader.Name: SHA256(archive)}})).(upgrade.ResultUpgrader)
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		content, err := os.ReadFile(executablePath)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+	})
+	assert.Equal(t, 3, downloader.Calls())
+}
+
+func TestServerFeed(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(t, "getsavvyinc", "savvy",
+		Release{Tag: "v0.2.0", Binaries: map[string][]byte{"savvy": []byte("v0.2.0")}},
+		Release{Tag: "v0.3.0-rc.1", Binaries: map[string][]byte{"savvy": []byte("v0.3.0-rc.1")}},
+	)
+
+	tag, err := release.NewFeedGetter("savvy", "getsavvyinc", release.WithFeedBaseURL(s.URL)).GetLatestTag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", tag)
+
+	u := upgrade.NewUpgrader("getsavvyinc", "savvy", "savvy", s.Opt(), s.FeedOpt())
+	available, err := u.IsNewVersionAvailable(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, available)
+	available, err = u.IsNewVersionAvailable(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.False(t, available)
+	assert.Equal(t, 3, s.Requests("/getsavvyinc/savvy/releases.atom"))
+	assert.Zero(t, s.Requests("/repos/getsavvyinc/savvy/releases/latest"))
+
+	// the API is used when the feed can't be read
+	u = upgrade.NewUpgrader("getsavvyinc", "savvy", "savvy", s.Opt(), upgrade.WithReleaseFeed(release.WithFeedBaseURL(s.URL+"/missing")))
+	available, err = u.IsNewVersionAvailable(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, available)
+	assert.Equal(t, 1, s.Requests("/repos/getsavvyinc/savvy/releases/latest"))
+}
+
+func TestServerHeaders(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(t, "getsavvyinc", "savvy",
+		Release{Tag: "v0.2.0", Binaries: map[string][]byte{"savvy": []byte("v0.2.0")}},
+	)
+
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("v0.1.0"), 0o755))
+	u := upgrade.NewUpgrader("getsavvyinc", "savvy", executablePath,
+		upgrade.WithGitHubBaseURL(s.URL),
+		upgrade.WithGitHubToken("token"),
+		upgrade.WithUserAgent("savvy/0.1.0"),
+		upgrade.WithHeader("Authorization", "Basic proxy"),
+		upgrade.WithHeader("X-Mirror", "a"),
+		upgrade.WithHeader("X-Mirror", "b"),
+		upgrade.WithAllowManagedInstall(),
+	)
+	require.NoError(t, u.Upgrade(ctx, "0.1.0"))
+
+	for _, p := range []string{
+		"/repos/getsavvyinc/savvy/releases/latest",
+		"/download/v0.2.0/checksums.txt",
+		"/download/v0.2.0/" + s.AssetName(runtime.GOOS+"_"+runtime.GOARCH),
+	} {
+		h := s.Header(p)
+		require.NotNil(t, h, p)
+		assert.Equal(t, "savvy/0.1.0", h.Get("User-Agent"), p)
+		assert.Equal(t, []string{"a", "b"}, h.Values("X-Mirror"), p)
+	}
+	// the GitHub token takes precedence on API requests
+	assert.Equal(t, "Bearer token", s.Header("/repos/getsavvyinc/savvy/releases/latest").Get("Authorization"))
+	assert.Equal(t, "Basic proxy", s.Header("/download/v0.2.0/checksums.txt").Get("Authorization"))
+}
+
+func TestServerBundle(t *testing.T) {
+	ctx := context.Background()
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	s := NewServer(t, "getsavvyinc", "savvy",
+		Release{Tag: "v0.2.0", Binaries: map[string][]byte{"savvy": []byte("v0.2.0")}, Platforms: []string{platform, "plan9_386"}},
+	)
+
+	bundleDir := filepath.Join(t.TempDir(), "bundle")
+	online := upgrade.NewUpgrader("getsavvyinc", "savvy", "savvy", s.Opt()).(upgrade.BundleUpgrader)
+	bundle, err := online.Export(ctx, "latest", bundleDir, upgrade.ExportPlatforms(platform, "plan9_386"))
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", bundle.Version)
+	require.Len(t, bundle.Assets, 2)
+	assert.Equal(t, s.AssetName("plan9_386"), bundle.Assets[1].Name)
+	assert.True(t, bundle.Assets[1].Verified)
+	for _, name := range []string{s.AssetName(platform), s.AssetName("plan9_386"), "checksums.txt", upgrade.BundleManifestName} {
+		assert.FileExists(t, filepath.Join(bundleDir, name))
+	}
+
+	executablePath := filepath.Join(t.TempDir(), "savvy")
+	require.NoError(t, os.WriteFile(executablePath, []byte("v0.1.0"), 0o755))
+	offline := upgrade.NewUpgrader("getsavvyinc", "savvy", executablePath, upgrade.WithAllowManagedInstall()).(upgrade.BundleUpgrader)
+	result, err := offline.ImportAndUpgrade(ctx, bundleDir)
+	require.NoError(t, err)
+	assert.True(t, result.ChecksumVerified)
+	assert.Equal(t, "v0.2.0", result.NewVersion)
+	content, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", string(content))
+
+	// an asset swapped along with its checksums doesn't match the manifest
+	swapped := []byte("swapped")
+	sum := sha256.Sum256(swapped)
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, s.AssetName(platform)), swapped, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "checksums.txt"), []byte(hex.EncodeToString(sum[:])+"  "+s.AssetName(platform)+"\n"), 0o644))
+	_, err = offline.ImportAndUpgrade(ctx, bundleDir)
+	assert.ErrorIs(t, err, upgrade.ErrChecksumMismatch)
+	content, err = os.ReadFile(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", string(content))
+}
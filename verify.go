@@ -0,0 +1,95 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrVersionMismatch is returned when the new binary doesn't report the version it was released as.
+var ErrVersionMismatch = errors.New("new binary reported an unexpected version")
+
+// versionCheckTimeout bounds running the candidate binary.
+const versionCheckTimeout = 30 * time.Second
+
+// WithVersionCheck runs the new binary with args (default "--version") before
+// it replaces the current one, and aborts the upgrade unless its output
+// contains the release tag as a whole word.
+//
+// The binary runs from a copy in an empty temp directory, which is also its
+// working and home directory.
+func WithVersionCheck(args ...string) Opt {
+	if len(args) == 0 {
+		args = []string{"--version"}
+	}
+	return func(u *upgrader) {
+		WithHooks(SmokeTest, Hook{
+			Name:    "version-check",
+			Timeout: versionCheckTimeout,
+			Run: func(ctx context.Context, env HookEnv, out io.Writer) error {
+				return checkVersion(ctx, u.workDir, env.BinaryPath, env.ToVersion, args, out)
+			},
+		})(u)
+	}
+}
+
+func checkVersion(ctx context.Context, workDir, binaryPath, expected string, args []string, out io.Writer) error {
+	sandbox, err := os.MkdirTemp(workDir, "upgrade-version-check-")
+	if err != nil {
+		return fmt.Errorf("failed to create sandbox: %w", err)
+	}
+	defer os.RemoveAll(sandbox)
+
+	candidate := filepath.Join(sandbox, filepath.Base(binaryPath))
+	if err := copyFile(binaryPath, candidate, 0o755); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, candidate, args...)
+	cmd.Dir = sandbox
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + sandbox, "TMPDIR=" + sandbox}
+	output, err := cmd.CombinedOutput()
+	out.Write(output)
+	if err != nil {
+		return fmt.Errorf("failed to run %s %s: %w", filepath.Base(binaryPath), strings.Join(args, " "), err)
+	}
+
+	if !reportsVersion(string(output), expected) {
+		return fmt.Errorf("%w: expected %s", ErrVersionMismatch, expected)
+	}
+	return nil
+}
+
+// reportsVersion reports whether output contains version as a whole word,
+// with or without a "v" prefix, so that "1.2.3" doesn't match "1.2.30" or
+// "1.2.3-rc.1". A trailing period, e.g. ending a sentence, is allowed.
+func reportsVersion(output, version string) bool {
+	re := regexp.MustCompile(`(?:^|[^\w.])v?` + regexp.QuoteMeta(strings.TrimPrefix(version, "v")) + `[.-]?(?:$|[^\w.-])`)
+	return re.MatchString(output)
+}
+
+// copyFile copies src to dst and sets its mode to perm.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package upgrade
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionCheck(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Matches", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "#!/bin/sh\necho savvy version 0.2.0\n"}, WithVersionCheck())
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		require.Len(t, result.Hooks, 1)
+		assert.Equal(t, "savvy version 0.2.0\n", result.Hooks[0].Output)
+		assert.Contains(t, readFile(t, executablePath), "0.2.0")
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "#!/bin/sh\necho savvy version 0.1.9\n"}, WithVersionCheck())
+		_, err := u.UpgradeWithResult(ctx, "0.1.0")
+		assert.ErrorIs(t, err, ErrVersionMismatch)
+		assert.Equal(t, "old", readFile(t, executablePath))
+	})
+}
+
+func TestReportsVersion(t *testing.T) {
+	testCases := []struct {
+		output  string
+		version string
+		matches bool
+	}{
+		{"savvy version 1.2.3\n", "v1.2.3", true},
+		{"savvy v1.2.3 (abcdef)", "1.2.3", true},
+		{"version=1.2.3.", "1.2.3", true},
+		{"1.2.3", "1.2.3", true},
+		{"savvy version 1.2.30\n", "1.2.3", false},
+		{"savvy version 11.2.3\n", "1.2.3", false},
+		{"savvy version 1.2.3-rc.1\n", "1.2.3", false},
+		{"savvy version 1.2.3.4\n", "1.2.3", false},
+		{"savvy version 1a2b3\n", "1.2.3", false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.matches, reportsVersion(tc.output, tc.version), "%q in %q", tc.version, tc.output)
+	}
+}
@@ -0,0 +1,141 @@
+package upgrade
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// Version is a version parsed by a VersionScheme.
+type Version interface {
+	// Original returns the version as it was parsed, e.g. "v1.2.3".
+	Original() string
+}
+
+// VersionScheme parses and orders the versions releases are tagged with,
+// see WithVersionScheme.
+type VersionScheme interface {
+	Parse(v string) (Version, error)
+	// Compare returns -1, 0 or +1 if a is older than, the same as or newer
+	// than b. a and b were returned by Parse.
+	Compare(a, b Version) int
+}
+
+var (
+	// Semver orders semantic versions, e.g. "v1.2.3" or "1.3.0-rc.1". It is the default.
+	Semver VersionScheme = semverScheme{}
+	// CalVer orders calendar versions and date-stamped builds, e.g.
+	// "2024.06.1", "v24.6" or "20240601-2", by their numeric parts in order.
+	// Missing parts count as zero.
+	CalVer VersionScheme = calverScheme{}
+)
+
+// WithVersionScheme parses and compares versions with s instead of Semver,
+// e.g. CalVer for projects that don't use semantic versions. It applies to
+// the current and released versions as well as minimum, yanked and skipped versions.
+func WithVersionScheme(s VersionScheme) Opt {
+	return func(u *upgrader) {
+		u.versionScheme = s
+	}
+}
+
+// WithVersionNormalizer rewrites every version with fn before it is parsed,
+// e.g. NormalizeVersion to accept the output of git describe.
+func WithVersionNormalizer(fn func(v string) string) Opt {
+	return func(u *upgrader) {
+		u.normalizeVersion = fn
+	}
+}
+
+// gitDescribeSuffix matches the suffix git describe appends to the tag of an
+// untagged commit, e.g. "-12-gabcdef0" or "-12-gabcdef0-dirty".
+var gitDescribeSuffix = regexp.MustCompile(`(-\d+-g[0-9a-f]+)?(-dirty)?$`)
+
+// NormalizeVersion reduces v to the release it was built from, so that e.g.
+// "v1.2.3", "1.2.3+build.5" and "1.2.3-12-gabcdef (dirty)" all compare as
+// 1.2.3. It drops anything after whitespace, build metadata, the "v" prefix
+// and the suffix git describe adds to untagged commits.
+func NormalizeVersion(v string) string {
+	v, _, _ = strings.Cut(strings.TrimSpace(v), " ")
+	v, _, _ = strings.Cut(v, "+")
+	v = gitDescribeSuffix.ReplaceAllString(v, "")
+	return strings.TrimPrefix(strings.TrimPrefix(v, "v"), "V")
+}
+
+// parseVersion parses v with the version scheme, normalizing it first.
+func (u *upgrader) parseVersion(v string) (Version, error) {
+	if u.normalizeVersion != nil {
+		v = u.normalizeVersion(v)
+	}
+	return u.versionScheme.Parse(v)
+}
+
+// compareVersions compares two versions with the version scheme, for the
+// release getters.
+func (u *upgrader) compareVersions(a, b string) (int, error) {
+	va, err := u.parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := u.parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	return u.versionScheme.Compare(va, vb), nil
+}
+
+type semverScheme struct{}
+
+func (semverScheme) Parse(v string) (Version, error) {
+	parsed, err := version.NewVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+func (semverScheme) Compare(a, b Version) int {
+	return a.(*version.Version).Compare(b.(*version.Version))
+}
+
+type calverScheme struct{}
+
+// calVersion is a version parsed by CalVer.
+type calVersion struct {
+	original string
+	parts    []uint64
+}
+
+func (v *calVersion) Original() string {
+	return v.original
+}
+
+func (calverScheme) Parse(v string) (Version, error) {
+	fields := strings.FieldsFunc(strings.TrimPrefix(v, "v"), func(r rune) bool {
+		return r == '.' || r == '-' || r == '_'
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("malformed calendar version: %q", v)
+	}
+	parsed := &calVersion{original: v, parts: make([]uint64, len(fields))}
+	for i, f := range fields {
+		n, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed calendar version: %q", v)
+		}
+		parsed.parts[i] = n
+	}
+	return parsed, nil
+}
+
+func (calverScheme) Compare(a, b Version) int {
+	pa, pb := a.(*calVersion).parts, b.(*calVersion).parts
+	n := max(len(pa), len(pb))
+	pa = append(slices.Clone(pa), make([]uint64, n-len(pa))...)
+	pb = append(slices.Clone(pb), make([]uint64, n-len(pb))...)
+	return slices.Compare(pa, pb)
+}
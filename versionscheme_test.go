@@ -0,0 +1,79 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalVer(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "2024.06.1", b: "2024.6.1", expected: 0},
+		{a: "2024.06.1", b: "2024.06", expected: 1},
+		{a: "2024.10", b: "2024.9.3", expected: 1},
+		{a: "v24.6", b: "2025.1", expected: -1},
+		{a: "20240601-2", b: "20240601-10", expected: -1},
+	}
+	for _, tc := range testCases {
+		a, err := CalVer.Parse(tc.a)
+		require.NoError(t, err)
+		b, err := CalVer.Parse(tc.b)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, CalVer.Compare(a, b), "%s vs %s", tc.a, tc.b)
+	}
+
+	for _, v := range []string{"", "v", "2024.06-rc1", "latest"} {
+		_, err := CalVer.Parse(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestVersionScheme(t *testing.T) {
+	ctx := context.Background()
+	u, executablePath := newTestUpgrader(t, "2024.10.1", map[string]string{"savvy": "new"}, WithVersionScheme(CalVer))
+	update, err := u.Check(ctx, "2024.9.3")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+
+	update, err = u.Check(ctx, "2024.10.01")
+	require.NoError(t, err)
+	assert.False(t, update.Available)
+
+	result, err := u.UpgradeWithResult(ctx, "2024.9.3")
+	require.NoError(t, err)
+	assert.Equal(t, "2024.10.1", result.NewVersion)
+	assert.Equal(t, "new", readFile(t, executablePath))
+
+}
+
+func TestNormalizeVersion(t *testing.T) {
+	for v, expected := range map[string]string{
+		"v1.2.3":                   "1.2.3",
+		"1.2.3+build.5":            "1.2.3",
+		"1.2.3-rc.1":               "1.2.3-rc.1",
+		"v1.2.3-12-gabcdef0":       "1.2.3",
+		"1.2.3-12-gabcdef (dirty)": "1.2.3",
+		"1.2.3-dirty":              "1.2.3",
+		" 2024.06.1\n":             "2024.06.1",
+	} {
+		assert.Equal(t, expected, NormalizeVersion(v), v)
+	}
+
+	ctx := context.Background()
+	u, _ := newTestUpgrader(t, "v1.2.3", map[string]string{"savvy": "new"})
+	_, err := u.Check(ctx, "1.2.3-12-gabcdef (dirty)")
+	assert.Error(t, err)
+
+	u, _ = newTestUpgrader(t, "v1.2.3", map[string]string{"savvy": "new"}, WithVersionNormalizer(NormalizeVersion))
+	update, err := u.Check(ctx, "1.2.3-12-gabcdef (dirty)")
+	require.NoError(t, err)
+	assert.False(t, update.Available)
+	update, err = u.Check(ctx, "1.2.2+build.5")
+	require.NoError(t, err)
+	assert.True(t, update.Available)
+}
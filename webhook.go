@@ -0,0 +1,131 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/getsavvyinc/upgrade-cli/release"
+)
+
+// DefaultWebhookTimeout bounds webhook requests that don't set a Timeout.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// Webhook is an HTTP request sent after every upgrade, see WithWebhook.
+type Webhook struct {
+	// URL receives a POST request.
+	URL string
+	// Template renders the request body from a WebhookEvent with
+	// text/template. Its json function encodes a value as JSON, e.g.
+	// `{"text": {{json .Hostname}}}`. By default the event is sent as JSON.
+	Template string
+	// ContentType is the Content-Type of the body, "application/json" by default.
+	ContentType string
+	// Header is added to the request, e.g. an Authorization header.
+	Header http.Header
+	// Timeout bounds the request, DefaultWebhookTimeout if zero.
+	Timeout time.Duration
+}
+
+// WebhookEvent describes an upgrade to a webhook.
+type WebhookEvent struct {
+	Report
+	// Operation is what ran, e.g. "upgrade", "apply" or "install".
+	Operation      string    `json:"operation"`
+	Hostname       string    `json:"hostname,omitempty"`
+	ExecutablePath string    `json:"executable_path"`
+	Time           time.Time `json:"time"`
+}
+
+// WithWebhook sends hook after every upgrade that succeeded, failed or was
+// delegated to a package manager, so fleet operators can record the upgrades
+// of their agents without writing a hook. Checks that find the binary up to
+// date aren't sent. The request is sent with the upgrader's HTTP client, so
+// its host has to be allowed by WithAllowedHosts if that is set, and is sent
+// even if the upgrade's context was canceled. A failed request doesn't fail the
+// upgrade, but adds a warning to the result.
+func WithWebhook(hook Webhook) Opt {
+	return func(u *upgrader) {
+		u.webhooks = append(u.webhooks, hook)
+	}
+}
+
+// sendWebhooks sends the outcome of operation to the webhooks, unless
+// nothing was attempted because the binary is up to date.
+func (u *upgrader) sendWebhooks(ctx context.Context, operation, executablePath string, result *UpgradeResult, err error) {
+	if len(u.webhooks) == 0 || result == nil || err == nil && !result.Upgraded && result.PackageManager == "" {
+		return
+	}
+	hostname, _ := os.Hostname()
+	event := WebhookEvent{
+		Report:         *UpgradeReport(result, err),
+		Operation:      operation,
+		Hostname:       hostname,
+		ExecutablePath: executablePath,
+		Time:           time.Now(),
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, hook := range u.webhooks {
+		if herr := u.sendWebhook(ctx, hook, event); herr != nil {
+			result.Warnings = append(result.Warnings, fmt.Errorf("failed to send webhook: %w", herr))
+		}
+	}
+}
+
+func (u *upgrader) sendWebhook(ctx context.Context, hook Webhook, event WebhookEvent) error {
+	body, err := webhookBody(hook.Template, event)
+	if err != nil {
+		return err
+	}
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range hook.Header {
+		req.Header[k] = v
+	}
+	contentType := hook.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return release.CheckResponse(resp)
+}
+
+// webhookBody renders event with tmpl, or encodes it as JSON if tmpl is empty.
+func webhookBody(tmpl string, event WebhookEvent) ([]byte, error) {
+	if tmpl == "" {
+		return json.Marshal(event)
+	}
+	t, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, event); err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %w", err)
+	}
+	return b.Bytes(), nil
+}
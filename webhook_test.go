@@ -0,0 +1,70 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook(t *testing.T) {
+	ctx := context.Background()
+	var bodies []string
+	var contentTypes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+	}))
+	t.Cleanup(srv.Close)
+	header := http.Header{"Authorization": {"Bearer secret"}}
+
+	u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"},
+		WithWebhook(Webhook{URL: srv.URL, Header: header}),
+		WithWebhook(Webhook{URL: srv.URL, Header: header, ContentType: "text/plain", Template: `{{.Operation}} {{.Action}} to {{.NewVersion}}: {{json .Error}}`}),
+	)
+
+	result, err := u.UpgradeWithResult(ctx, "0.2.0")
+	require.NoError(t, err)
+	assert.False(t, result.Upgraded)
+	assert.Empty(t, bodies, "up to date")
+
+	result, err = u.UpgradeWithResult(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.Empty(t, result.Warnings)
+	require.Len(t, bodies, 2)
+	var event WebhookEvent
+	require.NoError(t, json.Unmarshal([]byte(bodies[0]), &event))
+	assert.Equal(t, "upgrade", event.Operation)
+	assert.Equal(t, ActionUpgraded, event.Action)
+	assert.Equal(t, "0.1.0", event.CurrentVersion)
+	assert.Equal(t, "v0.2.0", event.NewVersion)
+	assert.NotEmpty(t, event.ExecutablePath)
+	assert.Equal(t, "application/json", contentTypes[0])
+	assert.Equal(t, `upgrade upgraded to v0.2.0: ""`, bodies[1])
+	assert.Equal(t, "text/plain", contentTypes[1])
+
+	t.Run("Failed", func(t *testing.T) {
+		bodies = nil
+		_, err := u.UpgradeWithResult(ctx, "invalid")
+		require.Error(t, err)
+		require.Len(t, bodies, 2)
+		assert.Contains(t, bodies[1], `upgrade failed to invalid: "failed to parse current version`)
+	})
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		u, _ := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithWebhook(Webhook{URL: srv.URL, Template: "{{"}))
+		result, err := u.UpgradeWithResult(ctx, "0.1.0")
+		require.NoError(t, err)
+		assert.True(t, result.Upgraded)
+		require.Len(t, result.Warnings, 1)
+		assert.ErrorContains(t, result.Warnings[0], "invalid webhook template")
+	})
+}
@@ -0,0 +1,54 @@
+package upgrade
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// capabilityXattr stores Linux file capabilities, e.g. cap_net_bind_service.
+const capabilityXattr = "security.capability"
+
+func getXattrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if errors.Is(err, syscall.ENOTSUP) || size == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n := string(name)
+		vsize, err := syscall.Getxattr(path, n, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, vsize)
+		if vsize, err = syscall.Getxattr(path, n, value); err != nil {
+			return nil, err
+		}
+		xattrs[n] = value[:vsize]
+	}
+	return xattrs, nil
+}
+
+// setXattrs sets xattrs on path. Capabilities must be preserved, other
+// attributes (e.g. SELinux labels) are preserved where permitted.
+func setXattrs(path string, xattrs map[string][]byte) error {
+	for name, value := range xattrs {
+		if err := syscall.Setxattr(path, name, value, 0); err != nil && name == capabilityXattr {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrYankedVersion is returned when asked to install a version that was yanked, see WithYankedVersions.
+var ErrYankedVersion = errors.New("version was yanked")
+
+// WithYankedVersions reads the versions withdrawn by the maintainers from
+// url, one per line. Blank lines and lines starting with "#" are ignored.
+// Hosting the list outside of the releases lets it be updated right away.
+//
+// Yanked versions are never installed: Check doesn't offer a yanked latest
+// release, and installing one fails with ErrYankedVersion. Installs already
+// on a yanked version are offered the latest release, even if it is older,
+// e.g. after the yanked release was deleted.
+func WithYankedVersions(url string) Opt {
+	return func(u *upgrader) {
+		u.yankedURL = url
+	}
+}
+
+// checkYanked updates the availability of update according to the yanked versions.
+func (u *upgrader) checkYanked(ctx context.Context, update *Update, curr, latest Version) error {
+	if u.yankedURL == "" {
+		return nil
+	}
+	yanked, err := u.yankedVersions(ctx)
+	if err != nil {
+		return err
+	}
+	update.CurrentYanked = u.isYanked(yanked, curr)
+	update.LatestYanked = u.isYanked(yanked, latest)
+	if update.LatestYanked {
+		update.Available = false
+	} else if update.CurrentYanked && u.versionScheme.Compare(latest, curr) != 0 {
+		update.Available = true
+	}
+	return nil
+}
+
+// refuseYanked returns an error wrapping ErrYankedVersion if tag was yanked.
+func (u *upgrader) refuseYanked(ctx context.Context, tag string) error {
+	if u.yankedURL == "" || tag == "" {
+		return nil
+	}
+	v, err := u.parseVersion(u.tagVersion(tag))
+	if err != nil {
+		return fmt.Errorf("failed to parse version: %s with err %w", tag, err)
+	}
+	yanked, err := u.yankedVersions(ctx)
+	if err != nil {
+		return err
+	}
+	if u.isYanked(yanked, v) {
+		return fmt.Errorf("%w: %s", ErrYankedVersion, tag)
+	}
+	return nil
+}
+
+// yankedVersions downloads the list of yanked versions.
+func (u *upgrader) yankedVersions(ctx context.Context) ([]Version, error) {
+	lines, err := u.fetchPolicyLines(ctx, u.yankedURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get yanked versions: %w", err)
+	}
+	yanked := make([]Version, 0, len(lines))
+	for _, line := range lines {
+		v, err := u.parseVersion(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse yanked version: %s with err %w", line, err)
+		}
+		yanked = append(yanked, v)
+	}
+	return yanked, nil
+}
+
+func (u *upgrader) isYanked(yanked []Version, v Version) bool {
+	for _, y := range yanked {
+		if u.versionScheme.Compare(y, v) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package upgrade
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYankedVersions(t *testing.T) {
+	ctx := context.Background()
+	yanked := "# broken config migration\nv0.2.0\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(yanked))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, executablePath := newTestUpgrader(t, "v0.2.0", map[string]string{"savvy": "new"}, WithYankedVersions(srv.URL))
+
+	update, err := u.Check(ctx, "0.1.0")
+	require.NoError(t, err)
+	assert.True(t, update.LatestYanked)
+	assert.False(t, update.Available)
+
+	_, err = u.Install(ctx, "v0.2.0", filepath.Join(t.TempDir(), "savvy"))
+	assert.ErrorIs(t, err, ErrYankedVersion)
+	assert.Equal(t, "old", readFile(t, executablePath))
+
+	// installs on a yanked version are offered the latest release, even an older one
+	yanked = "0.3.0\n"
+	update, err = u.Check(ctx, "0.3.0")
+	require.NoError(t, err)
+	assert.True(t, update.CurrentYanked)
+	assert.True(t, update.Available)
+
+	result, err := u.UpgradeWithResult(ctx, "0.3.0")
+	require.NoError(t, err)
+	assert.True(t, result.Upgraded)
+	assert.Equal(t, "new", readFile(t, executablePath))
+}